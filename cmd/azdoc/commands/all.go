@@ -2,7 +2,10 @@ package commands
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/automationpi/azdocs/pkg/rules"
+	"github.com/automationpi/azdocs/pkg/waiver"
 	"github.com/spf13/cobra"
 )
 
@@ -46,12 +49,19 @@ func init() {
 
 	// Scan flags
 	allCmd.Flags().String("subscription-id", "", "Azure subscription ID to scan")
+	allCmd.Flags().StringSlice("subscriptions", nil, "comma-separated subscription IDs to scan into one dataset")
+	allCmd.Flags().String("management-group", "", "scan every subscription under this management group")
+	allCmd.Flags().Bool("all-subscriptions", false, "scan all enabled subscriptions the credential can access")
 	allCmd.Flags().String("tenant-id", "", "Azure tenant ID (optional)")
 	allCmd.Flags().Int("concurrency", 8, "number of concurrent API requests")
-	allCmd.Flags().Duration("timeout", 5*60*1000000000, "overall operation timeout (default 5m)")
+	allCmd.Flags().Duration("timeout", 5*time.Minute, "overall operation timeout")
 	allCmd.Flags().String("cache-dir", ".azdoc", "cache directory path")
+	allCmd.Flags().Duration("cache-ttl", 0, "reuse cached query results younger than this (0 = always query)")
 	allCmd.Flags().String("json-out", "./data", "output directory for JSON files")
 	allCmd.Flags().Bool("no-progress", false, "suppress progress indicators")
+	allCmd.Flags().Int("page-size", 1000, "Resource Graph rows per page (max 1000)")
+	allCmd.Flags().Int("max-results", 0, "maximum rows per query (0 = unlimited)")
+	allCmd.Flags().Bool("include-effective-routes", false, "fetch and render effective routes for VM NICs (slow)")
 
 	// Build flags
 	allCmd.Flags().String("in", "./data", "input directory with cached JSON data")
@@ -61,10 +71,12 @@ func init() {
 	allCmd.Flags().String("theme", "default", "diagram theme")
 	allCmd.Flags().Bool("enable-ai", false, "enable AI-powered diagram optimization (requires OpenAI API key)")
 	allCmd.Flags().String("openai-key", "", "OpenAI API key (or set OPENAI_API_KEY env var)")
+	allCmd.Flags().String("waivers", waiver.DefaultFile, "waiver file with accepted findings")
+	allCmd.Flags().String("rules-dir", rules.DefaultDir, "directory with custom YAML rules")
 
 	// Explain flags
 	allCmd.Flags().String("doc", "./docs/SUBSCRIPTION.md", "documentation file to enhance")
 	allCmd.Flags().String("model", "gpt-4o-mini", "OpenAI model to use")
-	allCmd.Flags().Int("max-tokens", 2000, "maximum tokens for LLM response")
+	allCmd.Flags().Int("max-tokens", 0, "maximum tokens for LLM response (0 = per-request default)")
 	allCmd.Flags().Bool("dry-run", false, "preview explanations without modifying files")
 }
@@ -2,9 +2,12 @@ package commands
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"github.com/automationpi/azdocs/pkg/graph"
 	"github.com/automationpi/azdocs/pkg/renderer"
+	"github.com/automationpi/azdocs/pkg/rules"
+	"github.com/automationpi/azdocs/pkg/waiver"
 	"github.com/spf13/cobra"
 )
 
@@ -14,13 +17,13 @@ var buildCmd = &cobra.Command{
 	Long: `Generate Markdown documentation and network diagrams from previously
 scanned Azure resource data. Does not require network access.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Parse flags
-		inDir := cmd.Flag("in").Value.String()
-		outDir := cmd.Flag("out").Value.String()
-		withDiagrams, _ := cmd.Flags().GetBool("with-diagrams")
-		mdName := cmd.Flag("md-name").Value.String()
-		theme := cmd.Flag("theme").Value.String()
-		enableAI, _ := cmd.Flags().GetBool("enable-ai")
+		// Parse flags; shared settings come from the merged config
+		inDir := cfg.Output.DataDir
+		outDir := cfg.Output.DocsDir
+		withDiagrams := cfg.Rendering.WithDiagrams
+		mdName := cfg.Rendering.MDName
+		theme := cfg.Rendering.Theme
+		enableAI := cfg.LLM.Enabled
 		openaiKey := cmd.Flag("openai-key").Value.String()
 
 		fmt.Printf("Building documentation from %s...\n", inDir)
@@ -31,6 +34,24 @@ scanned Azure resource data. Does not require network access.`,
 			return fmt.Errorf("failed to load data: %w", err)
 		}
 
+		waivers, err := waiver.Load(cfg.WaiversFile)
+		if err != nil {
+			return err
+		}
+
+		customRules, err := rules.Load(cfg.RulesDir)
+		if err != nil {
+			return err
+		}
+
+		if cfg.Pricing.CostExport != "" {
+			fmt.Printf("Loading actual cost from %s...\n", cfg.Pricing.CostExport)
+		}
+		options, err := analysisOptions()
+		if err != nil {
+			return err
+		}
+
 		// Build graph
 		fmt.Println("Building topology graph...")
 		graphBuilder := graph.NewBuilder(data)
@@ -40,7 +61,7 @@ scanned Azure resource data. Does not require network access.`,
 		}
 
 		// Save graph
-		if err := topology.SaveToFile(inDir + "/graph.json"); err != nil {
+		if err := topology.SaveToFile(filepath.Join(inDir, "graph.json")); err != nil {
 			return fmt.Errorf("failed to save graph: %w", err)
 		}
 
@@ -53,6 +74,18 @@ scanned Azure resource data. Does not require network access.`,
 			Theme:        theme,
 			EnableAI:     enableAI,
 			OpenAIKey:    openaiKey,
+
+			DataDir:                inDir,
+			DiagramsDir:            cfg.Output.DiagramsDir,
+			Model:                  cfg.LLM.Model,
+			MaxTokens:              cfg.LLM.MaxTokens,
+			Temperature:            cfg.LLM.Temperature,
+			IncludeEffectiveRoutes: cfg.Rendering.IncludeEffectiveRoutes,
+			MaxRoutesPerNIC:        cfg.Rendering.MaxRoutesPerNIC,
+			Redact:                 cfg.RedactionPatterns(),
+			Waivers:                waivers,
+			Rules:                  customRules,
+			Analysis:               options,
 		})
 
 		if err := mdRenderer.Render(topology); err != nil {
@@ -66,10 +99,16 @@ scanned Azure resource data. Does not require network access.`,
 				fmt.Println("🤖 AI-enhanced diagram generation enabled")
 			}
 			diagramRenderer := renderer.NewDiagramRenderer(renderer.DiagramConfig{
-				OutputDir: outDir + "/diagrams",
+				OutputDir: cfg.Output.DiagramsDir,
 				Theme:     theme,
 				EnableAI:  enableAI,
 				OpenAIKey: openaiKey,
+
+				DataDir:     inDir,
+				Model:       cfg.LLM.Model,
+				MaxTokens:   cfg.LLM.MaxTokens,
+				Temperature: cfg.LLM.Temperature,
+				Redact:      cfg.RedactionPatterns(),
 			})
 
 			if err := diagramRenderer.RenderAll(topology); err != nil {
@@ -78,9 +117,9 @@ scanned Azure resource data. Does not require network access.`,
 		}
 
 		fmt.Printf("\nBuild complete!\n")
-		fmt.Printf("  Documentation: %s/%s\n", outDir, mdName)
+		fmt.Printf("  Documentation: %s\n", filepath.Join(outDir, mdName))
 		if withDiagrams {
-			fmt.Printf("  Diagrams: %s/diagrams/\n", outDir)
+			fmt.Printf("  Diagrams: %s/\n", cfg.Output.DiagramsDir)
 		}
 
 		return nil
@@ -97,4 +136,9 @@ func init() {
 	buildCmd.Flags().String("theme", "default", "diagram theme")
 	buildCmd.Flags().Bool("enable-ai", false, "enable AI-powered diagram optimization (requires OpenAI API key)")
 	buildCmd.Flags().String("openai-key", "", "OpenAI API key (or set OPENAI_API_KEY env var)")
+	buildCmd.Flags().Bool("include-effective-routes", false, "render effective routes captured by scan")
+	buildCmd.Flags().String("waivers", waiver.DefaultFile, "waiver file with accepted findings")
+	buildCmd.Flags().String("rules-dir", rules.DefaultDir, "directory with custom YAML rules")
+	buildCmd.Flags().String("cost-export", "", "Cost Management actual cost export (CSV) to report actual spend")
+	buildCmd.Flags().String("metrics", "", "Azure Monitor metric export (file or directory) for VM right-sizing")
 }
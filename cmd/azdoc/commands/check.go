@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+	"github.com/automationpi/azdocs/pkg/graph"
+	"github.com/automationpi/azdocs/pkg/rules"
+	"github.com/automationpi/azdocs/pkg/waiver"
+	"github.com/spf13/cobra"
+)
+
+// exitCheckFailed is the exit code when a gate fails; errors exit with 1
+const exitCheckFailed = 2
+
+// maxBlockingShown limits the blocking findings printed in the summary
+const maxBlockingShown = 10
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Gate CI on analysis findings and scores",
+	Long: `Run the security, cost, tagging and compliance analyses over cached data
+and fail when findings at or above a severity exist, or when a score is below
+its configured minimum.
+
+Exit codes: 0 when all gates pass, 2 when a gate fails, 1 on errors.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inDir := cfg.Output.DataDir
+		failOn := cfg.Check.FailOn
+		resultsPath := cfg.Check.Results
+
+		data, err := graph.LoadNormalizedData(inDir)
+		if err != nil {
+			return fmt.Errorf("failed to load data: %w", err)
+		}
+
+		waivers, err := waiver.Load(cfg.WaiversFile)
+		if err != nil {
+			return err
+		}
+
+		customRules, err := rules.Load(cfg.RulesDir)
+		if err != nil {
+			return err
+		}
+
+		options, err := analysisOptions()
+		if err != nil {
+			return err
+		}
+
+		report := analysis.Analyze(data.Resources, options)
+		report.AnalyzeResourceGroups(data.ResourceGroups, data.Resources)
+		rules.Apply(report, customRules, data.Resources)
+		waived := waiver.Apply(report, waivers, time.Now())
+		result := report.Evaluate(failOn, cfg.Check.MinScores)
+
+		if !cfg.Quiet {
+			printCheckSummary(result, waived)
+		}
+
+		if resultsPath != "" {
+			out, err := json.MarshalIndent(checkResults{GateResult: result, Waivers: waived}, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal results: %w", err)
+			}
+			if err := os.WriteFile(resultsPath, out, 0644); err != nil {
+				return fmt.Errorf("failed to write results: %w", err)
+			}
+		}
+
+		if !result.Passed {
+			return &ExitError{
+				Code:    exitCheckFailed,
+				Message: "Check failed: " + strings.Join(result.Failures, "; "),
+			}
+		}
+
+		if !cfg.Quiet {
+			fmt.Println("✅ Check passed")
+		}
+		return nil
+	},
+}
+
+// checkResults is the machine-readable output of `azdoc check`
+type checkResults struct {
+	*analysis.GateResult
+	Waivers *waiver.Result `json:"waivers"`
+}
+
+// printCheckSummary prints scores, severity counts and blocking findings
+func printCheckSummary(result *analysis.GateResult, waived *waiver.Result) {
+	fmt.Println("Scores:")
+	for _, name := range analysis.Analyses {
+		line := fmt.Sprintf("  %-11s %3d/100", name, result.Scores[name])
+		for key, min := range result.MinScores {
+			if strings.EqualFold(key, name) {
+				status := "✅"
+				if result.Scores[name] < min {
+					status = "❌"
+				}
+				line += fmt.Sprintf("  (min %d) %s", min, status)
+			}
+		}
+		fmt.Println(line)
+	}
+
+	fmt.Printf("Findings: %d critical, %d high, %d medium, %d low\n",
+		result.Counts["Critical"], result.Counts["High"], result.Counts["Medium"], result.Counts["Low"])
+	if result.Hygiene > 0 {
+		fmt.Printf("Network hygiene: %d findings (not gated)\n", result.Hygiene)
+	}
+	if len(waived.Waived) > 0 {
+		fmt.Printf("Waived: %d findings\n", len(waived.Waived))
+	}
+	for _, expired := range waived.Expired {
+		fmt.Printf("⚠️  Waiver expired on %s (owner %s); its findings are reported again\n", expired.Expires, expired.Owner)
+	}
+
+	if len(result.Blocking) == 0 {
+		return
+	}
+
+	fmt.Printf("Blocking findings (%s and above):\n", result.FailOn)
+	for i, finding := range result.Blocking {
+		if i == maxBlockingShown {
+			fmt.Printf("  ... and %d more\n", len(result.Blocking)-maxBlockingShown)
+			break
+		}
+		fmt.Printf("  [%s] %s/%s %s: %s\n",
+			finding.Severity, finding.Analysis, finding.Category, summarizeResources(finding.Resources), finding.Issue)
+	}
+}
+
+// summarizeResources joins the first few resource names
+func summarizeResources(resources []string) string {
+	const shown = 3
+	if len(resources) <= shown {
+		return strings.Join(resources, ", ")
+	}
+	return fmt.Sprintf("%s (+%d more)", strings.Join(resources[:shown], ", "), len(resources)-shown)
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+
+	checkCmd.Flags().String("in", "./data", "input directory with cached JSON")
+	checkCmd.Flags().String("fail-on", "high", "fail on findings at or above this severity (critical|high|medium|low|none)")
+	checkCmd.Flags().StringToInt("min-score", nil, "minimum scores, e.g. security=70,compliance=50")
+	checkCmd.Flags().String("results", "", "write machine-readable results to this JSON file")
+	checkCmd.Flags().String("waivers", waiver.DefaultFile, "waiver file with accepted findings")
+	checkCmd.Flags().String("rules-dir", rules.DefaultDir, "directory with custom YAML rules")
+	checkCmd.Flags().String("metrics", "", "Azure Monitor metric export (file or directory) for VM right-sizing")
+	checkCmd.Flags().String("cost-export", "", "Cost Management actual cost export (CSV) to score savings from actual spend")
+}
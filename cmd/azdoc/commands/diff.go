@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/automationpi/azdocs/pkg/renderer"
+	"github.com/automationpi/azdocs/pkg/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [snapA] [snapB]",
+	Short: "Compare two scan snapshots",
+	Long: `Report added, removed and modified resources between two snapshots, with
+property-level changes (NSG rules, routes, address spaces, tags, ...) and
+analysis score deltas.
+
+Every scan saves a timestamped snapshot under <cache-dir>/snapshots. A snapshot
+can be referenced by ID (or a unique ID prefix), "latest", "previous", or a
+path to a scan output directory. With no arguments "previous" is compared
+against "latest"; with one argument it is compared against "latest". Use
+--list to show saved snapshots.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cacheDir := cfg.Cache.Dir
+		format := cmd.Flag("format").Value.String()
+		output := cmd.Flag("output").Value.String()
+		jsonFile := cmd.Flag("json").Value.String()
+		list, _ := cmd.Flags().GetBool("list")
+
+		if format != "markdown" && format != "json" {
+			return fmt.Errorf("--format must be markdown or json")
+		}
+
+		if list {
+			snapshots, err := snapshot.List(cacheDir)
+			if err != nil {
+				return err
+			}
+			if len(snapshots) == 0 {
+				fmt.Printf("No snapshots found in %s\n", snapshot.Dir(cacheDir))
+				return nil
+			}
+			for _, snap := range snapshots {
+				fmt.Printf("%s  %s\n", snap.ID, snap.Timestamp.Local().Format("2006-01-02 15:04:05"))
+			}
+			return nil
+		}
+
+		fromRef, toRef := "previous", "latest"
+		switch len(args) {
+		case 1:
+			fromRef = args[0]
+		case 2:
+			fromRef, toRef = args[0], args[1]
+		}
+
+		from, err := snapshot.Load(cacheDir, fromRef)
+		if err != nil {
+			return err
+		}
+		to, err := snapshot.Load(cacheDir, toRef)
+		if err != nil {
+			return err
+		}
+
+		options, err := analysisOptions()
+		if err != nil {
+			return err
+		}
+		// A cost export covers one billing period, not both snapshots
+		options.CostExport = nil
+
+		diff := snapshot.Compare(from, to, options)
+
+		if jsonFile != "" {
+			if err := diff.SaveJSON(jsonFile); err != nil {
+				return fmt.Errorf("failed to write JSON diff: %w", err)
+			}
+		}
+
+		var content []byte
+		if format == "json" {
+			content, err = json.MarshalIndent(diff, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal diff: %w", err)
+			}
+		} else {
+			content = []byte(renderer.RenderDiffMarkdown(diff))
+		}
+
+		if output == "" {
+			fmt.Print(string(content))
+			return nil
+		}
+		if err := os.WriteFile(output, content, 0644); err != nil {
+			return fmt.Errorf("failed to write diff: %w", err)
+		}
+		fmt.Printf("Diff written to %s (%d added, %d removed, %d modified)\n",
+			output, len(diff.Added), len(diff.Removed), len(diff.Modified))
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().String("cache-dir", ".azdoc", "cache directory holding snapshots")
+	diffCmd.Flags().String("format", "markdown", "output format (markdown|json)")
+	diffCmd.Flags().StringP("output", "o", "", "write the report to a file instead of stdout")
+	diffCmd.Flags().String("json", "", "also write the diff as JSON to this file")
+	diffCmd.Flags().Bool("list", false, "list saved snapshots")
+}
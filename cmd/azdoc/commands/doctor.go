@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/automationpi/azdocs/pkg/auth"
+	"github.com/automationpi/azdocs/pkg/config"
 	"github.com/spf13/cobra"
 )
 
@@ -13,10 +14,22 @@ var doctorCmd = &cobra.Command{
 	Short: "Verify Azure authentication and permissions",
 	Long: `Check that Azure authentication is configured correctly and that
 the necessary permissions are available for scanning subscriptions.`,
+	Annotations: map[string]string{skipConfig: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Println("Running azdoc diagnostics...")
 		fmt.Println()
 
+		// Check configuration; an invalid file is reported, not fatal, so the
+		// remaining checks still run
+		fmt.Print("✓ Checking configuration... ")
+		_, cfgErr := config.Load(cfgFile, cmd.Flags())
+		if cfgErr != nil {
+			fmt.Println("FAILED")
+			fmt.Printf("  %v\n", cfgErr)
+		} else {
+			fmt.Println("OK")
+		}
+
 		// Check Azure authentication
 		fmt.Print("✓ Checking Azure authentication... ")
 		authClient, err := auth.NewAzureAuthenticator()
@@ -57,6 +70,9 @@ the necessary permissions are available for scanning subscriptions.`,
 		}
 
 		fmt.Println()
+		if cfgErr != nil {
+			return fmt.Errorf("invalid configuration: %w", cfgErr)
+		}
 		fmt.Println("All checks passed! Ready to run azdoc.")
 		return nil
 	},
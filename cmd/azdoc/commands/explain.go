@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/automationpi/azdocs/pkg/llm"
 	"github.com/spf13/cobra"
@@ -14,11 +15,14 @@ var explainCmd = &cobra.Command{
 	Long: `Use LLM to add narrative sections, risk analysis, and insights
 to existing documentation. Requires OpenAI API key.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Parse flags
-		inDir := cmd.Flag("in").Value.String()
+		// Parse flags; shared settings come from the merged config
+		inDir := cfg.Output.DataDir
 		docPath := cmd.Flag("doc").Value.String()
-		model := cmd.Flag("model").Value.String()
-		maxTokens, _ := cmd.Flags().GetInt("max-tokens")
+		if !cmd.Flags().Changed("doc") {
+			docPath = filepath.Join(cfg.Output.DocsDir, cfg.Rendering.MDName)
+		}
+		model := cfg.LLM.Model
+		maxTokens := cfg.LLM.MaxTokens
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
 
 		// Check API key
@@ -31,13 +35,14 @@ to existing documentation. Requires OpenAI API key.`,
 
 		// Initialize LLM client
 		llmClient := llm.NewClient(llm.Config{
-			Enabled: true,
-			APIKey:  apiKey,
-			Model:   model,
+			Enabled:     true,
+			APIKey:      apiKey,
+			Model:       model,
+			MaxTokens:   maxTokens,
+			Temperature: cfg.LLM.Temperature,
 		})
 
-		// Note: maxTokens and dryRun parameters are currently not used
-		_ = maxTokens
+		// Note: dryRun is currently not used
 		_ = dryRun
 
 		// Load normalized data
@@ -86,7 +91,7 @@ func init() {
 	explainCmd.Flags().String("in", "./data", "input directory with cached JSON data")
 	explainCmd.Flags().String("doc", "./docs/SUBSCRIPTION.md", "documentation file to enhance")
 	explainCmd.Flags().String("model", "gpt-4o-mini", "OpenAI model to use")
-	explainCmd.Flags().Int("max-tokens", 2000, "maximum tokens for LLM response")
+	explainCmd.Flags().Int("max-tokens", 0, "maximum tokens for LLM response (0 = per-request default)")
 	explainCmd.Flags().Bool("dry-run", false, "preview explanations without modifying files")
 }
 
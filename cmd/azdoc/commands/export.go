@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+	"github.com/automationpi/azdocs/pkg/export"
+	"github.com/automationpi/azdocs/pkg/graph"
+	"github.com/automationpi/azdocs/pkg/rules"
+	"github.com/automationpi/azdocs/pkg/waiver"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export analysis findings as SARIF, JUnit or JSON",
+	Long: `Run the security, cost, tagging and compliance analyses over cached data and
+export the findings with stable rule IDs for code-scanning dashboards (SARIF)
+and CI test reports (JUnit).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inDir := cfg.Output.DataDir
+		format := cmd.Flag("format").Value.String()
+		output := cmd.Flag("output").Value.String()
+
+		switch format {
+		case export.FormatSARIF, export.FormatJUnit, export.FormatJSON:
+		default:
+			return fmt.Errorf("--format must be sarif, junit or json")
+		}
+
+		data, err := graph.LoadNormalizedData(inDir)
+		if err != nil {
+			return fmt.Errorf("failed to load data: %w", err)
+		}
+
+		waivers, err := waiver.Load(cfg.WaiversFile)
+		if err != nil {
+			return err
+		}
+
+		customRules, err := rules.Load(cfg.RulesDir)
+		if err != nil {
+			return err
+		}
+
+		options, err := analysisOptions()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		report := analysis.Analyze(data.Resources, options)
+		report.AnalyzeResourceGroups(data.ResourceGroups, data.Resources)
+		rules.Apply(report, customRules, data.Resources)
+		waived := waiver.Apply(report, waivers, now)
+		opts := export.Options{
+			ToolVersion: version,
+			SourceFile:  filepath.ToSlash(filepath.Join(inDir, "raw", "all-resources.json")),
+			Generated:   now,
+			Waived:      waived.Waived,
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "" {
+			file, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", output, err)
+			}
+			defer file.Close()
+			w = file
+		}
+
+		if err := export.Write(w, format, report, opts); err != nil {
+			return fmt.Errorf("failed to export findings: %w", err)
+		}
+
+		if output != "" && !cfg.Quiet {
+			fmt.Printf("Exported %d findings to %s\n", len(report.Findings()), output)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().String("in", "./data", "input directory with cached JSON")
+	exportCmd.Flags().String("format", "sarif", "export format (sarif|junit|json)")
+	exportCmd.Flags().StringP("output", "o", "", "output file (default: stdout)")
+	exportCmd.Flags().String("waivers", waiver.DefaultFile, "waiver file with accepted findings")
+	exportCmd.Flags().String("metrics", "", "Azure Monitor metric export (file or directory) for VM right-sizing")
+	exportCmd.Flags().String("cost-export", "", "Cost Management actual cost export (CSV) to report actual spend")
+	exportCmd.Flags().String("rules-dir", rules.DefaultDir, "directory with custom YAML rules")
+}
@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/graph"
+	"github.com/automationpi/azdocs/pkg/ipam"
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/normalize"
+	"github.com/automationpi/azdocs/pkg/renderer"
+	"github.com/spf13/cobra"
+)
+
+var ipamCmd = &cobra.Command{
+	Use:   "ipam",
+	Short: "Plan IP address space in scanned VNets",
+	Long: `Find free address blocks for new subnets and report how each VNet's
+address space is used. Ranges listed in ipam.reserved-ranges in azdoc.yaml
+are never suggested.`,
+}
+
+var ipamNextCmd = &cobra.Command{
+	Use:   "next",
+	Short: "Print the next free subnet block of a size in a VNet",
+	Long: `Print the first free CIDR block of the requested size inside the VNet's
+address space, aligned to its size and avoiding existing subnets and
+reserved ranges. --vnet accepts a VNet name, resource ID or a unique part
+of a name.`,
+	Example: `  azdoc ipam next --vnet hub --size /26
+  azdoc ipam next --vnet vnet-spoke1 --size /64 --ipv6`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vnetName, _ := cmd.Flags().GetString("vnet")
+		size, _ := cmd.Flags().GetString("size")
+		ipv6, _ := cmd.Flags().GetBool("ipv6")
+
+		bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(size), "/"))
+		if err != nil {
+			return fmt.Errorf("invalid --size %q (use a prefix length such as /26)", size)
+		}
+
+		planner, err := loadPlanner()
+		if err != nil {
+			return err
+		}
+		vnet, err := planner.FindVNet(vnetName)
+		if err != nil {
+			return err
+		}
+
+		prefix, err := planner.Next(vnet, bits, ipv6)
+		if err != nil {
+			return &ExitError{Code: exitCheckFailed, Message: err.Error()}
+		}
+		fmt.Println(prefix)
+		return nil
+	},
+}
+
+var ipamReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report used, reserved and free address blocks per VNet",
+	Long: `Render a Markdown report with a free/used map of every VNet address
+space, its subnets with their utilization, reserved ranges and free blocks,
+and overlapping address spaces.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vnetName, _ := cmd.Flags().GetString("vnet")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		if format != "markdown" && format != "json" {
+			return fmt.Errorf("--format must be markdown or json")
+		}
+
+		data, err := graph.LoadNormalizedData(cfg.Output.DataDir)
+		if err != nil {
+			return fmt.Errorf("failed to load data: %w", err)
+		}
+		inv := normalize.Normalize(data.Resources)
+		planner, err := ipam.NewPlanner(inv, cfg.IPAM.ReservedRanges)
+		if err != nil {
+			return err
+		}
+
+		vnets := inv.VNets
+		if vnetName != "" {
+			vnet, err := planner.FindVNet(vnetName)
+			if err != nil {
+				return err
+			}
+			vnets = []models.VNet{*vnet}
+		}
+
+		var maps []ipam.VNetMap
+		for i := range vnets {
+			maps = append(maps, planner.Map(&vnets[i]))
+		}
+		usage := ipam.Analyze(inv, cfg.IPAM.UtilizationThreshold)
+		if vnetName != "" {
+			usage.Overlaps = overlapsOf(usage.Overlaps, maps[0].VNetID)
+		}
+
+		var content []byte
+		if format == "json" {
+			content, err = json.MarshalIndent(struct {
+				VNets    []ipam.VNetMap     `json:"vnets"`
+				Subnets  []ipam.SubnetUsage `json:"subnets"`
+				Overlaps []ipam.Overlap     `json:"overlaps"`
+			}{maps, usage.Subnets, usage.Overlaps}, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal report: %w", err)
+			}
+		} else {
+			content = []byte(renderer.RenderIPAMMarkdown(maps, usage))
+		}
+
+		if output == "" {
+			fmt.Print(string(content))
+			return nil
+		}
+		if err := os.WriteFile(output, content, 0644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		fmt.Printf("IP address report written to %s (%d VNets)\n", output, len(maps))
+		return nil
+	},
+}
+
+// overlapsOf returns the overlaps involving a VNet
+func overlapsOf(overlaps []ipam.Overlap, vnetID string) []ipam.Overlap {
+	var filtered []ipam.Overlap
+	for _, o := range overlaps {
+		if strings.EqualFold(o.VNetAID, vnetID) || strings.EqualFold(o.VNetBID, vnetID) {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered
+}
+
+// loadPlanner indexes the cached data for address planning
+func loadPlanner() (*ipam.Planner, error) {
+	data, err := graph.LoadNormalizedData(cfg.Output.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data: %w", err)
+	}
+	return ipam.NewPlanner(normalize.Normalize(data.Resources), cfg.IPAM.ReservedRanges)
+}
+
+func init() {
+	rootCmd.AddCommand(ipamCmd)
+	ipamCmd.AddCommand(ipamNextCmd)
+	ipamCmd.AddCommand(ipamReportCmd)
+
+	ipamNextCmd.Flags().String("vnet", "", "VNet name or resource ID (required)")
+	ipamNextCmd.Flags().String("size", "", "prefix length of the new subnet, e.g. /26 (required)")
+	ipamNextCmd.Flags().Bool("ipv6", false, "allocate from the VNet's IPv6 address space")
+	ipamNextCmd.Flags().String("in", "./data", "input directory with cached JSON")
+	_ = ipamNextCmd.MarkFlagRequired("vnet")
+	_ = ipamNextCmd.MarkFlagRequired("size")
+
+	ipamReportCmd.Flags().String("vnet", "", "report a single VNet")
+	ipamReportCmd.Flags().String("format", "markdown", "output format (markdown|json)")
+	ipamReportCmd.Flags().StringP("output", "o", "", "write the report to a file instead of stdout")
+	ipamReportCmd.Flags().String("in", "./data", "input directory with cached JSON")
+}
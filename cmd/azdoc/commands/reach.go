@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/automationpi/azdocs/pkg/graph"
+	"github.com/automationpi/azdocs/pkg/normalize"
+	"github.com/automationpi/azdocs/pkg/reach"
+	"github.com/spf13/cobra"
+)
+
+var reachCmd = &cobra.Command{
+	Use:   "reach",
+	Short: "Check whether one endpoint can reach another on a port",
+	Long: `Walk the path between two endpoints in cached data: source NSGs, the
+effective routes of each subnet (UDRs and system routes), VNet peerings,
+firewalls and NVAs, gateways and destination NSGs. Each hop prints the rule
+or route that allowed or blocked the traffic.
+
+Endpoints are VM, NIC, private endpoint, private link resource, firewall or
+public IP names, resource IDs, or IP addresses. IPs outside the scanned VNets
+are on-premises when private and Internet hosts otherwise.
+
+Exit codes: 0 when the destination is reachable, 2 when it is not or the
+result cannot be determined from the scanned data, 1 on errors.`,
+	Example: `  azdoc reach --from vm-web1 --to pe-sql --port 1433
+  azdoc reach --from vm-web1 --to 192.168.10.5 --port 443
+  azdoc reach --from 203.0.113.7 --to pip-vm-web1 --port 22`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		port, _ := cmd.Flags().GetInt("port")
+		protocol, _ := cmd.Flags().GetString("proto")
+		format, _ := cmd.Flags().GetString("format")
+
+		if format != "text" && format != "json" {
+			return fmt.Errorf("unsupported format %q (use text or json)", format)
+		}
+
+		data, err := graph.LoadNormalizedData(cfg.Output.DataDir)
+		if err != nil {
+			return fmt.Errorf("failed to load data: %w", err)
+		}
+
+		result, err := reach.Evaluate(normalize.Normalize(data.Resources), reach.Query{
+			From:     from,
+			To:       to,
+			Protocol: protocol,
+			Port:     port,
+		})
+		if err != nil {
+			return err
+		}
+
+		if format == "json" {
+			out, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal result: %w", err)
+			}
+			fmt.Println(string(out))
+		} else {
+			printReachResult(result)
+		}
+
+		if result.Verdict != reach.Reachable {
+			return &ExitError{Code: exitCheckFailed}
+		}
+		return nil
+	},
+}
+
+// printReachResult prints the hop-by-hop verdict of a reachability query
+func printReachResult(result *reach.Result) {
+	fmt.Printf("%s → %s on %s\n\n", result.Source, result.Destination, result.Flow())
+
+	for i, hop := range result.Hops {
+		fmt.Printf("%2d. %s %-16s %s\n", i+1, reachIcon(hop.Verdict), hop.Step, hop.Resource)
+		fmt.Printf("       %s\n", hop.Detail)
+	}
+	if len(result.Hops) > 0 {
+		fmt.Println()
+	}
+
+	fmt.Printf("%s %s: %s\n", reachIcon(result.Verdict), result.Verdict, result.Reason)
+}
+
+func reachIcon(verdict string) string {
+	switch verdict {
+	case reach.Pass, reach.Reachable:
+		return "✅"
+	case reach.Block, reach.Unreachable:
+		return "❌"
+	}
+	return "❔"
+}
+
+func init() {
+	rootCmd.AddCommand(reachCmd)
+
+	reachCmd.Flags().String("from", "", "source resource name, resource ID or IP address (required)")
+	reachCmd.Flags().String("to", "", "destination resource name, resource ID or IP address (required)")
+	reachCmd.Flags().Int("port", 0, "destination port (required for tcp and udp)")
+	reachCmd.Flags().String("proto", "tcp", "protocol: tcp, udp or icmp")
+	reachCmd.Flags().String("format", "text", "output format: text or json")
+	reachCmd.Flags().String("in", "./data", "input directory with cached JSON")
+	_ = reachCmd.MarkFlagRequired("from")
+	_ = reachCmd.MarkFlagRequired("to")
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+	"github.com/automationpi/azdocs/pkg/graph"
+	"github.com/automationpi/azdocs/pkg/renderer"
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Generate standalone reports from scanned data",
+}
+
+var reportChargebackCmd = &cobra.Command{
+	Use:   "chargeback",
+	Short: "Allocate monthly cost to tag values for chargeback or showback",
+	Long: `Aggregate the monthly cost of scanned resources by the values of one or
+more tags. Costs are actual spend from a Cost Management export when
+pricing.cost-export (--cost-export) is set, and pay-as-you-go estimates
+otherwise. Resources without a tag inherit it from their resource group;
+cost that still has no value is reported as (untagged) and counted as
+unallocated.`,
+	Example: `  azdoc report chargeback --by cost-center,application
+  azdoc report chargeback --by cost-center --cost-export ./cost.csv --format csv -o chargeback.csv`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		by, _ := cmd.Flags().GetString("by")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		if format != "markdown" && format != "csv" {
+			return fmt.Errorf("--format must be markdown or csv")
+		}
+		var keys []string
+		for _, key := range strings.Split(by, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("--by must name at least one tag")
+		}
+
+		data, err := graph.LoadNormalizedData(cfg.Output.DataDir)
+		if err != nil {
+			return fmt.Errorf("failed to load data: %w", err)
+		}
+
+		prices, err := loadPrices()
+		if err != nil {
+			return err
+		}
+
+		costExport, err := loadCostExport()
+		if err != nil {
+			return err
+		}
+
+		cb := analysis.AllocateCost(keys, data.Resources, data.ResourceGroups, costExport, prices)
+
+		var content []byte
+		if format == "csv" {
+			content, err = renderer.RenderChargebackCSV(cb)
+			if err != nil {
+				return fmt.Errorf("failed to render report: %w", err)
+			}
+		} else {
+			content = []byte(renderer.RenderChargebackMarkdown(cb))
+		}
+
+		if output == "" {
+			fmt.Print(string(content))
+			return nil
+		}
+		if err := os.WriteFile(output, content, 0644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		fmt.Printf("Chargeback report written to %s ($%.2f/month, %.1f%% unallocated)\n", output, cb.Total, cb.Share(cb.Unallocated))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportChargebackCmd)
+
+	reportChargebackCmd.Flags().String("by", "cost-center,application", "comma-separated tag keys to allocate cost by")
+	reportChargebackCmd.Flags().String("format", "markdown", "output format (markdown|csv)")
+	reportChargebackCmd.Flags().StringP("output", "o", "", "write the report to a file instead of stdout")
+	reportChargebackCmd.Flags().String("cost-export", "", "Cost Management actual cost export (CSV) to allocate actual spend")
+	reportChargebackCmd.Flags().String("in", "./data", "input directory with cached JSON")
+}
@@ -3,8 +3,12 @@ package commands
 import (
 	"fmt"
 
+	"github.com/automationpi/azdocs/pkg/analysis"
+	"github.com/automationpi/azdocs/pkg/config"
+	"github.com/automationpi/azdocs/pkg/costexport"
+	"github.com/automationpi/azdocs/pkg/metrics"
+	"github.com/automationpi/azdocs/pkg/pricing"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
@@ -15,6 +19,9 @@ var (
 	logLevel  string
 	noAnsi    bool
 	quiet     bool
+
+	// cfg is the merged configuration for the running command
+	cfg *config.Config
 )
 
 var rootCmd = &cobra.Command{
@@ -26,40 +33,136 @@ Creates inventory tables, network topology diagrams, routing views, and more.
 Supports optional LLM-powered explanations with deterministic outputs.`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if _, skip := cmd.Annotations[skipConfig]; skip {
+			return nil
+		}
+		return initConfig(cmd)
+	},
 }
 
-func init() {
-	cobra.OnInitialize(initConfig)
+// skipConfig marks commands that must run even when the configuration is
+// invalid, e.g. `azdoc version`. They leave cfg nil.
+const skipConfig = "azdoc/skip-config"
 
+func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default: ./azdoc.yaml)")
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level (debug|info|warn|error)")
 	rootCmd.PersistentFlags().BoolVar(&noAnsi, "no-ansi", false, "disable ANSI colors in output")
 	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "suppress all non-error output")
+}
 
-	// Bind flags to viper
-	viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level"))
-	viper.BindPFlag("no-ansi", rootCmd.PersistentFlags().Lookup("no-ansi"))
-	viper.BindPFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
+// initConfig loads azdoc.yaml, AZDOC_* environment variables and the flags
+// of the running command into cfg
+func initConfig(cmd *cobra.Command) error {
+	loaded, err := config.Load(cfgFile, cmd.Flags())
+	if err != nil {
+		return err
+	}
+	cfg = loaded
+	return nil
 }
 
-func initConfig() {
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
-	} else {
-		viper.SetConfigName("azdoc")
-		viper.SetConfigType("yaml")
-		viper.AddConfigPath(".")
-		viper.AddConfigPath("$HOME/.azdoc")
+// analysisOptions builds the analysis settings from cfg, loading the
+// configured price sheet, Azure Monitor metrics and cost export. Only
+// commands that run the analyses call it.
+func analysisOptions() (analysis.Options, error) {
+	prices, err := loadPrices()
+	if err != nil {
+		return analysis.Options{}, err
+	}
+
+	var store *metrics.Store
+	if cfg.Utilization.Metrics != "" {
+		store, err = metrics.Load(cfg.Utilization.Metrics)
+		if err != nil {
+			return analysis.Options{}, err
+		}
+	}
+
+	costExport, err := loadCostExport()
+	if err != nil {
+		return analysis.Options{}, err
 	}
 
-	viper.AutomaticEnv()
-	viper.SetEnvPrefix("AZDOC")
+	return analysis.Options{
+		UtilizationThreshold: cfg.IPAM.UtilizationThreshold,
+		Prices:               prices,
+		VMUtilization: analysis.UtilizationPolicy{
+			Percentile:          cfg.Utilization.Percentile,
+			MinDays:             cfg.Utilization.MinDays,
+			CPUPercent:          cfg.Utilization.CPUPercent,
+			MemoryPercent:       cfg.Utilization.MemoryPercent,
+			NetworkMbps:         cfg.Utilization.NetworkMbps,
+			TargetCPUPercent:    cfg.Utilization.TargetCPUPercent,
+			TargetMemoryPercent: cfg.Utilization.TargetMemoryPercent,
+		},
+		Metrics:               store,
+		SnapshotMaxAgeDays:    cfg.Orphans.SnapshotAgeDays,
+		CommitmentExcludeTags: cfg.Commitments.ExcludeTags,
+		TaggingPolicy:         tagPolicy(cfg.Tagging),
+		CostExport:            costExport,
+	}, nil
+}
 
-	// Ignore error if config file not found
-	if err := viper.ReadInConfig(); err == nil {
-		// Config file found and loaded
+// loadPrices returns the configured price sheet, or the bundled one
+func loadPrices() (*pricing.Catalog, error) {
+	if cfg.Pricing.PriceSheet == "" {
+		return pricing.Default(), nil
 	}
+	return pricing.Load(cfg.Pricing.PriceSheet)
+}
+
+// loadCostExport returns the configured Cost Management export, or nil
+func loadCostExport() (*costexport.Export, error) {
+	if cfg.Pricing.CostExport == "" {
+		return nil, nil
+	}
+	return costexport.Load(cfg.Pricing.CostExport)
+}
+
+// tagPolicy converts the tagging configuration to the analysis policy
+func tagPolicy(c config.TaggingConfig) analysis.TagPolicy {
+	policy := analysis.TagPolicy{
+		Required:  c.Required,
+		KeyCase:   c.KeyCase,
+		ValueCase: c.ValueCase,
+		Inherit:   c.Inherit,
+	}
+	for _, s := range c.Scopes {
+		policy.Scopes = append(policy.Scopes, analysis.TagScope{
+			TagSelector: analysis.TagSelector{Types: s.Types, ResourceGroups: s.ResourceGroups},
+			Required:    s.Required,
+		})
+	}
+	for _, v := range c.Values {
+		policy.Values = append(policy.Values, analysis.TagValueRule{
+			Tag:         v.Tag,
+			Values:      v.Values,
+			Pattern:     v.Pattern,
+			Description: v.Description,
+		})
+	}
+	for _, e := range c.Exemptions {
+		policy.Exemptions = append(policy.Exemptions, analysis.TagExemption{
+			TagSelector: analysis.TagSelector{Names: e.Names, Types: e.Types, ResourceGroups: e.ResourceGroups},
+			Tags:        e.Tags,
+			Reason:      e.Reason,
+		})
+	}
+	return policy
+}
+
+// ExitError is returned by commands whose result, rather than a failure to
+// run, should set the process exit code (e.g. a failed `azdoc check`)
+type ExitError struct {
+	Code    int
+	Message string
+}
+
+func (e *ExitError) Error() string {
+	return e.Message
 }
 
 func SetVersion(v, commit, date string) {
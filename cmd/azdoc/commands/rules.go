@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/automationpi/azdocs/pkg/rules"
+	"github.com/spf13/cobra"
+)
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "List and test custom YAML rules",
+	Long: `Custom rules are YAML files in the rules directory (rules-dir, default
+./rules). They run alongside the built-in analyses in build, check and export.`,
+}
+
+var rulesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List custom rules",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		customRules, err := rules.Load(cfg.RulesDir)
+		if err != nil {
+			return err
+		}
+
+		if len(customRules) == 0 {
+			fmt.Printf("No custom rules found in %s\n", cfg.RulesDir)
+			return nil
+		}
+
+		for _, rule := range customRules {
+			fmt.Printf("%-12s %-10s %-8s %-24s %s\n", rule.ID, rule.Analysis, rule.Severity, rule.Name, rule.Resource.Type)
+		}
+		return nil
+	},
+}
+
+var rulesTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Run custom rules against their test fixtures",
+	Long: `Run the tests declared in each rule file and compare the number of
+findings with the expected count.
+
+Exit codes: 0 when all tests pass, 2 when a test fails, 1 on errors.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		customRules, err := rules.Load(cfg.RulesDir)
+		if err != nil {
+			return err
+		}
+
+		results := rules.Test(customRules)
+		failed := 0
+		for _, result := range results {
+			switch {
+			case result.Error != "":
+				failed++
+				fmt.Printf("ERROR %s %s: %s\n", result.Rule, result.Name, result.Error)
+			case !result.Passed:
+				failed++
+				fmt.Printf("FAIL  %s %s: expected %d findings, got %d\n", result.Rule, result.Name, result.Expected, result.Actual)
+			case !cfg.Quiet:
+				fmt.Printf("PASS  %s %s\n", result.Rule, result.Name)
+			}
+		}
+
+		untested := 0
+		for _, rule := range customRules {
+			if len(rule.Tests) == 0 {
+				untested++
+				if !cfg.Quiet {
+					fmt.Fprintf(os.Stderr, "⚠️  Rule %s (%s) has no tests\n", rule.ID, rule.File)
+				}
+			}
+		}
+
+		if failed > 0 {
+			return &ExitError{
+				Code:    exitCheckFailed,
+				Message: fmt.Sprintf("%d of %d rule tests failed", failed, len(results)),
+			}
+		}
+
+		if !cfg.Quiet {
+			fmt.Printf("✅ %d rule tests passed (%d rules, %d without tests)\n", len(results), len(customRules), untested)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rulesCmd)
+	rulesCmd.AddCommand(rulesListCmd)
+	rulesCmd.AddCommand(rulesTestCmd)
+
+	rulesCmd.PersistentFlags().String("rules-dir", rules.DefaultDir, "directory with custom YAML rules")
+}
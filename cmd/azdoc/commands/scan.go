@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/automationpi/azdocs/pkg/auth"
 	"github.com/automationpi/azdocs/pkg/cache"
 	"github.com/automationpi/azdocs/pkg/discovery"
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/normalize"
+	"github.com/automationpi/azdocs/pkg/snapshot"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var scanCmd = &cobra.Command{
@@ -20,21 +23,33 @@ var scanCmd = &cobra.Command{
 This command performs inventory collection via Azure Resource Graph and
 detailed queries via ARM APIs.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Parse flags
-		subscriptionID := cmd.Flag("subscription-id").Value.String()
-		if subscriptionID == "" {
+		// Parse flags; shared settings come from the merged config
+		subscriptionID := cfg.SubscriptionID
+		subscriptionIDs, _ := cmd.Flags().GetStringSlice("subscriptions")
+		managementGroupID := cmd.Flag("management-group").Value.String()
+		allSubscriptions, _ := cmd.Flags().GetBool("all-subscriptions")
+		if subscriptionID == "" && len(subscriptionIDs) == 0 && managementGroupID == "" && !allSubscriptions {
 			subscriptionID = os.Getenv("AZURE_SUBSCRIPTION_ID")
 			if subscriptionID == "" {
-				return fmt.Errorf("subscription ID is required (use --subscription-id or AZURE_SUBSCRIPTION_ID)")
+				return fmt.Errorf("subscription ID is required (use --subscription-id, --subscriptions, --management-group, --all-subscriptions or AZURE_SUBSCRIPTION_ID)")
 			}
 		}
+		if managementGroupID != "" && (len(subscriptionIDs) > 0 || allSubscriptions) {
+			return fmt.Errorf("--management-group cannot be combined with --subscriptions or --all-subscriptions")
+		}
 
-		tenantID := cmd.Flag("tenant-id").Value.String()
-		concurrency, _ := cmd.Flags().GetInt("concurrency")
-		timeout, _ := cmd.Flags().GetDuration("timeout")
-		cacheDir := cmd.Flag("cache-dir").Value.String()
-		jsonOut := cmd.Flag("json-out").Value.String()
+		tenantID := cfg.TenantID
+		concurrency := cfg.Discovery.Concurrency
+		timeout := cfg.Discovery.Timeout
+		cacheDir := cfg.Cache.Dir
+		jsonOut := cfg.Output.DataDir
 		noProgress, _ := cmd.Flags().GetBool("no-progress")
+		noProgress = noProgress || cfg.Quiet
+		pageSize, _ := cmd.Flags().GetInt("page-size")
+		maxResults, _ := cmd.Flags().GetInt("max-results")
+		if pageSize < 1 || pageSize > 1000 {
+			return fmt.Errorf("--page-size must be between 1 and 1000")
+		}
 
 		// Initialize auth
 		authClient, err := auth.NewAzureAuthenticator()
@@ -42,6 +57,21 @@ detailed queries via ARM APIs.`,
 			return fmt.Errorf("authentication failed: %w", err)
 		}
 
+		if allSubscriptions {
+			subs, err := authClient.ListSubscriptions()
+			if err != nil {
+				return fmt.Errorf("failed to list subscriptions: %w", err)
+			}
+			for _, sub := range subs {
+				if sub.State == "" || sub.State == "Enabled" {
+					subscriptionIDs = append(subscriptionIDs, sub.ID)
+				}
+			}
+			if len(subscriptionIDs) == 0 && subscriptionID == "" {
+				return fmt.Errorf("no enabled subscriptions are accessible")
+			}
+		}
+
 		// Initialize cache
 		cacheClient, err := cache.NewCache(cacheDir)
 		if err != nil {
@@ -54,15 +84,31 @@ detailed queries via ARM APIs.`,
 		defer cancel()
 
 		discoveryClient := discovery.NewDiscoveryClient(authClient, cacheClient, discovery.Config{
-			SubscriptionID: subscriptionID,
-			TenantID:       tenantID,
-			Concurrency:    concurrency,
-			ShowProgress:   !noProgress,
+			SubscriptionID:    subscriptionID,
+			SubscriptionIDs:   subscriptionIDs,
+			ManagementGroupID: managementGroupID,
+			TenantID:          tenantID,
+			Concurrency:       concurrency,
+			ShowProgress:      !noProgress,
+			PageSize:          pageSize,
+			MaxResults:        maxResults,
+			IncludeTypes:      cfg.Discovery.IncludeTypes,
+			ExcludeTypes:      cfg.Discovery.ExcludeTypes,
+			CacheTTL:          cfg.Cache.TTL,
+			RateLimitRPS:      cfg.RateLimit.RPS,
+			RateLimitBurst:    cfg.RateLimit.Burst,
 		})
 
 		// Run discovery
 		if !noProgress {
-			fmt.Printf("Scanning subscription %s...\n", subscriptionID)
+			switch subs := discoveryClient.Subscriptions(); {
+			case managementGroupID != "":
+				fmt.Printf("Scanning management group %s...\n", managementGroupID)
+			case len(subs) == 1:
+				fmt.Printf("Scanning subscription %s...\n", subs[0])
+			default:
+				fmt.Printf("Scanning %d subscriptions...\n", len(subs))
+			}
 		}
 
 		result, err := discoveryClient.Discover(ctx)
@@ -85,7 +131,7 @@ detailed queries via ARM APIs.`,
 			fmt.Println("   Continuing without recommendations...")
 		} else {
 			// Save recommendations
-			recPath := jsonOut + "/raw/recommendations.json"
+			recPath := filepath.Join(jsonOut, "raw", "recommendations.json")
 			if err := discovery.SaveRecommendations(recommendations, recPath); err != nil {
 				fmt.Printf("⚠️  Warning: Failed to save recommendations: %v\n", err)
 			} else if !noProgress {
@@ -93,6 +139,33 @@ detailed queries via ARM APIs.`,
 			}
 		}
 
+		// Fetch effective routes for VM NICs (slow, one request per NIC)
+		if cfg.Rendering.IncludeEffectiveRoutes {
+			if resources, ok := result.RawData["resources"].([]map[string]interface{}); ok {
+				var nics []models.NetworkInterface
+				for _, nic := range normalize.Normalize(resources).NICs {
+					if nic.AttachedTo != nil && nic.AttachedTo.Type == "VM" {
+						nics = append(nics, nic)
+					}
+				}
+				if !noProgress {
+					fmt.Printf("\nFetching effective routes for %d NICs...\n", len(nics))
+				}
+				routes, err := discoveryClient.FetchEffectiveRoutes(ctx, nics, cfg.Rendering.MaxRoutesPerNIC)
+				if err != nil {
+					fmt.Printf("⚠️  Warning: Failed to fetch effective routes: %v\n", err)
+				} else if err := discovery.SaveEffectiveRoutes(routes, filepath.Join(jsonOut, "raw", "effective-routes.json")); err != nil {
+					fmt.Printf("⚠️  Warning: Failed to save effective routes: %v\n", err)
+				}
+			}
+		}
+
+		// Keep a timestamped copy for `azdoc diff`
+		snapshotID, err := snapshot.Save(cacheDir, jsonOut, time.Now())
+		if err != nil {
+			fmt.Printf("⚠️  Warning: Failed to save snapshot: %v\n", err)
+		}
+
 		if !noProgress {
 			fmt.Printf("\nScan complete!\n")
 			fmt.Printf("  Resources discovered: %d\n", result.Stats.TotalResources)
@@ -100,7 +173,23 @@ detailed queries via ARM APIs.`,
 			fmt.Printf("  Subnets: %d\n", result.Stats.Subnets)
 			fmt.Printf("  NSGs: %d\n", result.Stats.NSGs)
 			fmt.Printf("  Route Tables: %d\n", result.Stats.RouteTables)
+			if len(result.Subscriptions) > 1 {
+				fmt.Printf("  Subscriptions: %d\n", len(result.Subscriptions))
+				for _, sub := range result.Subscriptions {
+					fmt.Printf("    %s: %d resources\n", sub, result.Stats.BySubscription[sub].TotalResources)
+				}
+			}
+		}
+
+		for _, warning := range discoveryClient.Warnings() {
+			fmt.Printf("⚠️  Warning: %s\n", warning)
+		}
+
+		if !noProgress {
 			fmt.Printf("\nData saved to: %s\n", jsonOut)
+			if snapshotID != "" {
+				fmt.Printf("Snapshot: %s\n", snapshotID)
+			}
 		}
 
 		return nil
@@ -111,15 +200,17 @@ func init() {
 	rootCmd.AddCommand(scanCmd)
 
 	scanCmd.Flags().String("subscription-id", "", "Azure subscription ID to scan")
+	scanCmd.Flags().StringSlice("subscriptions", nil, "comma-separated subscription IDs to scan into one dataset")
+	scanCmd.Flags().String("management-group", "", "scan every subscription under this management group")
+	scanCmd.Flags().Bool("all-subscriptions", false, "scan all enabled subscriptions the credential can access")
 	scanCmd.Flags().String("tenant-id", "", "Azure tenant ID (optional)")
 	scanCmd.Flags().Int("concurrency", 8, "number of concurrent API requests")
 	scanCmd.Flags().Duration("timeout", 5*time.Minute, "overall operation timeout")
 	scanCmd.Flags().String("cache-dir", ".azdoc", "cache directory path")
+	scanCmd.Flags().Duration("cache-ttl", 0, "reuse cached query results younger than this (0 = always query)")
 	scanCmd.Flags().String("json-out", "./data", "output directory for JSON files")
 	scanCmd.Flags().Bool("no-progress", false, "suppress progress indicators")
-
-	// Bind to viper
-	viper.BindPFlag("subscription-id", scanCmd.Flags().Lookup("subscription-id"))
-	viper.BindPFlag("concurrency", scanCmd.Flags().Lookup("concurrency"))
-	viper.BindPFlag("cache-dir", scanCmd.Flags().Lookup("cache-dir"))
+	scanCmd.Flags().Int("page-size", 1000, "Resource Graph rows per page (max 1000)")
+	scanCmd.Flags().Int("max-results", 0, "maximum rows per query (0 = unlimited)")
+	scanCmd.Flags().Bool("include-effective-routes", false, "fetch effective routes for VM NICs (slow)")
 }
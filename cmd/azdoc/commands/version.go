@@ -7,9 +7,10 @@ import (
 )
 
 var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Print version information",
-	Long:  "Display the version, git commit, and build date of azdoc",
+	Use:         "version",
+	Short:       "Print version information",
+	Long:        "Display the version, git commit, and build date of azdoc",
+	Annotations: map[string]string{skipConfig: ""},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println(GetVersion())
 	},
@@ -0,0 +1,201 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/costexport"
+)
+
+// SpendTags are the tag keys actual spend is broken down by
+var SpendTags = []string{"cost-center", "application", "environment"}
+
+// Untagged labels the cost of resources without a tag
+const Untagged = "(untagged)"
+
+// ActualCost is the monthly spend from a Cost Management export
+type ActualCost struct {
+	Source   string
+	Currency string
+	Months   []string // billing months the export covers
+
+	Total      float64 // monthly spend of all rows
+	Unassigned float64 // monthly spend of rows without a resource ID
+
+	Resources      []ResourceSpend
+	ResourceGroups []Spend
+	Tags           map[string][]Spend // by tag key in SpendTags
+}
+
+// ResourceSpend is the actual and estimated monthly cost of a resource
+type ResourceSpend struct {
+	Name          string
+	ResourceID    string
+	ResourceGroup string
+	Type          string
+	Monthly       float64
+	Estimated     float64
+	Priced        bool // Estimated is known
+	Scanned       bool // false for resources in the export but not in the scan
+}
+
+// Spend is the monthly spend of a resource group or tag value
+type Spend struct {
+	Name      string
+	Monthly   float64
+	Resources int
+}
+
+// applyActualCost replaces estimated costs with the actual spend in a Cost
+// Management export: the total, and the current cost and savings of every
+// finding. Resources in a subscription the export covers but without rows
+// incurred no cost.
+func (a *CostAnalysis) applyActualCost(export *costexport.Export, resources []map[string]interface{}) {
+	scanned := make(map[string]map[string]interface{})
+	for _, res := range resources {
+		id, _ := res["id"].(string)
+		scanned[strings.ToLower(id)] = res
+	}
+
+	actual := &ActualCost{
+		Source:     export.Source,
+		Currency:   export.Currency,
+		Months:     export.Months,
+		Total:      export.Monthly(export.Total),
+		Unassigned: export.Monthly(export.Unassigned),
+		Tags:       make(map[string][]Spend),
+	}
+
+	groups := make(map[string]*Spend)
+	tags := make(map[string]map[string]*Spend)
+	for _, key := range SpendTags {
+		tags[key] = make(map[string]*Spend)
+	}
+	add := func(spends map[string]*Spend, name string, monthly float64) {
+		s, ok := spends[strings.ToLower(name)]
+		if !ok {
+			s = &Spend{Name: name}
+			spends[strings.ToLower(name)] = s
+		}
+		s.Monthly += monthly
+		s.Resources++
+	}
+
+	for _, rc := range export.Resources() {
+		spend := ResourceSpend{
+			ResourceID:    rc.ResourceID,
+			ResourceGroup: rc.ResourceGroup,
+			Monthly:       export.Monthly(rc.Total),
+		}
+		// Tags on the usage rows win over the scanned tags, which may
+		// have changed since the usage was billed
+		resourceTags := make(map[string]string)
+		if res, ok := scanned[strings.ToLower(rc.ResourceID)]; ok {
+			estimate := a.options.prices().Estimate(res)
+			spend.Scanned = true
+			spend.Name, _ = res["name"].(string)
+			spend.Type, _ = res["type"].(string)
+			spend.Estimated = estimate.Monthly
+			spend.Priced = estimate.Priced
+			resourceTags = stringTags(res)
+		} else {
+			spend.Name = rc.ResourceID[strings.LastIndex(rc.ResourceID, "/")+1:]
+		}
+		for k, v := range rc.Tags {
+			resourceTags[k] = v
+		}
+		actual.Resources = append(actual.Resources, spend)
+
+		add(groups, rc.ResourceGroup, spend.Monthly)
+		for _, key := range SpendTags {
+			value := Untagged
+			if v := tagValue(resourceTags, key); v != "" {
+				value = v
+			}
+			add(tags[key], value, spend.Monthly)
+		}
+	}
+
+	actual.ResourceGroups = sortedSpend(groups)
+	for key, values := range tags {
+		actual.Tags[key] = sortedSpend(values)
+	}
+
+	a.Actual = actual
+	a.TotalMonthlyCost = actual.Total
+
+	for i := range a.Findings {
+		actualFindingCost(export, &a.Findings[i])
+	}
+	for i := range a.Orphans {
+		if rc, ok := export.Resource(a.Orphans[i].ResourceID); ok {
+			a.Orphans[i].Monthly = export.Monthly(rc.Total)
+		} else if export.Covers(a.Orphans[i].ResourceID) {
+			a.Orphans[i].Monthly = 0
+		}
+	}
+	a.sumSavings()
+}
+
+// actualFindingCost replaces the current cost of a finding with the actual
+// spend of its resource, keeping the share of the cost the finding saves
+func actualFindingCost(export *costexport.Export, f *CostFinding) {
+	var monthly float64
+	if rc, ok := export.Resource(f.ResourceID); ok {
+		monthly = export.Monthly(rc.Total)
+	} else if !export.Covers(f.ResourceID) {
+		return
+	}
+
+	// Orphaned resources save all of their cost, including those without
+	// an estimate
+	ratio := 0.0
+	if f.CurrentCost > 0 {
+		ratio = f.PotentialSavings / f.CurrentCost
+	} else if f.Category == "Orphaned" {
+		ratio = 1
+	}
+	f.CurrentCost = monthly
+	f.PotentialSavings = monthly * ratio
+}
+
+// stringTags returns the tags of a resource
+func stringTags(res map[string]interface{}) map[string]string {
+	tags := make(map[string]string)
+	if raw, ok := res["tags"].(map[string]interface{}); ok {
+		for k, v := range raw {
+			if s, ok := v.(string); ok {
+				tags[k] = s
+			}
+		}
+	}
+	return tags
+}
+
+// tagValue returns the value of a tag, matching the key case-insensitively
+func tagValue(tags map[string]string, key string) string {
+	if v, ok := tags[key]; ok {
+		return v
+	}
+	for k, v := range tags {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// sortedSpend returns spends by descending monthly cost
+func sortedSpend(spends map[string]*Spend) []Spend {
+	sorted := make([]Spend, 0, len(spends))
+	for _, s := range spends {
+		sorted = append(sorted, *s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Monthly != sorted[j].Monthly {
+			return sorted[i].Monthly > sorted[j].Monthly
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
@@ -0,0 +1,204 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/costexport"
+	"github.com/automationpi/azdocs/pkg/pricing"
+)
+
+// Chargeback allocates monthly cost to the values of a set of tag keys
+type Chargeback struct {
+	Keys     []string
+	Actual   bool   // costs are actual spend from a Cost Management export
+	Source   string // cost export or price sheet
+	Currency string
+	Months   []string // billing months of an export
+
+	Total       float64
+	Allocated   float64 // cost with a value for every key
+	Unallocated float64 // cost missing a value for a key, including Unassigned
+	Unassigned  float64 // export spend not tied to a resource
+	Inherited   float64 // allocated cost with a value from resource group tags
+	Unpriced    int     // resources left out because their cost could not be estimated
+
+	Allocations []Allocation         // by descending cost
+	Untagged    []ChargebackResource // resources missing a value, by descending cost
+}
+
+// Allocation is the cost of one combination of tag values
+type Allocation struct {
+	Values    []string // one per key; "(untagged)" when missing
+	Resources int
+	Inherited int // resources with a value from their resource group
+	Monthly   float64
+}
+
+// Allocated reports whether every key has a value
+func (a Allocation) Allocated() bool {
+	for _, v := range a.Values {
+		if v == Untagged {
+			return false
+		}
+	}
+	return true
+}
+
+// ChargebackResource is a resource whose cost cannot be fully allocated
+type ChargebackResource struct {
+	Name          string
+	ResourceID    string
+	ResourceGroup string
+	Missing       []string // keys without a value
+	Monthly       float64
+}
+
+// chargebackItem is the cost and tags of one resource
+type chargebackItem struct {
+	name, id, rg string
+	tags         map[string]string
+	monthly      float64
+}
+
+// AllocateCost allocates the monthly cost of resources to the values of the
+// tag keys. Costs are the actual spend in a Cost Management export when one
+// is given, otherwise pay-as-you-go estimates. Keys a resource lacks are
+// inherited from its resource group's tags. Estimates use prices, or the
+// bundled price sheet when nil.
+func AllocateCost(keys []string, resources, groups []map[string]interface{}, export *costexport.Export, prices *pricing.Catalog) *Chargeback {
+	if prices == nil {
+		prices = pricing.Default()
+	}
+	cb := &Chargeback{Keys: keys, Source: prices.Source, Currency: prices.Currency}
+
+	var items []chargebackItem
+	if export != nil {
+		cb.Actual = true
+		cb.Source, cb.Currency, cb.Months = export.Source, export.Currency, export.Months
+		cb.Unassigned = export.Monthly(export.Unassigned)
+
+		scanned := make(map[string]map[string]interface{})
+		for _, res := range resources {
+			id, _ := res["id"].(string)
+			scanned[strings.ToLower(id)] = res
+		}
+		for _, rc := range export.Resources() {
+			item := chargebackItem{
+				name:    rc.ResourceID[strings.LastIndex(rc.ResourceID, "/")+1:],
+				id:      rc.ResourceID,
+				rg:      rc.ResourceGroup,
+				tags:    make(map[string]string),
+				monthly: export.Monthly(rc.Total),
+			}
+			// Tags on the usage rows win, as in applyActualCost
+			if res, ok := scanned[strings.ToLower(rc.ResourceID)]; ok {
+				item.name, _ = res["name"].(string)
+				item.tags = stringTags(res)
+			}
+			for k, v := range rc.Tags {
+				item.tags[k] = v
+			}
+			items = append(items, item)
+		}
+	} else {
+		for _, res := range resources {
+			if deallocated(res) {
+				continue
+			}
+			estimate := prices.Estimate(res)
+			if !estimate.Priced {
+				cb.Unpriced++
+				continue
+			}
+			if estimate.Monthly == 0 {
+				continue
+			}
+			rg, _ := res["resourceGroup"].(string)
+			items = append(items, chargebackItem{
+				name:    estimate.Name,
+				id:      estimate.ResourceID,
+				rg:      rg,
+				tags:    stringTags(res),
+				monthly: estimate.Monthly,
+			})
+		}
+	}
+
+	groupTags := make(map[string]map[string]string)
+	for _, group := range groups {
+		name, _ := group["name"].(string)
+		groupTags[resourceGroupKey(group, name)] = stringTags(group)
+	}
+
+	allocations := make(map[string]*Allocation)
+	for _, item := range items {
+		inherited := false
+		values := make([]string, len(keys))
+		var missing []string
+		for i, key := range keys {
+			values[i] = tagValue(item.tags, key)
+			if values[i] == "" {
+				rgTags := groupTags[resourceGroupKey(map[string]interface{}{"id": item.id}, item.rg)]
+				if v := tagValue(rgTags, key); v != "" {
+					values[i], inherited = v, true
+				}
+			}
+			if values[i] == "" {
+				values[i] = Untagged
+				missing = append(missing, key)
+			}
+		}
+
+		allocationKey := strings.ToLower(strings.Join(values, "\x00"))
+		allocation, ok := allocations[allocationKey]
+		if !ok {
+			allocation = &Allocation{Values: values}
+			allocations[allocationKey] = allocation
+		}
+		allocation.Resources++
+		allocation.Monthly += item.monthly
+		cb.Total += item.monthly
+
+		if len(missing) > 0 {
+			cb.Unallocated += item.monthly
+			cb.Untagged = append(cb.Untagged, ChargebackResource{
+				Name:          item.name,
+				ResourceID:    item.id,
+				ResourceGroup: item.rg,
+				Missing:       missing,
+				Monthly:       item.monthly,
+			})
+			continue
+		}
+		cb.Allocated += item.monthly
+		if inherited {
+			allocation.Inherited++
+			cb.Inherited += item.monthly
+		}
+	}
+	cb.Total += cb.Unassigned
+	cb.Unallocated += cb.Unassigned
+
+	for _, allocation := range allocations {
+		cb.Allocations = append(cb.Allocations, *allocation)
+	}
+	sort.Slice(cb.Allocations, func(i, j int) bool {
+		if cb.Allocations[i].Monthly != cb.Allocations[j].Monthly {
+			return cb.Allocations[i].Monthly > cb.Allocations[j].Monthly
+		}
+		return strings.Join(cb.Allocations[i].Values, "/") < strings.Join(cb.Allocations[j].Values, "/")
+	})
+	sort.SliceStable(cb.Untagged, func(i, j int) bool {
+		return cb.Untagged[i].Monthly > cb.Untagged[j].Monthly
+	})
+	return cb
+}
+
+// Share returns a cost as a percentage of the total
+func (cb *Chargeback) Share(monthly float64) float64 {
+	if cb.Total == 0 {
+		return 0
+	}
+	return monthly / cb.Total * 100
+}
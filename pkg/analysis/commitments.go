@@ -0,0 +1,225 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/pricing"
+)
+
+// CommitmentSaving is the saving of one reservation or savings plan term
+// over pay-as-you-go
+type CommitmentSaving struct {
+	Kind    string // pricing.Reservation or pricing.SavingsPlan
+	Years   int
+	Monthly float64 // monthly cost of the commitment
+	Savings float64 // monthly saving over pay-as-you-go
+
+	priced int // VMs of the group priced for this term
+}
+
+// Breakeven returns the share of hours the VMs must run for the commitment
+// to cost less than pay-as-you-go
+func (s CommitmentSaving) Breakeven() float64 {
+	if s.Monthly+s.Savings == 0 {
+		return 0
+	}
+	return s.Monthly / (s.Monthly + s.Savings)
+}
+
+// CommitmentOpportunity groups always-on VMs of one size family and region,
+// the scope of a reservation with instance size flexibility
+type CommitmentOpportunity struct {
+	Family      string
+	Region      string
+	VMs         []string
+	Sizes       map[string]int // VM size -> count
+	VCPUs       int
+	PayAsYouGo  float64 // monthly compute cost at Linux pay-as-you-go rates
+	Savings     []CommitmentSaving
+	Approximate bool // some prices are another region's rates
+}
+
+// Saving returns the saving of a commitment kind and term, if priced
+func (o CommitmentOpportunity) Saving(kind string, years int) (CommitmentSaving, bool) {
+	for _, s := range o.Savings {
+		if s.Kind == kind && s.Years == years {
+			return s, true
+		}
+	}
+	return CommitmentSaving{}, false
+}
+
+// CommitmentExclusion is a VM left out of the commitment opportunities
+type CommitmentExclusion struct {
+	VM     string
+	Reason string
+}
+
+// analyzeCommitments groups running VMs by size family and region and
+// prices 1- and 3-year reservations and savings plans for them. Commitments
+// cover compute only, so Windows VMs are compared at Linux rates. VMs that
+// are stopped, tagged as dev/test or due for right-sizing are left out.
+func (a *CostAnalysis) analyzeCommitments(resources []map[string]interface{}) {
+	resize := make(map[string]bool)
+	for _, f := range a.Findings {
+		if f.RuleID == RuleOversizedVM {
+			resize[strings.ToLower(f.ResourceID)] = true
+		}
+	}
+
+	groups := make(map[string]*CommitmentOpportunity)
+	for _, res := range resources {
+		resType, _ := res["type"].(string)
+		if strings.ToLower(resType) != "microsoft.compute/virtualmachines" {
+			continue
+		}
+		id, _ := res["id"].(string)
+		name, _ := res["name"].(string)
+		region, _ := res["location"].(string)
+		region = strings.ToLower(region)
+		props, _ := res["properties"].(map[string]interface{})
+		hardware, _ := props["hardwareProfile"].(map[string]interface{})
+		sizeName, _ := hardware["vmSize"].(string)
+
+		exclude := func(reason string) {
+			a.CommitmentExclusions = append(a.CommitmentExclusions, CommitmentExclusion{VM: name, Reason: reason})
+		}
+		if state := vmPowerState(props); state != PowerRunning {
+			exclude(valueOr(state, "power state unknown"))
+			continue
+		}
+		if tag := excludedByTag(res, a.options.CommitmentExcludeTags); tag != "" {
+			exclude("tagged " + tag)
+			continue
+		}
+		if resize[strings.ToLower(id)] {
+			exclude("right-sizing candidate; resize before committing")
+			continue
+		}
+		size, ok := pricing.LookupVMSize(sizeName)
+		if !ok {
+			exclude(fmt.Sprintf("size %s is not in the size table", valueOr(sizeName, "unknown")))
+			continue
+		}
+		payg, ok := a.options.prices().VMMonthly(size.Name, region, false)
+		if !ok {
+			exclude(fmt.Sprintf("no pay-as-you-go price for %s", size.Name))
+			continue
+		}
+
+		key := size.Series + "|" + region
+		group, ok := groups[key]
+		if !ok {
+			group = &CommitmentOpportunity{Family: size.Series, Region: region, Sizes: make(map[string]int)}
+			groups[key] = group
+		}
+		group.VMs = append(group.VMs, name)
+		group.Sizes[size.Name]++
+		group.VCPUs += size.VCPUs
+		group.PayAsYouGo += payg
+
+		for _, kind := range []string{pricing.Reservation, pricing.SavingsPlan} {
+			for _, years := range pricing.CommitmentTerms {
+				c, ok := a.options.prices().VMCommitment(kind, size.Name, region, years)
+				if !ok {
+					continue
+				}
+				group.addSaving(kind, years, c.Monthly, payg-c.Monthly)
+				group.Approximate = group.Approximate || c.Approximate
+			}
+		}
+	}
+
+	for _, group := range groups {
+		group.dropPartialSavings()
+		a.Commitments = append(a.Commitments, *group)
+	}
+	sort.Slice(a.Commitments, func(i, j int) bool {
+		si, sj := a.Commitments[i].bestSavings(), a.Commitments[j].bestSavings()
+		if si != sj {
+			return si > sj
+		}
+		return a.Commitments[i].Family+a.Commitments[i].Region < a.Commitments[j].Family+a.Commitments[j].Region
+	})
+}
+
+// addSaving adds the cost and saving of one VM to a commitment term
+func (o *CommitmentOpportunity) addSaving(kind string, years int, monthly, savings float64) {
+	for i := range o.Savings {
+		if o.Savings[i].Kind == kind && o.Savings[i].Years == years {
+			o.Savings[i].Monthly += monthly
+			o.Savings[i].Savings += savings
+			o.Savings[i].priced++
+			return
+		}
+	}
+	o.Savings = append(o.Savings, CommitmentSaving{Kind: kind, Years: years, Monthly: monthly, Savings: savings, priced: 1})
+}
+
+// dropPartialSavings removes terms priced for only some VMs of the group,
+// whose sums would not be comparable with the pay-as-you-go total
+func (o *CommitmentOpportunity) dropPartialSavings() {
+	savings := o.Savings[:0]
+	for _, s := range o.Savings {
+		if s.priced == len(o.VMs) {
+			savings = append(savings, s)
+		}
+	}
+	o.Savings = savings
+}
+
+// bestSavings returns the largest monthly saving of any term
+func (o CommitmentOpportunity) bestSavings() float64 {
+	best := 0.0
+	for _, s := range o.Savings {
+		if s.Savings > best {
+			best = s.Savings
+		}
+	}
+	return best
+}
+
+// excludedByTag returns the key=value entry of excludeTags a resource
+// matches, or ""
+func excludedByTag(res map[string]interface{}, excludeTags []string) string {
+	tags := stringTags(res)
+	for _, entry := range excludeTags {
+		key, value, _ := strings.Cut(entry, "=")
+		if v := tagValue(tags, strings.TrimSpace(key)); v != "" && strings.EqualFold(v, strings.TrimSpace(value)) {
+			return entry
+		}
+	}
+	return ""
+}
+
+// valueOr returns value, or fallback when empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// CommitmentTotals sums each commitment kind and term over the groups
+// priced for it, reservations first
+func (a *CostAnalysis) CommitmentTotals() []CommitmentSaving {
+	var totals []CommitmentSaving
+	for _, kind := range []string{pricing.Reservation, pricing.SavingsPlan} {
+		for _, years := range pricing.CommitmentTerms {
+			total := CommitmentSaving{Kind: kind, Years: years}
+			for _, o := range a.Commitments {
+				if s, ok := o.Saving(kind, years); ok {
+					total.Monthly += s.Monthly
+					total.Savings += s.Savings
+					total.priced += s.priced
+				}
+			}
+			if total.priced > 0 {
+				totals = append(totals, total)
+			}
+		}
+	}
+	return totals
+}
@@ -7,9 +7,12 @@ import (
 
 // ComplianceFinding represents a compliance issue
 type ComplianceFinding struct {
+	RuleID      string   // Stable rule identifier, see Rules
 	Category    string   // DR, Monitoring, Backup
 	Severity    string   // Critical, High, Medium, Low
 	Resources   []string // Affected resources
+	ResourceIDs []string // ARM IDs of affected resources
+	Detail      string   // Distinguishes findings of one rule
 	Issue       string
 	Impact      string
 	Remediation string
@@ -36,7 +39,7 @@ func AnalyzeCompliance(resources []map[string]interface{}) *ComplianceAnalysis {
 }
 
 func (a *ComplianceAnalysis) analyzeBackup(resources []map[string]interface{}) {
-	vmsWithoutBackup := []string{}
+	withoutBackup := 0
 	totalVMs := 0
 
 	for _, res := range resources {
@@ -47,30 +50,30 @@ func (a *ComplianceAnalysis) analyzeBackup(resources []map[string]interface{}) {
 
 		totalVMs++
 		name, _ := res["name"].(string)
+		id, _ := res["id"].(string)
 
 		// In real implementation, check Azure Backup vault associations
 		// For now, assume VMs without backup
-		vmsWithoutBackup = append(vmsWithoutBackup, name)
+		withoutBackup++
+		a.Findings = append(a.Findings, ComplianceFinding{
+			RuleID:      RuleVMBackup,
+			Category:    "Backup",
+			Severity:    "High",
+			Resources:   []string{name},
+			ResourceIDs: []string{id},
+			Issue:       "VM without Azure Backup configured",
+			Impact:      "Risk of data loss if VM fails or is corrupted",
+			Remediation: "Configure Azure Backup with appropriate retention policy (7-30 days recommended)",
+		})
 	}
 
 	if totalVMs > 0 {
-		a.BackupCoverage = float64(totalVMs-len(vmsWithoutBackup)) / float64(totalVMs) * 100
-
-		if len(vmsWithoutBackup) > 0 {
-			a.Findings = append(a.Findings, ComplianceFinding{
-				Category:    "Backup",
-				Severity:    "High",
-				Resources:   vmsWithoutBackup,
-				Issue:       fmt.Sprintf("%d VMs without Azure Backup configured", len(vmsWithoutBackup)),
-				Impact:      "Risk of data loss if VM fails or is corrupted",
-				Remediation: "Configure Azure Backup with appropriate retention policy (7-30 days recommended)",
-			})
-		}
+		a.BackupCoverage = float64(totalVMs-withoutBackup) / float64(totalVMs) * 100
 	}
 }
 
 func (a *ComplianceAnalysis) analyzeMonitoring(resources []map[string]interface{}) {
-	resourcesWithoutDiagnostics := []string{}
+	withoutDiagnostics := 0
 	totalMonitorable := 0
 
 	for _, res := range resources {
@@ -83,40 +86,29 @@ func (a *ComplianceAnalysis) analyzeMonitoring(resources []map[string]interface{
 		}
 
 		totalMonitorable++
+		id, _ := res["id"].(string)
 
 		// In real implementation, check diagnostic settings
 		// For now, assume resources need diagnostics
-		resourcesWithoutDiagnostics = append(resourcesWithoutDiagnostics, fmt.Sprintf("%s (%s)", name, resType))
+		withoutDiagnostics++
+		a.Findings = append(a.Findings, ComplianceFinding{
+			RuleID:      RuleDiagnostics,
+			Category:    "Monitoring",
+			Severity:    "Medium",
+			Resources:   []string{fmt.Sprintf("%s (%s)", name, resType)},
+			ResourceIDs: []string{id},
+			Issue:       "Resource without diagnostic settings",
+			Impact:      "Limited visibility into resource health and performance",
+			Remediation: "Enable diagnostic settings to send logs to Log Analytics workspace",
+		})
 	}
 
 	if totalMonitorable > 0 {
-		a.MonitoringCoverage = float64(totalMonitorable-len(resourcesWithoutDiagnostics)) / float64(totalMonitorable) * 100
-
-		if len(resourcesWithoutDiagnostics) > 5 {
-			a.Findings = append(a.Findings, ComplianceFinding{
-				Category:    "Monitoring",
-				Severity:    "Medium",
-				Resources:   resourcesWithoutDiagnostics[:5], // Show first 5
-				Issue:       fmt.Sprintf("%d resources without diagnostic settings (showing first 5)", len(resourcesWithoutDiagnostics)),
-				Impact:      "Limited visibility into resource health and performance",
-				Remediation: "Enable diagnostic settings to send logs to Log Analytics workspace",
-			})
-		} else if len(resourcesWithoutDiagnostics) > 0 {
-			a.Findings = append(a.Findings, ComplianceFinding{
-				Category:    "Monitoring",
-				Severity:    "Medium",
-				Resources:   resourcesWithoutDiagnostics,
-				Issue:       fmt.Sprintf("%d resources without diagnostic settings", len(resourcesWithoutDiagnostics)),
-				Impact:      "Limited visibility into resource health and performance",
-				Remediation: "Enable diagnostic settings to send logs to Log Analytics workspace",
-			})
-		}
+		a.MonitoringCoverage = float64(totalMonitorable-withoutDiagnostics) / float64(totalMonitorable) * 100
 	}
 }
 
 func (a *ComplianceAnalysis) analyzeGeoRedundancy(resources []map[string]interface{}) {
-	nonRedundantStorage := []string{}
-
 	for _, res := range resources {
 		resType, _ := res["type"].(string)
 		if strings.ToLower(resType) != "microsoft.storage/storageaccounts" {
@@ -133,20 +125,19 @@ func (a *ComplianceAnalysis) analyzeGeoRedundancy(resources []map[string]interfa
 
 		// Check if using LRS (not geo-redundant)
 		if strings.Contains(skuName, "LRS") {
-			nonRedundantStorage = append(nonRedundantStorage, name)
+			id, _ := res["id"].(string)
+			a.Findings = append(a.Findings, ComplianceFinding{
+				RuleID:      RuleStorageRedundant,
+				Category:    "DR",
+				Severity:    "Medium",
+				Resources:   []string{name},
+				ResourceIDs: []string{id},
+				Issue:       "Storage account using LRS (locally redundant)",
+				Impact:      "Data not protected against regional outages",
+				Remediation: "Consider GRS (Geo-Redundant Storage) or GZRS for critical data",
+			})
 		}
 	}
-
-	if len(nonRedundantStorage) > 0 {
-		a.Findings = append(a.Findings, ComplianceFinding{
-			Category:    "DR",
-			Severity:    "Medium",
-			Resources:   nonRedundantStorage,
-			Issue:       fmt.Sprintf("%d storage accounts using LRS (locally redundant)", len(nonRedundantStorage)),
-			Impact:      "Data not protected against regional outages",
-			Remediation: "Consider GRS (Geo-Redundant Storage) or GZRS for critical data",
-		})
-	}
 }
 
 func isMonitorable(resType string) bool {
@@ -177,8 +168,14 @@ func (a *ComplianceAnalysis) GetComplianceScore() int {
 	score -= int((100 - a.BackupCoverage) * 0.3)
 	score -= int((100 - a.MonitoringCoverage) * 0.2)
 
-	// Penalize for findings
+	// Penalize once per issue, however many resources it affects
+	seen := make(map[string]bool)
 	for _, finding := range a.Findings {
+		key := finding.RuleID + "/" + finding.Detail
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
 		switch finding.Severity {
 		case "Critical":
 			score -= 15
@@ -3,13 +3,19 @@ package analysis
 import (
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/automationpi/azdocs/pkg/pricing"
 )
 
 // CostFinding represents a cost optimization opportunity
 type CostFinding struct {
+	RuleID           string  // Stable rule identifier, see Rules
 	Severity         string  // High, Medium, Low
 	Category         string  // Idle, Oversized, Orphaned, etc.
 	Resource         string  // Resource name
+	ResourceID       string  // ARM resource ID
+	Detail           string  // Distinguishes findings of one rule on a resource
 	Issue            string  // What's the problem
 	CurrentCost      float64 // Estimated current monthly cost
 	PotentialSavings float64 // Estimated monthly savings
@@ -18,15 +24,30 @@ type CostFinding struct {
 
 // CostAnalysis contains cost optimization findings
 type CostAnalysis struct {
-	TotalMonthlyCost      float64
+	TotalMonthlyCost        float64
 	PotentialMonthlySavings float64
-	Findings              []CostFinding
+	Findings                []CostFinding
+
+	PriceSource string             // price sheet the estimates are based on
+	Currency    string             // currency of all amounts
+	Unpriced    []pricing.Estimate // resources without a price, or priced at another region's rates
+	Actual      *ActualCost        // spend from Options.CostExport, see applyActualCost
+	Orphans     []Orphan           // unused resources, including those reported by security rules
+
+	Commitments          []CommitmentOpportunity // always-on VMs by size family and region
+	CommitmentExclusions []CommitmentExclusion   // VMs left out of Commitments
+
+	MetricsProvided bool // Azure Monitor metrics were given, so VMs were checked for right-sizing
+
+	options Options
 }
 
 // AnalyzeCost performs cost optimization analysis
-func AnalyzeCost(resources []map[string]interface{}) *CostAnalysis {
+func AnalyzeCost(resources []map[string]interface{}, opts Options) *CostAnalysis {
 	analysis := &CostAnalysis{
-		Findings: []CostFinding{},
+		Findings:        []CostFinding{},
+		MetricsProvided: opts.Metrics != nil,
+		options:         opts,
 	}
 
 	// Analyze orphaned resources
@@ -41,170 +62,113 @@ func AnalyzeCost(resources []map[string]interface{}) *CostAnalysis {
 	// Analyze storage tier optimization
 	analysis.analyzeStorageTiers(resources)
 
+	// Price reservations and savings plans for always-on VMs
+	analysis.analyzeCommitments(resources)
+
 	// Calculate totals
-	for _, finding := range analysis.Findings {
-		analysis.PotentialMonthlySavings += finding.PotentialSavings
-	}
+	analysis.sumSavings()
 
 	// Estimate total cost (rough estimates)
 	analysis.estimateTotalCost(resources)
 
+	// Replace estimates with actual spend when an export is given
+	if opts.CostExport != nil {
+		analysis.applyActualCost(opts.CostExport, resources)
+	}
+
 	return analysis
 }
 
-func (a *CostAnalysis) analyzeOrphanedResources(resources []map[string]interface{}) {
-	// Build map of attached disks
-	attachedDisks := make(map[string]bool)
-	for _, res := range resources {
-		resType, _ := res["type"].(string)
-		if strings.ToLower(resType) != "microsoft.compute/virtualmachines" {
-			continue
-		}
-
-		props, ok := res["properties"].(map[string]interface{})
-		if !ok {
-			continue
-		}
+// sumSavings recomputes the potential savings from the findings
+func (a *CostAnalysis) sumSavings() {
+	a.PotentialMonthlySavings = 0
+	for _, finding := range a.Findings {
+		a.PotentialMonthlySavings += finding.PotentialSavings
+	}
+}
 
-		// Check OS disk
-		if osDisk, ok := props["storageProfile"].(map[string]interface{}); ok {
-			if managedDisk, ok := osDisk["osDisk"].(map[string]interface{}); ok {
-				if diskRef, ok := managedDisk["managedDisk"].(map[string]interface{}); ok {
-					if id, ok := diskRef["id"].(string); ok {
-						attachedDisks[id] = true
-					}
-				}
-			}
-		}
+// analyzeOrphanedResources reports resources nothing in the scan uses, see
+// findOrphans
+func (a *CostAnalysis) analyzeOrphanedResources(resources []map[string]interface{}) {
+	for _, orphan := range a.findOrphans(resources, time.Now()) {
+		a.addOrphan(orphan)
 	}
+}
 
-	// Check for orphaned disks
+// analyzeIdleResources finds VMs that are stopped but still billed for
+// compute, and deallocated VMs whose disks are still billed
+func (a *CostAnalysis) analyzeIdleResources(resources []map[string]interface{}) {
+	disks := make(map[string]map[string]interface{})
 	for _, res := range resources {
-		resType, _ := res["type"].(string)
-		if strings.ToLower(resType) != "microsoft.compute/disks" {
-			continue
-		}
-
-		id, _ := res["id"].(string)
-		name, _ := res["name"].(string)
-
-		if !attachedDisks[id] {
-			props, ok := res["properties"].(map[string]interface{})
-			diskSize := 128 // default
-			if ok {
-				if size, ok := props["diskSizeGB"].(float64); ok {
-					diskSize = int(size)
-				}
-			}
-
-			// Estimate cost: ~$0.12/GB/month for Standard HDD
-			estimatedCost := float64(diskSize) * 0.12
-
-			a.Findings = append(a.Findings, CostFinding{
-				Severity:         "Medium",
-				Category:         "Orphaned",
-				Resource:         name,
-				Issue:            "Disk is not attached to any VM",
-				CurrentCost:      estimatedCost,
-				PotentialSavings: estimatedCost,
-				Remediation:      "Delete orphaned disk or attach to a VM if needed",
-			})
+		if resType, _ := res["type"].(string); strings.ToLower(resType) == "microsoft.compute/disks" {
+			id, _ := res["id"].(string)
+			disks[strings.ToLower(id)] = res
 		}
 	}
 
-	// Check for orphaned public IPs
-	usedPublicIPs := make(map[string]bool)
 	for _, res := range resources {
 		resType, _ := res["type"].(string)
-		if strings.ToLower(resType) != "microsoft.network/networkinterfaces" {
+		name, _ := res["name"].(string)
+		id, _ := res["id"].(string)
+
+		if strings.ToLower(resType) != "microsoft.compute/virtualmachines" {
 			continue
 		}
-
 		props, ok := res["properties"].(map[string]interface{})
 		if !ok {
 			continue
 		}
 
-		if ipConfigs, ok := props["ipConfigurations"].([]interface{}); ok {
-			for _, ipConfigIface := range ipConfigs {
-				if ipConfig, ok := ipConfigIface.(map[string]interface{}); ok {
-					if ipProps, ok := ipConfig["properties"].(map[string]interface{}); ok {
-						if pubIP, ok := ipProps["publicIPAddress"].(map[string]interface{}); ok {
-							if id, ok := pubIP["id"].(string); ok {
-								usedPublicIPs[id] = true
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-
-	for _, res := range resources {
-		resType, _ := res["type"].(string)
-		if strings.ToLower(resType) != "microsoft.network/publicipaddresses" {
-			continue
-		}
-
-		id, _ := res["id"].(string)
-		name, _ := res["name"].(string)
-
-		if !usedPublicIPs[id] {
-			// Static IPs cost ~$3.65/month
+		switch vmPowerState(props) {
+		case PowerStopped:
+			// A VM stopped from inside the guest keeps its compute allocation
+			estimatedCost := a.options.prices().Estimate(res).Monthly
 			a.Findings = append(a.Findings, CostFinding{
-				Severity:         "Low",
-				Category:         "Orphaned",
+				RuleID:           RuleIdleVM,
+				Severity:         "Medium",
+				Category:         "Idle",
 				Resource:         name,
-				Issue:            "Public IP is not associated with any resource",
-				CurrentCost:      3.65,
-				PotentialSavings: 3.65,
-				Remediation:      "Delete unused public IP or associate with a resource",
+				ResourceID:       id,
+				Issue:            "VM is stopped but not deallocated, so compute is still billed",
+				CurrentCost:      estimatedCost,
+				PotentialSavings: estimatedCost,
+				Remediation:      "Deallocate the VM (Stop in the portal or az vm deallocate) instead of shutting it down from the guest OS",
 			})
-		}
-	}
-}
-
-func (a *CostAnalysis) analyzeIdleResources(resources []map[string]interface{}) {
-	for _, res := range resources {
-		resType, _ := res["type"].(string)
-		name, _ := res["name"].(string)
 
-		if strings.ToLower(resType) == "microsoft.compute/virtualmachines" {
-			props, ok := res["properties"].(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			// Check power state (if available in properties)
-			// Note: This requires extended properties from Azure Resource Graph
-			// For now, we'll add a finding suggesting to check for idle VMs
-
-			vmSize := "Standard_B2s" // default
-			if hardwareProfile, ok := props["hardwareProfile"].(map[string]interface{}); ok {
-				if size, ok := hardwareProfile["vmSize"].(string); ok {
-					vmSize = size
+		case PowerDeallocated:
+			diskCost := 0.0
+			var diskNames []string
+			for _, diskID := range vmDiskIDs(props) {
+				diskNames = append(diskNames, diskID[strings.LastIndex(diskID, "/")+1:])
+				if disk, ok := disks[strings.ToLower(diskID)]; ok {
+					diskCost += a.options.prices().Estimate(disk).Monthly
 				}
 			}
-
-			estimatedCost := estimateVMCost(vmSize)
-
+			if len(diskNames) == 0 {
+				continue
+			}
 			a.Findings = append(a.Findings, CostFinding{
+				RuleID:           RuleDeallocatedVMDisks,
 				Severity:         "Low",
 				Category:         "Idle",
 				Resource:         name,
-				Issue:            "VM may be idle or underutilized (requires metrics analysis)",
-				CurrentCost:      estimatedCost,
-				PotentialSavings: estimatedCost * 0.7, // Could save 70% by deallocating
-				Remediation:      "Review VM metrics. If CPU <5% avg, consider deallocating when not in use or downsizing",
+				ResourceID:       id,
+				Issue:            fmt.Sprintf("VM is deallocated but its disks (%s) are still billed", strings.Join(diskNames, ", ")),
+				CurrentCost:      diskCost,
+				PotentialSavings: diskCost,
+				Remediation:      "Delete the VM and its disks if no longer needed, or snapshot the disks to cheaper storage and delete them",
 			})
 		}
 	}
 }
 
+// analyzeOversizedResources finds running VMs whose metrics stay below the
+// Options.VMUtilization thresholds and suggests a smaller size of the same series
 func (a *CostAnalysis) analyzeOversizedResources(resources []map[string]interface{}) {
 	for _, res := range resources {
 		resType, _ := res["type"].(string)
 		name, _ := res["name"].(string)
+		id, _ := res["id"].(string)
 
 		switch strings.ToLower(resType) {
 		case "microsoft.compute/virtualmachines":
@@ -212,6 +176,9 @@ func (a *CostAnalysis) analyzeOversizedResources(resources []map[string]interfac
 			if !ok {
 				continue
 			}
+			if state := vmPowerState(props); state != "" && state != PowerRunning {
+				continue
+			}
 
 			vmSize := ""
 			if hardwareProfile, ok := props["hardwareProfile"].(map[string]interface{}); ok {
@@ -219,30 +186,53 @@ func (a *CostAnalysis) analyzeOversizedResources(resources []map[string]interfac
 					vmSize = size
 				}
 			}
+			current, sized := pricing.LookupVMSize(vmSize)
 
-			// Check if using expensive SKUs that could be downgraded
-			if strings.Contains(vmSize, "Standard_D") || strings.Contains(vmSize, "Standard_E") {
-				currentCost := estimateVMCost(vmSize)
-				potentialSavings := currentCost * 0.4 // 40% savings with B-series
+			usage, ok := a.vmUsage(id, current, sized)
+			if !ok || !usage.underutilized(a.options.VMUtilization) {
+				continue
+			}
 
-				a.Findings = append(a.Findings, CostFinding{
-					Severity:         "Medium",
-					Category:         "Oversized",
-					Resource:         name,
-					Issue:            fmt.Sprintf("VM using %s - may be oversized for workload", vmSize),
-					CurrentCost:      currentCost,
-					PotentialSavings: potentialSavings,
-					Remediation:      "Analyze CPU/Memory metrics. Consider B-series or smaller size if utilization <30%",
-				})
+			estimate := a.options.prices().Estimate(res)
+			finding := CostFinding{
+				RuleID:      RuleOversizedVM,
+				Severity:    "Medium",
+				Category:    "Oversized",
+				Resource:    name,
+				ResourceID:  id,
+				Issue:       fmt.Sprintf("VM using %s is underutilized: %s", vmSize, usage),
+				CurrentCost: estimate.Monthly,
+				Remediation: fmt.Sprintf("No smaller %s size fits the workload; consider a burstable B-series size or consolidating workloads", vmSize),
+			}
+
+			location, _ := res["location"].(string)
+			windows := strings.EqualFold(osType(props), "Windows")
+			if !sized {
+				finding.Remediation = fmt.Sprintf("Size %s is not in the size table, so no smaller size was suggested; pick a smaller size of the same series that keeps CPU and memory within the utilization targets",
+					valueOr(vmSize, "unknown"))
+			} else if size, cost, ok := a.rightSize(current, usage, location, windows, estimate.Monthly); ok {
+				finding.PotentialSavings = estimate.Monthly - cost
+				finding.Remediation = fmt.Sprintf("Resize to %s (%d vCPUs, %.0f GiB) for about %.2f %s/month",
+					size.Name, size.VCPUs, size.MemoryGB, cost, a.options.prices().Currency)
 			}
+			a.Findings = append(a.Findings, finding)
 		}
 	}
 }
 
+// osType returns the OS disk's operating system type of a VM
+func osType(props map[string]interface{}) string {
+	storage, _ := props["storageProfile"].(map[string]interface{})
+	osDisk, _ := storage["osDisk"].(map[string]interface{})
+	value, _ := osDisk["osType"].(string)
+	return value
+}
+
 func (a *CostAnalysis) analyzeStorageTiers(resources []map[string]interface{}) {
 	for _, res := range resources {
 		resType, _ := res["type"].(string)
 		name, _ := res["name"].(string)
+		id, _ := res["id"].(string)
 
 		if strings.ToLower(resType) == "microsoft.storage/storageaccounts" {
 			props, ok := res["properties"].(map[string]interface{})
@@ -252,82 +242,50 @@ func (a *CostAnalysis) analyzeStorageTiers(resources []map[string]interface{}) {
 
 			accessTier, _ := props["accessTier"].(string)
 			if accessTier == "Hot" {
-				// Suggest reviewing if data is accessed infrequently
+				// Suggest reviewing if data is accessed infrequently.
+				// Storage is billed by stored data and transactions, so
+				// the savings of the Cool tier cannot be estimated here
 				a.Findings = append(a.Findings, CostFinding{
-					Severity:         "Low",
-					Category:         "StorageTier",
-					Resource:         name,
-					Issue:            "Storage account using Hot tier - review access patterns",
-					CurrentCost:      50, // Estimated
-					PotentialSavings: 25, // 50% savings with Cool tier
-					Remediation:      "If data is accessed <1x/month, move to Cool tier. For archival, use Archive tier",
+					RuleID:      RuleStorageHotTier,
+					Severity:    "Low",
+					Category:    "StorageTier",
+					Resource:    name,
+					ResourceID:  id,
+					Issue:       "Storage account using Hot tier - review access patterns",
+					Remediation: "If data is accessed <1x/month, move to Cool tier. For archival, use Archive tier",
 				})
 			}
 		}
 	}
 }
 
+// estimateTotalCost prices every resource from the price sheet and records
+// the resources that could not be priced. Deallocated VMs are not billed for
+// compute; their disks are priced separately.
 func (a *CostAnalysis) estimateTotalCost(resources []map[string]interface{}) {
-	totalCost := 0.0
-
+	deallocatedVMs := make(map[string]bool)
 	for _, res := range resources {
-		resType, _ := res["type"].(string)
-
-		switch strings.ToLower(resType) {
-		case "microsoft.compute/virtualmachines":
-			props, _ := res["properties"].(map[string]interface{})
-			vmSize := "Standard_B2s"
-			if props != nil {
-				if hw, ok := props["hardwareProfile"].(map[string]interface{}); ok {
-					if size, ok := hw["vmSize"].(string); ok {
-						vmSize = size
-					}
-				}
-			}
-			totalCost += estimateVMCost(vmSize)
-
-		case "microsoft.storage/storageaccounts":
-			totalCost += 50 // Rough estimate
-
-		case "microsoft.network/natgateways":
-			totalCost += 33 // ~$33/month
-
-		case "microsoft.network/publicipaddresses":
-			totalCost += 3.65
-
-		case "microsoft.compute/disks":
-			props, _ := res["properties"].(map[string]interface{})
-			diskSize := 128.0
-			if props != nil {
-				if size, ok := props["diskSizeGB"].(float64); ok {
-					diskSize = size
-				}
-			}
-			totalCost += diskSize * 0.12
+		if deallocated(res) {
+			id, _ := res["id"].(string)
+			deallocatedVMs[strings.ToLower(id)] = true
 		}
 	}
 
-	a.TotalMonthlyCost = totalCost
-}
-
-func estimateVMCost(vmSize string) float64 {
-	// Rough monthly cost estimates for common VM sizes
-	costMap := map[string]float64{
-		"Standard_B1s":  7.5,
-		"Standard_B2s":  30,
-		"Standard_B2ms": 60,
-		"Standard_D2s_v3": 70,
-		"Standard_D4s_v3": 140,
-		"Standard_E2s_v3": 87,
-		"Standard_E4s_v3": 175,
-	}
+	prices := a.options.prices()
+	a.PriceSource = prices.Source
+	a.Currency = prices.Currency
+	a.TotalMonthlyCost = 0
+	a.Unpriced = nil
 
-	if cost, ok := costMap[vmSize]; ok {
-		return cost
+	for _, estimate := range prices.EstimateAll(resources) {
+		if deallocatedVMs[strings.ToLower(estimate.ResourceID)] {
+			continue
+		}
+		a.TotalMonthlyCost += estimate.Monthly
+		if !estimate.Priced || estimate.Approximate {
+			a.Unpriced = append(a.Unpriced, estimate)
+		}
 	}
-
-	// Default estimate if size not in map
-	return 50
 }
 
 // GetCostScore calculates cost optimization score (0-100)
@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GateResult is the outcome of evaluating a report against CI thresholds
+type GateResult struct {
+	Passed    bool           `json:"passed"`
+	FailOn    string         `json:"failOn"`
+	Scores    map[string]int `json:"scores"`
+	MinScores map[string]int `json:"minScores,omitempty"`
+	Counts    map[string]int `json:"counts"`   // findings per severity, without hygiene findings
+	Hygiene   int            `json:"hygiene"`  // hygiene findings, which never block
+	Failures  []string       `json:"failures"` // why the gate failed
+	Blocking  []Finding      `json:"blocking"` // findings at or above FailOn
+	Findings  []Finding      `json:"findings"`
+}
+
+// Evaluate checks the report against a severity threshold and per-analysis
+// minimum scores. failOn "none" disables the severity gate. minScores keys
+// are analysis names, matched case-insensitively. Hygiene findings are left
+// out of the severity counts and the gate, as they are of the security score.
+func (r *Report) Evaluate(failOn string, minScores map[string]int) *GateResult {
+	result := &GateResult{
+		Passed:    true,
+		FailOn:    failOn,
+		Scores:    r.Scores(),
+		MinScores: minScores,
+		Counts:    map[string]int{"Critical": 0, "High": 0, "Medium": 0, "Low": 0},
+		Failures:  []string{},
+		Blocking:  []Finding{},
+		Findings:  r.Findings(),
+	}
+
+	for _, finding := range result.Findings {
+		if finding.Hygiene {
+			result.Hygiene++
+			continue
+		}
+		result.Counts[finding.Severity]++
+		if !strings.EqualFold(failOn, "none") && AtOrAbove(finding.Severity, failOn) {
+			result.Blocking = append(result.Blocking, finding)
+		}
+	}
+
+	if len(result.Blocking) > 0 {
+		result.Passed = false
+		result.Failures = append(result.Failures,
+			fmt.Sprintf("%d findings at or above %s severity", len(result.Blocking), failOn))
+	}
+
+	for _, name := range Analyses {
+		min, ok := lookupScore(minScores, name)
+		if !ok {
+			continue
+		}
+		if score := result.Scores[name]; score < min {
+			result.Passed = false
+			result.Failures = append(result.Failures,
+				fmt.Sprintf("%s score %d is below minimum %d", name, score, min))
+		}
+	}
+
+	return result
+}
+
+// lookupScore finds a minimum score by analysis name, ignoring case
+func lookupScore(scores map[string]int, name string) (int, bool) {
+	for key, value := range scores {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return 0, false
+}
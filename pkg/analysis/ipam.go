@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/automationpi/azdocs/pkg/ipam"
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// analyzeIPAM finds overlapping VNet address spaces and subnets whose
+// utilization is above threshold percent
+func (a *SecurityAnalysis) analyzeIPAM(inv *models.Inventory, threshold float64) {
+	a.IPAM = ipam.Analyze(inv, threshold)
+
+	for _, o := range a.IPAM.Overlaps {
+		// Overlapping peered VNets cannot route to each other; unpeered ones
+		// block a future peering or shared on-premises connectivity
+		severity := "Medium"
+		impact := "The VNets cannot be peered or share on-premises connectivity without re-addressing"
+		if o.Peered {
+			severity = "High"
+			impact = "Traffic to the overlapping range stays in the local VNet, so the peered VNet is unreachable there"
+		}
+
+		a.Findings = append(a.Findings, SecurityFinding{
+			RuleID:      RuleAddressSpaceOverlap,
+			Severity:    severity,
+			Category:    "IP Addressing",
+			Resource:    o.VNetA,
+			ResourceID:  o.VNetAID,
+			Detail:      fmt.Sprintf("%s overlaps %s %s", o.PrefixA, o.VNetB, o.PrefixB),
+			Issue:       fmt.Sprintf("Address space %s overlaps %s of %s (%s)", o.PrefixA, o.PrefixB, o.VNetB, o.Relationship()),
+			Impact:      impact,
+			Remediation: "Re-address one of the VNets from a range reserved in the organization's IP plan",
+		})
+	}
+
+	for _, s := range a.IPAM.OverThreshold() {
+		severity := "Medium"
+		if s.Available == 0 {
+			severity = "High"
+		}
+
+		a.Findings = append(a.Findings, SecurityFinding{
+			RuleID:      RuleSubnetExhaustion,
+			Severity:    severity,
+			Category:    "IP Addressing",
+			Resource:    s.VNet + "/" + s.Subnet,
+			ResourceID:  s.SubnetID,
+			Detail:      s.Prefix,
+			Issue:       fmt.Sprintf("Subnet %s is %.0f%% utilized (%d of %d usable IPs, threshold %.0f%%)", s.Prefix, s.Utilization, s.Used, s.Usable, a.IPAM.Threshold),
+			Impact:      "New NICs, private endpoints and scale-out instances fail to deploy once the subnet is full",
+			Remediation: "Add an address prefix to the subnet, move workloads to a larger subnet, or release unused IPs",
+		})
+	}
+}
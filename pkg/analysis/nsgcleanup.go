@@ -0,0 +1,154 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/nsg"
+)
+
+// NSGCleanup lists clean-up candidates in one NSG
+type NSGCleanup struct {
+	NSG           string
+	NSGID         string
+	ResourceGroup string
+	RuleCount     int
+	Unattached    bool // associated with no subnet and no NIC
+	Issues        []NSGRuleIssue
+}
+
+// NSGRuleIssue is a rule that can be removed or needs fixing
+type NSGRuleIssue struct {
+	RuleID    string // AZSEC008 shadowed, AZSEC009 duplicate, AZSEC010 missing ASG
+	Rule      string
+	Priority  int
+	Direction string
+	Issue     string
+}
+
+// HasIssues reports whether the NSG needs any clean-up
+func (c NSGCleanup) HasIssues() bool {
+	return c.Unattached || len(c.Issues) > 0
+}
+
+// analyzeNSGCleanup finds shadowed, duplicate and broken rules and NSGs
+// attached to nothing
+func (a *SecurityAnalysis) analyzeNSGCleanup(inv *models.Inventory) {
+	asgs := make(map[string]bool)
+	for _, asg := range inv.ASGs {
+		asgs[strings.ToLower(asg.ID)] = true
+	}
+
+	for _, m := range inv.NSGs {
+		group := nsg.New(m)
+		cleanup := NSGCleanup{
+			NSG:           m.Name,
+			NSGID:         m.ID,
+			ResourceGroup: m.ResourceGroup,
+			RuleCount:     len(m.Rules),
+			Unattached:    len(m.Subnets) == 0 && len(m.NICs) == 0,
+		}
+
+		reported := make(map[string]bool)
+		for _, duplicate := range group.Duplicates() {
+			reported[duplicate.Rule.Name] = true
+			cleanup.Issues = append(cleanup.Issues, NSGRuleIssue{
+				RuleID:    RuleNSGDuplicateRule,
+				Rule:      duplicate.Rule.Name,
+				Priority:  duplicate.Rule.Priority,
+				Direction: duplicate.Rule.Direction,
+				Issue:     fmt.Sprintf("Duplicates rule '%s' (priority %d)", duplicate.Of.Name, duplicate.Of.Priority),
+			})
+		}
+
+		for _, shadow := range group.Shadowed() {
+			if reported[shadow.Rule.Name] {
+				continue
+			}
+			issue := fmt.Sprintf("Never matches: traffic is already decided by %s", quoteNames(shadow.By))
+			if !shadow.Redundant {
+				issue = fmt.Sprintf("Never takes effect: %s overrides this %s rule", quoteNames(shadow.By), strings.ToLower(shadow.Rule.Access))
+			}
+			cleanup.Issues = append(cleanup.Issues, NSGRuleIssue{
+				RuleID:    RuleNSGShadowedRule,
+				Rule:      shadow.Rule.Name,
+				Priority:  shadow.Rule.Priority,
+				Direction: shadow.Rule.Direction,
+				Issue:     issue,
+			})
+		}
+
+		for _, rule := range group.Rules {
+			var missing []string
+			for _, id := range rule.ASGs() {
+				if !asgs[strings.ToLower(id)] {
+					missing = append(missing, nsg.ASGAddress(id).String())
+				}
+			}
+			if len(missing) > 0 {
+				cleanup.Issues = append(cleanup.Issues, NSGRuleIssue{
+					RuleID:    RuleNSGMissingASG,
+					Rule:      rule.Name,
+					Priority:  rule.Priority,
+					Direction: rule.Direction,
+					Issue:     fmt.Sprintf("References application security groups not found in the scanned data: %s", strings.Join(missing, ", ")),
+				})
+			}
+		}
+
+		a.NSGCleanup = append(a.NSGCleanup, cleanup)
+		a.addCleanupFindings(cleanup)
+	}
+}
+
+// addCleanupFindings reports an NSG's clean-up candidates as findings
+func (a *SecurityAnalysis) addCleanupFindings(cleanup NSGCleanup) {
+	for _, issue := range cleanup.Issues {
+		severity := "Low"
+		impact := "Stale rules make NSGs harder to review and hide the effective policy"
+		remediation := fmt.Sprintf("Remove rule '%s' or reorder priorities so it takes effect", issue.Rule)
+		switch issue.RuleID {
+		case RuleNSGDuplicateRule:
+			remediation = fmt.Sprintf("Remove duplicate rule '%s'", issue.Rule)
+		case RuleNSGMissingASG:
+			severity = "Medium"
+			impact = "A rule referencing a deleted application security group matches no traffic, so an intended allow or deny silently does not apply"
+			remediation = "Recreate the application security group or update the rule to reference an existing one"
+		}
+
+		a.Findings = append(a.Findings, SecurityFinding{
+			RuleID:      issue.RuleID,
+			Severity:    severity,
+			Category:    "NSGHygiene",
+			Resource:    cleanup.NSG,
+			ResourceID:  cleanup.NSGID,
+			Detail:      issue.Rule,
+			Issue:       fmt.Sprintf("NSG rule '%s' (%s, priority %d): %s", issue.Rule, issue.Direction, issue.Priority, issue.Issue),
+			Impact:      impact,
+			Remediation: remediation,
+		})
+	}
+
+	if cleanup.Unattached {
+		a.Findings = append(a.Findings, SecurityFinding{
+			RuleID:      RuleNSGUnattached,
+			Severity:    "Low",
+			Category:    "NSGHygiene",
+			Resource:    cleanup.NSG,
+			ResourceID:  cleanup.NSGID,
+			Issue:       "NSG is not associated with any subnet or network interface",
+			Impact:      "Unused NSGs add review overhead and may be mistaken for active policy",
+			Remediation: "Associate the NSG with a subnet or NIC, or delete it",
+		})
+	}
+}
+
+// quoteNames formats rule names as 'a', 'b'
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,148 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+const (
+	asgWeb = "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network/applicationSecurityGroups/asg-web"
+	asgOld = "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network/applicationSecurityGroups/asg-old"
+)
+
+// inboundRule builds an inbound TCP rule to any destination
+func inboundRule(name string, priority int, access string, sources, ports []string) models.NSGRule {
+	return models.NSGRule{
+		Name:                  name,
+		Priority:              priority,
+		Direction:             "Inbound",
+		Access:                access,
+		Protocol:              "Tcp",
+		SourceAddressPrefixes: sources,
+		SourcePortRanges:      []string{"*"},
+		DestAddressPrefixes:   []string{"*"},
+		DestPortRanges:        ports,
+	}
+}
+
+// cleanupInventory has an attached NSG with stale rules and an unattached one
+func cleanupInventory() *models.Inventory {
+	toWeb := inboundRule("allow-lb-to-web", 400, "Allow", []string{"AzureLoadBalancer"}, []string{"80"})
+	toWeb.DestAddressPrefixes = nil
+	toWeb.DestASGs = []string{asgWeb}
+	toOld := inboundRule("allow-lb-to-old", 410, "Allow", []string{"AzureLoadBalancer"}, []string{"8080"})
+	toOld.DestAddressPrefixes = nil
+	toOld.DestASGs = []string{asgOld}
+
+	return &models.Inventory{
+		NSGs: []models.NSG{
+			{
+				ID:            "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network/networkSecurityGroups/nsg-app",
+				Name:          "nsg-app",
+				ResourceGroup: "rg-app",
+				Subnets:       []string{"/subscriptions/sub1/resourceGroups/rg-net/providers/Microsoft.Network/virtualNetworks/vnet-spoke/subnets/snet-app"},
+				Rules: []models.NSGRule{
+					inboundRule("allow-https", 100, "Allow", []string{"*"}, []string{"443"}),
+					inboundRule("deny-ssh", 110, "Deny", []string{"*"}, []string{"22"}),
+					inboundRule("allow-admin", 120, "Allow", []string{"10.0.0.0/24"}, []string{"22", "3389"}),
+					inboundRule("allow-https-copy", 200, "Allow", []string{"*"}, []string{"443"}),
+					inboundRule("allow-ssh-bastion", 300, "Allow", []string{"10.0.1.0/26"}, []string{"22"}),
+					toWeb,
+					toOld,
+				},
+			},
+			{
+				ID:            "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network/networkSecurityGroups/nsg-unused",
+				Name:          "nsg-unused",
+				ResourceGroup: "rg-app",
+			},
+		},
+		ASGs: []models.ASG{{ID: asgWeb, Name: "asg-web", ResourceGroup: "rg-app"}},
+	}
+}
+
+func TestAnalyzeNSGCleanup(t *testing.T) {
+	a := &SecurityAnalysis{}
+	a.analyzeNSGCleanup(cleanupInventory())
+
+	if len(a.NSGCleanup) != 2 {
+		t.Fatalf("got %d NSG clean-ups, want 2", len(a.NSGCleanup))
+	}
+	app, unused := a.NSGCleanup[0], a.NSGCleanup[1]
+
+	type issue struct{ ruleID, rule string }
+	var got []issue
+	for _, i := range app.Issues {
+		got = append(got, issue{i.RuleID, i.Rule})
+	}
+	// allow-https-copy is also shadowed by allow-https but is reported once.
+	// allow-admin is only partly shadowed by deny-ssh and is not reported.
+	want := []issue{
+		{RuleNSGDuplicateRule, "allow-https-copy"},
+		{RuleNSGShadowedRule, "allow-ssh-bastion"},
+		{RuleNSGMissingASG, "allow-lb-to-old"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nsg-app issues = %v, want %v", got, want)
+	}
+	if app.Unattached || app.RuleCount != 7 {
+		t.Errorf("nsg-app unattached = %v, rule count = %d, want attached with 7 rules", app.Unattached, app.RuleCount)
+	}
+	if !unused.Unattached || len(unused.Issues) != 0 || !unused.HasIssues() {
+		t.Errorf("nsg-unused = %+v, want unattached with no rule issues", unused)
+	}
+
+	wantFindings := []struct{ ruleID, severity, detail string }{
+		{RuleNSGDuplicateRule, "Low", "allow-https-copy"},
+		{RuleNSGShadowedRule, "Low", "allow-ssh-bastion"},
+		{RuleNSGMissingASG, "Medium", "allow-lb-to-old"},
+		{RuleNSGUnattached, "Low", ""},
+	}
+	if len(a.Findings) != len(wantFindings) {
+		t.Fatalf("got %d findings, want %d: %+v", len(a.Findings), len(wantFindings), a.Findings)
+	}
+	for i, w := range wantFindings {
+		f := a.Findings[i]
+		if f.RuleID != w.ruleID || f.Severity != w.severity || f.Detail != w.detail {
+			t.Errorf("finding %d = %s %s %q, want %s %s %q", i, f.RuleID, f.Severity, f.Detail, w.ruleID, w.severity, w.detail)
+		}
+		if f.Category != "NSGHygiene" || !f.Hygiene() {
+			t.Errorf("finding %d category = %q, want a NSGHygiene hygiene finding", i, f.Category)
+		}
+	}
+}
+
+func TestEvaluateSkipsHygieneFindings(t *testing.T) {
+	a := &SecurityAnalysis{}
+	a.analyzeNSGCleanup(cleanupInventory())
+	a.Findings = append(a.Findings, SecurityFinding{
+		RuleID:   RuleNSGInternetInbound,
+		Severity: "High",
+		Category: "NSG",
+		Resource: "nsg-app",
+		Issue:    "SSH open to the Internet",
+	})
+	a.countBySeverity()
+
+	report := &Report{Security: a, Cost: &CostAnalysis{}, Tagging: &TaggingAnalysis{}, Compliance: &ComplianceAnalysis{}}
+	result := report.Evaluate("low", nil)
+
+	if result.Hygiene != 4 || result.Hygiene != a.HygieneCount {
+		t.Errorf("gate hygiene = %d, analysis hygiene = %d, want 4", result.Hygiene, a.HygieneCount)
+	}
+	wantCounts := map[string]int{"Critical": 0, "High": 1, "Medium": 0, "Low": 0}
+	if !reflect.DeepEqual(result.Counts, wantCounts) {
+		t.Errorf("gate counts = %v, want %v", result.Counts, wantCounts)
+	}
+	if len(result.Blocking) != 1 || result.Blocking[0].RuleID != RuleNSGInternetInbound {
+		t.Errorf("blocking = %+v, want only the Internet inbound finding", result.Blocking)
+	}
+	if result.Passed {
+		t.Error("gate passed with a High finding")
+	}
+	if len(result.Findings) != 5 {
+		t.Errorf("got %d findings in the gate result, want hygiene findings listed too", len(result.Findings))
+	}
+}
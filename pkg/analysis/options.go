@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"github.com/automationpi/azdocs/pkg/costexport"
+	"github.com/automationpi/azdocs/pkg/ipam"
+	"github.com/automationpi/azdocs/pkg/metrics"
+	"github.com/automationpi/azdocs/pkg/pricing"
+)
+
+// Options configures the analyses run by Analyze
+type Options struct {
+	// UtilizationThreshold is the subnet utilization percentage above which
+	// AZSEC018 is reported (ipam.utilization-threshold in azdoc.yaml)
+	UtilizationThreshold float64
+
+	// Prices is the price sheet cost estimates are based on; nil uses the
+	// bundled sheet
+	Prices *pricing.Catalog
+
+	// VMUtilization is the policy used by the right-sizing check
+	VMUtilization UtilizationPolicy
+
+	// Metrics holds Azure Monitor metric exports for the right-sizing check;
+	// without metrics no VM is reported as underutilized
+	Metrics *metrics.Store
+
+	// SnapshotMaxAgeDays is the age after which a snapshot is reported as
+	// stale; 0 disables the check
+	SnapshotMaxAgeDays int
+
+	// CommitmentExcludeTags are key=value tags of VMs left out of commitment
+	// opportunities, e.g. dev/test VMs that are shut down outside working hours
+	CommitmentExcludeTags []string
+
+	// TaggingPolicy is the policy used by the tagging analysis
+	TaggingPolicy TagPolicy
+
+	// CostExport is a Cost Management export whose actual spend replaces
+	// estimated costs; nil keeps the estimates
+	CostExport *costexport.Export
+}
+
+// DefaultOptions returns the settings documented in azdoc.yaml.example, with
+// the bundled price sheet and no metrics
+func DefaultOptions() Options {
+	return Options{
+		UtilizationThreshold: ipam.DefaultThreshold,
+		Prices:               pricing.Default(),
+		VMUtilization: UtilizationPolicy{
+			Percentile:          95,
+			MinDays:             7,
+			CPUPercent:          20,
+			MemoryPercent:       50,
+			NetworkMbps:         10,
+			TargetCPUPercent:    60,
+			TargetMemoryPercent: 75,
+		},
+		SnapshotMaxAgeDays:    90,
+		CommitmentExcludeTags: []string{"environment=dev", "environment=test"},
+		TaggingPolicy: TagPolicy{
+			Required: []string{"environment", "owner", "cost-center", "application"},
+		},
+	}
+}
+
+// prices returns the configured price sheet or the bundled one
+func (o Options) prices() *pricing.Catalog {
+	if o.Prices == nil {
+		return pricing.Default()
+	}
+	return o.Prices
+}
@@ -0,0 +1,338 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotMaxAgeDays is the age after which a snapshot is reported as
+// stale; 0 disables the check
+var SnapshotMaxAgeDays = 90
+
+// Orphan is a resource that nothing in the scan uses
+type Orphan struct {
+	RuleID        string // cost rule, or the security rule reporting unattached NSGs and route tables
+	Name          string
+	ResourceID    string
+	ResourceGroup string
+	Type          string
+	Issue         string
+	Monthly       float64
+}
+
+// orphanRules are the severity and remediation of the cost findings
+// reported for orphans; other orphans are reported by security rules
+var orphanRules = map[string]struct{ severity, remediation string }{
+	RuleOrphanedDisk:         {"Medium", "Delete orphaned disk or attach to a VM if needed"},
+	RuleOrphanedPublicIP:     {"Low", "Delete unused public IP or associate with a resource"},
+	RuleOrphanedNIC:          {"Low", "Delete the network interface or attach it to a VM"},
+	RuleEmptyAvailabilitySet: {"Low", "Delete the availability set or place VMs in it"},
+	RuleUnusedAppServicePlan: {"Medium", "Delete the App Service plan or deploy apps to it; plans are billed without apps"},
+	RuleStaleSnapshot:        {"Low", "Delete the snapshot if it is no longer needed, or move long-term copies to a backup vault"},
+	RuleEmptyResourceGroup:   {"Low", "Delete the empty resource group"},
+}
+
+// publicIPNonConsumers are resource types that reference public IPs
+// without using them
+var publicIPNonConsumers = map[string]bool{
+	"microsoft.network/publicipprefixes": true,
+}
+
+// references records which resources refer to each resource, from every
+// resource ID found anywhere in resource properties
+type references struct {
+	types     map[string]string          // by lower-cased resource ID
+	referrers map[string]map[string]bool // lower-cased resource ID -> referring resource IDs
+}
+
+// newReferences indexes the resource IDs in the properties of resources.
+// References to child resources, e.g. a subnet or IP configuration, count
+// as references to their top-level resource.
+func newReferences(resources []map[string]interface{}) *references {
+	r := &references{
+		types:     make(map[string]string),
+		referrers: make(map[string]map[string]bool),
+	}
+	for _, res := range resources {
+		id, _ := res["id"].(string)
+		resType, _ := res["type"].(string)
+		r.types[strings.ToLower(id)] = strings.ToLower(resType)
+	}
+
+	for _, res := range resources {
+		id, _ := res["id"].(string)
+		from := strings.ToLower(id)
+		walkStrings(res["properties"], func(value string) {
+			to := topLevelResourceID(value)
+			if to == "" || to == from {
+				return
+			}
+			if r.referrers[to] == nil {
+				r.referrers[to] = make(map[string]bool)
+			}
+			r.referrers[to][from] = true
+		})
+	}
+	return r
+}
+
+// usedBy reports whether a resource is referenced by a resource of one of
+// the types
+func (r *references) usedBy(id string, types ...string) bool {
+	for from := range r.referrers[strings.ToLower(id)] {
+		for _, t := range types {
+			if r.types[from] == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usedByAny reports whether a resource is referenced by a resource of a
+// type not in the excluded set
+func (r *references) usedByAny(id string, excluded map[string]bool) bool {
+	for from := range r.referrers[strings.ToLower(id)] {
+		if !excluded[r.types[from]] {
+			return true
+		}
+	}
+	return false
+}
+
+// walkStrings calls fn for every string in a decoded JSON value
+func walkStrings(v interface{}, fn func(string)) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, item := range value {
+			walkStrings(item, fn)
+		}
+	case []interface{}:
+		for _, item := range value {
+			walkStrings(item, fn)
+		}
+	case string:
+		fn(value)
+	}
+}
+
+// topLevelResourceID returns the lower-cased ID of the top-level resource a
+// resource ID belongs to, or "" if the value is not a resource ID
+func topLevelResourceID(value string) string {
+	parts := strings.Split(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), "/"), "/")
+	// "", subscriptions, {sub}, resourcegroups, {rg}, providers, {ns}, {type}, {name}
+	if len(parts) < 9 || parts[0] != "" || parts[1] != "subscriptions" || parts[3] != "resourcegroups" || parts[5] != "providers" {
+		return ""
+	}
+	return strings.Join(parts[:9], "/")
+}
+
+// findOrphans returns the resources nothing in the scan uses: unattached
+// disks, public IPs and NICs, NSGs and route tables without associations,
+// empty availability sets and App Service plans, and old snapshots
+func (a *CostAnalysis) findOrphans(resources []map[string]interface{}, now time.Time) []Orphan {
+	refs := newReferences(resources)
+
+	var orphans []Orphan
+	for _, res := range resources {
+		id, _ := res["id"].(string)
+		resType, _ := res["type"].(string)
+		props, _ := res["properties"].(map[string]interface{})
+
+		var ruleID, issue string
+		switch strings.ToLower(resType) {
+		case "microsoft.compute/disks":
+			// Reserved and ActiveSAS disks are in use without a VM reference
+			state, _ := props["diskState"].(string)
+			managedBy, _ := res["managedBy"].(string)
+			if managedBy == "" && (state == "" || strings.EqualFold(state, "Unattached")) &&
+				!refs.usedBy(id, "microsoft.compute/virtualmachines", "microsoft.compute/virtualmachinescalesets") {
+				ruleID, issue = RuleOrphanedDisk, "Disk is not attached to any VM"
+			}
+
+		case "microsoft.network/publicipaddresses":
+			// Consumers reference the IP, and the IP references the
+			// consumer's IP configuration or its NAT gateway
+			if !hasRef(props, "ipConfiguration") && !hasRef(props, "natGateway") &&
+				!refs.usedByAny(id, publicIPNonConsumers) {
+				ruleID, issue = RuleOrphanedPublicIP, "Public IP is not associated with any resource"
+			}
+
+		case "microsoft.network/networkinterfaces":
+			// Private endpoint and private link service NICs are managed by Azure
+			if !hasRef(props, "virtualMachine") && !hasRef(props, "privateEndpoint") && !hasRef(props, "privateLinkService") &&
+				!refs.usedBy(id, "microsoft.compute/virtualmachines", "microsoft.network/privateendpoints", "microsoft.network/privatelinkservices") {
+				ruleID, issue = RuleOrphanedNIC, "Network interface is not attached to a VM"
+			}
+
+		case "microsoft.network/networksecuritygroups":
+			if !hasItems(props, "subnets") && !hasItems(props, "networkInterfaces") &&
+				!refs.usedBy(id, "microsoft.network/virtualnetworks", "microsoft.network/networkinterfaces") {
+				ruleID, issue = RuleNSGUnattached, "NSG is not associated with any subnet or network interface"
+			}
+
+		case "microsoft.network/routetables":
+			if !hasItems(props, "subnets") && !refs.usedBy(id, "microsoft.network/virtualnetworks") {
+				ruleID, issue = RuleRouteTableUnattached, "Route table is not associated with any subnet"
+			}
+
+		case "microsoft.compute/availabilitysets":
+			if !hasItems(props, "virtualMachines") && !refs.usedBy(id, "microsoft.compute/virtualmachines") {
+				ruleID, issue = RuleEmptyAvailabilitySet, "Availability set contains no VMs"
+			}
+
+		case "microsoft.web/serverfarms":
+			sites, counted := props["numberOfSites"].(float64)
+			if (!counted || sites == 0) && !refs.usedBy(id, "microsoft.web/sites") {
+				ruleID, issue = RuleUnusedAppServicePlan, "App Service plan hosts no apps"
+			}
+
+		case "microsoft.compute/snapshots":
+			created, _ := props["timeCreated"].(string)
+			t, err := time.Parse(time.RFC3339, created)
+			if days := int(now.Sub(t).Hours() / 24); err == nil && a.options.SnapshotMaxAgeDays > 0 && days > a.options.SnapshotMaxAgeDays {
+				ruleID, issue = RuleStaleSnapshot, fmt.Sprintf("Snapshot is %d days old (created %s)", days, t.Format("2006-01-02"))
+			}
+		}
+
+		if ruleID != "" {
+			orphans = append(orphans, a.newOrphan(res, ruleID, issue))
+		}
+	}
+	return orphans
+}
+
+// newOrphan describes an unused resource
+func (a *CostAnalysis) newOrphan(res map[string]interface{}, ruleID, issue string) Orphan {
+	id, _ := res["id"].(string)
+	name, _ := res["name"].(string)
+	resType, _ := res["type"].(string)
+	rg, _ := res["resourceGroup"].(string)
+	return Orphan{
+		RuleID:        ruleID,
+		Name:          name,
+		ResourceID:    id,
+		ResourceGroup: rg,
+		Type:          strings.ToLower(resType),
+		Issue:         issue,
+		Monthly:       a.options.prices().Estimate(res).Monthly,
+	}
+}
+
+// addOrphan records an orphan and reports it as a cost finding unless a
+// security rule reports it
+func (a *CostAnalysis) addOrphan(orphan Orphan) {
+	a.Orphans = append(a.Orphans, orphan)
+
+	rule, ok := orphanRules[orphan.RuleID]
+	if !ok {
+		return
+	}
+	a.Findings = append(a.Findings, CostFinding{
+		RuleID:           orphan.RuleID,
+		Severity:         rule.severity,
+		Category:         "Orphaned",
+		Resource:         orphan.Name,
+		ResourceID:       orphan.ResourceID,
+		Issue:            orphan.Issue,
+		CurrentCost:      orphan.Monthly,
+		PotentialSavings: orphan.Monthly,
+		Remediation:      rule.remediation,
+	})
+}
+
+// AnalyzeResourceGroups reports resource groups without resources. Groups
+// listed with a resource count use it, so groups holding only resource types
+// excluded from the scan are not reported. Managed resource groups, e.g.
+// AKS node resource groups, are skipped.
+func (a *CostAnalysis) AnalyzeResourceGroups(groups, resources []map[string]interface{}) {
+	scanned := make(map[string]bool)
+	for _, res := range resources {
+		rg, _ := res["resourceGroup"].(string)
+		scanned[resourceGroupKey(res, rg)] = true
+	}
+
+	for _, group := range groups {
+		name, _ := group["name"].(string)
+		if managedBy, _ := group["managedBy"].(string); managedBy != "" {
+			continue
+		}
+		if count, ok := group["resourceCount"].(float64); ok && count > 0 {
+			continue
+		}
+		if scanned[resourceGroupKey(group, name)] {
+			continue
+		}
+
+		id, _ := group["id"].(string)
+		a.addOrphan(Orphan{
+			RuleID:        RuleEmptyResourceGroup,
+			Name:          name,
+			ResourceID:    id,
+			ResourceGroup: name,
+			Type:          "microsoft.resources/subscriptions/resourcegroups",
+			Issue:         "Resource group contains no resources",
+		})
+	}
+	a.sumSavings()
+}
+
+// OrphanSummary is the number and cost of orphans of one resource type
+type OrphanSummary struct {
+	Type    string
+	Count   int
+	Monthly float64
+}
+
+// OrphansByType summarizes the orphans by resource type, most costly first
+func (a *CostAnalysis) OrphansByType() []OrphanSummary {
+	byType := make(map[string]*OrphanSummary)
+	for _, orphan := range a.Orphans {
+		s, ok := byType[orphan.Type]
+		if !ok {
+			s = &OrphanSummary{Type: orphan.Type}
+			byType[orphan.Type] = s
+		}
+		s.Count++
+		s.Monthly += orphan.Monthly
+	}
+
+	summaries := make([]OrphanSummary, 0, len(byType))
+	for _, s := range byType {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Monthly != summaries[j].Monthly {
+			return summaries[i].Monthly > summaries[j].Monthly
+		}
+		return summaries[i].Type < summaries[j].Type
+	})
+	return summaries
+}
+
+// resourceGroupKey identifies a resource group across subscriptions
+func resourceGroupKey(res map[string]interface{}, rg string) string {
+	sub, _ := res["subscriptionId"].(string)
+	if sub == "" {
+		id, _ := res["id"].(string)
+		if parts := strings.Split(id, "/"); len(parts) > 2 {
+			sub = parts[2]
+		}
+	}
+	return strings.ToLower(sub + "/" + rg)
+}
+
+// hasRef reports whether a property is a reference such as {"id": "..."}
+func hasRef(props map[string]interface{}, key string) bool {
+	ref, _ := props[key].(map[string]interface{})
+	id, _ := ref["id"].(string)
+	return id != ""
+}
+
+// hasItems reports whether a property is a non-empty list
+func hasItems(props map[string]interface{}, key string) bool {
+	items, _ := props[key].([]interface{})
+	return len(items) > 0
+}
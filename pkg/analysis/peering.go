@@ -0,0 +1,316 @@
+package analysis
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/reach"
+)
+
+// PeeringIssue is a problem with a VNet peering or with traffic between
+// spokes of a hub
+type PeeringIssue struct {
+	RuleID        string // AZSEC019 not connected ... AZSEC022 remote gateway missing
+	VNet          string
+	VNetID        string
+	ResourceGroup string
+	Peering       string // peering name, or the other spoke for spoke-to-spoke issues
+	Issue         string
+}
+
+// Topology is the hub-and-spoke layout detected from VNet peerings
+type Topology struct {
+	Hubs    []Hub
+	Orphans []string // VNets without connected peerings
+	Other   []string // peered VNets that are neither hubs nor spokes, e.g. meshes
+}
+
+// Hub is a VNet that peers with several spokes or hosts shared gateways
+// and firewalls
+type Hub struct {
+	Name     string
+	ID       string
+	Spokes   []string // spoke VNet names; VNets outside the scan are marked
+	Gateway  bool
+	Firewall bool
+}
+
+// peeredVNet is a VNet with the indexes used by the peering checks
+type peeredVNet struct {
+	vnet     *models.VNet
+	gateway  bool
+	firewall bool
+	hub      bool
+}
+
+// analyzePeering finds peerings that are not connected or one-sided,
+// remote gateways that do not exist, spokes that cannot reach each other,
+// and summarizes the hub-and-spoke topology
+func (a *SecurityAnalysis) analyzePeering(inv *models.Inventory) {
+	vnets := make(map[string]*peeredVNet)
+	for i := range inv.VNets {
+		vnets[strings.ToLower(inv.VNets[i].ID)] = &peeredVNet{vnet: &inv.VNets[i]}
+	}
+	for _, gw := range inv.Gateways {
+		if v, ok := vnets[strings.ToLower(gw.VNetID)]; ok {
+			v.gateway = true
+		}
+	}
+	for _, fw := range inv.Firewalls {
+		if v, ok := vnets[strings.ToLower(fw.VNetID)]; ok {
+			v.firewall = true
+		}
+	}
+
+	var issues []PeeringIssue
+	for i := range inv.VNets {
+		vnet := &inv.VNets[i]
+		add := func(ruleID, peering, issue string) {
+			issues = append(issues, PeeringIssue{
+				RuleID:        ruleID,
+				VNet:          vnet.Name,
+				VNetID:        vnet.ID,
+				ResourceGroup: vnet.ResourceGroup,
+				Peering:       peering,
+				Issue:         issue,
+			})
+		}
+
+		for _, p := range vnet.Peerings {
+			remote, scanned := vnets[strings.ToLower(p.RemoteVNetID)]
+			reverse := (*models.VNetPeering)(nil)
+			if scanned {
+				reverse = reach.Peering(remote.vnet, vnet.ID)
+			}
+
+			switch {
+			case scanned && reverse == nil:
+				add(RulePeeringMissingReverse, p.Name, fmt.Sprintf("%s has no peering back to %s, so no traffic flows in either direction", remote.vnet.Name, vnet.Name))
+			case !strings.EqualFold(p.PeeringState, "Connected"):
+				state := p.PeeringState
+				if state == "" {
+					state = "in an unknown state"
+				}
+				add(RulePeeringNotConnected, p.Name, fmt.Sprintf("Peering to %s is %s, not Connected", reach.ResourceName(p.RemoteVNetID), state))
+			}
+
+			if p.UseRemoteGateways && scanned {
+				switch {
+				case !remote.gateway:
+					add(RuleRemoteGatewayMissing, p.Name, fmt.Sprintf("Uses remote gateways but %s has no virtual network gateway", remote.vnet.Name))
+				case reverse != nil && !reverse.AllowGatewayTransit:
+					add(RuleRemoteGatewayMissing, p.Name, fmt.Sprintf("Uses remote gateways but %s's peering '%s' does not allow gateway transit", remote.vnet.Name, reverse.Name))
+				}
+			}
+		}
+	}
+
+	a.Topology = detectTopology(inv, vnets)
+
+	router := reach.NewRouter(inv)
+	for _, hub := range a.Topology.Hubs {
+		issues = append(issues, spokeTransitIssues(vnets[strings.ToLower(hub.ID)].vnet, vnets, router)...)
+	}
+
+	a.PeeringIssues = append(a.PeeringIssues, issues...)
+	a.addPeeringFindings(issues)
+}
+
+// addPeeringFindings reports peering issues as findings
+func (a *SecurityAnalysis) addPeeringFindings(issues []PeeringIssue) {
+	for _, issue := range issues {
+		severity := "High"
+		impact := ""
+		remediation := ""
+		switch issue.RuleID {
+		case RulePeeringNotConnected:
+			impact = "Traffic does not flow over a peering until both sides are Connected"
+			remediation = "Create or re-create the peering on the remote VNet, then sync the peering so both sides show Connected"
+		case RulePeeringMissingReverse:
+			impact = "A peering only carries traffic once both VNets peer with each other"
+			remediation = "Add the reverse peering on the remote VNet"
+		case RuleSpokeTransit:
+			severity = "Medium"
+			impact = "Peering is not transitive: spokes of a hub cannot reach each other through it without a forwarding appliance"
+			remediation = "Route the other spoke's range to the hub firewall or NVA, peer the spokes directly, or use Virtual WAN"
+		case RuleRemoteGatewayMissing:
+			impact = "The VNet learns no on-premises routes and has no gateway path out of Azure"
+			remediation = "Deploy a gateway in the remote VNet and allow gateway transit on its peering, or clear 'Use remote gateways'"
+		}
+
+		a.Findings = append(a.Findings, SecurityFinding{
+			RuleID:      issue.RuleID,
+			Severity:    severity,
+			Category:    "Peering",
+			Resource:    issue.VNet,
+			ResourceID:  issue.VNetID,
+			Detail:      issue.Peering + ": " + issue.Issue,
+			Issue:       fmt.Sprintf("Peering '%s': %s", issue.Peering, issue.Issue),
+			Impact:      impact,
+			Remediation: remediation,
+		})
+	}
+}
+
+// detectTopology classifies VNets as hubs, spokes, orphans and others. Only
+// Connected peerings count. A hub hosts a gateway or firewall, allows gateway
+// transit or is another VNet's remote gateway, or peers with two or more VNets
+// that are none of these; a spoke peers only with hubs. VNets outside the scan
+// are listed as spokes of the hubs they peer with.
+func detectTopology(inv *models.Inventory, vnets map[string]*peeredVNet) Topology {
+	transit := make(map[*peeredVNet]bool)
+	for _, v := range vnets {
+		for _, p := range connectedPeerings(v.vnet) {
+			if p.AllowGatewayTransit {
+				transit[v] = true
+			}
+			if remote, ok := vnets[strings.ToLower(p.RemoteVNetID)]; ok && p.UseRemoteGateways {
+				transit[remote] = true
+			}
+		}
+	}
+	shared := func(v *peeredVNet) bool { return v.gateway || v.firewall || transit[v] }
+
+	for _, v := range vnets {
+		peerings := connectedPeerings(v.vnet)
+		if len(peerings) == 0 {
+			continue
+		}
+		if shared(v) {
+			v.hub = true
+			continue
+		}
+		// A VNet peered with several shared-services VNets is a dual-homed
+		// spoke rather than a hub
+		plain := 0
+		for _, p := range peerings {
+			if remote, ok := vnets[strings.ToLower(p.RemoteVNetID)]; !ok || !shared(remote) {
+				plain++
+			}
+		}
+		v.hub = plain >= 2
+	}
+
+	// A spoke peers with at least one hub and with no scanned non-hub VNet;
+	// peers outside the scan cannot be classified and are ignored
+	spoke := func(v *peeredVNet) bool {
+		hubs := 0
+		for _, p := range connectedPeerings(v.vnet) {
+			remote, ok := vnets[strings.ToLower(p.RemoteVNetID)]
+			switch {
+			case ok && remote.hub:
+				hubs++
+			case ok:
+				return false
+			}
+		}
+		return !v.hub && hubs > 0
+	}
+
+	var topology Topology
+	for i := range inv.VNets {
+		vnet := &inv.VNets[i]
+		v := vnets[strings.ToLower(vnet.ID)]
+		peerings := connectedPeerings(vnet)
+		switch {
+		case len(peerings) == 0:
+			topology.Orphans = append(topology.Orphans, vnet.Name)
+		case v.hub:
+			hub := Hub{Name: vnet.Name, ID: vnet.ID, Gateway: v.gateway, Firewall: v.firewall}
+			for _, p := range peerings {
+				remote, scanned := vnets[strings.ToLower(p.RemoteVNetID)]
+				switch {
+				case !scanned:
+					hub.Spokes = append(hub.Spokes, reach.ResourceName(p.RemoteVNetID)+" (not scanned)")
+				case spoke(remote):
+					hub.Spokes = append(hub.Spokes, remote.vnet.Name)
+				}
+			}
+			sort.Strings(hub.Spokes)
+			topology.Hubs = append(topology.Hubs, hub)
+		case !spoke(v):
+			topology.Other = append(topology.Other, vnet.Name)
+		}
+	}
+	return topology
+}
+
+// connectedPeerings returns the VNet's peerings that carry traffic
+func connectedPeerings(vnet *models.VNet) []models.VNetPeering {
+	var peerings []models.VNetPeering
+	for _, p := range vnet.Peerings {
+		if strings.EqualFold(p.PeeringState, "Connected") {
+			peerings = append(peerings, p)
+		}
+	}
+	return peerings
+}
+
+// spokeTransitIssues finds pairs of scanned spokes of a hub that are not
+// peered with each other and have no route through an appliance to each
+// other's address space
+func spokeTransitIssues(hub *models.VNet, vnets map[string]*peeredVNet, router *reach.Router) []PeeringIssue {
+	var spokes []*models.VNet
+	for _, p := range connectedPeerings(hub) {
+		if remote, ok := vnets[strings.ToLower(p.RemoteVNetID)]; ok && !remote.hub && len(remote.vnet.Subnets) > 0 {
+			spokes = append(spokes, remote.vnet)
+		}
+	}
+
+	var issues []PeeringIssue
+	for _, from := range spokes {
+		for _, to := range spokes {
+			if from == to || reach.Peering(from, to.ID) != nil {
+				continue
+			}
+			dst, ok := spokeAddress(to)
+			if !ok {
+				continue
+			}
+
+			var missing []string
+			for _, subnet := range from.Subnets {
+				if strings.EqualFold(subnet.Name, "GatewaySubnet") {
+					continue
+				}
+				route, found := router.Lookup(subnet.ID, dst)
+				if !found || route.NextHopType != reach.NextHopVirtualAppliance {
+					missing = append(missing, subnet.Name)
+				}
+			}
+			if len(missing) == 0 {
+				continue
+			}
+
+			issues = append(issues, PeeringIssue{
+				RuleID:        RuleSpokeTransit,
+				VNet:          from.Name,
+				VNetID:        from.ID,
+				ResourceGroup: from.ResourceGroup,
+				Peering:       to.Name,
+				Issue: fmt.Sprintf("Subnets %s have no route through an appliance to spoke %s (%s) via hub %s",
+					strings.Join(missing, ", "), to.Name, strings.Join(to.AddressSpaces, ", "), hub.Name),
+			})
+		}
+	}
+	return issues
+}
+
+// spokeAddress returns an address inside a spoke to look up routes for:
+// the first subnet's network address, or the address space's
+func spokeAddress(vnet *models.VNet) (netip.Addr, bool) {
+	for _, subnet := range vnet.Subnets {
+		if prefix, err := netip.ParsePrefix(subnet.AddressPrefix); err == nil {
+			return prefix.Masked().Addr(), true
+		}
+	}
+	for _, space := range vnet.AddressSpaces {
+		if prefix, err := netip.ParsePrefix(space); err == nil {
+			return prefix.Masked().Addr(), true
+		}
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/automationpi/azdocs/pkg/normalize"
+)
+
+// analyzePeeringFixture runs the peering checks on recorded Resource Graph
+// rows in testdata
+func analyzePeeringFixture(t *testing.T, name string) *SecurityAnalysis {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var resources []map[string]interface{}
+	if err := json.Unmarshal(data, &resources); err != nil {
+		t.Fatalf("failed to parse fixture: %v", err)
+	}
+
+	a := &SecurityAnalysis{}
+	a.analyzePeering(normalize.Normalize(resources))
+	return a
+}
+
+func TestDetectTopology(t *testing.T) {
+	a := analyzePeeringFixture(t, "peering.json")
+
+	wantHubs := []Hub{
+		{Name: "vnet-gateway", Spokes: []string{"vnet-spoke-d"}},
+		{Name: "vnet-hub", Spokes: []string{"vnet-spoke-a", "vnet-spoke-b"}},
+		{Name: "vnet-transit", Spokes: []string{"vnet-spoke-c"}},
+	}
+	var hubs []Hub
+	for _, hub := range a.Topology.Hubs {
+		hubs = append(hubs, Hub{Name: hub.Name, Spokes: hub.Spokes})
+	}
+	if !reflect.DeepEqual(hubs, wantHubs) {
+		t.Errorf("hubs = %+v, want %+v", hubs, wantHubs)
+	}
+
+	// vnet-stale only has a peering that is not connected
+	if want := []string{"vnet-orphan", "vnet-stale"}; !reflect.DeepEqual(a.Topology.Orphans, want) {
+		t.Errorf("orphans = %v, want %v", a.Topology.Orphans, want)
+	}
+	if len(a.Topology.Other) != 0 {
+		t.Errorf("other = %v, want none", a.Topology.Other)
+	}
+}
+
+func TestSpokeTransitUsesDetectedHub(t *testing.T) {
+	a := analyzePeeringFixture(t, "peering.json")
+
+	type pair struct{ from, to string }
+	var got []pair
+	for _, issue := range a.PeeringIssues {
+		if issue.RuleID == RuleSpokeTransit {
+			got = append(got, pair{issue.VNet, issue.Peering})
+		}
+	}
+	want := []pair{{"vnet-spoke-a", "vnet-spoke-b"}, {"vnet-spoke-b", "vnet-spoke-a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("spoke transit issues = %v, want %v", got, want)
+	}
+}
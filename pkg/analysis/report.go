@@ -0,0 +1,355 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Analysis names used in reports and gates
+const (
+	AnalysisSecurity   = "Security"
+	AnalysisCost       = "Cost"
+	AnalysisTagging    = "Tagging"
+	AnalysisCompliance = "Compliance"
+)
+
+// Analyses lists the analysis names in report order
+var Analyses = []string{AnalysisSecurity, AnalysisCost, AnalysisTagging, AnalysisCompliance}
+
+// severityRanks orders severities from least to most severe
+var severityRanks = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// Report bundles every analysis over one set of resources
+type Report struct {
+	Security   *SecurityAnalysis
+	Cost       *CostAnalysis
+	Tagging    *TaggingAnalysis
+	Compliance *ComplianceAnalysis
+
+	// CustomRules are rules added with Add, in addition to the built-in Rules
+	CustomRules []Rule
+
+	options Options
+}
+
+// Finding is a flattened view of a security, cost, tagging or compliance
+// finding, used for gating and export
+type Finding struct {
+	RuleID      string   `json:"ruleId"`
+	Fingerprint string   `json:"fingerprint"`
+	Analysis    string   `json:"analysis"`
+	Severity    string   `json:"severity"`
+	Category    string   `json:"category"`
+	Resources   []string `json:"resources"`
+	ResourceIDs []string `json:"resourceIds"`
+	Detail      string   `json:"detail,omitempty"`
+	Issue       string   `json:"issue"`
+	Impact      string   `json:"impact,omitempty"`
+	Remediation string   `json:"remediation,omitempty"`
+	// Hygiene marks security findings about network hygiene, which do not
+	// count towards the security score or the severity gate
+	Hygiene bool `json:"hygiene,omitempty"`
+}
+
+// Analyze runs all analyses over the resources
+func Analyze(resources []map[string]interface{}, opts Options) *Report {
+	return &Report{
+		Security:   AnalyzeSecurity(resources, opts),
+		Cost:       AnalyzeCost(resources, opts),
+		Tagging:    AnalyzeTagging(resources, nil, opts.TaggingPolicy),
+		Compliance: AnalyzeCompliance(resources),
+		options:    opts,
+	}
+}
+
+// AnalyzeResourceGroups adds the checks that need the resource groups of
+// the subscription: empty resource groups, and tags inherited from resource
+// groups by the tagging policy. Call it before adding custom rules.
+func (r *Report) AnalyzeResourceGroups(groups, resources []map[string]interface{}) {
+	r.Cost.AnalyzeResourceGroups(groups, resources)
+	if r.options.TaggingPolicy.Inherit {
+		r.Tagging = AnalyzeTagging(resources, groups, r.options.TaggingPolicy)
+	}
+}
+
+// Scores returns the score of each analysis keyed by analysis name
+func (r *Report) Scores() map[string]int {
+	return map[string]int{
+		AnalysisSecurity:   r.Security.GetSecurityScore(),
+		AnalysisCost:       r.Cost.GetCostScore(),
+		AnalysisTagging:    r.Tagging.GetTaggingScore(),
+		AnalysisCompliance: r.Compliance.GetComplianceScore(),
+	}
+}
+
+// Rules returns the built-in rules followed by custom rules
+func (r *Report) Rules() []Rule {
+	rules := make([]Rule, 0, len(Rules)+len(r.CustomRules))
+	rules = append(rules, Rules...)
+	return append(rules, r.CustomRules...)
+}
+
+// Add registers a custom rule and adds its findings to the analysis named by
+// rule.Analysis, so they count towards that analysis' score
+func (r *Report) Add(rule Rule, findings []Finding) {
+	r.CustomRules = append(r.CustomRules, rule)
+
+	for _, f := range findings {
+		switch rule.Analysis {
+		case AnalysisCost:
+			finding := CostFinding{
+				RuleID:      rule.ID,
+				Severity:    f.Severity,
+				Category:    f.Category,
+				Resource:    first(f.Resources),
+				ResourceID:  first(f.ResourceIDs),
+				Detail:      f.Detail,
+				Issue:       f.Issue,
+				Remediation: f.Remediation,
+			}
+			if r.options.CostExport != nil {
+				actualFindingCost(r.options.CostExport, &finding)
+			}
+			r.Cost.Findings = append(r.Cost.Findings, finding)
+		case AnalysisTagging:
+			for _, f := range perResource(f) {
+				r.Tagging.Findings = append(r.Tagging.Findings, TagFinding{
+					RuleID:      rule.ID,
+					Severity:    f.Severity,
+					Category:    f.Category,
+					Resources:   f.Resources,
+					ResourceIDs: f.ResourceIDs,
+					Detail:      f.Detail,
+					Issue:       f.Issue,
+					Impact:      f.Impact,
+					Remediation: f.Remediation,
+				})
+			}
+		case AnalysisCompliance:
+			for _, f := range perResource(f) {
+				r.Compliance.Findings = append(r.Compliance.Findings, ComplianceFinding{
+					RuleID:      rule.ID,
+					Category:    f.Category,
+					Severity:    f.Severity,
+					Resources:   f.Resources,
+					ResourceIDs: f.ResourceIDs,
+					Detail:      f.Detail,
+					Issue:       f.Issue,
+					Impact:      f.Impact,
+					Remediation: f.Remediation,
+				})
+			}
+		default:
+			r.Security.Findings = append(r.Security.Findings, SecurityFinding{
+				RuleID:      rule.ID,
+				Severity:    f.Severity,
+				Category:    f.Category,
+				Resource:    first(f.Resources),
+				ResourceID:  first(f.ResourceIDs),
+				Detail:      f.Detail,
+				Issue:       f.Issue,
+				Impact:      f.Impact,
+				Remediation: f.Remediation,
+			})
+		}
+	}
+
+	r.Security.countBySeverity()
+	r.Cost.sumSavings()
+}
+
+// perResource splits a finding about several resources into one finding per
+// resource, so each can be waived on its own
+func perResource(f Finding) []Finding {
+	if len(f.ResourceIDs) < 2 {
+		return []Finding{f}
+	}
+	findings := make([]Finding, len(f.ResourceIDs))
+	for i, id := range f.ResourceIDs {
+		findings[i] = f
+		findings[i].ResourceIDs = []string{id}
+		findings[i].Resources = nil
+		if i < len(f.Resources) {
+			findings[i].Resources = []string{f.Resources[i]}
+		}
+	}
+	return findings
+}
+
+// first returns the first element of a list, or ""
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Findings returns all findings in analysis order
+func (r *Report) Findings() []Finding {
+	var findings []Finding
+
+	for _, f := range r.Security.Findings {
+		findings = append(findings, securityFinding(f))
+	}
+	for _, f := range r.Cost.Findings {
+		findings = append(findings, costFinding(f))
+	}
+	for _, f := range r.Tagging.Findings {
+		findings = append(findings, tagFinding(f))
+	}
+	for _, f := range r.Compliance.Findings {
+		findings = append(findings, complianceFinding(f))
+	}
+
+	return findings
+}
+
+// Filter removes the findings for which drop returns true from every
+// analysis, so they no longer count towards scores, and returns them
+func (r *Report) Filter(drop func(Finding) bool) []Finding {
+	var removed []Finding
+
+	security := r.Security.Findings[:0]
+	for _, f := range r.Security.Findings {
+		if finding := securityFinding(f); drop(finding) {
+			removed = append(removed, finding)
+		} else {
+			security = append(security, f)
+		}
+	}
+	r.Security.Findings = security
+	r.Security.countBySeverity()
+
+	cost := r.Cost.Findings[:0]
+	for _, f := range r.Cost.Findings {
+		if finding := costFinding(f); drop(finding) {
+			removed = append(removed, finding)
+		} else {
+			cost = append(cost, f)
+		}
+	}
+	r.Cost.Findings = cost
+	r.Cost.sumSavings()
+
+	tagging := r.Tagging.Findings[:0]
+	for _, f := range r.Tagging.Findings {
+		if finding := tagFinding(f); drop(finding) {
+			removed = append(removed, finding)
+		} else {
+			tagging = append(tagging, f)
+		}
+	}
+	r.Tagging.Findings = tagging
+
+	compliance := r.Compliance.Findings[:0]
+	for _, f := range r.Compliance.Findings {
+		if finding := complianceFinding(f); drop(finding) {
+			removed = append(removed, finding)
+		} else {
+			compliance = append(compliance, f)
+		}
+	}
+	r.Compliance.Findings = compliance
+
+	return removed
+}
+
+func securityFinding(f SecurityFinding) Finding {
+	ids := []string{f.ResourceID}
+	return Finding{
+		RuleID:      f.RuleID,
+		Fingerprint: Fingerprint(f.RuleID, ids, f.Detail),
+		Analysis:    AnalysisSecurity,
+		Severity:    f.Severity,
+		Category:    f.Category,
+		Resources:   []string{f.Resource},
+		ResourceIDs: ids,
+		Detail:      f.Detail,
+		Issue:       f.Issue,
+		Impact:      f.Impact,
+		Remediation: f.Remediation,
+		Hygiene:     f.Hygiene(),
+	}
+}
+
+func costFinding(f CostFinding) Finding {
+	ids := []string{f.ResourceID}
+	return Finding{
+		RuleID:      f.RuleID,
+		Fingerprint: Fingerprint(f.RuleID, ids, f.Detail),
+		Analysis:    AnalysisCost,
+		Severity:    f.Severity,
+		Category:    f.Category,
+		Resources:   []string{f.Resource},
+		ResourceIDs: ids,
+		Detail:      f.Detail,
+		Issue:       f.Issue,
+		Impact:      fmt.Sprintf("Potential savings $%.2f/month", f.PotentialSavings),
+		Remediation: f.Remediation,
+	}
+}
+
+func tagFinding(f TagFinding) Finding {
+	return Finding{
+		RuleID:      f.RuleID,
+		Fingerprint: Fingerprint(f.RuleID, f.ResourceIDs, f.Detail),
+		Analysis:    AnalysisTagging,
+		Severity:    f.Severity,
+		Category:    f.Category,
+		Resources:   f.Resources,
+		ResourceIDs: f.ResourceIDs,
+		Detail:      f.Detail,
+		Issue:       f.Issue,
+		Impact:      f.Impact,
+		Remediation: f.Remediation,
+	}
+}
+
+func complianceFinding(f ComplianceFinding) Finding {
+	return Finding{
+		RuleID:      f.RuleID,
+		Fingerprint: Fingerprint(f.RuleID, f.ResourceIDs, f.Detail),
+		Analysis:    AnalysisCompliance,
+		Severity:    f.Severity,
+		Category:    f.Category,
+		Resources:   f.Resources,
+		ResourceIDs: f.ResourceIDs,
+		Detail:      f.Detail,
+		Issue:       f.Issue,
+		Impact:      f.Impact,
+		Remediation: f.Remediation,
+	}
+}
+
+// Fingerprint returns a deterministic identifier for a finding from its rule
+// ID, affected resource IDs (order and case insensitive) and a detail such
+// as the NSG rule name
+func Fingerprint(ruleID string, resourceIDs []string, detail string) string {
+	ids := make([]string, len(resourceIDs))
+	for i, id := range resourceIDs {
+		ids[i] = strings.ToLower(id)
+	}
+	sort.Strings(ids)
+
+	sum := sha256.Sum256([]byte(ruleID + "\n" + strings.Join(ids, "\n") + "\n" + strings.ToLower(detail)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SeverityRank returns 1 (Low) to 4 (Critical), or 0 for an unknown severity
+func SeverityRank(severity string) int {
+	return severityRanks[strings.ToLower(severity)]
+}
+
+// AtOrAbove reports whether severity is at least as severe as threshold
+func AtOrAbove(severity, threshold string) bool {
+	rank := SeverityRank(severity)
+	return rank > 0 && rank >= SeverityRank(threshold)
+}
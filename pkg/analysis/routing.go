@@ -0,0 +1,371 @@
+package analysis
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/reach"
+)
+
+// RouteIssue is a problem with a route table or one of its routes
+type RouteIssue struct {
+	RuleID        string // AZSEC012 black hole ... AZSEC016 asymmetric routing
+	RouteTable    string
+	RouteTableID  string
+	ResourceGroup string
+	Route         string // empty for issues with the whole table
+	Issue         string
+}
+
+// routeTarget is an in-use subnet that routes may cover
+type routeTarget struct {
+	vnet   *models.VNet
+	subnet *models.Subnet
+	prefix netip.Prefix
+	users  int // NICs, private endpoints and other IP consumers
+}
+
+// appliance is a next hop address able to forward traffic
+type appliance struct {
+	name       string
+	forwarding bool // false for NICs with IP forwarding disabled
+	subnetID   string
+}
+
+// analyzeRouting finds routes that drop in-use traffic, next hops that
+// cannot forward, conflicting routes, unattached route tables and spokes
+// whose traffic returns around the firewall it was sent through
+func (a *SecurityAnalysis) analyzeRouting(inv *models.Inventory) {
+	targets := routeTargets(inv)
+	hops := appliances(inv)
+	router := reach.NewRouter(inv)
+
+	for _, table := range inv.RouteTables {
+		var issues []RouteIssue
+		add := func(ruleID, route, issue string) {
+			issues = append(issues, RouteIssue{
+				RuleID:        ruleID,
+				RouteTable:    table.Name,
+				RouteTableID:  table.ID,
+				ResourceGroup: table.ResourceGroup,
+				Route:         route,
+				Issue:         issue,
+			})
+		}
+
+		if len(table.Subnets) == 0 {
+			add(RuleRouteTableUnattached, "", "Route table is not associated with any subnet")
+		}
+
+		for i, route := range table.Routes {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(route.AddressPrefix))
+			if err != nil {
+				continue
+			}
+			prefix = prefix.Masked()
+
+			switch {
+			case strings.EqualFold(route.NextHopType, reach.NextHopNone) && len(table.Subnets) > 0:
+				if covered := coveredTargets(table, route, prefix, targets, router); len(covered) > 0 {
+					add(RuleRouteBlackHole, route.Name, fmt.Sprintf("Drops traffic to subnets in use: %s", strings.Join(covered, ", ")))
+				}
+			case strings.EqualFold(route.NextHopType, reach.NextHopVirtualAppliance):
+				if issue := nextHopIssue(route.NextHopIPAddress, hops); issue != "" {
+					add(RuleRouteInvalidNextHop, route.Name, issue)
+				}
+			}
+
+			for _, other := range table.Routes[:i] {
+				if issue := routeConflict(route, other); issue != "" {
+					add(RuleRouteConflict, route.Name, issue)
+				}
+			}
+		}
+
+		for _, issue := range asymmetricRoutes(table, inv, router, hops) {
+			add(RuleAsymmetricRouting, issue.route, issue.text)
+		}
+
+		a.RouteIssues = append(a.RouteIssues, issues...)
+		a.addRouteFindings(issues)
+	}
+}
+
+// addRouteFindings reports route issues as findings
+func (a *SecurityAnalysis) addRouteFindings(issues []RouteIssue) {
+	for _, issue := range issues {
+		severity := "Medium"
+		impact := ""
+		remediation := ""
+		switch issue.RuleID {
+		case RuleRouteBlackHole:
+			severity = "High"
+			impact = "Subnets using the route table cannot reach workloads in the dropped range"
+			remediation = fmt.Sprintf("Remove route '%s' or narrow its prefix so it no longer covers subnets in use", issue.Route)
+		case RuleRouteInvalidNextHop:
+			severity = "High"
+			impact = "Traffic sent to a next hop that does not exist or does not forward is dropped"
+			remediation = fmt.Sprintf("Point route '%s' at the appliance's current IP and enable IP forwarding on its NIC", issue.Route)
+		case RuleRouteConflict:
+			impact = "Overlapping routes make the effective path depend on route order and prefix length rather than intent"
+			remediation = fmt.Sprintf("Remove or re-scope route '%s' so each range has one intended next hop", issue.Route)
+		case RuleRouteTableUnattached:
+			severity = "Low"
+			impact = "Unused route tables add review overhead and may be mistaken for active routing"
+			remediation = "Associate the route table with a subnet or delete it"
+		case RuleAsymmetricRouting:
+			impact = "Stateful firewalls drop flows they only see in one direction, and return traffic bypasses inspection"
+			remediation = "Add a route on the returning subnet sending the spoke range to the same appliance, or stop routing the spoke's traffic through it"
+		}
+
+		// A route may have several issues of one rule, e.g. conflicts with
+		// two other routes, so the issue text distinguishes them
+		detail := ""
+		subject := issue.Issue
+		if issue.Route != "" {
+			detail = issue.Route + ": " + issue.Issue
+			subject = fmt.Sprintf("Route '%s': %s", issue.Route, issue.Issue)
+		}
+
+		a.Findings = append(a.Findings, SecurityFinding{
+			RuleID:      issue.RuleID,
+			Severity:    severity,
+			Category:    "Routing",
+			Resource:    issue.RouteTable,
+			ResourceID:  issue.RouteTableID,
+			Detail:      detail,
+			Issue:       subject,
+			Impact:      impact,
+			Remediation: remediation,
+		})
+	}
+}
+
+// routeTargets returns subnets with at least one IP in use
+func routeTargets(inv *models.Inventory) []routeTarget {
+	users := make(map[string]int)
+	count := func(subnetID string) {
+		if subnetID != "" {
+			users[strings.ToLower(subnetID)]++
+		}
+	}
+	for _, nic := range inv.NICs {
+		for _, config := range nic.IPConfigurations {
+			count(config.SubnetID)
+		}
+	}
+	for _, pe := range inv.PrivateEndpoints {
+		// Private endpoint NICs are already counted
+		if pe.PrivateIP == "" {
+			count(pe.SubnetID)
+		}
+	}
+	for _, lb := range inv.LoadBalancers {
+		for _, frontend := range lb.FrontendIPs {
+			count(frontend.SubnetID)
+		}
+	}
+	for _, gw := range inv.Gateways {
+		count(gw.SubnetID)
+	}
+	for _, fw := range inv.Firewalls {
+		count(fw.SubnetID)
+	}
+
+	var targets []routeTarget
+	for i := range inv.VNets {
+		vnet := &inv.VNets[i]
+		for j := range vnet.Subnets {
+			subnet := &vnet.Subnets[j]
+			prefix, err := netip.ParsePrefix(subnet.AddressPrefix)
+			if err != nil || users[strings.ToLower(subnet.ID)] == 0 {
+				continue
+			}
+			targets = append(targets, routeTarget{vnet: vnet, subnet: subnet, prefix: prefix.Masked(), users: users[strings.ToLower(subnet.ID)]})
+		}
+	}
+	return targets
+}
+
+// coveredTargets lists in-use subnets whose traffic from the table's
+// subnets is dropped by a None route. A subnet the route overlaps is only
+// covered when longest-prefix match selects the route, so VnetLocal and
+// peering routes more specific than it still deliver.
+func coveredTargets(table models.RouteTable, route models.Route, prefix netip.Prefix, targets []routeTarget, router *reach.Router) []string {
+	var covered []string
+	for _, target := range targets {
+		if !prefix.Overlaps(target.prefix) {
+			continue
+		}
+		// The first address both prefixes contain
+		dst := target.prefix.Addr()
+		if !prefix.Contains(dst) {
+			dst = prefix.Addr()
+		}
+		for _, subnetID := range table.Subnets {
+			selected, ok := router.Lookup(subnetID, dst)
+			if ok && selected.Source == reach.SourceUser && selected.Table == table.Name && selected.Name == route.Name {
+				covered = append(covered, fmt.Sprintf("%s/%s (%s, %d IPs)", target.vnet.Name, target.subnet.Name, target.prefix, target.users))
+				break
+			}
+		}
+	}
+	return covered
+}
+
+// appliances indexes the private IPs that can be route next hops: NICs,
+// Azure Firewalls and internal load balancer frontends
+func appliances(inv *models.Inventory) map[netip.Addr]appliance {
+	result := make(map[netip.Addr]appliance)
+	add := func(ip string, a appliance) {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(ip)); err == nil {
+			result[addr.Unmap()] = a
+		}
+	}
+	for _, nic := range inv.NICs {
+		for _, config := range nic.IPConfigurations {
+			add(config.PrivateIP, appliance{name: "NIC " + nic.Name, forwarding: nic.EnableIPForwarding, subnetID: config.SubnetID})
+		}
+	}
+	for _, lb := range inv.LoadBalancers {
+		for _, frontend := range lb.FrontendIPs {
+			add(frontend.PrivateIP, appliance{name: "load balancer " + lb.Name, forwarding: true, subnetID: frontend.SubnetID})
+		}
+	}
+	for _, fw := range inv.Firewalls {
+		add(fw.PrivateIP, appliance{name: "firewall " + fw.Name, forwarding: true, subnetID: fw.SubnetID})
+	}
+	return result
+}
+
+// nextHopIssue explains why a virtual appliance next hop cannot forward, or
+// returns ""
+func nextHopIssue(ip string, appliances map[netip.Addr]appliance) string {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return fmt.Sprintf("Next hop IP %q is not a valid address", ip)
+	}
+	a, ok := appliances[addr.Unmap()]
+	switch {
+	case !ok:
+		return fmt.Sprintf("Next hop %s does not belong to any NIC, firewall or load balancer in the scanned data", ip)
+	case !a.forwarding:
+		return fmt.Sprintf("Next hop %s is %s, which has IP forwarding disabled", ip, a.name)
+	}
+	return ""
+}
+
+// routeConflict describes two routes of one table that overlap with
+// different next hops, or returns "". Identical prefixes conflict outright;
+// a more specific route conflicts when it sends part of an appliance's range
+// straight to the Internet or drops it.
+func routeConflict(route, other models.Route) string {
+	p1, err1 := netip.ParsePrefix(strings.TrimSpace(route.AddressPrefix))
+	p2, err2 := netip.ParsePrefix(strings.TrimSpace(other.AddressPrefix))
+	if err1 != nil || err2 != nil || !p1.Overlaps(p2) {
+		return ""
+	}
+	p1, p2 = p1.Masked(), p2.Masked()
+	if strings.EqualFold(route.NextHopType, other.NextHopType) && route.NextHopIPAddress == other.NextHopIPAddress {
+		return ""
+	}
+
+	if p1 == p2 {
+		return fmt.Sprintf("Same prefix %s as route '%s' with a different next hop (%s vs %s)", p1, other.Name, describeNextHop(route), describeNextHop(other))
+	}
+
+	specific, broad := route, other
+	if p1.Bits() < p2.Bits() {
+		specific, broad = other, route
+	}
+	if strings.EqualFold(broad.NextHopType, reach.NextHopVirtualAppliance) && strings.EqualFold(specific.NextHopType, reach.NextHopInternet) {
+		return fmt.Sprintf("Route '%s' (%s) sends part of the range that route '%s' (%s) sends to %s directly to the Internet, bypassing the appliance",
+			specific.Name, specific.AddressPrefix, broad.Name, broad.AddressPrefix, broad.NextHopIPAddress)
+	}
+	return ""
+}
+
+// describeNextHop formats a route's next hop, e.g. "VirtualAppliance 10.0.1.4"
+func describeNextHop(route models.Route) string {
+	if route.NextHopIPAddress != "" {
+		return route.NextHopType + " " + route.NextHopIPAddress
+	}
+	return route.NextHopType
+}
+
+// asymmetricIssue is a path through an appliance whose return bypasses it
+type asymmetricIssue struct {
+	route string
+	text  string
+}
+
+// asymmetricRoutes finds subnets that send traffic for another VNet's
+// subnets through an appliance while those subnets return it directly
+func asymmetricRoutes(table models.RouteTable, inv *models.Inventory, router *reach.Router, appliances map[netip.Addr]appliance) []asymmetricIssue {
+	subnets := make(map[string]routeTarget)
+	for i := range inv.VNets {
+		vnet := &inv.VNets[i]
+		for j := range vnet.Subnets {
+			subnet := &vnet.Subnets[j]
+			if prefix, err := netip.ParsePrefix(subnet.AddressPrefix); err == nil {
+				subnets[strings.ToLower(subnet.ID)] = routeTarget{vnet: vnet, subnet: subnet, prefix: prefix.Masked()}
+			}
+		}
+	}
+
+	var issues []asymmetricIssue
+	for _, sourceID := range table.Subnets {
+		source, ok := subnets[strings.ToLower(sourceID)]
+		if !ok {
+			continue
+		}
+
+		for _, destination := range sortedTargets(subnets) {
+			if destination.vnet == source.vnet || strings.EqualFold(destination.subnet.Name, "GatewaySubnet") {
+				continue
+			}
+			forward, ok := router.Lookup(source.subnet.ID, destination.prefix.Addr())
+			if !ok || forward.Source != reach.SourceUser || forward.NextHopType != reach.NextHopVirtualAppliance {
+				continue
+			}
+			hop, err := netip.ParseAddr(forward.NextHopIP)
+			if err != nil {
+				continue
+			}
+			// Traffic delivered to the appliance's own subnet is not returned
+			// through it
+			if a, ok := appliances[hop.Unmap()]; !ok || strings.EqualFold(a.subnetID, destination.subnet.ID) {
+				continue
+			}
+
+			back, ok := router.Lookup(destination.subnet.ID, source.prefix.Addr())
+			if !ok || back.NextHopType == reach.NextHopVirtualAppliance && back.NextHopIP == forward.NextHopIP {
+				continue
+			}
+
+			issues = append(issues, asymmetricIssue{
+				route: forward.Name,
+				text: fmt.Sprintf("Traffic from %s/%s to %s/%s goes through %s, but the return path uses %s",
+					source.vnet.Name, source.subnet.Name, destination.vnet.Name, destination.subnet.Name, forward.NextHopIP, back),
+			})
+		}
+	}
+	return issues
+}
+
+// sortedTargets returns subnets in a deterministic order
+func sortedTargets(subnets map[string]routeTarget) []routeTarget {
+	ids := make([]string, 0, len(subnets))
+	for id := range subnets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	targets := make([]routeTarget, len(ids))
+	for i, id := range ids {
+		targets[i] = subnets[id]
+	}
+	return targets
+}
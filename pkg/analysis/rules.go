@@ -0,0 +1,116 @@
+package analysis
+
+// Rule describes a check performed by an analysis. Rule IDs are stable
+// across releases so exported findings can be tracked over time.
+type Rule struct {
+	ID          string
+	Name        string
+	Analysis    string
+	Description string
+}
+
+// Rule IDs
+const (
+	RuleNSGInternetInbound    = "AZSEC001"
+	RuleNSGInternetRiskyPort  = "AZSEC002"
+	RuleVMPublicExposure      = "AZSEC003"
+	RuleStorageEncryption     = "AZSEC004"
+	RuleStorageEncryptionSvcs = "AZSEC005"
+	RuleDiskEncryption        = "AZSEC006"
+	RuleStoragePublicNetwork  = "AZSEC007"
+	RuleNSGShadowedRule       = "AZSEC008"
+	RuleNSGDuplicateRule      = "AZSEC009"
+	RuleNSGMissingASG         = "AZSEC010"
+	RuleNSGUnattached         = "AZSEC011"
+	RuleRouteBlackHole        = "AZSEC012"
+	RuleRouteInvalidNextHop   = "AZSEC013"
+	RuleRouteConflict         = "AZSEC014"
+	RuleRouteTableUnattached  = "AZSEC015"
+	RuleAsymmetricRouting     = "AZSEC016"
+	RuleAddressSpaceOverlap   = "AZSEC017"
+	RuleSubnetExhaustion      = "AZSEC018"
+	RulePeeringNotConnected   = "AZSEC019"
+	RulePeeringMissingReverse = "AZSEC020"
+	RuleSpokeTransit          = "AZSEC021"
+	RuleRemoteGatewayMissing  = "AZSEC022"
+
+	RuleOrphanedDisk         = "AZCOST001"
+	RuleOrphanedPublicIP     = "AZCOST002"
+	RuleIdleVM               = "AZCOST003"
+	RuleOversizedVM          = "AZCOST004"
+	RuleStorageHotTier       = "AZCOST005"
+	RuleDeallocatedVMDisks   = "AZCOST006"
+	RuleOrphanedNIC          = "AZCOST007"
+	RuleEmptyAvailabilitySet = "AZCOST008"
+	RuleUnusedAppServicePlan = "AZCOST009"
+	RuleStaleSnapshot        = "AZCOST010"
+	RuleEmptyResourceGroup   = "AZCOST011"
+
+	RuleMissingTag          = "AZTAG001"
+	RuleInconsistentTagKey  = "AZTAG002"
+	RuleInconsistentEnvTags = "AZTAG003"
+	RuleInvalidTagValue     = "AZTAG004"
+	RuleTagValueCase        = "AZTAG005"
+
+	RuleVMBackup         = "AZCMP001"
+	RuleDiagnostics      = "AZCMP002"
+	RuleStorageRedundant = "AZCMP003"
+)
+
+// Rules is the catalog of built-in rules in report order
+var Rules = []Rule{
+	{RuleNSGInternetInbound, "NSGInternetInbound", AnalysisSecurity, "NSG rule allows inbound traffic from the Internet"},
+	{RuleNSGInternetRiskyPort, "NSGInternetRiskyPort", AnalysisSecurity, "NSG rule allows a management or database port from the Internet"},
+	{RuleVMPublicExposure, "VMPublicExposure", AnalysisSecurity, "Virtual machine is reachable from the Internet through its subnet and NIC NSGs"},
+	{RuleStorageEncryption, "StorageEncryptionUnknown", AnalysisSecurity, "Storage account encryption settings are missing"},
+	{RuleStorageEncryptionSvcs, "StorageEncryptionServices", AnalysisSecurity, "Storage account encryption services are not configured"},
+	{RuleDiskEncryption, "DiskEncryption", AnalysisSecurity, "Managed disk is not encrypted with customer-managed keys"},
+	{RuleStoragePublicNetwork, "StoragePublicNetworkAccess", AnalysisSecurity, "Storage account allows access from all networks"},
+	{RuleNSGShadowedRule, "NSGShadowedRule", AnalysisSecurity, "NSG rule is fully shadowed by higher-priority rules"},
+	{RuleNSGDuplicateRule, "NSGDuplicateRule", AnalysisSecurity, "NSG rule duplicates a higher-priority rule"},
+	{RuleNSGMissingASG, "NSGMissingASG", AnalysisSecurity, "NSG rule references an application security group that does not exist"},
+	{RuleNSGUnattached, "NSGUnattached", AnalysisSecurity, "NSG is not associated with any subnet or network interface"},
+	{RuleRouteBlackHole, "RouteBlackHole", AnalysisSecurity, "Route with next hop None drops traffic to subnets in use"},
+	{RuleRouteInvalidNextHop, "RouteInvalidNextHop", AnalysisSecurity, "Virtual appliance next hop is not a forwarding NIC, firewall or load balancer"},
+	{RuleRouteConflict, "RouteConflict", AnalysisSecurity, "UDR prefixes overlap with conflicting next hops"},
+	{RuleRouteTableUnattached, "RouteTableUnattached", AnalysisSecurity, "Route table is not associated with any subnet"},
+	{RuleAsymmetricRouting, "AsymmetricRouting", AnalysisSecurity, "Traffic is routed through an appliance but returns around it"},
+	{RuleAddressSpaceOverlap, "AddressSpaceOverlap", AnalysisSecurity, "VNet address spaces overlap"},
+	{RuleSubnetExhaustion, "SubnetExhaustion", AnalysisSecurity, "Subnet utilization is above the threshold"},
+	{RulePeeringNotConnected, "PeeringNotConnected", AnalysisSecurity, "VNet peering is not in the Connected state"},
+	{RulePeeringMissingReverse, "PeeringMissingReverse", AnalysisSecurity, "VNet peering has no reverse peering on the remote VNet"},
+	{RuleSpokeTransit, "SpokeTransit", AnalysisSecurity, "Spokes of a hub have no route through an appliance to each other"},
+	{RuleRemoteGatewayMissing, "RemoteGatewayMissing", AnalysisSecurity, "Peering uses remote gateways the remote VNet does not provide"},
+
+	{RuleOrphanedDisk, "OrphanedDisk", AnalysisCost, "Managed disk is not attached to a VM"},
+	{RuleOrphanedPublicIP, "OrphanedPublicIP", AnalysisCost, "Public IP is not associated with a resource"},
+	{RuleIdleVM, "IdleVM", AnalysisCost, "Virtual machine is stopped but not deallocated"},
+	{RuleOversizedVM, "OversizedVM", AnalysisCost, "Virtual machine utilization is below the right-sizing thresholds"},
+	{RuleStorageHotTier, "StorageHotTier", AnalysisCost, "Storage account uses the Hot access tier"},
+	{RuleDeallocatedVMDisks, "DeallocatedVMDisks", AnalysisCost, "Disks of a deallocated virtual machine are still billed"},
+	{RuleOrphanedNIC, "OrphanedNIC", AnalysisCost, "Network interface is not attached to a VM"},
+	{RuleEmptyAvailabilitySet, "EmptyAvailabilitySet", AnalysisCost, "Availability set contains no VMs"},
+	{RuleUnusedAppServicePlan, "UnusedAppServicePlan", AnalysisCost, "App Service plan hosts no apps"},
+	{RuleStaleSnapshot, "StaleSnapshot", AnalysisCost, "Snapshot is older than the configured maximum age"},
+	{RuleEmptyResourceGroup, "EmptyResourceGroup", AnalysisCost, "Resource group contains no resources"},
+
+	{RuleMissingTag, "MissingRequiredTag", AnalysisTagging, "Resources are missing a required tag"},
+	{RuleInconsistentTagKey, "InconsistentTagKey", AnalysisTagging, "Tag key is spelled with different casing"},
+	{RuleInconsistentEnvTags, "InconsistentEnvironmentValues", AnalysisTagging, "Environment tag has too many distinct values"},
+	{RuleInvalidTagValue, "InvalidTagValue", AnalysisTagging, "Tag value is not allowed by the tagging policy"},
+	{RuleTagValueCase, "TagValueCase", AnalysisTagging, "Tag value does not follow the case policy"},
+
+	{RuleVMBackup, "VMBackup", AnalysisCompliance, "Virtual machines without Azure Backup"},
+	{RuleDiagnostics, "DiagnosticSettings", AnalysisCompliance, "Resources without diagnostic settings"},
+	{RuleStorageRedundant, "StorageGeoRedundancy", AnalysisCompliance, "Storage accounts using locally redundant storage"},
+}
+
+// LookupRule returns the catalog entry for a rule ID
+func LookupRule(id string) (Rule, bool) {
+	for _, rule := range Rules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
@@ -3,39 +3,73 @@ package analysis
 import (
 	"fmt"
 	"strings"
+
+	"github.com/automationpi/azdocs/pkg/ipam"
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/normalize"
+	"github.com/automationpi/azdocs/pkg/nsg"
 )
 
 // SecurityFinding represents a security issue
 type SecurityFinding struct {
+	RuleID      string   // Stable rule identifier, see Rules
 	Severity    string   // Critical, High, Medium, Low
 	Category    string   // NSG, PublicExposure, Encryption, etc.
 	Resource    string   // Resource name
+	ResourceID  string   // ARM resource ID
+	Detail      string   // Distinguishes findings of one rule on a resource, e.g. the NSG rule name
 	Issue       string   // What's the problem
 	Impact      string   // Why it matters
 	Remediation string   // How to fix it
 	References  []string // Related resources
 }
 
-// SecurityAnalysis contains all security findings
+// hygieneCategories are the categories of network hygiene and IP planning
+// findings: they are reported with the security findings but are not
+// security risks, so they do not count towards the security score
+var hygieneCategories = map[string]bool{
+	"NSGHygiene":    true,
+	"Routing":       true,
+	"IP Addressing": true,
+	"Peering":       true,
+}
+
+// Hygiene reports whether the finding is about network hygiene or IP planning
+// rather than a security risk
+func (f SecurityFinding) Hygiene() bool {
+	return hygieneCategories[f.Category]
+}
+
+// SecurityAnalysis contains all security findings. The severity counts and
+// the score leave out hygiene findings, which are counted in HygieneCount.
 type SecurityAnalysis struct {
 	CriticalCount int
 	HighCount     int
 	MediumCount   int
 	LowCount      int
+	HygieneCount  int
 	Findings      []SecurityFinding
+	NSGCleanup    []NSGCleanup // per-NSG clean-up candidates
+	RouteIssues   []RouteIssue
+	IPAM          *ipam.Analysis // subnet utilization and address space overlaps
+	PeeringIssues []PeeringIssue
+	Topology      Topology
 }
 
 // AnalyzeSecurity performs comprehensive security analysis
-func AnalyzeSecurity(resources []map[string]interface{}) *SecurityAnalysis {
+func AnalyzeSecurity(resources []map[string]interface{}, opts Options) *SecurityAnalysis {
 	analysis := &SecurityAnalysis{
 		Findings: []SecurityFinding{},
 	}
 
+	// The network passes share one normalized inventory
+	inv := normalize.Normalize(resources)
+
 	// Analyze NSG rules
-	analysis.analyzeNSGRules(resources)
+	analysis.analyzeNSGRules(inv)
 
 	// Analyze public exposure
-	analysis.analyzePublicExposure(resources)
+	analysis.analyzePublicExposure(inv)
 
 	// Analyze encryption
 	analysis.analyzeEncryption(resources)
@@ -43,123 +77,175 @@ func AnalyzeSecurity(resources []map[string]interface{}) *SecurityAnalysis {
 	// Analyze network isolation
 	analysis.analyzeNetworkIsolation(resources)
 
+	// Find shadowed, duplicate and broken NSG rules
+	analysis.analyzeNSGCleanup(inv)
+
+	// Find black holes, broken next hops and asymmetric routes
+	analysis.analyzeRouting(inv)
+
+	// Find overlapping address spaces and subnets running out of addresses
+	analysis.analyzeIPAM(inv, opts.UtilizationThreshold)
+
+	// Find broken peerings and summarize the hub-and-spoke topology
+	analysis.analyzePeering(inv)
+
 	// Count by severity
-	for _, finding := range analysis.Findings {
+	analysis.countBySeverity()
+
+	return analysis
+}
+
+// countBySeverity recomputes the severity counters from the findings
+func (a *SecurityAnalysis) countBySeverity() {
+	a.CriticalCount, a.HighCount, a.MediumCount, a.LowCount, a.HygieneCount = 0, 0, 0, 0, 0
+	for _, finding := range a.Findings {
+		if finding.Hygiene() {
+			a.HygieneCount++
+			continue
+		}
 		switch finding.Severity {
 		case "Critical":
-			analysis.CriticalCount++
+			a.CriticalCount++
 		case "High":
-			analysis.HighCount++
+			a.HighCount++
 		case "Medium":
-			analysis.MediumCount++
+			a.MediumCount++
 		case "Low":
-			analysis.LowCount++
+			a.LowCount++
 		}
 	}
-
-	return analysis
 }
 
-func (a *SecurityAnalysis) analyzeNSGRules(resources []map[string]interface{}) {
-	for _, res := range resources {
-		resType, _ := res["type"].(string)
-		if strings.ToLower(resType) != "microsoft.network/networksecuritygroups" {
-			continue
-		}
-
-		nsgName, _ := res["name"].(string)
-		props, ok := res["properties"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		securityRules, ok := props["securityRules"].([]interface{})
-		if !ok {
-			continue
-		}
+func (a *SecurityAnalysis) analyzeNSGRules(inv *models.Inventory) {
+	for _, m := range inv.NSGs {
+		group := nsg.New(m)
 
-		for _, ruleIface := range securityRules {
-			rule, ok := ruleIface.(map[string]interface{})
-			if !ok {
+		for _, exposure := range widestExposures(group.InboundExposure()) {
+			if exposure.Scope < nsg.ScopeAzureCloud {
 				continue
 			}
 
-			ruleProps, ok := rule["properties"].(map[string]interface{})
-			if !ok {
-				continue
+			from := exposure.Scope.String()
+			if exposure.Source.String() != from {
+				from = fmt.Sprintf("%s (%s)", from, exposure.Source)
 			}
 
-			// Check for overly permissive rules
-			direction, _ := ruleProps["direction"].(string)
-			access, _ := ruleProps["access"].(string)
-			sourcePrefix, _ := ruleProps["sourceAddressPrefix"].(string)
-			destPort, _ := ruleProps["destinationPortRange"].(string)
-			ruleName, _ := rule["name"].(string)
-
-			if direction == "Inbound" && access == "Allow" {
-				// Check for 0.0.0.0/0 or * or Internet
-				if sourcePrefix == "0.0.0.0/0" || sourcePrefix == "*" || sourcePrefix == "Internet" {
-					severity := "Medium"
-					issue := fmt.Sprintf("NSG rule '%s' allows inbound traffic from Internet (%s)", ruleName, sourcePrefix)
-
-					// Critical if dangerous ports are open
-					if isDangerousPort(destPort) {
-						severity = "Critical"
-						issue = fmt.Sprintf("NSG rule '%s' allows %s from Internet (port %s)", ruleName, destPort, destPort)
-					}
+			ruleID := RuleNSGInternetInbound
+			severity := "Medium"
+			if exposure.Scope == nsg.ScopeAzureCloud {
+				severity = "Low"
+			}
+			issue := fmt.Sprintf("NSG rule '%s' allows inbound %s from %s to %s",
+				exposure.Rule.Name, exposure, from, exposure.Destinations())
+			impact := "Resources may be exposed to attacks from the Internet"
+			if exposure.Scope == nsg.ScopeAzureCloud {
+				impact = "Resources are reachable from any Azure tenant's workloads, not just your own"
+			}
 
-					a.Findings = append(a.Findings, SecurityFinding{
-						Severity:    severity,
-						Category:    "NSG",
-						Resource:    nsgName,
-						Issue:       issue,
-						Impact:      "Resources may be exposed to attacks from the Internet",
-						Remediation: "Restrict source IP ranges to known trusted networks. Use Azure Bastion for management access.",
-					})
+			// Critical if management or database ports are reachable
+			if services := riskyServices(exposure.Ports); len(services) > 0 {
+				ruleID = RuleNSGInternetRiskyPort
+				severity = "Critical"
+				if exposure.Scope == nsg.ScopeAzureCloud {
+					severity = "High"
 				}
+				issue = fmt.Sprintf("NSG rule '%s' allows %s from %s to %s (%s)",
+					exposure.Rule.Name, strings.Join(services, ", "), from, exposure.Destinations(), exposure)
 			}
+
+			a.Findings = append(a.Findings, SecurityFinding{
+				RuleID:      ruleID,
+				Severity:    severity,
+				Category:    "NSG",
+				Resource:    group.Name,
+				ResourceID:  group.ID,
+				Detail:      exposure.Rule.Name,
+				Issue:       issue,
+				Impact:      impact,
+				Remediation: "Restrict source IP ranges to known trusted networks. Use Azure Bastion for management access.",
+			})
 		}
 	}
 }
 
-func (a *SecurityAnalysis) analyzePublicExposure(resources []map[string]interface{}) {
-	// Build map of public IPs
-	publicIPs := make(map[string]string) // resource ID -> public IP
-	for _, res := range resources {
-		resType, _ := res["type"].(string)
-		if strings.ToLower(resType) != "microsoft.network/publicipaddresses" {
+// widestExposures keeps, for each NSG rule, the exposure of its widest
+// source scope, merging the ports of sources with that scope
+func widestExposures(exposures []nsg.Exposure) []nsg.Exposure {
+	var result []nsg.Exposure
+	index := make(map[string]int)
+
+	for _, exposure := range exposures {
+		i, seen := index[exposure.Rule.Name]
+		if !seen {
+			index[exposure.Rule.Name] = len(result)
+			result = append(result, exposure)
 			continue
 		}
 
-		id, _ := res["id"].(string)
-		props, ok := res["properties"].(map[string]interface{})
-		if !ok {
-			continue
+		widest := &result[i]
+		switch {
+		case exposure.Scope > widest.Scope:
+			*widest = exposure
+		case exposure.Scope == widest.Scope:
+			ports := make(map[string]nsg.PortSet)
+			for protocol, set := range widest.Ports {
+				ports[protocol] = set
+			}
+			for protocol, set := range exposure.Ports {
+				ports[protocol] = ports[protocol].Union(set)
+			}
+			widest.Ports = ports
 		}
+	}
 
-		ipAddress, _ := props["ipAddress"].(string)
-		if ipAddress != "" {
-			publicIPs[id] = ipAddress
-		}
+	return result
+}
+
+func (a *SecurityAnalysis) analyzePublicExposure(inv *models.Inventory) {
+	// Combine subnet and NIC NSGs per IP configuration, one finding per VM
+	type exposure struct {
+		vmID    string
+		vmName  string
+		inbound map[string]nsg.PortSet
+		via     []string
 	}
+	var exposed []*exposure
+	byVM := make(map[string]*exposure)
 
-	// Check VMs with public IPs
-	for _, res := range resources {
-		resType, _ := res["type"].(string)
-		if strings.ToLower(resType) != "microsoft.compute/virtualmachines" {
+	for _, access := range nsg.EffectiveAccess(inv) {
+		if access.VMID == "" || !access.Reachable {
 			continue
 		}
 
-		vmName, _ := res["name"].(string)
+		key := strings.ToLower(access.VMID)
+		e, ok := byVM[key]
+		if !ok {
+			e = &exposure{vmID: access.VMID, vmName: access.VMName, inbound: map[string]nsg.PortSet{}}
+			byVM[key] = e
+			exposed = append(exposed, e)
+		}
+		for protocol, ports := range access.Inbound {
+			e.inbound[protocol] = e.inbound[protocol].Union(ports)
+		}
+		e.via = append(e.via, fmt.Sprintf("%s (%s): %s", access.NICName, access.PublicIP, access.Status))
+	}
+
+	for _, e := range exposed {
+		severity := "Medium"
+		issue := fmt.Sprintf("Virtual Machine is reachable from the Internet on %s", nsg.FormatPorts(e.inbound))
+		if services := riskyServices(e.inbound); len(services) > 0 {
+			severity = "High"
+			issue = fmt.Sprintf("Virtual Machine is reachable from the Internet on %s", strings.Join(services, ", "))
+		}
 
-		// Check if VM has public IP attached via NIC
-		// This would require checking NICs, for now flag all VMs with public exposure potential
 		a.Findings = append(a.Findings, SecurityFinding{
-			Severity:    "High",
+			RuleID:      RuleVMPublicExposure,
+			Severity:    severity,
 			Category:    "PublicExposure",
-			Resource:    vmName,
-			Issue:       "Virtual Machine may have public IP exposure",
-			Impact:      "Direct internet exposure increases attack surface",
+			Resource:    e.vmName,
+			ResourceID:  e.vmID,
+			Issue:       issue,
+			Impact:      fmt.Sprintf("Direct internet exposure increases attack surface (%s)", strings.Join(e.via, "; ")),
 			Remediation: "Use Azure Bastion for secure remote access instead of public IPs",
 		})
 	}
@@ -169,6 +255,7 @@ func (a *SecurityAnalysis) analyzeEncryption(resources []map[string]interface{})
 	for _, res := range resources {
 		resType, _ := res["type"].(string)
 		resName, _ := res["name"].(string)
+		resID, _ := res["id"].(string)
 
 		switch strings.ToLower(resType) {
 		case "microsoft.storage/storageaccounts":
@@ -180,9 +267,11 @@ func (a *SecurityAnalysis) analyzeEncryption(resources []map[string]interface{})
 			encryption, ok := props["encryption"].(map[string]interface{})
 			if !ok {
 				a.Findings = append(a.Findings, SecurityFinding{
+					RuleID:      RuleStorageEncryption,
 					Severity:    "Medium",
 					Category:    "Encryption",
 					Resource:    resName,
+					ResourceID:  resID,
 					Issue:       "Storage account encryption status unclear",
 					Impact:      "Data at rest may not be encrypted",
 					Remediation: "Enable storage account encryption with customer-managed keys",
@@ -193,9 +282,11 @@ func (a *SecurityAnalysis) analyzeEncryption(resources []map[string]interface{})
 			services, _ := encryption["services"].(map[string]interface{})
 			if services == nil {
 				a.Findings = append(a.Findings, SecurityFinding{
+					RuleID:      RuleStorageEncryptionSvcs,
 					Severity:    "Low",
 					Category:    "Encryption",
 					Resource:    resName,
+					ResourceID:  resID,
 					Issue:       "Storage encryption services not configured",
 					Impact:      "Some storage services may not be encrypted",
 					Remediation: "Enable encryption for Blob, File, Table, and Queue services",
@@ -211,9 +302,11 @@ func (a *SecurityAnalysis) analyzeEncryption(resources []map[string]interface{})
 			encryptionSettings, ok := props["encryptionSettingsCollection"].(map[string]interface{})
 			if !ok || encryptionSettings == nil {
 				a.Findings = append(a.Findings, SecurityFinding{
+					RuleID:      RuleDiskEncryption,
 					Severity:    "Low",
 					Category:    "Encryption",
 					Resource:    resName,
+					ResourceID:  resID,
 					Issue:       "Disk encryption not configured",
 					Impact:      "Disk data at rest is not encrypted with customer-managed keys",
 					Remediation: "Enable Azure Disk Encryption (ADE) or use encryption at host",
@@ -228,6 +321,7 @@ func (a *SecurityAnalysis) analyzeNetworkIsolation(resources []map[string]interf
 	for _, res := range resources {
 		resType, _ := res["type"].(string)
 		resName, _ := res["name"].(string)
+		resID, _ := res["id"].(string)
 
 		switch strings.ToLower(resType) {
 		case "microsoft.storage/storageaccounts":
@@ -242,9 +336,11 @@ func (a *SecurityAnalysis) analyzeNetworkIsolation(resources []map[string]interf
 				defaultAction, _ := networkAcls["defaultAction"].(string)
 				if defaultAction == "Allow" {
 					a.Findings = append(a.Findings, SecurityFinding{
+						RuleID:      RuleStoragePublicNetwork,
 						Severity:    "Medium",
 						Category:    "NetworkIsolation",
 						Resource:    resName,
+						ResourceID:  resID,
 						Issue:       "Storage account allows public network access",
 						Impact:      "Data can be accessed from any network",
 						Remediation: "Configure network ACLs to deny by default and use private endpoints",
@@ -255,22 +351,35 @@ func (a *SecurityAnalysis) analyzeNetworkIsolation(resources []map[string]interf
 	}
 }
 
-func isDangerousPort(portRange string) bool {
-	dangerousPorts := []string{"22", "3389", "1433", "3306", "5432", "27017", "6379"}
-	for _, port := range dangerousPorts {
-		if strings.Contains(portRange, port) {
-			return true
+// riskyPorts are management and database ports that should never be open to
+// the Internet
+var riskyPorts = []struct {
+	Port    int
+	Service string
+}{
+	{22, "SSH"},
+	{3389, "RDP"},
+	{1433, "SQL Server"},
+	{3306, "MySQL"},
+	{5432, "PostgreSQL"},
+	{27017, "MongoDB"},
+	{6379, "Redis"},
+}
+
+// riskyServices names the risky ports reachable in a per-protocol port map,
+// e.g. "SSH (22)"
+func riskyServices(ports map[string]nsg.PortSet) []string {
+	var services []string
+	for _, risky := range riskyPorts {
+		if nsg.Reaches(ports, risky.Port) {
+			services = append(services, fmt.Sprintf("%s (%d)", risky.Service, risky.Port))
 		}
 	}
-	return false
+	return services
 }
 
 // GetSecurityScore calculates overall security score (0-100)
 func (a *SecurityAnalysis) GetSecurityScore() int {
-	if len(a.Findings) == 0 {
-		return 100
-	}
-
 	// Weighted scoring: Critical=-20, High=-10, Medium=-5, Low=-2
 	score := 100
 	score -= a.CriticalCount * 20
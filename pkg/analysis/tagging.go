@@ -2,14 +2,18 @@ package analysis
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 // TagFinding represents a tagging issue
 type TagFinding struct {
+	RuleID      string   // Stable rule identifier, see Rules
 	Severity    string   // High, Medium, Low
 	Category    string   // Missing, Inconsistent, Invalid
 	Resources   []string // Affected resources
+	ResourceIDs []string // ARM IDs of affected resources
+	Detail      string   // Tag key the finding is about
 	Issue       string   // What's the problem
 	Impact      string   // Why it matters
 	Remediation string   // How to fix it
@@ -17,134 +21,114 @@ type TagFinding struct {
 
 // TaggingAnalysis contains tagging compliance findings
 type TaggingAnalysis struct {
-	TotalResources      int
-	TaggedResources     int
-	UntaggedResources   int
-	ComplianceRate      float64
-	Findings            []TagFinding
-	RequiredTags        []string
+	TotalResources          int
+	TaggedResources         int
+	UntaggedResources       int
+	CompliantResources      int // resources meeting every policy requirement
+	ExemptResources         int // resources exempt from the whole policy, not counted in TotalResources
+	ComplianceRate          float64
+	Findings                []TagFinding
+	RequiredTags            []string
 	TagValueInconsistencies map[string][]string // tag key -> list of different values
+	Policy                  TagPolicy
+	ResourceGroups          []TagGroupCompliance // by ascending compliance rate
 }
 
-// AnalyzeTagging performs tagging compliance analysis
-func AnalyzeTagging(resources []map[string]interface{}) *TaggingAnalysis {
+// AnalyzeTagging checks resources against a tagging policy. Tags of the
+// resource groups count for their resources when the policy inherits them.
+func AnalyzeTagging(resources, groups []map[string]interface{}, policy TagPolicy) *TaggingAnalysis {
 	analysis := &TaggingAnalysis{
-		TotalResources: len(resources),
-		RequiredTags:   []string{"environment", "owner", "cost-center", "application"},
+		RequiredTags:            policy.Required,
 		TagValueInconsistencies: make(map[string][]string),
-		Findings:       []TagFinding{},
+		Findings:                []TagFinding{},
+		Policy:                  policy,
 	}
 
-	// Analyze missing tags
-	analysis.analyzeMissingTags(resources)
+	// Check required tags and values
+	checked := analysis.analyzePolicy(resources, groups)
 
 	// Analyze tag consistency
-	analysis.analyzeTagConsistency(resources)
+	analysis.analyzeTagConsistency(checked)
 
 	// Analyze tag value patterns
-	analysis.analyzeTagValuePatterns(resources)
+	analysis.analyzeTagValuePatterns(checked)
 
 	// Calculate compliance rate
 	if analysis.TotalResources > 0 {
-		analysis.ComplianceRate = (float64(analysis.TaggedResources) / float64(analysis.TotalResources)) * 100
+		analysis.ComplianceRate = (float64(analysis.CompliantResources) / float64(analysis.TotalResources)) * 100
 	}
 
 	return analysis
 }
 
-func (a *TaggingAnalysis) analyzeMissingTags(resources []map[string]interface{}) {
-	missingByTag := make(map[string][]string) // tag name -> list of resources missing it
+func (a *TaggingAnalysis) analyzeTagConsistency(resources []map[string]interface{}) {
+	// Collect all spellings of tag keys and the resources using them
+	tagKeyVariations := make(map[string]map[string][]map[string]interface{}) // normalized key -> {actual key -> resources}
 
 	for _, res := range resources {
-		name, _ := res["name"].(string)
-		resType, _ := res["type"].(string)
-
-		// Skip certain system resource types
-		if isSystemResource(resType) {
-			continue
-		}
-
 		tags, ok := res["tags"].(map[string]interface{})
-		if !ok || len(tags) == 0 {
-			a.UntaggedResources++
-			for _, requiredTag := range a.RequiredTags {
-				missingByTag[requiredTag] = append(missingByTag[requiredTag], name)
-			}
+		if !ok {
 			continue
 		}
 
-		a.TaggedResources++
-
-		// Check for missing required tags
-		for _, requiredTag := range a.RequiredTags {
-			found := false
-			for tagKey := range tags {
-				if strings.EqualFold(tagKey, requiredTag) {
-					found = true
-					break
-				}
-			}
-			if !found {
-				missingByTag[requiredTag] = append(missingByTag[requiredTag], name)
+		for tagKey := range tags {
+			normalized := strings.ToLower(tagKey)
+			if tagKeyVariations[normalized] == nil {
+				tagKeyVariations[normalized] = make(map[string][]map[string]interface{})
 			}
+			tagKeyVariations[normalized][tagKey] = append(tagKeyVariations[normalized][tagKey], res)
 		}
 	}
 
-	// Create findings for missing tags
-	for tagName, resourceList := range missingByTag {
-		if len(resourceList) > 0 {
-			severity := "Medium"
-			if tagName == "owner" || tagName == "cost-center" {
-				severity = "High"
-			}
-
-			a.Findings = append(a.Findings, TagFinding{
-				Severity:    severity,
-				Category:    "Missing",
-				Resources:   resourceList,
-				Issue:       fmt.Sprintf("%d resources missing '%s' tag", len(resourceList), tagName),
-				Impact:      "Cannot track ownership, cost allocation, or compliance",
-				Remediation: fmt.Sprintf("Add '%s' tag to all resources according to tagging policy", tagName),
-			})
-		}
+	normalizedKeys := make([]string, 0, len(tagKeyVariations))
+	for normalized := range tagKeyVariations {
+		normalizedKeys = append(normalizedKeys, normalized)
 	}
-}
-
-func (a *TaggingAnalysis) analyzeTagConsistency(resources []map[string]interface{}) {
-	// Collect all variations of tag keys
-	tagKeyVariations := make(map[string]map[string]int) // normalized key -> {actual key -> count}
-
-	for _, res := range resources {
-		tags, ok := res["tags"].(map[string]interface{})
-		if !ok {
+	sort.Strings(normalizedKeys)
+
+	// Find inconsistencies, and policy tags spelled differently when the
+	// policy requires exact keys
+	for _, normalized := range normalizedKeys {
+		variations := tagKeyVariations[normalized]
+		recommended, inPolicy := a.Policy.spelling(normalized)
+		if !inPolicy {
+			recommended = normalized
+		}
+		exact := inPolicy && a.Policy.KeyCase == KeyCaseExact
+		if len(variations) < 2 && (!exact || variations[recommended] != nil) {
 			continue
 		}
 
-		for tagKey := range tags {
-			normalized := strings.ToLower(tagKey)
-			if tagKeyVariations[normalized] == nil {
-				tagKeyVariations[normalized] = make(map[string]int)
-			}
-			tagKeyVariations[normalized][tagKey]++
+		varList := []string{}
+		for variant := range variations {
+			varList = append(varList, variant)
 		}
-	}
+		sort.Strings(varList)
 
-	// Find inconsistencies
-	for normalized, variations := range tagKeyVariations {
-		if len(variations) > 1 {
-			varList := []string{}
-			for variant := range variations {
-				varList = append(varList, variant)
-			}
+		issue := fmt.Sprintf("Tag key '%s' has %d variations: %v", normalized, len(variations), varList)
+		if len(variations) == 1 {
+			issue = fmt.Sprintf("Tag key '%s' is spelled '%s' instead of '%s'", normalized, varList[0], recommended)
+		}
 
-			a.Findings = append(a.Findings, TagFinding{
-				Severity:    "Low",
-				Category:    "Inconsistent",
-				Resources:   []string{}, // All resources with these variations
-				Issue:       fmt.Sprintf("Tag key '%s' has %d variations: %v", normalized, len(variations), varList),
-				Impact:      "Makes filtering and cost reporting difficult",
-				Remediation: fmt.Sprintf("Standardize to single format (recommended: '%s')", normalized),
-			})
+		for _, variant := range varList {
+			if variant == recommended {
+				continue
+			}
+			for _, res := range variations[variant] {
+				name, _ := res["name"].(string)
+				id, _ := res["id"].(string)
+				a.Findings = append(a.Findings, TagFinding{
+					RuleID:      RuleInconsistentTagKey,
+					Severity:    "Low",
+					Category:    "Inconsistent",
+					Resources:   []string{fmt.Sprintf("%s ('%s')", name, variant)},
+					ResourceIDs: []string{id},
+					Detail:      normalized,
+					Issue:       issue,
+					Impact:      "Makes filtering and cost reporting difficult",
+					Remediation: fmt.Sprintf("Standardize to single format (recommended: '%s')", recommended),
+				})
+			}
 		}
 	}
 }
@@ -178,9 +162,11 @@ func (a *TaggingAnalysis) analyzeTagValuePatterns(resources []map[string]interfa
 		}
 
 		a.Findings = append(a.Findings, TagFinding{
+			RuleID:      RuleInconsistentEnvTags,
 			Severity:    "Medium",
 			Category:    "Inconsistent",
 			Resources:   []string{},
+			Detail:      "environment",
 			Issue:       fmt.Sprintf("Environment tag has %d different values: %v", len(envValues), values),
 			Impact:      "Difficult to filter resources by environment",
 			Remediation: "Standardize environment values to: production, staging, development, test",
@@ -209,8 +195,14 @@ func isSystemResource(resType string) bool {
 func (a *TaggingAnalysis) GetTaggingScore() int {
 	score := int(a.ComplianceRate)
 
-	// Penalize for findings
+	// Penalize once per issue, however many resources it affects
+	seen := make(map[string]bool)
 	for _, finding := range a.Findings {
+		key := finding.RuleID + "/" + finding.Detail
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
 		switch finding.Severity {
 		case "High":
 			score -= 10
@@ -0,0 +1,420 @@
+package analysis
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Case policies of a TagPolicy
+const (
+	KeyCaseExact   = "exact" // keys must be spelled as in the policy
+	ValueCaseLower = "lower"
+	ValueCaseUpper = "upper"
+)
+
+// TagPolicy is the tagging policy checked by the tagging analysis
+type TagPolicy struct {
+	Required   []string       // tags every resource must have
+	Scopes     []TagScope     // tags required of some resources only
+	Values     []TagValueRule // allowed values of tags
+	KeyCase    string         // KeyCaseExact, or "" / "any"
+	ValueCase  string         // ValueCaseLower or ValueCaseUpper for the values of policy tags, or "" / "any"
+	Inherit    bool           // resource group tags count for their resources
+	Exemptions []TagExemption
+}
+
+// TagSelector selects resources by name, type and resource group. Entries
+// are case-insensitive path.Match patterns such as rg-prod-*; an empty list
+// matches every resource.
+type TagSelector struct {
+	Names          []string
+	Types          []string
+	ResourceGroups []string
+}
+
+// TagScope requires tags of the resources it selects
+type TagScope struct {
+	TagSelector
+	Required []string
+}
+
+// TagValueRule restricts the values of a tag to a list, a pattern or both
+type TagValueRule struct {
+	Tag         string
+	Values      []string // allowed values, case-insensitive
+	Pattern     string   // regular expression the whole value must match
+	Description string   // what a valid value is, e.g. "an email address"
+}
+
+// TagExemption exempts the resources it selects from some or all tags
+type TagExemption struct {
+	TagSelector
+	Tags   []string // exempted tags; empty exempts from the whole policy
+	Reason string
+}
+
+// TagGroupCompliance is the tagging compliance of one resource group
+type TagGroupCompliance struct {
+	Name      string
+	Resources int
+	Compliant int
+	Missing   map[string]int // required tag -> resources missing it
+	Invalid   int            // resources with a value or key the policy does not allow
+}
+
+// Rate returns the percentage of compliant resources
+func (g TagGroupCompliance) Rate() float64 {
+	if g.Resources == 0 {
+		return 100
+	}
+	return float64(g.Compliant) / float64(g.Resources) * 100
+}
+
+// matches reports whether the selector selects a resource
+func (s TagSelector) matches(name, resType, rg string) bool {
+	return matchAny(s.Names, name) && matchAny(s.Types, resType) && matchAny(s.ResourceGroups, rg)
+}
+
+// matchAny reports whether a value matches one of the patterns, or whether
+// there are none
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(value)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredTags returns the tags required of a resource
+func (p TagPolicy) requiredTags(name, resType, rg string) []string {
+	tags := appendTags(nil, p.Required...)
+	for _, scope := range p.Scopes {
+		if scope.matches(name, resType, rg) {
+			tags = appendTags(tags, scope.Required...)
+		}
+	}
+	return tags
+}
+
+// tags returns every tag the policy names, in policy order
+func (p TagPolicy) tags() []string {
+	tags := appendTags(nil, p.Required...)
+	for _, scope := range p.Scopes {
+		tags = appendTags(tags, scope.Required...)
+	}
+	for _, rule := range p.Values {
+		tags = appendTags(tags, rule.Tag)
+	}
+	return tags
+}
+
+// spelling returns the policy's spelling of a tag key
+func (p TagPolicy) spelling(key string) (string, bool) {
+	for _, tag := range p.tags() {
+		if strings.EqualFold(tag, key) {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+// exemption returns whether a resource is exempt from the whole policy, and
+// otherwise the lower-cased tags it is exempt from
+func (p TagPolicy) exemption(name, resType, rg string) (bool, map[string]bool) {
+	exempt := make(map[string]bool)
+	for _, e := range p.Exemptions {
+		if !e.matches(name, resType, rg) {
+			continue
+		}
+		if len(e.Tags) == 0 {
+			return true, nil
+		}
+		for _, tag := range e.Tags {
+			exempt[strings.ToLower(tag)] = true
+		}
+	}
+	return false, exempt
+}
+
+// appendTags appends the tags not already in the list, ignoring case
+func appendTags(tags []string, more ...string) []string {
+	for _, tag := range more {
+		found := false
+		for _, t := range tags {
+			if strings.EqualFold(t, tag) {
+				found = true
+				break
+			}
+		}
+		if !found && tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// allows reports whether a value is allowed; pattern is the compiled,
+// anchored Pattern
+func (r TagValueRule) allows(value string, pattern *regexp.Regexp) bool {
+	if len(r.Values) > 0 {
+		found := false
+		for _, v := range r.Values {
+			if strings.EqualFold(v, strings.TrimSpace(value)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return pattern == nil || pattern.MatchString(value)
+}
+
+// describe returns what a valid value is
+func (r TagValueRule) describe() string {
+	switch {
+	case r.Description != "":
+		return r.Description
+	case len(r.Values) > 0:
+		return "one of " + strings.Join(r.Values, ", ")
+	default:
+		return fmt.Sprintf("matching `%s`", r.Pattern)
+	}
+}
+
+// valueCaseOK reports whether a value follows the value case policy
+func (p TagPolicy) valueCaseOK(value string) bool {
+	switch p.ValueCase {
+	case ValueCaseLower:
+		return value == strings.ToLower(value)
+	case ValueCaseUpper:
+		return value == strings.ToUpper(value)
+	}
+	return true
+}
+
+// lookupTag returns the key and value of a tag, matching the key
+// case-insensitively; blank values count as missing
+func lookupTag(tags map[string]string, key string) (string, string, bool) {
+	for k, v := range tags {
+		if strings.EqualFold(k, key) && strings.TrimSpace(v) != "" {
+			return k, v, true
+		}
+	}
+	return "", "", false
+}
+
+// tagViolation is a resource violating the policy for one tag
+type tagViolation struct {
+	name  string
+	id    string
+	value string // offending value, "" for a missing tag
+}
+
+// violationSet records violations by lower-cased tag
+type violationSet map[string][]tagViolation
+
+// add records a resource violating the policy for a tag
+func (s violationSet) add(tag, name, id, value string) {
+	key := strings.ToLower(tag)
+	s[key] = append(s[key], tagViolation{name: name, id: id, value: value})
+}
+
+// analyzePolicy checks each resource against the policy and returns the
+// resources checked: all but system resources and fully exempt resources
+func (a *TaggingAnalysis) analyzePolicy(resources, groups []map[string]interface{}) []map[string]interface{} {
+	policy := a.Policy
+
+	groupTags := make(map[string]map[string]string)
+	if policy.Inherit {
+		for _, group := range groups {
+			name, _ := group["name"].(string)
+			groupTags[resourceGroupKey(group, name)] = stringTags(group)
+		}
+	}
+
+	// Config validates patterns; an invalid one disables its check
+	patterns := make([]*regexp.Regexp, len(policy.Values))
+	for i, rule := range policy.Values {
+		if rule.Pattern != "" {
+			patterns[i], _ = regexp.Compile("^(?:" + rule.Pattern + ")$")
+		}
+	}
+
+	missing, invalid, badCase := make(violationSet), make(violationSet), make(violationSet)
+	byGroup := make(map[string]*TagGroupCompliance)
+	var checked []map[string]interface{}
+
+	for _, res := range resources {
+		name, _ := res["name"].(string)
+		id, _ := res["id"].(string)
+		resType, _ := res["type"].(string)
+		rg, _ := res["resourceGroup"].(string)
+
+		// Skip certain system resource types
+		if isSystemResource(resType) {
+			continue
+		}
+		all, exempt := policy.exemption(name, resType, rg)
+		if all {
+			a.ExemptResources++
+			continue
+		}
+		checked = append(checked, res)
+
+		tags := stringTags(res)
+		if len(tags) == 0 {
+			a.UntaggedResources++
+		} else {
+			a.TaggedResources++
+		}
+
+		groupKey := resourceGroupKey(res, rg)
+		group, ok := byGroup[groupKey]
+		if !ok {
+			group = &TagGroupCompliance{Name: rg, Missing: make(map[string]int)}
+			byGroup[groupKey] = group
+		}
+		group.Resources++
+
+		// The resource's own tag wins over its resource group's
+		value := func(tag string) (string, bool) {
+			if _, v, ok := lookupTag(tags, tag); ok {
+				return v, true
+			}
+			_, v, ok := lookupTag(groupTags[groupKey], tag)
+			return v, ok
+		}
+
+		compliant, valid := true, true
+		for _, tag := range policy.requiredTags(name, resType, rg) {
+			if exempt[strings.ToLower(tag)] {
+				continue
+			}
+			if _, ok := value(tag); !ok {
+				missing.add(tag, name, id, "")
+				group.Missing[tag]++
+				compliant = false
+			}
+		}
+		for i, rule := range policy.Values {
+			if exempt[strings.ToLower(rule.Tag)] {
+				continue
+			}
+			if v, ok := value(rule.Tag); ok && !rule.allows(v, patterns[i]) {
+				invalid.add(rule.Tag, name, id, v)
+				valid = false
+			}
+		}
+		for _, tag := range policy.tags() {
+			if exempt[strings.ToLower(tag)] {
+				continue
+			}
+			// Misspelled keys are reported by analyzeTagConsistency
+			if key, _, ok := lookupTag(tags, tag); ok && policy.KeyCase == KeyCaseExact && key != tag {
+				valid = false
+			}
+			if v, ok := value(tag); ok && !policy.valueCaseOK(v) {
+				badCase.add(tag, name, id, v)
+				valid = false
+			}
+		}
+
+		if !valid {
+			group.Invalid++
+		}
+		if compliant && valid {
+			a.CompliantResources++
+			group.Compliant++
+		}
+	}
+	a.TotalResources = len(checked)
+
+	a.addMissingFindings(missing)
+	a.addValueFindings(invalid, badCase)
+
+	for _, group := range byGroup {
+		a.ResourceGroups = append(a.ResourceGroups, *group)
+	}
+	sort.Slice(a.ResourceGroups, func(i, j int) bool {
+		ri, rj := a.ResourceGroups[i].Rate(), a.ResourceGroups[j].Rate()
+		if ri != rj {
+			return ri < rj
+		}
+		return a.ResourceGroups[i].Name < a.ResourceGroups[j].Name
+	})
+	return checked
+}
+
+// addMissingFindings reports each resource missing a required tag
+func (a *TaggingAnalysis) addMissingFindings(missing violationSet) {
+	remediation := "Add '%s' tag to the resource according to tagging policy"
+	if a.Policy.Inherit {
+		remediation = "Add '%s' tag to the resource or its resource group according to tagging policy"
+	}
+
+	for _, tag := range a.Policy.tags() {
+		severity := "Medium"
+		if strings.EqualFold(tag, "owner") || strings.EqualFold(tag, "cost-center") {
+			severity = "High"
+		}
+
+		for _, v := range missing[strings.ToLower(tag)] {
+			a.Findings = append(a.Findings, TagFinding{
+				RuleID:      RuleMissingTag,
+				Severity:    severity,
+				Category:    "Missing",
+				Resources:   []string{v.name},
+				ResourceIDs: []string{v.id},
+				Detail:      tag,
+				Issue:       fmt.Sprintf("Missing '%s' tag", tag),
+				Impact:      "Cannot track ownership, cost allocation, or compliance",
+				Remediation: fmt.Sprintf(remediation, tag),
+			})
+		}
+	}
+}
+
+// addValueFindings reports each resource with a tag value the policy does
+// not allow, or a value in the wrong case
+func (a *TaggingAnalysis) addValueFindings(invalid, badCase violationSet) {
+	for _, rule := range a.Policy.Values {
+		for _, v := range invalid[strings.ToLower(rule.Tag)] {
+			a.Findings = append(a.Findings, TagFinding{
+				RuleID:      RuleInvalidTagValue,
+				Severity:    "Medium",
+				Category:    "Invalid",
+				Resources:   []string{fmt.Sprintf("%s ('%s')", v.name, v.value)},
+				ResourceIDs: []string{v.id},
+				Detail:      rule.Tag,
+				Issue:       fmt.Sprintf("'%s' value is not %s", rule.Tag, rule.describe()),
+				Impact:      "Tag values cannot be relied on for ownership, cost allocation or automation",
+				Remediation: fmt.Sprintf("Set '%s' to %s", rule.Tag, rule.describe()),
+			})
+		}
+	}
+
+	for _, tag := range a.Policy.tags() {
+		for _, v := range badCase[strings.ToLower(tag)] {
+			a.Findings = append(a.Findings, TagFinding{
+				RuleID:      RuleTagValueCase,
+				Severity:    "Low",
+				Category:    "Inconsistent",
+				Resources:   []string{fmt.Sprintf("%s ('%s')", v.name, v.value)},
+				ResourceIDs: []string{v.id},
+				Detail:      tag,
+				Issue:       fmt.Sprintf("'%s' value is not %s case", tag, a.Policy.ValueCase),
+				Impact:      "Filters and cost reports that compare values exactly split the same value",
+				Remediation: fmt.Sprintf("Change '%s' value to %s case", tag, a.Policy.ValueCase),
+			})
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/metrics"
+	"github.com/automationpi/azdocs/pkg/pricing"
+)
+
+// VM power states reported by the instance view
+const (
+	PowerRunning     = "running"
+	PowerStopped     = "stopped"
+	PowerDeallocated = "deallocated"
+)
+
+// UtilizationPolicy decides when a VM is underutilized and how far it may
+// be downsized
+type UtilizationPolicy struct {
+	Percentile          float64 // percentile of the metric samples compared, e.g. 95
+	MinDays             float64 // metrics must cover at least this many days
+	CPUPercent          float64 // underutilized below this CPU percentile
+	MemoryPercent       float64 // and below this memory percentile, when reported
+	NetworkMbps         float64 // and below this network throughput, when reported
+	TargetCPUPercent    float64 // projected CPU after downsizing stays at or below this
+	TargetMemoryPercent float64 // projected memory after downsizing stays at or below this
+}
+
+// VMUsage is the utilization of a VM at the policy percentile
+type VMUsage struct {
+	Percentile  float64
+	Days        float64
+	CPU         float64 // percent
+	Memory      float64 // percent used
+	HasMemory   bool
+	NetworkMbps float64
+	HasNetwork  bool
+}
+
+// String summarizes the usage, e.g. "CPU p95 4.1%, memory p95 22.0% over 14 days"
+func (u VMUsage) String() string {
+	p := fmt.Sprintf("p%.0f", u.Percentile)
+	parts := []string{fmt.Sprintf("CPU %s %.1f%%", p, u.CPU)}
+	if u.HasMemory {
+		parts = append(parts, fmt.Sprintf("memory %s %.1f%%", p, u.Memory))
+	}
+	if u.HasNetwork {
+		parts = append(parts, fmt.Sprintf("network %s %.1f Mbps", p, u.NetworkMbps))
+	}
+	return fmt.Sprintf("%s over %.0f days", strings.Join(parts, ", "), u.Days)
+}
+
+// vmPowerState returns the power state of a VM from the Resource Graph
+// extended properties or an ARM instance view, or "" when unknown
+func vmPowerState(props map[string]interface{}) string {
+	var code string
+	if extended, ok := props["extended"].(map[string]interface{}); ok {
+		if view, ok := extended["instanceView"].(map[string]interface{}); ok {
+			switch state := view["powerState"].(type) {
+			case map[string]interface{}:
+				code, _ = state["code"].(string)
+			case string:
+				code = state
+			}
+		}
+	}
+	if view, ok := props["instanceView"].(map[string]interface{}); ok && code == "" {
+		statuses, _ := view["statuses"].([]interface{})
+		for _, s := range statuses {
+			if status, ok := s.(map[string]interface{}); ok {
+				if c, _ := status["code"].(string); strings.HasPrefix(strings.ToLower(c), "powerstate/") {
+					code = c
+				}
+			}
+		}
+	}
+
+	code = strings.ToLower(strings.TrimPrefix(strings.ToLower(code), "powerstate/"))
+	switch code {
+	case "stopped", "stopping":
+		return PowerStopped
+	case "deallocated", "deallocating":
+		return PowerDeallocated
+	}
+	return code
+}
+
+// deallocated reports whether a resource is a deallocated VM, which is not
+// billed for compute
+func deallocated(res map[string]interface{}) bool {
+	resType, _ := res["type"].(string)
+	props, _ := res["properties"].(map[string]interface{})
+	return strings.EqualFold(resType, "microsoft.compute/virtualmachines") && vmPowerState(props) == PowerDeallocated
+}
+
+// vmUsage summarizes the metrics of a VM, and false when there are no CPU
+// metrics or they cover fewer than the policy's days
+func (a *CostAnalysis) vmUsage(vmID string, size pricing.VMSize, sized bool) (VMUsage, bool) {
+	store, policy := a.options.Metrics, a.options.VMUtilization
+	if store == nil {
+		return VMUsage{}, false
+	}
+
+	cpu, ok := store.Percentile(vmID, metrics.CPU, policy.Percentile)
+	if !ok {
+		return VMUsage{}, false
+	}
+	usage := VMUsage{Percentile: policy.Percentile, Days: store.Days(vmID), CPU: cpu}
+	if usage.Days < policy.MinDays {
+		return usage, false
+	}
+
+	// High memory use means little available memory, so the used
+	// percentile is the complement of the low available percentile
+	if available, ok := store.Percentile(vmID, metrics.AvailableMemoryPercent, 100-policy.Percentile); ok {
+		usage.Memory, usage.HasMemory = 100-available, true
+	} else if available, ok := store.Percentile(vmID, metrics.AvailableMemoryBytes, 100-policy.Percentile); ok && sized {
+		usage.Memory, usage.HasMemory = 100-available/(size.MemoryGB*(1<<30))*100, true
+	}
+	usage.NetworkMbps, usage.HasNetwork = store.NetworkMbps(vmID, policy.Percentile)
+	return usage, true
+}
+
+// underutilized reports whether usage is below every threshold of the
+// policy that the metrics report
+func (u VMUsage) underutilized(policy UtilizationPolicy) bool {
+	return u.CPU < policy.CPUPercent &&
+		(!u.HasMemory || u.Memory < policy.MemoryPercent) &&
+		(!u.HasNetwork || u.NetworkMbps < policy.NetworkMbps)
+}
+
+// rightSize returns the smallest cheaper size of the same series that keeps
+// the projected CPU and memory use within the policy targets. Without memory
+// metrics, memory is halved at most.
+func (a *CostAnalysis) rightSize(current pricing.VMSize, usage VMUsage, region string, windows bool, currentCost float64) (pricing.VMSize, float64, bool) {
+	policy := a.options.VMUtilization
+	for _, size := range pricing.SmallerVMSizes(current.Name) {
+		if usage.CPU*float64(current.VCPUs)/float64(size.VCPUs) > policy.TargetCPUPercent {
+			continue
+		}
+		if usage.HasMemory {
+			if usage.Memory*current.MemoryGB/size.MemoryGB > policy.TargetMemoryPercent {
+				continue
+			}
+		} else if size.MemoryGB*2 < current.MemoryGB {
+			continue
+		}
+
+		cost, ok := a.options.prices().VMMonthly(size.Name, region, windows)
+		if ok && cost < currentCost {
+			return size, cost, true
+		}
+	}
+	return pricing.VMSize{}, 0, false
+}
+
+// vmDiskIDs returns the IDs of the managed OS and data disks of a VM
+func vmDiskIDs(props map[string]interface{}) []string {
+	var ids []string
+	storage, _ := props["storageProfile"].(map[string]interface{})
+	if osDisk, ok := storage["osDisk"].(map[string]interface{}); ok {
+		if managed, ok := osDisk["managedDisk"].(map[string]interface{}); ok {
+			if id, _ := managed["id"].(string); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	dataDisks, _ := storage["dataDisks"].([]interface{})
+	for _, d := range dataDisks {
+		if disk, ok := d.(map[string]interface{}); ok {
+			if managed, ok := disk["managedDisk"].(map[string]interface{}); ok {
+				if id, _ := managed["id"].(string); id != "" {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	return ids
+}
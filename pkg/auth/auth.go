@@ -47,6 +47,15 @@ func NewAzureAuthenticator() (*AzureAuthenticator, error) {
 	}, nil
 }
 
+// NewAuthenticatorWithCredential wraps an existing credential, e.g. a static
+// token credential used against a local fake endpoint
+func NewAuthenticatorWithCredential(cred azcore.TokenCredential, tenantID string) *AzureAuthenticator {
+	return &AzureAuthenticator{
+		credential: cred,
+		tenantID:   tenantID,
+	}
+}
+
 // GetCredential returns the Azure credential
 func (a *AzureAuthenticator) GetCredential() azcore.TokenCredential {
 	return a.credential
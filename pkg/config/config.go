@@ -0,0 +1,519 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is the prefix for environment variable overrides, e.g.
+// AZDOC_DISCOVERY_CONCURRENCY overrides discovery.concurrency
+const EnvPrefix = "AZDOC"
+
+// Config is the typed azdoc configuration
+type Config struct {
+	SubscriptionID string            `mapstructure:"subscription-id"`
+	TenantID       string            `mapstructure:"tenant-id"`
+	Output         OutputConfig      `mapstructure:"output"`
+	Cache          CacheConfig       `mapstructure:"cache"`
+	Discovery      DiscoveryConfig   `mapstructure:"discovery"`
+	Rendering      RenderingConfig   `mapstructure:"rendering"`
+	LLM            LLMConfig         `mapstructure:"llm"`
+	Redaction      RedactionConfig   `mapstructure:"redaction"`
+	RateLimit      RateLimitConfig   `mapstructure:"rate-limit"`
+	Check          CheckConfig       `mapstructure:"check"`
+	IPAM           IPAMConfig        `mapstructure:"ipam"`
+	Pricing        PricingConfig     `mapstructure:"pricing"`
+	Utilization    UtilizationConfig `mapstructure:"utilization"`
+	Orphans        OrphansConfig     `mapstructure:"orphans"`
+	Commitments    CommitmentsConfig `mapstructure:"commitments"`
+	Tagging        TaggingConfig     `mapstructure:"tagging"`
+	WaiversFile    string            `mapstructure:"waivers-file"`
+	RulesDir       string            `mapstructure:"rules-dir"`
+	LogLevel       string            `mapstructure:"log-level"`
+	NoANSI         bool              `mapstructure:"no-ansi"`
+	Quiet          bool              `mapstructure:"quiet"`
+}
+
+// OutputConfig holds output directories
+type OutputConfig struct {
+	DataDir     string `mapstructure:"data-dir"`
+	DocsDir     string `mapstructure:"docs-dir"`
+	DiagramsDir string `mapstructure:"diagrams-dir"`
+}
+
+// CacheConfig holds query cache settings
+type CacheConfig struct {
+	Dir string        `mapstructure:"dir"`
+	TTL time.Duration `mapstructure:"ttl"` // 0 disables reuse of cached query results
+}
+
+// DiscoveryConfig holds discovery settings
+type DiscoveryConfig struct {
+	Concurrency  int           `mapstructure:"concurrency"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	IncludeTypes []string      `mapstructure:"include-types"`
+	ExcludeTypes []string      `mapstructure:"exclude-types"`
+}
+
+// RenderingConfig holds documentation rendering settings
+type RenderingConfig struct {
+	WithDiagrams           bool   `mapstructure:"with-diagrams"`
+	Theme                  string `mapstructure:"theme"`
+	MDName                 string `mapstructure:"md-name"`
+	IncludeEffectiveRoutes bool   `mapstructure:"include-effective-routes"`
+	MaxRoutesPerNIC        int    `mapstructure:"max-routes-per-nic"`
+}
+
+// LLMConfig holds LLM settings
+type LLMConfig struct {
+	Enabled     bool     `mapstructure:"enabled"`
+	Model       string   `mapstructure:"model"`
+	MaxTokens   int      `mapstructure:"max-tokens"`  // 0 keeps each request's own limit
+	Temperature *float32 `mapstructure:"temperature"` // nil keeps each request's own temperature
+}
+
+// RedactionConfig holds redaction settings for generated documentation
+type RedactionConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Patterns []string `mapstructure:"patterns"`
+}
+
+// RateLimitConfig holds Azure API rate limiting settings
+type RateLimitConfig struct {
+	RPS   float64 `mapstructure:"rps"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// CheckConfig holds the gates applied by `azdoc check`
+type CheckConfig struct {
+	FailOn    string         `mapstructure:"fail-on"` // lowest failing severity, or "none"
+	MinScores map[string]int `mapstructure:"min-scores"`
+	Results   string         `mapstructure:"results"` // JSON results file
+}
+
+// IPAMConfig holds IP address management settings
+type IPAMConfig struct {
+	UtilizationThreshold float64  `mapstructure:"utilization-threshold"` // percent
+	ReservedRanges       []string `mapstructure:"reserved-ranges"`       // CIDRs `azdoc ipam next` never allocates
+}
+
+// PricingConfig holds cost estimation settings
+type PricingConfig struct {
+	PriceSheet string `mapstructure:"price-sheet"` // JSON or CSV retail price export; empty uses the bundled sheet
+	CostExport string `mapstructure:"cost-export"` // Cost Management actual cost CSV; replaces estimates when set
+}
+
+// UtilizationConfig holds the thresholds of the VM right-sizing check
+type UtilizationConfig struct {
+	Metrics             string  `mapstructure:"metrics"`               // Azure Monitor metric export file or directory
+	Percentile          float64 `mapstructure:"percentile"`            // percentile of the samples compared
+	MinDays             float64 `mapstructure:"min-days"`              // metrics must cover at least this many days
+	CPUPercent          float64 `mapstructure:"cpu-percent"`           // underutilized below this CPU
+	MemoryPercent       float64 `mapstructure:"memory-percent"`        // and below this memory use
+	NetworkMbps         float64 `mapstructure:"network-mbps"`          // and below this network throughput
+	TargetCPUPercent    float64 `mapstructure:"target-cpu-percent"`    // projected CPU after resizing
+	TargetMemoryPercent float64 `mapstructure:"target-memory-percent"` // projected memory after resizing
+}
+
+// OrphansConfig holds the settings of the unused resource checks
+type OrphansConfig struct {
+	SnapshotAgeDays int `mapstructure:"snapshot-age-days"` // snapshots older than this are reported, 0 disables
+}
+
+// CommitmentsConfig holds the settings of the reservation and savings plan
+// analysis
+type CommitmentsConfig struct {
+	ExcludeTags []string `mapstructure:"exclude-tags"` // key=value tags of VMs left out, e.g. environment=dev
+}
+
+// TaggingConfig holds the tagging policy
+type TaggingConfig struct {
+	Required   []string             `mapstructure:"required"`   // tags every resource must have
+	Scopes     []TagScopeConfig     `mapstructure:"scopes"`     // tags required of some resource types or groups
+	Values     []TagValueConfig     `mapstructure:"values"`     // allowed values per tag
+	KeyCase    string               `mapstructure:"key-case"`   // any, or exact: keys spelled as in the policy
+	ValueCase  string               `mapstructure:"value-case"` // any, lower or upper
+	Inherit    bool                 `mapstructure:"inherit"`    // resource group tags count for their resources
+	Exemptions []TagExemptionConfig `mapstructure:"exemptions"`
+}
+
+// TagScopeConfig requires tags of the resources of some types or resource
+// groups; entries are patterns such as rg-prod-*
+type TagScopeConfig struct {
+	Types          []string `mapstructure:"types"`
+	ResourceGroups []string `mapstructure:"resource-groups"`
+	Required       []string `mapstructure:"required"`
+}
+
+// TagValueConfig restricts the values of a tag
+type TagValueConfig struct {
+	Tag         string   `mapstructure:"tag"`
+	Values      []string `mapstructure:"values"`      // allowed values, case-insensitive
+	Pattern     string   `mapstructure:"pattern"`     // regular expression the whole value must match
+	Description string   `mapstructure:"description"` // shown in findings, e.g. "an email address"
+}
+
+// TagExemptionConfig exempts resources from some or all tags; entries are
+// patterns such as rg-sandbox-*
+type TagExemptionConfig struct {
+	Names          []string `mapstructure:"names"`
+	Types          []string `mapstructure:"types"`
+	ResourceGroups []string `mapstructure:"resource-groups"`
+	Tags           []string `mapstructure:"tags"` // empty exempts from the whole policy
+	Reason         string   `mapstructure:"reason"`
+}
+
+// defaults mirrors azdoc.yaml.example
+var defaults = map[string]interface{}{
+	"subscription-id":                    "",
+	"tenant-id":                          "",
+	"output.data-dir":                    "./data",
+	"output.docs-dir":                    "./docs",
+	"output.diagrams-dir":                "",
+	"cache.dir":                          ".azdoc",
+	"cache.ttl":                          "0s",
+	"discovery.concurrency":              8,
+	"discovery.timeout":                  "5m",
+	"discovery.include-types":            []string{},
+	"discovery.exclude-types":            []string{},
+	"rendering.with-diagrams":            true,
+	"rendering.theme":                    "default",
+	"rendering.md-name":                  "SUBSCRIPTION.md",
+	"rendering.include-effective-routes": false,
+	"rendering.max-routes-per-nic":       50,
+	"llm.enabled":                        false,
+	"llm.model":                          "gpt-4o-mini",
+	"llm.max-tokens":                     0,
+	"redaction.enabled":                  false,
+	"redaction.patterns":                 []string{},
+	"rate-limit.rps":                     10,
+	"rate-limit.burst":                   20,
+	"check.fail-on":                      "high",
+	"check.min-scores":                   map[string]int{},
+	"check.results":                      "",
+	"ipam.utilization-threshold":         80,
+	"ipam.reserved-ranges":               []string{},
+	"pricing.price-sheet":                "",
+	"pricing.cost-export":                "",
+	"utilization.metrics":                "",
+	"utilization.percentile":             95,
+	"utilization.min-days":               7,
+	"utilization.cpu-percent":            20,
+	"utilization.memory-percent":         50,
+	"utilization.network-mbps":           10,
+	"utilization.target-cpu-percent":     60,
+	"utilization.target-memory-percent":  75,
+	"orphans.snapshot-age-days":          90,
+	"commitments.exclude-tags":           []string{"environment=dev", "environment=test"},
+	"tagging.required":                   []string{"environment", "owner", "cost-center", "application"},
+	"tagging.scopes":                     []map[string]interface{}{},
+	"tagging.values":                     []map[string]interface{}{},
+	"tagging.key-case":                   "any",
+	"tagging.value-case":                 "any",
+	"tagging.inherit":                    false,
+	"tagging.exemptions":                 []map[string]interface{}{},
+	"waivers-file":                       "azdoc-waivers.yaml",
+	"rules-dir":                          "rules",
+	"log-level":                          "info",
+	"no-ansi":                            false,
+	"quiet":                              false,
+}
+
+// flagKeys maps command-line flag names to configuration keys
+var flagKeys = map[string]string{
+	"subscription-id":          "subscription-id",
+	"tenant-id":                "tenant-id",
+	"json-out":                 "output.data-dir",
+	"in":                       "output.data-dir",
+	"out":                      "output.docs-dir",
+	"cache-dir":                "cache.dir",
+	"cache-ttl":                "cache.ttl",
+	"concurrency":              "discovery.concurrency",
+	"timeout":                  "discovery.timeout",
+	"with-diagrams":            "rendering.with-diagrams",
+	"theme":                    "rendering.theme",
+	"md-name":                  "rendering.md-name",
+	"include-effective-routes": "rendering.include-effective-routes",
+	"cost-export":              "pricing.cost-export",
+	"metrics":                  "utilization.metrics",
+	"fail-on":                  "check.fail-on",
+	"min-score":                "check.min-scores",
+	"results":                  "check.results",
+	"waivers":                  "waivers-file",
+	"rules-dir":                "rules-dir",
+	"enable-ai":                "llm.enabled",
+	"model":                    "llm.model",
+	"max-tokens":               "llm.max-tokens",
+	"log-level":                "log-level",
+	"no-ansi":                  "no-ansi",
+	"quiet":                    "quiet",
+}
+
+// Load reads configuration with the precedence flags > AZDOC_* environment
+// variables > config file > defaults. Only flags explicitly set on the
+// command line override lower layers. An empty cfgFile searches ./azdoc.yaml
+// and $HOME/.azdoc/azdoc.yaml; a missing default file is not an error.
+func Load(cfgFile string, flags *pflag.FlagSet) (*Config, error) {
+	v := viper.New()
+
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	v.AutomaticEnv()
+	// Keys without a default are only read from the environment when bound
+	if err := v.BindEnv("llm.temperature"); err != nil {
+		return nil, fmt.Errorf("failed to bind environment: %w", err)
+	}
+
+	if cfgFile != "" {
+		v.SetConfigFile(cfgFile)
+	} else {
+		// No SetConfigType: with a type set, viper also matches an
+		// extensionless "azdoc" file, which is usually the binary itself
+		v.SetConfigName("azdoc")
+		v.AddConfigPath(".")
+		v.AddConfigPath("$HOME/.azdoc")
+	}
+
+	if err := v.ReadInConfig(); err != nil {
+		if _, notFound := err.(viper.ConfigFileNotFoundError); !notFound || cfgFile != "" {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+
+	if flags != nil {
+		if err := bindFlags(v, flags); err != nil {
+			return nil, err
+		}
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if cfg.Output.DiagramsDir == "" {
+		cfg.Output.DiagramsDir = strings.TrimSuffix(cfg.Output.DocsDir, "/") + "/diagrams"
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// bindFlags binds known flags to their configuration keys. When two flags
+// map to the same key (e.g. --json-out and --in on `azdoc all`), an
+// explicitly set flag wins over one left at its default.
+func bindFlags(v *viper.Viper, flags *pflag.FlagSet) error {
+	bound := make(map[string]*pflag.Flag)
+
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		key, ok := flagKeys[flag.Name]
+		if !ok || err != nil {
+			return
+		}
+		if prev, seen := bound[key]; seen && (prev.Changed || !flag.Changed) {
+			return
+		}
+		bound[key] = flag
+		if bindErr := v.BindPFlag(key, flag); bindErr != nil {
+			err = fmt.Errorf("failed to bind flag --%s: %w", flag.Name, bindErr)
+		}
+	})
+
+	return err
+}
+
+// Validate checks that configuration values are usable
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Discovery.Concurrency < 1 {
+		problems = append(problems, "discovery.concurrency must be at least 1")
+	}
+	if c.Discovery.Timeout <= 0 {
+		problems = append(problems, "discovery.timeout must be positive")
+	}
+	if c.Cache.TTL < 0 {
+		problems = append(problems, "cache.ttl must not be negative")
+	}
+	if c.Rendering.MaxRoutesPerNIC < 0 {
+		problems = append(problems, "rendering.max-routes-per-nic must not be negative")
+	}
+	switch c.Rendering.Theme {
+	case "default", "dark", "light":
+	default:
+		problems = append(problems, fmt.Sprintf("rendering.theme %q must be one of default, dark, light", c.Rendering.Theme))
+	}
+	if c.Rendering.MDName == "" {
+		problems = append(problems, "rendering.md-name must not be empty")
+	}
+	if c.IPAM.UtilizationThreshold <= 0 || c.IPAM.UtilizationThreshold > 100 {
+		problems = append(problems, "ipam.utilization-threshold must be between 0 and 100")
+	}
+	for _, r := range c.IPAM.ReservedRanges {
+		if _, err := netip.ParsePrefix(strings.TrimSpace(r)); err != nil {
+			problems = append(problems, fmt.Sprintf("ipam.reserved-ranges entry %q is not a CIDR prefix", r))
+		}
+	}
+	if c.Utilization.Percentile <= 0 || c.Utilization.Percentile > 100 {
+		problems = append(problems, "utilization.percentile must be between 0 and 100")
+	}
+	if c.Utilization.MinDays < 0 {
+		problems = append(problems, "utilization.min-days must not be negative")
+	}
+	for key, value := range map[string]float64{
+		"utilization.cpu-percent":           c.Utilization.CPUPercent,
+		"utilization.memory-percent":        c.Utilization.MemoryPercent,
+		"utilization.target-cpu-percent":    c.Utilization.TargetCPUPercent,
+		"utilization.target-memory-percent": c.Utilization.TargetMemoryPercent,
+	} {
+		if value <= 0 || value > 100 {
+			problems = append(problems, fmt.Sprintf("%s must be between 0 and 100", key))
+		}
+	}
+	if c.Utilization.NetworkMbps < 0 {
+		problems = append(problems, "utilization.network-mbps must not be negative")
+	}
+	if c.Orphans.SnapshotAgeDays < 0 {
+		problems = append(problems, "orphans.snapshot-age-days must not be negative")
+	}
+	for _, tag := range c.Commitments.ExcludeTags {
+		if key, _, ok := strings.Cut(tag, "="); !ok || strings.TrimSpace(key) == "" {
+			problems = append(problems, fmt.Sprintf("commitments.exclude-tags entry %q must be key=value", tag))
+		}
+	}
+	problems = append(problems, c.Tagging.validate()...)
+	if c.LLM.MaxTokens < 0 {
+		problems = append(problems, "llm.max-tokens must not be negative")
+	}
+	if t := c.LLM.Temperature; t != nil && (*t < 0 || *t > 2) {
+		problems = append(problems, "llm.temperature must be between 0 and 2")
+	}
+	for _, pattern := range c.Redaction.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("redaction pattern %q is invalid: %v", pattern, err))
+		}
+	}
+	if c.RateLimit.RPS < 0 {
+		problems = append(problems, "rate-limit.rps must not be negative")
+	}
+	if c.RateLimit.Burst < 0 {
+		problems = append(problems, "rate-limit.burst must not be negative")
+	}
+	switch strings.ToLower(c.Check.FailOn) {
+	case "critical", "high", "medium", "low", "none":
+	default:
+		problems = append(problems, fmt.Sprintf("check.fail-on %q must be one of critical, high, medium, low, none", c.Check.FailOn))
+	}
+	for name, min := range c.Check.MinScores {
+		switch strings.ToLower(name) {
+		case "security", "cost", "tagging", "compliance":
+		default:
+			problems = append(problems, fmt.Sprintf("check.min-scores has unknown category %q", name))
+		}
+		if min < 0 || min > 100 {
+			problems = append(problems, fmt.Sprintf("check.min-scores.%s must be between 0 and 100", name))
+		}
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log-level %q must be one of debug, info, warn, error", c.LogLevel))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+
+	return nil
+}
+
+// validate checks the tagging policy and returns its problems
+func (t TaggingConfig) validate() []string {
+	var problems []string
+
+	switch t.KeyCase {
+	case "any", "exact":
+	default:
+		problems = append(problems, fmt.Sprintf("tagging.key-case %q must be one of any, exact", t.KeyCase))
+	}
+	switch t.ValueCase {
+	case "any", "lower", "upper":
+	default:
+		problems = append(problems, fmt.Sprintf("tagging.value-case %q must be one of any, lower, upper", t.ValueCase))
+	}
+	for i, scope := range t.Scopes {
+		if len(scope.Required) == 0 {
+			problems = append(problems, fmt.Sprintf("tagging.scopes[%d] must list required tags", i))
+		}
+		if len(scope.Types) == 0 && len(scope.ResourceGroups) == 0 {
+			problems = append(problems, fmt.Sprintf("tagging.scopes[%d] must select types or resource-groups", i))
+		}
+		problems = append(problems, badPatterns(fmt.Sprintf("tagging.scopes[%d]", i), scope.Types, scope.ResourceGroups)...)
+	}
+	seen := make(map[string]bool)
+	for i, rule := range t.Values {
+		if strings.TrimSpace(rule.Tag) == "" {
+			problems = append(problems, fmt.Sprintf("tagging.values[%d] must name a tag", i))
+		} else if seen[strings.ToLower(rule.Tag)] {
+			problems = append(problems, fmt.Sprintf("tagging.values has more than one entry for tag %q", rule.Tag))
+		}
+		seen[strings.ToLower(rule.Tag)] = true
+		if len(rule.Values) == 0 && rule.Pattern == "" {
+			problems = append(problems, fmt.Sprintf("tagging.values[%d] must list values or a pattern", i))
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("tagging.values[%d] pattern %q is invalid: %v", i, rule.Pattern, err))
+		}
+	}
+	for i, e := range t.Exemptions {
+		if len(e.Names) == 0 && len(e.Types) == 0 && len(e.ResourceGroups) == 0 {
+			problems = append(problems, fmt.Sprintf("tagging.exemptions[%d] must select names, types or resource-groups", i))
+		}
+		problems = append(problems, badPatterns(fmt.Sprintf("tagging.exemptions[%d]", i), e.Names, e.Types, e.ResourceGroups)...)
+	}
+
+	return problems
+}
+
+// badPatterns returns a problem for each entry that is not a valid
+// path.Match pattern
+func badPatterns(prefix string, lists ...[]string) []string {
+	var problems []string
+	for _, list := range lists {
+		for _, p := range list {
+			if _, err := path.Match(p, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("%s pattern %q is invalid: %v", prefix, p, err))
+			}
+		}
+	}
+	return problems
+}
+
+// RedactionPatterns returns the compiled redaction patterns, or nil when
+// redaction is disabled
+func (c *Config) RedactionPatterns() []*regexp.Regexp {
+	if !c.Redaction.Enabled {
+		return nil
+	}
+
+	var patterns []*regexp.Regexp
+	for _, pattern := range c.Redaction.Patterns {
+		patterns = append(patterns, regexp.MustCompile(pattern))
+	}
+	return patterns
+}
@@ -0,0 +1,244 @@
+// Package costexport reads Azure Cost Management "actual cost" exports
+package costexport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column names, in order of preference, of the fields read from an export.
+// Exports for EA, MCA and pay-as-you-go subscriptions name them differently.
+var (
+	resourceIDColumns    = []string{"resourceid", "instanceid", "resourceuri"}
+	costColumns          = []string{"costinbillingcurrency", "pretaxcost", "cost", "costinusd"}
+	currencyColumns      = []string{"billingcurrency", "billingcurrencycode", "currency", "currencycode"}
+	dateColumns          = []string{"date", "usagedatetime", "usagedate", "billingperiodstartdate"}
+	resourceGroupColumns = []string{"resourcegroup", "resourcegroupname"}
+	tagsColumns          = []string{"tags"}
+)
+
+// dateLayouts are the date formats used by Cost Management exports
+var dateLayouts = []string{"01/02/2006", "2006-01-02", time.RFC3339, "2006-01-02T15:04:05", "20060102", "1/2/2006"}
+
+// Export is the spend of an actual cost export, summed per resource
+type Export struct {
+	Source   string
+	Currency string
+	Months   []string // billing months covered by the export, as YYYY-MM
+
+	Total      float64 // cost of all rows
+	Unassigned float64 // cost of rows without a resource ID, e.g. support or Marketplace
+
+	resources     map[string]*ResourceCost // by lower-cased resource ID
+	subscriptions map[string]bool          // lower-cased subscription IDs with rows
+}
+
+// ResourceCost is the cost of one resource over the whole export
+type ResourceCost struct {
+	ResourceID    string
+	ResourceGroup string
+	Tags          map[string]string // tags recorded on the usage rows
+	Total         float64
+}
+
+// Load reads a CSV actual cost export
+func Load(path string) (*Export, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cost export: %w", err)
+	}
+	defer file.Close()
+
+	export, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cost export %s: %w", path, err)
+	}
+	export.Source = path
+	return export, nil
+}
+
+// Parse reads CSV actual cost export rows
+func Parse(r io.Reader) (*Export, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	column := func(names []string) int {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+
+	idCol, costCol := column(resourceIDColumns), column(costColumns)
+	if idCol < 0 {
+		return nil, fmt.Errorf("no resource ID column (ResourceId or InstanceId)")
+	}
+	if costCol < 0 {
+		return nil, fmt.Errorf("no cost column (CostInBillingCurrency, PreTaxCost or Cost)")
+	}
+	currencyCol, dateCol := column(currencyColumns), column(dateColumns)
+	groupCol, tagsCol := column(resourceGroupColumns), column(tagsColumns)
+
+	export := &Export{resources: make(map[string]*ResourceCost), subscriptions: make(map[string]bool)}
+	months := make(map[string]bool)
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		field := func(i int) string {
+			if i >= 0 && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		value := field(costCol)
+		if value == "" {
+			continue
+		}
+		cost, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid cost %q", line, value)
+		}
+
+		if export.Currency == "" {
+			export.Currency = field(currencyCol)
+		}
+		if date, ok := parseDate(field(dateCol)); ok {
+			months[date.Format("2006-01")] = true
+		}
+
+		export.Total += cost
+		id := field(idCol)
+		if id == "" {
+			export.Unassigned += cost
+			continue
+		}
+
+		key := strings.ToLower(id)
+		rc, ok := export.resources[key]
+		if !ok {
+			rc = &ResourceCost{ResourceID: id, ResourceGroup: field(groupCol), Tags: make(map[string]string)}
+			if rc.ResourceGroup == "" {
+				rc.ResourceGroup = segment(id, "resourcegroups")
+			}
+			export.resources[key] = rc
+			export.subscriptions[strings.ToLower(segment(id, "subscriptions"))] = true
+		}
+		rc.Total += cost
+		for k, v := range parseTags(field(tagsCol)) {
+			rc.Tags[k] = v
+		}
+	}
+
+	if len(export.resources) == 0 && export.Total == 0 {
+		return nil, fmt.Errorf("no cost rows found")
+	}
+	if export.Currency == "" {
+		export.Currency = "USD"
+	}
+	for month := range months {
+		export.Months = append(export.Months, month)
+	}
+	sort.Strings(export.Months)
+	return export, nil
+}
+
+// Monthly converts a cost over the whole export to a monthly cost, averaged
+// over the billing months the export covers
+func (e *Export) Monthly(total float64) float64 {
+	if len(e.Months) <= 1 {
+		return total
+	}
+	return total / float64(len(e.Months))
+}
+
+// Resource returns the cost of a resource by ID
+func (e *Export) Resource(id string) (*ResourceCost, bool) {
+	rc, ok := e.resources[strings.ToLower(id)]
+	return rc, ok
+}
+
+// Resources returns the cost of every resource, highest first
+func (e *Export) Resources() []*ResourceCost {
+	costs := make([]*ResourceCost, 0, len(e.resources))
+	for _, rc := range e.resources {
+		costs = append(costs, rc)
+	}
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].Total != costs[j].Total {
+			return costs[i].Total > costs[j].Total
+		}
+		return costs[i].ResourceID < costs[j].ResourceID
+	})
+	return costs
+}
+
+// Covers reports whether the export has rows for the subscription of a
+// resource ID, so a resource missing from it incurred no cost
+func (e *Export) Covers(id string) bool {
+	subscription := strings.ToLower(segment(id, "subscriptions"))
+	return subscription != "" && e.subscriptions[subscription]
+}
+
+// parseTags reads the Tags column, a JSON object that older exports write
+// without the surrounding braces
+func parseTags(value string) map[string]string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	if !strings.HasPrefix(value, "{") {
+		value = "{" + value + "}"
+	}
+	var tags map[string]string
+	if err := json.Unmarshal([]byte(value), &tags); err != nil {
+		return nil
+	}
+	return tags
+}
+
+func parseDate(value string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// segment returns the value after a key in a resource ID, e.g. the resource
+// group name after "resourceGroups"
+func segment(id, key string) string {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if strings.EqualFold(parts[i], key) {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
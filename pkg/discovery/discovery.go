@@ -6,61 +6,130 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/automationpi/azdocs/pkg/auth"
 	"github.com/automationpi/azdocs/pkg/cache"
+	"github.com/automationpi/azdocs/pkg/normalize"
 )
 
 // Config holds discovery configuration
 type Config struct {
-	SubscriptionID string
-	TenantID       string
-	Concurrency    int
-	ShowProgress   bool
+	SubscriptionID    string
+	SubscriptionIDs   []string // Additional subscriptions scanned into one dataset
+	ManagementGroupID string   // Scan every subscription under this management group
+	TenantID          string
+	Concurrency       int
+	ShowProgress      bool
+	PageSize          int           // Resource Graph page size ($top)
+	Skip              int           // Rows to skip before the first page ($skip)
+	MaxResults        int           // Cap on rows per query, 0 means no limit
+	Endpoint          string        // Resource Manager endpoint override
+	IncludeTypes      []string      // Only discover these resource types (empty = all)
+	ExcludeTypes      []string      // Resource types to skip
+	CacheTTL          time.Duration // Reuse cached query results younger than this, 0 disables
+	RateLimitRPS      float64       // Azure API requests per second, 0 disables limiting
+	RateLimitBurst    int           // Burst capacity of the rate limiter
+}
+
+// Subscriptions returns the de-duplicated list of configured subscriptions
+func (c Config) Subscriptions() []string {
+	seen := make(map[string]bool)
+	var subs []string
+	for _, sub := range append([]string{c.SubscriptionID}, c.SubscriptionIDs...) {
+		sub = strings.TrimSpace(sub)
+		if sub == "" || seen[strings.ToLower(sub)] {
+			continue
+		}
+		seen[strings.ToLower(sub)] = true
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// scope returns the Resource Graph scope for the configuration
+func (c Config) scope() Scope {
+	if c.ManagementGroupID != "" {
+		return Scope{ManagementGroups: []string{c.ManagementGroupID}}
+	}
+	return Scope{Subscriptions: c.Subscriptions()}
 }
 
 // Client handles Azure resource discovery
 type Client struct {
-	auth   *auth.AzureAuthenticator
-	cache  *cache.Cache
-	config Config
+	auth     *auth.AzureAuthenticator
+	cache    *cache.Cache
+	config   Config
+	limiter  *rateLimiter
+	warnings []string
 }
 
 // NewDiscoveryClient creates a new discovery client
 func NewDiscoveryClient(auth *auth.AzureAuthenticator, cache *cache.Cache, config Config) *Client {
 	return &Client{
-		auth:   auth,
-		cache:  cache,
-		config: config,
+		auth:    auth,
+		cache:   cache,
+		config:  config,
+		limiter: newRateLimiter(config.RateLimitRPS, config.RateLimitBurst),
 	}
 }
 
+// wait blocks until the rate limiter allows another Azure API request
+func (c *Client) wait(ctx context.Context) error {
+	return c.limiter.Wait(ctx)
+}
+
 // Result contains discovery results
 type Result struct {
-	SubscriptionID string                 `json:"subscriptionId"`
-	Timestamp      string                 `json:"timestamp"`
-	Stats          Stats                  `json:"stats"`
-	RawData        map[string]interface{} `json:"rawData,omitempty"`
+	SubscriptionID    string                 `json:"subscriptionId"`
+	Subscriptions     []string               `json:"subscriptions,omitempty"`     // Every subscription present in the dataset
+	ManagementGroupID string                 `json:"managementGroupId,omitempty"` // Set when scanned by management group
+	Timestamp         string                 `json:"timestamp"`
+	Stats             Stats                  `json:"stats"`
+	RawData           map[string]interface{} `json:"rawData,omitempty"`
 }
 
 // Stats contains resource statistics
 type Stats struct {
-	TotalResources int `json:"totalResources"`
-	VNets          int `json:"vnets"`
-	Subnets        int `json:"subnets"`
-	NSGs           int `json:"nsgs"`
-	RouteTables    int `json:"routeTables"`
+	TotalResources int      `json:"totalResources"`
+	VNets          int      `json:"vnets"`
+	Subnets        int      `json:"subnets"`
+	NSGs           int      `json:"nsgs"`
+	RouteTables    int      `json:"routeTables"`
+	Warnings       []string `json:"warnings,omitempty"` // e.g. result sets that were capped
+
+	// Per-subscription breakdown, keyed by subscription ID
+	BySubscription map[string]*Stats `json:"bySubscription,omitempty"`
+}
+
+// count adds a resource of the given type to the stats
+func (s *Stats) count(resType string) {
+	s.TotalResources++
+
+	// Resource Graph returns lowercase types, normalize them
+	switch strings.ToLower(resType) {
+	case "microsoft.network/virtualnetworks":
+		s.VNets++
+	case "microsoft.network/virtualnetworks/subnets":
+		s.Subnets++
+	case "microsoft.network/networksecuritygroups":
+		s.NSGs++
+	case "microsoft.network/routetables":
+		s.RouteTables++
+	}
 }
 
 // Discover performs resource discovery
 func (c *Client) Discover(ctx context.Context) (*Result, error) {
 	// Use Azure Resource Graph for fast discovery
 	result := &Result{
-		SubscriptionID: c.config.SubscriptionID,
-		Timestamp:      fmt.Sprintf("%v", time.Now().UTC().Format(time.RFC3339)),
-		Stats:          Stats{},
-		RawData:        make(map[string]interface{}),
+		SubscriptionID:    c.config.SubscriptionID,
+		ManagementGroupID: c.config.ManagementGroupID,
+		Timestamp:         fmt.Sprintf("%v", time.Now().UTC().Format(time.RFC3339)),
+		Stats:             Stats{},
+		RawData:           make(map[string]interface{}),
 	}
 
 	// Query all resources using Resource Graph
@@ -69,33 +138,64 @@ func (c *Client) Discover(ctx context.Context) (*Result, error) {
 		return nil, fmt.Errorf("failed to query Resource Graph: %w", err)
 	}
 
-	// Count resources by type
-	result.Stats.TotalResources = len(resources)
+	// Resource groups are only used to find empty ones, so a failure is a warning
+	groups, err := c.GetResourceGroups(ctx)
+	if err != nil {
+		c.warnings = append(c.warnings, fmt.Sprintf("resource groups: %v", err))
+	}
+
+	// VM power states drive the idle and right-sizing cost checks
+	if err := c.FetchPowerStates(ctx, resources); err != nil {
+		c.warnings = append(c.warnings, fmt.Sprintf("power states: %v", err))
+	}
+
+	// Count resources by type, overall and per subscription
+	result.Stats.BySubscription = make(map[string]*Stats)
+	for _, sub := range c.config.Subscriptions() {
+		result.Stats.BySubscription[strings.ToLower(sub)] = &Stats{}
+	}
 
 	for _, res := range resources {
-		resType, ok := res["type"].(string)
-		if !ok {
+		resType, _ := res["type"].(string)
+		result.Stats.count(resType)
+
+		sub := subscriptionOf(res)
+		if sub == "" {
 			continue
 		}
-
-		// Resource Graph returns lowercase types, normalize them
-		switch {
-		case resType == "microsoft.network/virtualnetworks" || resType == "Microsoft.Network/virtualNetworks":
-			result.Stats.VNets++
-		case resType == "microsoft.network/virtualnetworks/subnets" || resType == "Microsoft.Network/virtualNetworks/subnets":
-			result.Stats.Subnets++
-		case resType == "microsoft.network/networksecuritygroups" || resType == "Microsoft.Network/networkSecurityGroups":
-			result.Stats.NSGs++
-		case resType == "microsoft.network/routetables" || resType == "Microsoft.Network/routeTables":
-			result.Stats.RouteTables++
+		if _, ok := result.Stats.BySubscription[sub]; !ok {
+			result.Stats.BySubscription[sub] = &Stats{}
 		}
+		result.Stats.BySubscription[sub].count(resType)
+	}
+
+	for sub := range result.Stats.BySubscription {
+		result.Subscriptions = append(result.Subscriptions, sub)
+	}
+	sort.Strings(result.Subscriptions)
+	if result.SubscriptionID == "" && len(result.Subscriptions) > 0 {
+		result.SubscriptionID = result.Subscriptions[0]
 	}
 
 	result.RawData["resources"] = resources
+	if groups != nil {
+		result.RawData["resourceGroups"] = groups
+	}
+	result.Stats.Warnings = c.Warnings()
 
 	return result, nil
 }
 
+// Subscriptions returns the subscriptions the client is configured to scan
+func (c *Client) Subscriptions() []string {
+	return c.config.Subscriptions()
+}
+
+// Warnings returns warnings collected by queries run so far
+func (c *Client) Warnings() []string {
+	return append([]string(nil), c.warnings...)
+}
+
 // queryResourceGraph queries Azure Resource Graph for all resources
 func (c *Client) queryResourceGraph(ctx context.Context) ([]map[string]interface{}, error) {
 	return c.getAllResources(ctx)
@@ -123,14 +223,39 @@ func (r *Result) SaveToDirectory(dir string) error {
 		if err := os.WriteFile(resourcesPath, resourcesData, 0644); err != nil {
 			return fmt.Errorf("failed to write resources: %w", err)
 		}
+
+		if rows, ok := resources.([]map[string]interface{}); ok {
+			// Save one partition per subscription to raw/subscriptions/<id>.json
+			if err := savePartitions(rows, filepath.Join(rawDir, "subscriptions")); err != nil {
+				return err
+			}
+
+			// Save typed models to normalized/*.json
+			if err := normalize.SaveToDirectory(normalize.Normalize(rows), dir); err != nil {
+				return fmt.Errorf("failed to save normalized data: %w", err)
+			}
+		}
+	}
+
+	// Save resource groups to raw/resource-groups.json
+	if groups, ok := r.RawData["resourceGroups"]; ok {
+		groupsData, err := json.MarshalIndent(groups, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal resource groups: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(rawDir, "resource-groups.json"), groupsData, 0644); err != nil {
+			return fmt.Errorf("failed to write resource groups: %w", err)
+		}
 	}
 
 	// Save metadata
 	metaPath := filepath.Join(dir, "metadata.json")
 	metaData, err := json.MarshalIndent(map[string]interface{}{
-		"subscriptionId": r.SubscriptionID,
-		"timestamp":      r.Timestamp,
-		"stats":          r.Stats,
+		"subscriptionId":    r.SubscriptionID,
+		"subscriptions":     r.Subscriptions,
+		"managementGroupId": r.ManagementGroupID,
+		"timestamp":         r.Timestamp,
+		"stats":             r.Stats,
 	}, "", "  ")
 	if err != nil {
 		return err
@@ -138,3 +263,44 @@ func (r *Result) SaveToDirectory(dir string) error {
 
 	return os.WriteFile(metaPath, metaData, 0644)
 }
+
+// savePartitions writes the resources of each subscription to its own file
+func savePartitions(resources []map[string]interface{}, dir string) error {
+	partitions := make(map[string][]map[string]interface{})
+	for _, res := range resources {
+		if sub := subscriptionOf(res); sub != "" {
+			partitions[sub] = append(partitions[sub], res)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create partition directory: %w", err)
+	}
+
+	for sub, rows := range partitions {
+		data, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal partition %s: %w", sub, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, sub+".json"), data, 0644); err != nil {
+			return fmt.Errorf("failed to write partition %s: %w", sub, err)
+		}
+	}
+
+	return nil
+}
+
+// subscriptionOf returns the lowercased subscription ID of a resource row,
+// falling back to parsing the resource ID
+func subscriptionOf(res map[string]interface{}) string {
+	if sub, ok := res["subscriptionId"].(string); ok && sub != "" {
+		return strings.ToLower(sub)
+	}
+
+	id, _ := res["id"].(string)
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	if len(parts) >= 2 && strings.EqualFold(parts[0], "subscriptions") {
+		return strings.ToLower(parts[1])
+	}
+	return ""
+}
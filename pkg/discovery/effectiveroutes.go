@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// effectiveRoutesAPIVersion is the Microsoft.Network API version used for
+// the effectiveRouteTable action
+const effectiveRoutesAPIVersion = "2023-09-01"
+
+// effectiveRouteList is the response body of the effectiveRouteTable action
+type effectiveRouteList struct {
+	Value []struct {
+		Name                       string   `json:"name"`
+		Source                     string   `json:"source"`
+		State                      string   `json:"state"`
+		AddressPrefix              []string `json:"addressPrefix"`
+		NextHopType                string   `json:"nextHopType"`
+		NextHopIPAddress           []string `json:"nextHopIpAddress"`
+		DisableBGPRoutePropagation bool     `json:"disableBgpRoutePropagation"`
+	} `json:"value"`
+}
+
+// FetchEffectiveRoutes retrieves the effective route table of each NIC.
+// The action only succeeds for NICs attached to running VMs, so failures are
+// recorded as warnings rather than aborting the scan. maxRoutes limits the
+// routes kept per NIC (0 keeps all).
+func (c *Client) FetchEffectiveRoutes(ctx context.Context, nics []models.NetworkInterface, maxRoutes int) ([]models.EffectiveRoutes, error) {
+	client, err := arm.NewClient("azdoc", "v1", c.auth.GetCredential(), QueryOptions{Endpoint: c.config.Endpoint}.clientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ARM client: %w", err)
+	}
+
+	concurrency := c.config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []models.EffectiveRoutes
+		sem     = make(chan struct{}, concurrency)
+	)
+
+	for _, nic := range nics {
+		wg.Add(1)
+		go func(nic models.NetworkInterface) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			routes, err := c.fetchEffectiveRoutes(ctx, client, nic.ID)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				c.warnings = append(c.warnings, fmt.Sprintf("effective routes for %s: %v", nic.Name, err))
+				return
+			}
+
+			entry := models.EffectiveRoutes{
+				NICID:        nic.ID,
+				NICName:      nic.Name,
+				SubnetID:     nic.SubnetID,
+				Routes:       routes,
+				SampledAt:    time.Now().UTC(),
+				TopNPrefixes: maxRoutes,
+			}
+			if maxRoutes > 0 && len(entry.Routes) > maxRoutes {
+				entry.Routes = entry.Routes[:maxRoutes]
+			}
+			results = append(results, entry)
+		}(nic)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].NICID < results[j].NICID })
+
+	return results, nil
+}
+
+// fetchEffectiveRoutes runs the effectiveRouteTable long-running action for one NIC
+func (c *Client) fetchEffectiveRoutes(ctx context.Context, client *arm.Client, nicID string) ([]models.EffectiveRoute, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := runtime.NewRequest(ctx, http.MethodPost, runtime.JoinPaths(client.Endpoint(), nicID, "effectiveRouteTable"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	query := req.Raw().URL.Query()
+	query.Set("api-version", effectiveRoutesAPIVersion)
+	req.Raw().URL.RawQuery = query.Encode()
+
+	resp, err := client.Pipeline().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK, http.StatusAccepted) {
+		return nil, runtime.NewResponseError(resp)
+	}
+
+	poller, err := runtime.NewPoller[effectiveRouteList](resp, client.Pipeline(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create poller: %w", err)
+	}
+	list, err := poller.PollUntilDone(ctx, &runtime.PollUntilDoneOptions{Frequency: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("polling failed: %w", err)
+	}
+
+	routes := make([]models.EffectiveRoute, 0, len(list.Value))
+	for _, r := range list.Value {
+		routes = append(routes, models.EffectiveRoute{
+			Name:                r.Name,
+			Source:              r.Source,
+			State:               r.State,
+			AddressPrefixes:     r.AddressPrefix,
+			NextHopType:         r.NextHopType,
+			NextHopIPAddresses:  r.NextHopIPAddress,
+			DisableBGPRouteProp: r.DisableBGPRoutePropagation,
+		})
+	}
+
+	return routes, nil
+}
+
+// SaveEffectiveRoutes saves effective routes to a JSON file
+func SaveEffectiveRoutes(routes []models.EffectiveRoutes, outputPath string) error {
+	data, err := json.MarshalIndent(routes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal effective routes: %w", err)
+	}
+
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write effective routes file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// computeAPIVersion is the Microsoft.Compute API version used for VM
+// instance views
+const computeAPIVersion = "2024-03-01"
+
+// FetchPowerStates fills in the power state of VMs whose Resource Graph row
+// has none, from the VM instance view. Resource Graph usually reports it in
+// properties.extended.instanceView; the instance view is stored in
+// properties.instanceView as returned by ARM. Failures are recorded as
+// warnings.
+func (c *Client) FetchPowerStates(ctx context.Context, resources []map[string]interface{}) error {
+	var missing []map[string]interface{}
+	for _, res := range resources {
+		resType, _ := res["type"].(string)
+		if !strings.EqualFold(resType, "microsoft.compute/virtualmachines") {
+			continue
+		}
+		props, _ := res["properties"].(map[string]interface{})
+		if props == nil {
+			props = make(map[string]interface{})
+			res["properties"] = props
+		}
+		if extended, ok := props["extended"].(map[string]interface{}); ok {
+			if view, ok := extended["instanceView"].(map[string]interface{}); ok && view["powerState"] != nil {
+				continue
+			}
+		}
+		missing = append(missing, res)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	client, err := arm.NewClient("azdoc", "v1", c.auth.GetCredential(), QueryOptions{Endpoint: c.config.Endpoint}.clientOptions())
+	if err != nil {
+		return fmt.Errorf("failed to create ARM client: %w", err)
+	}
+
+	concurrency := c.config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+
+	for _, res := range missing {
+		wg.Add(1)
+		go func(res map[string]interface{}) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			id, _ := res["id"].(string)
+			view, err := c.fetchInstanceView(ctx, client, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				name, _ := res["name"].(string)
+				c.warnings = append(c.warnings, fmt.Sprintf("instance view for %s: %v", name, err))
+				return
+			}
+			res["properties"].(map[string]interface{})["instanceView"] = view
+		}(res)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// fetchInstanceView reads the instance view of one VM
+func (c *Client) fetchInstanceView(ctx context.Context, client *arm.Client, vmID string) (map[string]interface{}, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := runtime.NewRequest(ctx, http.MethodGet, runtime.JoinPaths(client.Endpoint(), vmID, "instanceView"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	query := req.Raw().URL.Query()
+	query.Set("api-version", computeAPIVersion)
+	req.Raw().URL.RawQuery = query.Encode()
+
+	resp, err := client.Pipeline().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return nil, runtime.NewResponseError(resp)
+	}
+
+	var view map[string]interface{}
+	if err := runtime.UnmarshalAsJSON(resp, &view); err != nil {
+		return nil, fmt.Errorf("failed to parse instance view: %w", err)
+	}
+	return view, nil
+}
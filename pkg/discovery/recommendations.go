@@ -25,7 +25,7 @@ func (c *Client) FetchRecommendations(ctx context.Context) ([]map[string]interfa
 		resourceId = tostring(properties.resourceMetadata.resourceId)
 	`
 
-	return QueryResourceGraph(ctx, c.auth, c.config.SubscriptionID, query)
+	return c.query(ctx, "recommendations", query)
 }
 
 // SaveRecommendations saves recommendations to JSON file
@@ -2,68 +2,302 @@ package discovery
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
 	"github.com/automationpi/azdocs/pkg/auth"
 )
 
-// QueryResourceGraph queries Azure Resource Graph for resources
-func QueryResourceGraph(ctx context.Context, authClient *auth.AzureAuthenticator, subscriptionID string, query string) ([]map[string]interface{}, error) {
+// QueryOptions controls paging of Resource Graph queries
+type QueryOptions struct {
+	PageSize   int    // Rows requested per page ($top), 0 uses the service default
+	Skip       int    // Rows to skip before the first page ($skip)
+	MaxResults int    // Cap on the total rows returned, 0 means no limit
+	Endpoint   string // Resource Manager endpoint override (e.g. a local fake server)
+
+	// OnPage is called after each page has been fetched
+	OnPage func(page int, fetched int, total int64)
+
+	// Wait is called before each page request, e.g. for rate limiting
+	Wait func(ctx context.Context) error
+}
+
+// Scope selects the subscriptions or management groups a query runs against
+type Scope struct {
+	Subscriptions    []string
+	ManagementGroups []string
+}
+
+// QueryResult contains the rows returned by a paginated query
+type QueryResult struct {
+	Rows         []map[string]interface{}
+	TotalRecords int64
+	Pages        int
+	Truncated    bool // Result set was capped by MaxResults or by Resource Graph
+}
+
+// QueryResourceGraph queries Azure Resource Graph for resources, following
+// skip tokens until all pages have been retrieved
+func QueryResourceGraph(ctx context.Context, authClient *auth.AzureAuthenticator, scope Scope, query string, opts QueryOptions) (*QueryResult, error) {
+	if len(scope.Subscriptions) == 0 && len(scope.ManagementGroups) == 0 {
+		return nil, fmt.Errorf("query scope requires at least one subscription or management group")
+	}
+
 	// Create Resource Graph client
-	client, err := armresourcegraph.NewClient(authClient.GetCredential(), nil)
+	client, err := armresourcegraph.NewClient(authClient.GetCredential(), opts.clientOptions())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Resource Graph client: %w", err)
 	}
 
 	// Build query request
+	resultFormat := armresourcegraph.ResultFormatObjectArray
 	request := armresourcegraph.QueryRequest{
-		Subscriptions: []*string{&subscriptionID},
-		Query:         &query,
+		Query: &query,
+		Options: &armresourcegraph.QueryRequestOptions{
+			ResultFormat: &resultFormat,
+		},
 	}
 
-	// Execute query
-	response, err := client.Resources(ctx, request, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+	// Management groups take precedence; Resource Graph rejects requests that set both
+	if len(scope.ManagementGroups) > 0 {
+		request.ManagementGroups = toPtrSlice(scope.ManagementGroups)
+	} else {
+		request.Subscriptions = toPtrSlice(scope.Subscriptions)
+	}
+	if opts.PageSize > 0 {
+		top := int32(opts.PageSize)
+		request.Options.Top = &top
+	}
+	if opts.Skip > 0 {
+		skip := int32(opts.Skip)
+		request.Options.Skip = &skip
 	}
 
-	// Parse results
-	if response.Data == nil {
-		return []map[string]interface{}{}, nil
+	result := &QueryResult{Rows: []map[string]interface{}{}}
+
+	for {
+		if opts.Wait != nil {
+			if err := opts.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		// Execute query
+		response, err := client.Resources(ctx, request, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute query (page %d): %w", result.Pages+1, err)
+		}
+
+		rows, err := parseRows(response.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Rows = append(result.Rows, rows...)
+		result.Pages++
+		if response.TotalRecords != nil {
+			result.TotalRecords = *response.TotalRecords
+		}
+		if response.ResultTruncated != nil && *response.ResultTruncated == armresourcegraph.ResultTruncatedTrue {
+			result.Truncated = true
+		}
+
+		if opts.OnPage != nil {
+			opts.OnPage(result.Pages, len(result.Rows), result.TotalRecords)
+		}
+
+		hasMore := response.SkipToken != nil && *response.SkipToken != ""
+
+		// Stop once the caller's cap has been reached
+		if opts.MaxResults > 0 && len(result.Rows) >= opts.MaxResults {
+			if len(result.Rows) > opts.MaxResults || hasMore || result.TotalRecords > int64(opts.MaxResults) {
+				result.Truncated = true
+			}
+			if len(result.Rows) > opts.MaxResults {
+				result.Rows = result.Rows[:opts.MaxResults]
+			}
+			break
+		}
+
+		if !hasMore {
+			break
+		}
+
+		// The skip token carries the next offset, so $skip must not be resent
+		request.Options.SkipToken = response.SkipToken
+		request.Options.Skip = nil
 	}
 
-	// Convert response data to slice of maps
-	var results []map[string]interface{}
+	return result, nil
+}
+
+// parseRows converts the Data field of a query response to a slice of maps
+func parseRows(data interface{}) ([]map[string]interface{}, error) {
+	if data == nil {
+		return []map[string]interface{}{}, nil
+	}
 
 	// The Data field is an interface{}, need to handle it properly
-	dataBytes, err := json.Marshal(response.Data)
+	dataBytes, err := json.Marshal(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal response data: %w", err)
 	}
 
-	if err := json.Unmarshal(dataBytes, &results); err != nil {
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(dataBytes, &rows); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response data: %w", err)
 	}
 
-	return results, nil
+	return rows, nil
+}
+
+// toPtrSlice converts a string slice to the pointer slice the SDK expects
+func toPtrSlice(values []string) []*string {
+	ptrs := make([]*string, len(values))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	return ptrs
+}
+
+// clientOptions builds ARM client options, pointing the client at a custom
+// Resource Manager endpoint when one is configured
+func (o QueryOptions) clientOptions() *arm.ClientOptions {
+	if o.Endpoint == "" {
+		return nil
+	}
+
+	endpoint := strings.TrimSuffix(o.Endpoint, "/")
+	return &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Cloud: cloud.Configuration{
+				ActiveDirectoryAuthorityHost: cloud.AzurePublic.ActiveDirectoryAuthorityHost,
+				Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+					cloud.ResourceManager: {
+						Audience: endpoint,
+						Endpoint: endpoint,
+					},
+				},
+			},
+			// Local fake endpoints are usually served over plain HTTP
+			InsecureAllowCredentialWithHTTP: strings.HasPrefix(endpoint, "http://"),
+		},
+	}
+}
+
+// query runs a Resource Graph query with the client's paging settings,
+// reporting per-page progress and recording a warning if the result was capped
+func (c *Client) query(ctx context.Context, name string, query string) ([]map[string]interface{}, error) {
+	opts := QueryOptions{
+		PageSize:   c.config.PageSize,
+		Skip:       c.config.Skip,
+		MaxResults: c.config.MaxResults,
+		Endpoint:   c.config.Endpoint,
+		Wait:       c.wait,
+	}
+
+	// Reuse results cached by an earlier scan of the same scope
+	cacheKey := c.cacheKey(name, query)
+	if c.cache != nil && c.config.CacheTTL > 0 {
+		var cached []map[string]interface{}
+		if err := c.cache.GetWithTTL(cacheKey, c.config.CacheTTL, &cached); err == nil {
+			if c.config.ShowProgress {
+				fmt.Printf("  [%s] using %d cached rows\n", name, len(cached))
+			}
+			return cached, nil
+		}
+	}
+
+	if c.config.ShowProgress {
+		opts.OnPage = func(page int, fetched int, total int64) {
+			fmt.Printf("  [%s] page %d: %d/%d rows\n", name, page, fetched, total)
+		}
+	}
+
+	result, err := QueryResourceGraph(ctx, c.auth, c.config.scope(), query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Truncated {
+		c.warnings = append(c.warnings, fmt.Sprintf("%s: result set capped at %d of %d rows", name, len(result.Rows), result.TotalRecords))
+	} else if c.cache != nil && c.config.CacheTTL > 0 {
+		if err := c.cache.Set(cacheKey, result.Rows); err != nil {
+			c.warnings = append(c.warnings, fmt.Sprintf("%s: failed to cache results: %v", name, err))
+		}
+	}
+
+	return result.Rows, nil
+}
+
+// cacheKey identifies a query and the scope and paging it ran with
+func (c *Client) cacheKey(name string, query string) string {
+	scope := c.config.scope()
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		query,
+		strings.Join(scope.Subscriptions, ","),
+		strings.Join(scope.ManagementGroups, ","),
+		fmt.Sprintf("%d/%d/%d", c.config.PageSize, c.config.Skip, c.config.MaxResults),
+	}, "|")))
+	return fmt.Sprintf("query-%s-%s", name, hex.EncodeToString(hash[:8]))
 }
 
-// GetAllResources retrieves all resources in a subscription
+// typeFilter returns a KQL where clause for the include/exclude type lists
+func (c *Client) typeFilter() string {
+	var filter strings.Builder
+	if len(c.config.IncludeTypes) > 0 {
+		filter.WriteString(fmt.Sprintf(" | where type in~ (%s)", kqlStrings(c.config.IncludeTypes)))
+	}
+	if len(c.config.ExcludeTypes) > 0 {
+		filter.WriteString(fmt.Sprintf(" | where type !in~ (%s)", kqlStrings(c.config.ExcludeTypes)))
+	}
+	return filter.String()
+}
+
+// kqlStrings formats values as a comma-separated list of KQL string literals
+func kqlStrings(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + strings.ReplaceAll(strings.TrimSpace(v), "'", "\\'") + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// GetAllResources retrieves all resources in the configured scope
 func (c *Client) getAllResources(ctx context.Context) ([]map[string]interface{}, error) {
-	query := "Resources | project id, name, type, location, resourceGroup, tags, properties"
+	query := "Resources" + c.typeFilter() + " | project id, name, type, location, resourceGroup, subscriptionId, managedBy, sku, kind, tags, properties | order by id asc"
+
+	return c.query(ctx, "resources", query)
+}
+
+// GetResourceGroups retrieves the resource groups in the configured scope
+// with the number of resources in each, counted before type filters apply
+func (c *Client) GetResourceGroups(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `ResourceContainers
+| where type == 'microsoft.resources/subscriptions/resourcegroups'
+| extend rg = tolower(name)
+| join kind=leftouter (Resources | summarize resourceCount = count() by subscriptionId, rg = tolower(resourceGroup)) on subscriptionId, rg
+| project id, name, type, location, subscriptionId, managedBy, tags, properties, resourceCount = iff(isnull(resourceCount), 0, resourceCount)
+| order by id asc`
 
-	return QueryResourceGraph(ctx, c.auth, c.config.SubscriptionID, query)
+	return c.query(ctx, "resource-groups", query)
 }
 
 // GetVNetDetails retrieves detailed VNet information including subnets
 func (c *Client) GetVNetDetails(ctx context.Context) ([]map[string]interface{}, error) {
 	query := `Resources
 | where type == 'microsoft.network/virtualnetworks'
-| project id, name, type, location, resourceGroup, tags, properties`
+| project id, name, type, location, resourceGroup, subscriptionId, tags, properties
+| order by id asc`
 
-	return QueryResourceGraph(ctx, c.auth, c.config.SubscriptionID, query)
+	return c.query(ctx, "vnets", query)
 }
 
 // GetVNetPeerings retrieves VNet peering information
@@ -71,9 +305,10 @@ func (c *Client) GetVNetPeerings(ctx context.Context) ([]map[string]interface{},
 	query := `Resources
 | where type == 'microsoft.network/virtualnetworks'
 | mv-expand peering = properties.virtualNetworkPeerings
-| project vnetId = id, vnetName = name, peeringName = peering.name,
+| project id = tostring(peering.id), vnetId = id, vnetName = name, peeringName = peering.name,
   remoteVNetId = tostring(peering.properties.remoteVirtualNetwork.id),
-  peeringState = tostring(peering.properties.peeringState)`
+  peeringState = tostring(peering.properties.peeringState)
+| order by vnetId asc`
 
-	return QueryResourceGraph(ctx, c.auth, c.config.SubscriptionID, query)
+	return c.query(ctx, "peerings", query)
 }
@@ -0,0 +1,214 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/automationpi/azdocs/pkg/auth"
+)
+
+// staticCredential returns a fixed token for the fake endpoint
+type staticCredential struct{}
+
+func (staticCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "fake", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// graphRequest is the part of a Resource Graph query request the fake reads
+type graphRequest struct {
+	Query         string   `json:"query"`
+	Subscriptions []string `json:"subscriptions"`
+	Options       struct {
+		Top       *int   `json:"$top"`
+		Skip      *int   `json:"$skip"`
+		SkipToken string `json:"$skipToken"`
+	} `json:"options"`
+}
+
+// fakeResourceGraph serves total rows in pages of pageSize, handing out the
+// next offset as the skip token like Resource Graph does
+type fakeResourceGraph struct {
+	total     int
+	pageSize  int
+	truncated bool
+
+	mu       sync.Mutex
+	requests []graphRequest
+}
+
+func (f *fakeResourceGraph) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/providers/Microsoft.ResourceGraph/resources") {
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer fake" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req graphRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	start := 0
+	if req.Options.Skip != nil {
+		start = *req.Options.Skip
+	}
+	if req.Options.SkipToken != "" {
+		fmt.Sscanf(req.Options.SkipToken, "offset-%d", &start)
+	}
+	size := f.pageSize
+	if req.Options.Top != nil && *req.Options.Top < size {
+		size = *req.Options.Top
+	}
+	end := start + size
+	if end > f.total {
+		end = f.total
+	}
+
+	rows := []map[string]interface{}{}
+	for i := start; i < end; i++ {
+		rows = append(rows, map[string]interface{}{"id": fmt.Sprintf("/subscriptions/sub1/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet%03d", i)})
+	}
+	resp := map[string]interface{}{
+		"totalRecords":    f.total,
+		"count":           len(rows),
+		"resultTruncated": fmt.Sprintf("%t", f.truncated),
+		"data":            rows,
+	}
+	if end < f.total {
+		resp["$skipToken"] = fmt.Sprintf("offset-%d", end)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// query runs QueryResourceGraph against a fake endpoint
+func (f *fakeResourceGraph) query(t *testing.T, opts QueryOptions) *QueryResult {
+	t.Helper()
+
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	opts.Endpoint = server.URL
+	authClient := auth.NewAuthenticatorWithCredential(staticCredential{}, "")
+	result, err := QueryResourceGraph(context.Background(), authClient, Scope{Subscriptions: []string{"sub1"}}, "Resources", opts)
+	if err != nil {
+		t.Fatalf("QueryResourceGraph: %v", err)
+	}
+	return result
+}
+
+func TestQueryResourceGraphFollowsSkipTokens(t *testing.T) {
+	fake := &fakeResourceGraph{total: 250, pageSize: 1000}
+
+	var pages []int
+	result := fake.query(t, QueryOptions{
+		PageSize: 100,
+		OnPage:   func(page int, fetched int, total int64) { pages = append(pages, fetched) },
+	})
+
+	if len(result.Rows) != 250 || result.Pages != 3 || result.TotalRecords != 250 || result.Truncated {
+		t.Fatalf("got %d rows in %d pages of %d records (truncated %t), want 250 rows in 3 pages",
+			len(result.Rows), result.Pages, result.TotalRecords, result.Truncated)
+	}
+	for i, row := range result.Rows {
+		if want := fmt.Sprintf("vnet%03d", i); !strings.HasSuffix(row["id"].(string), want) {
+			t.Fatalf("row %d is %v, want %s", i, row["id"], want)
+		}
+	}
+	if fmt.Sprint(pages) != "[100 200 250]" {
+		t.Errorf("OnPage saw %v rows, want [100 200 250]", pages)
+	}
+
+	if len(fake.requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(fake.requests))
+	}
+	for i, req := range fake.requests {
+		if req.Options.Top == nil || *req.Options.Top != 100 {
+			t.Errorf("request %d: $top = %v, want 100", i, req.Options.Top)
+		}
+		if fmt.Sprint(req.Subscriptions) != "[sub1]" {
+			t.Errorf("request %d: subscriptions = %v, want [sub1]", i, req.Subscriptions)
+		}
+	}
+	if fake.requests[0].Options.SkipToken != "" {
+		t.Errorf("first request sent skip token %q", fake.requests[0].Options.SkipToken)
+	}
+	if got := fake.requests[2].Options.SkipToken; got != "offset-200" {
+		t.Errorf("third request skip token = %q, want offset-200", got)
+	}
+}
+
+func TestQueryResourceGraphSkipIsNotResent(t *testing.T) {
+	fake := &fakeResourceGraph{total: 30, pageSize: 10}
+
+	result := fake.query(t, QueryOptions{Skip: 5})
+
+	if len(result.Rows) != 25 || result.Pages != 3 {
+		t.Fatalf("got %d rows in %d pages, want 25 rows in 3 pages", len(result.Rows), result.Pages)
+	}
+	if skip := fake.requests[0].Options.Skip; skip == nil || *skip != 5 {
+		t.Errorf("first request $skip = %v, want 5", skip)
+	}
+	for i, req := range fake.requests[1:] {
+		if req.Options.Skip != nil {
+			t.Errorf("request %d resent $skip %d with a skip token", i+2, *req.Options.Skip)
+		}
+	}
+}
+
+func TestQueryResourceGraphMaxResults(t *testing.T) {
+	fake := &fakeResourceGraph{total: 250, pageSize: 100}
+
+	result := fake.query(t, QueryOptions{MaxResults: 150})
+
+	if len(result.Rows) != 150 || !result.Truncated {
+		t.Fatalf("got %d rows (truncated %t), want 150 truncated rows", len(result.Rows), result.Truncated)
+	}
+	if len(fake.requests) != 2 {
+		t.Errorf("got %d requests, want paging to stop after 2", len(fake.requests))
+	}
+}
+
+func TestQueryResourceGraphMaxResultsNotTruncatedAtExactTotal(t *testing.T) {
+	fake := &fakeResourceGraph{total: 100, pageSize: 100}
+
+	result := fake.query(t, QueryOptions{MaxResults: 100})
+
+	if len(result.Rows) != 100 || result.Truncated {
+		t.Fatalf("got %d rows (truncated %t), want 100 complete rows", len(result.Rows), result.Truncated)
+	}
+}
+
+func TestQueryResourceGraphServiceTruncation(t *testing.T) {
+	fake := &fakeResourceGraph{total: 20, pageSize: 20, truncated: true}
+
+	result := fake.query(t, QueryOptions{})
+
+	if !result.Truncated {
+		t.Error("result not marked truncated when Resource Graph reports resultTruncated")
+	}
+}
+
+func TestQueryResourceGraphRequiresScope(t *testing.T) {
+	authClient := auth.NewAuthenticatorWithCredential(staticCredential{}, "")
+	if _, err := QueryResourceGraph(context.Background(), authClient, Scope{}, "Resources", QueryOptions{}); err == nil {
+		t.Error("expected an error for an empty scope")
+	}
+}
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+	"github.com/automationpi/azdocs/pkg/waiver"
+)
+
+// Formats supported by Write
+const (
+	FormatSARIF = "sarif"
+	FormatJUnit = "junit"
+	FormatJSON  = "json"
+)
+
+// Options describe the tool run being exported
+type Options struct {
+	ToolVersion string
+	// SourceFile is the scanned data file reported as the artifact location
+	SourceFile string
+	Generated  time.Time
+	// Waived findings are reported as suppressed rather than omitted
+	Waived []waiver.Waived
+}
+
+// Write renders the report's findings in the given format
+func Write(w io.Writer, format string, report *analysis.Report, opts Options) error {
+	switch format {
+	case FormatSARIF:
+		return WriteSARIF(w, report, opts)
+	case FormatJUnit:
+		return WriteJUnit(w, report, opts)
+	case FormatJSON:
+		return WriteJSON(w, report, opts)
+	default:
+		return fmt.Errorf("unsupported export format %q (use sarif, junit or json)", format)
+	}
+}
+
+// resourceIDsOf returns the resource IDs of a finding, falling back to
+// resource names when an ID is unknown
+func resourceIDsOf(finding analysis.Finding) []string {
+	var ids []string
+	for i, id := range finding.ResourceIDs {
+		if id == "" && i < len(finding.Resources) {
+			id = finding.Resources[i]
+		}
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		ids = append(ids, finding.Resources...)
+	}
+	return ids
+}
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+	"github.com/automationpi/azdocs/pkg/waiver"
+)
+
+// jsonReport is the JSON export document
+type jsonReport struct {
+	Tool      string             `json:"tool"`
+	Version   string             `json:"version,omitempty"`
+	Generated time.Time          `json:"generated"`
+	Scores    map[string]int     `json:"scores"`
+	Rules     []jsonRule         `json:"rules"`
+	Findings  []analysis.Finding `json:"findings"`
+	Waived    []waiver.Waived    `json:"waived"`
+}
+
+type jsonRule struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Analysis    string `json:"analysis"`
+	Description string `json:"description"`
+}
+
+// WriteJSON writes scores, the rule catalog, findings and waived findings
+// as JSON
+func WriteJSON(w io.Writer, report *analysis.Report, opts Options) error {
+	doc := jsonReport{
+		Tool:      toolName,
+		Version:   opts.ToolVersion,
+		Generated: opts.Generated,
+		Scores:    report.Scores(),
+		Findings:  report.Findings(),
+	}
+	if doc.Findings == nil {
+		doc.Findings = []analysis.Finding{}
+	}
+	doc.Waived = opts.Waived
+	if doc.Waived == nil {
+		doc.Waived = []waiver.Waived{}
+	}
+	for _, rule := range report.Rules() {
+		doc.Rules = append(doc.Rules, jsonRule{
+			ID:          rule.ID,
+			Name:        rule.Name,
+			Analysis:    rule.Analysis,
+			Description: rule.Description,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
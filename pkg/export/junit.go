@@ -0,0 +1,136 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+	"github.com/automationpi/azdocs/pkg/waiver"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes findings as a JUnit XML report with one suite per
+// analysis. Every finding is a failed test case; rules without findings are
+// reported as passing test cases and waived findings as skipped ones.
+func WriteJUnit(w io.Writer, report *analysis.Report, opts Options) error {
+	byRule := make(map[string][]analysis.Finding)
+	for _, finding := range report.Findings() {
+		byRule[finding.RuleID] = append(byRule[finding.RuleID], finding)
+	}
+	waivedByRule := make(map[string][]waiver.Waived)
+	for _, waived := range opts.Waived {
+		waivedByRule[waived.RuleID] = append(waivedByRule[waived.RuleID], waived)
+	}
+
+	suites := junitTestSuites{Name: toolName}
+	for _, name := range analysis.Analyses {
+		suite := junitTestSuite{Name: toolName + "." + strings.ToLower(name)}
+		if !opts.Generated.IsZero() {
+			suite.Timestamp = opts.Generated.UTC().Format("2006-01-02T15:04:05")
+		}
+
+		for _, rule := range report.Rules() {
+			if rule.Analysis != name {
+				continue
+			}
+			className := fmt.Sprintf("%s.%s", suite.Name, rule.ID)
+
+			for _, waived := range waivedByRule[rule.ID] {
+				suite.Cases = append(suite.Cases, junitTestCase{
+					Name:      fmt.Sprintf("%s: %s", rule.Name, strings.Join(waived.Resources, ", ")),
+					ClassName: className,
+					Skipped: &junitSkipped{
+						Message: fmt.Sprintf("Waived until %s by %s: %s", waived.Waiver.Expires, waived.Waiver.Owner, waived.Waiver.Justification),
+					},
+				})
+				suite.Skipped++
+			}
+
+			findings := byRule[rule.ID]
+			if len(findings) == 0 && len(waivedByRule[rule.ID]) == 0 {
+				suite.Cases = append(suite.Cases, junitTestCase{Name: rule.Name, ClassName: className})
+				continue
+			}
+
+			for _, finding := range findings {
+				suite.Cases = append(suite.Cases, junitTestCase{
+					Name:      fmt.Sprintf("%s: %s", rule.Name, strings.Join(finding.Resources, ", ")),
+					ClassName: className,
+					Failure: &junitFailure{
+						Message: finding.Issue,
+						Type:    finding.Severity,
+						Text:    junitFailureText(finding),
+					},
+				})
+				suite.Failures++
+			}
+		}
+
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitFailureText describes a finding in the failure body
+func junitFailureText(finding analysis.Finding) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Severity: %s\n", finding.Severity))
+	if finding.Impact != "" {
+		text.WriteString(fmt.Sprintf("Impact: %s\n", finding.Impact))
+	}
+	if finding.Remediation != "" {
+		text.WriteString(fmt.Sprintf("Remediation: %s\n", finding.Remediation))
+	}
+	for _, id := range resourceIDsOf(finding) {
+		text.WriteString(fmt.Sprintf("Resource: %s\n", id))
+	}
+	return text.String()
+}
@@ -0,0 +1,225 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolName     = "azdoc"
+	toolURI      = "https://github.com/automationpi/azdocs"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string                 `json:"id"`
+	Name             string                 `json:"name"`
+	ShortDescription sarifMessage           `json:"shortDescription"`
+	DefaultConfig    sarifConfig            `json:"defaultConfiguration"`
+	Properties       map[string]interface{} `json:"properties"`
+}
+
+type sarifConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	RuleIndex           int                    `json:"ruleIndex"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints"`
+	Suppressions        []sarifSuppression     `json:"suppressions,omitempty"`
+	Properties          map[string]interface{} `json:"properties"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Status        string `json:"status"`
+	Justification string `json:"justification"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifLevel maps a finding severity to a SARIF result level
+func sarifLevel(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical", "high":
+		return "error"
+	case "medium":
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// securitySeverity maps a severity to the numeric score code-scanning tools
+// use to rank results
+func securitySeverity(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical":
+		return "9.0"
+	case "high":
+		return "7.0"
+	case "medium":
+		return "5.0"
+	default:
+		return "3.0"
+	}
+}
+
+// WriteSARIF writes findings as a SARIF 2.1.0 log with one result per
+// finding and affected resource IDs as locations
+func WriteSARIF(w io.Writer, report *analysis.Report, opts Options) error {
+	findings := report.Findings()
+	suppressions := make(map[int]sarifSuppression)
+	for _, waived := range opts.Waived {
+		suppressions[len(findings)] = sarifSuppression{
+			Kind:          "external",
+			Status:        "accepted",
+			Justification: fmt.Sprintf("%s (owner: %s, expires: %s)", waived.Waiver.Justification, waived.Waiver.Owner, waived.Waiver.Expires),
+		}
+		findings = append(findings, waived.Finding)
+	}
+
+	// The default level of a rule is taken from its most severe finding
+	ruleSeverity := make(map[string]string)
+	for _, finding := range findings {
+		if analysis.SeverityRank(finding.Severity) > analysis.SeverityRank(ruleSeverity[finding.RuleID]) {
+			ruleSeverity[finding.RuleID] = finding.Severity
+		}
+	}
+
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           toolName,
+			Version:        opts.ToolVersion,
+			InformationURI: toolURI,
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	ruleIndex := make(map[string]int)
+	for _, rule := range report.Rules() {
+		severity := ruleSeverity[rule.ID]
+		if severity == "" {
+			severity = "Low"
+		}
+		ruleIndex[rule.ID] = len(run.Tool.Driver.Rules)
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               rule.ID,
+			Name:             rule.Name,
+			ShortDescription: sarifMessage{Text: rule.Description},
+			DefaultConfig:    sarifConfig{Level: sarifLevel(severity)},
+			Properties: map[string]interface{}{
+				"tags":              []string{strings.ToLower(rule.Analysis)},
+				"security-severity": securitySeverity(severity),
+			},
+		})
+	}
+
+	for i, finding := range findings {
+		index, ok := ruleIndex[finding.RuleID]
+		if !ok {
+			return fmt.Errorf("finding %q has unknown rule ID %q", finding.Issue, finding.RuleID)
+		}
+
+		location := sarifLocation{LogicalLocations: []sarifLogicalLocation{}}
+		if opts.SourceFile != "" {
+			location.PhysicalLocation = &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: opts.SourceFile},
+			}
+		}
+		for _, id := range resourceIDsOf(finding) {
+			location.LogicalLocations = append(location.LogicalLocations, sarifLogicalLocation{
+				FullyQualifiedName: id,
+				Kind:               "resource",
+			})
+		}
+
+		message := finding.Issue
+		if finding.Remediation != "" {
+			message += ". Remediation: " + finding.Remediation
+		}
+
+		result := sarifResult{
+			RuleID:    finding.RuleID,
+			RuleIndex: index,
+			Level:     sarifLevel(finding.Severity),
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{location},
+			PartialFingerprints: map[string]string{
+				"azdocFingerprint/v1": finding.Fingerprint,
+			},
+			Properties: map[string]interface{}{
+				"severity":    finding.Severity,
+				"category":    finding.Category,
+				"impact":      finding.Impact,
+				"remediation": finding.Remediation,
+			},
+		}
+		if suppression, ok := suppressions[i]; ok {
+			result.Suppressions = []sarifSuppression{suppression}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
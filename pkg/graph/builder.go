@@ -4,22 +4,442 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
+// Node types
+const (
+	NodeVNet            = "VNet"
+	NodeSubnet          = "Subnet"
+	NodeNIC             = "NIC"
+	NodeVM              = "VM"
+	NodeNSG             = "NSG"
+	NodeRouteTable      = "RouteTable"
+	NodeNATGateway      = "NATGateway"
+	NodePublicIP        = "PublicIP"
+	NodePrivateEndpoint = "PrivateEndpoint"
+	NodeLoadBalancer    = "LB"
+	NodeAppGateway      = "AppGW"
+	NodeFirewall        = "Firewall"
+	NodeGateway         = "Gateway"
+)
+
+// Edge types
+const (
+	EdgeContains       = "contains"        // VNet -> Subnet
+	EdgeAttachedTo     = "attached-to"     // NIC -> Subnet/VM, PublicIP -> consumer, ...
+	EdgeAssociatedWith = "associated-with" // Subnet/NIC -> NSG, Subnet -> RouteTable, ...
+	EdgePeeredWith     = "peered-with"     // VNet -> VNet
+	EdgeRoutesVia      = "routes-via"      // RouteTable -> Firewall/NIC/Gateway
+	EdgeEgressVia      = "egress-via"      // Subnet -> NATGateway
+)
+
+// nodeTypes maps ARM resource types to graph node types
+var nodeTypes = map[string]string{
+	"microsoft.network/virtualnetworks":        NodeVNet,
+	"microsoft.network/networkinterfaces":      NodeNIC,
+	"microsoft.compute/virtualmachines":        NodeVM,
+	"microsoft.network/networksecuritygroups":  NodeNSG,
+	"microsoft.network/routetables":            NodeRouteTable,
+	"microsoft.network/natgateways":            NodeNATGateway,
+	"microsoft.network/publicipaddresses":      NodePublicIP,
+	"microsoft.network/privateendpoints":       NodePrivateEndpoint,
+	"microsoft.network/loadbalancers":          NodeLoadBalancer,
+	"microsoft.network/applicationgateways":    NodeAppGateway,
+	"microsoft.network/azurefirewalls":         NodeFirewall,
+	"microsoft.network/virtualnetworkgateways": NodeGateway,
+}
+
+// Data holds previously scanned data loaded from disk
+type Data struct {
+	Metadata       map[string]interface{}
+	Resources      []map[string]interface{}
+	ResourceGroups []map[string]interface{} // nil for scans that did not list resource groups
+}
+
 // Builder constructs topology graphs from normalized data
 type Builder struct {
-	data interface{}
+	data *Data
+
+	nodes map[string]*Node
+	edges map[string]Edge
 }
 
 // NewBuilder creates a new graph builder
-func NewBuilder(data interface{}) *Builder {
+func NewBuilder(data *Data) *Builder {
 	return &Builder{data: data}
 }
 
 // Build constructs the topology graph
 func (b *Builder) Build() (*Topology, error) {
-	// TODO: Implement actual graph building logic
-	return &Topology{}, nil
+	b.nodes = make(map[string]*Node)
+	b.edges = make(map[string]Edge)
+
+	if b.data == nil {
+		return &Topology{Nodes: []Node{}, Edges: []Edge{}}, nil
+	}
+
+	// First pass: create nodes so references can be resolved in any order
+	for _, res := range b.data.Resources {
+		b.addResourceNode(res)
+	}
+
+	// Second pass: derive edges from resource ID references in properties
+	for _, res := range b.data.Resources {
+		resType := strings.ToLower(getString(res, "type"))
+		id := normalizeID(getString(res, "id"))
+		props := getMap(res, "properties")
+		if props == nil {
+			continue
+		}
+
+		switch nodeTypes[resType] {
+		case NodeVNet:
+			b.addVNetEdges(id, props)
+		case NodeNIC:
+			b.addNICEdges(id, props)
+		case NodeVM:
+			for _, nic := range getSlice(getMap(props, "networkProfile"), "networkInterfaces") {
+				b.addEdge(refID(nic), id, EdgeAttachedTo, nil)
+			}
+		case NodeNSG:
+			for _, subnet := range getSlice(props, "subnets") {
+				b.addEdge(refID(subnet), id, EdgeAssociatedWith, nil)
+			}
+			for _, nic := range getSlice(props, "networkInterfaces") {
+				b.addEdge(refID(nic), id, EdgeAssociatedWith, nil)
+			}
+		case NodeRouteTable:
+			for _, subnet := range getSlice(props, "subnets") {
+				b.addEdge(refID(subnet), id, EdgeAssociatedWith, nil)
+			}
+		case NodeNATGateway:
+			for _, subnet := range getSlice(props, "subnets") {
+				b.addEdge(refID(subnet), id, EdgeEgressVia, nil)
+			}
+			for _, pip := range getSlice(props, "publicIpAddresses") {
+				b.addEdge(refID(pip), id, EdgeAttachedTo, nil)
+			}
+		case NodePublicIP:
+			// ipConfiguration points at the consumer's IP configuration
+			if consumer := topLevelID(refID(props["ipConfiguration"])); consumer != "" {
+				b.addEdge(id, consumer, EdgeAttachedTo, nil)
+			}
+		case NodePrivateEndpoint:
+			b.addEdge(id, refID(props["subnet"]), EdgeAttachedTo, nil)
+			for _, nic := range getSlice(props, "networkInterfaces") {
+				b.addEdge(refID(nic), id, EdgeAttachedTo, nil)
+			}
+			for _, conn := range append(getSlice(props, "privateLinkServiceConnections"), getSlice(props, "manualPrivateLinkServiceConnections")...) {
+				target := normalizeID(getString(getMap(asMap(conn), "properties"), "privateLinkServiceId"))
+				b.addEdge(id, target, EdgeAssociatedWith, nil)
+			}
+		case NodeLoadBalancer:
+			b.addIPConfigEdges(id, getSlice(props, "frontendIPConfigurations"))
+		case NodeAppGateway:
+			b.addIPConfigEdges(id, getSlice(props, "gatewayIPConfigurations"))
+			b.addIPConfigEdges(id, getSlice(props, "frontendIPConfigurations"))
+		case NodeFirewall, NodeGateway:
+			b.addIPConfigEdges(id, getSlice(props, "ipConfigurations"))
+		}
+	}
+
+	// Routes are resolved last since they depend on subnet and NIC edges
+	for _, res := range b.data.Resources {
+		if strings.ToLower(getString(res, "type")) == "microsoft.network/routetables" {
+			b.addRouteEdges(normalizeID(getString(res, "id")), getMap(res, "properties"))
+		}
+	}
+
+	return b.topology(), nil
+}
+
+// addResourceNode adds a node for a top-level resource and its subnets
+func (b *Builder) addResourceNode(res map[string]interface{}) {
+	nodeType, ok := nodeTypes[strings.ToLower(getString(res, "type"))]
+	if !ok {
+		return
+	}
+
+	id := normalizeID(getString(res, "id"))
+	if id == "" {
+		return
+	}
+
+	props := getMap(res, "properties")
+	data := map[string]interface{}{
+		"name":          getString(res, "name"),
+		"resourceGroup": getString(res, "resourceGroup"),
+		"location":      getString(res, "location"),
+	}
+	if sub := subscriptionOf(id); sub != "" {
+		data["subscriptionId"] = sub
+	}
+
+	switch nodeType {
+	case NodeVNet:
+		data["addressPrefixes"] = getStrings(getMap(props, "addressSpace"), "addressPrefixes")
+		for _, subnetIface := range getSlice(props, "subnets") {
+			subnet := asMap(subnetIface)
+			subnetID := normalizeID(getString(subnet, "id"))
+			if subnetID == "" {
+				continue
+			}
+			subnetProps := getMap(subnet, "properties")
+			prefixes := getStrings(subnetProps, "addressPrefixes")
+			if prefix := getString(subnetProps, "addressPrefix"); prefix != "" {
+				prefixes = append([]string{prefix}, prefixes...)
+			}
+			b.nodes[subnetID] = &Node{
+				ID:   subnetID,
+				Type: NodeSubnet,
+				Data: map[string]interface{}{
+					"name":            getString(subnet, "name"),
+					"vnet":            getString(res, "name"),
+					"addressPrefixes": prefixes,
+				},
+			}
+		}
+	case NodeNIC:
+		var privateIPs []string
+		for _, ipConfig := range getSlice(props, "ipConfigurations") {
+			if ip := getString(getMap(asMap(ipConfig), "properties"), "privateIPAddress"); ip != "" {
+				privateIPs = append(privateIPs, ip)
+			}
+		}
+		data["privateIPs"] = privateIPs
+		data["enableIPForwarding"] = props["enableIPForwarding"] == true
+	case NodePublicIP:
+		if ip := getString(props, "ipAddress"); ip != "" {
+			data["ipAddress"] = ip
+		}
+	case NodeFirewall:
+		var privateIPs []string
+		for _, ipConfig := range getSlice(props, "ipConfigurations") {
+			if ip := getString(getMap(asMap(ipConfig), "properties"), "privateIPAddress"); ip != "" {
+				privateIPs = append(privateIPs, ip)
+			}
+		}
+		data["privateIPs"] = privateIPs
+	case NodeRouteTable:
+		data["routes"] = len(getSlice(props, "routes"))
+	}
+
+	b.nodes[id] = &Node{ID: id, Type: nodeType, Data: data}
+}
+
+// addVNetEdges adds subnet containment, per-subnet associations and peerings
+func (b *Builder) addVNetEdges(vnetID string, props map[string]interface{}) {
+	for _, subnetIface := range getSlice(props, "subnets") {
+		subnet := asMap(subnetIface)
+		subnetID := normalizeID(getString(subnet, "id"))
+		b.addEdge(vnetID, subnetID, EdgeContains, nil)
+
+		subnetProps := getMap(subnet, "properties")
+		b.addEdge(subnetID, refID(subnetProps["networkSecurityGroup"]), EdgeAssociatedWith, nil)
+		b.addEdge(subnetID, refID(subnetProps["routeTable"]), EdgeAssociatedWith, nil)
+		b.addEdge(subnetID, refID(subnetProps["natGateway"]), EdgeEgressVia, nil)
+	}
+
+	for _, peeringIface := range getSlice(props, "virtualNetworkPeerings") {
+		peering := asMap(peeringIface)
+		peeringProps := getMap(peering, "properties")
+		remoteID := refID(peeringProps["remoteVirtualNetwork"])
+		if remoteID == "" {
+			continue
+		}
+
+		// Peerings may point at VNets outside the scanned scope
+		if _, ok := b.nodes[remoteID]; !ok {
+			b.nodes[remoteID] = &Node{
+				ID:   remoteID,
+				Type: NodeVNet,
+				Data: map[string]interface{}{
+					"name":           lastSegment(remoteID),
+					"subscriptionId": subscriptionOf(remoteID),
+					"external":       true,
+				},
+			}
+		}
+
+		b.addEdge(vnetID, remoteID, EdgePeeredWith, map[string]interface{}{
+			"name":                  getString(peering, "name"),
+			"peeringState":          getString(peeringProps, "peeringState"),
+			"allowVirtualNetwork":   peeringProps["allowVirtualNetworkAccess"] == true,
+			"allowForwardedTraffic": peeringProps["allowForwardedTraffic"] == true,
+			"allowGatewayTransit":   peeringProps["allowGatewayTransit"] == true,
+			"useRemoteGateways":     peeringProps["useRemoteGateways"] == true,
+			"crossSubscription":     subscriptionOf(vnetID) != subscriptionOf(remoteID),
+		})
+	}
+}
+
+// addNICEdges adds subnet, VM, NSG, public IP and load balancer edges for a NIC
+func (b *Builder) addNICEdges(nicID string, props map[string]interface{}) {
+	b.addEdge(nicID, refID(props["virtualMachine"]), EdgeAttachedTo, nil)
+	b.addEdge(nicID, refID(props["networkSecurityGroup"]), EdgeAssociatedWith, nil)
+
+	for _, ipConfig := range getSlice(props, "ipConfigurations") {
+		ipProps := getMap(asMap(ipConfig), "properties")
+		b.addEdge(nicID, refID(ipProps["subnet"]), EdgeAttachedTo, nil)
+		b.addEdge(refID(ipProps["publicIPAddress"]), nicID, EdgeAttachedTo, nil)
+
+		for _, pool := range getSlice(ipProps, "loadBalancerBackendAddressPools") {
+			b.addEdge(nicID, topLevelID(refID(pool)), EdgeAssociatedWith, nil)
+		}
+		for _, pool := range getSlice(ipProps, "applicationGatewayBackendAddressPools") {
+			b.addEdge(nicID, topLevelID(refID(pool)), EdgeAssociatedWith, nil)
+		}
+	}
+}
+
+// addIPConfigEdges adds subnet and public IP edges for an IP configuration list
+func (b *Builder) addIPConfigEdges(id string, ipConfigs []interface{}) {
+	for _, ipConfig := range ipConfigs {
+		ipProps := getMap(asMap(ipConfig), "properties")
+		b.addEdge(id, refID(ipProps["subnet"]), EdgeAttachedTo, nil)
+		b.addEdge(refID(ipProps["publicIPAddress"]), id, EdgeAttachedTo, nil)
+	}
+}
+
+// addRouteEdges resolves route next hops to appliances and gateways
+func (b *Builder) addRouteEdges(rtID string, props map[string]interface{}) {
+	if props == nil {
+		return
+	}
+
+	for _, routeIface := range getSlice(props, "routes") {
+		route := asMap(routeIface)
+		routeProps := getMap(route, "properties")
+		edgeData := map[string]interface{}{
+			"route":         getString(route, "name"),
+			"addressPrefix": getString(routeProps, "addressPrefix"),
+		}
+
+		switch getString(routeProps, "nextHopType") {
+		case "VirtualAppliance":
+			hopIP := getString(routeProps, "nextHopIpAddress")
+			edgeData["nextHopIpAddress"] = hopIP
+			if target := b.nodeByPrivateIP(hopIP); target != "" {
+				b.addEdge(rtID, target, EdgeRoutesVia, edgeData)
+			}
+		case "VirtualNetworkGateway":
+			// Use the gateway deployed in the VNet of each associated subnet
+			for _, gateway := range b.gatewaysForRouteTable(rtID) {
+				b.addEdge(rtID, gateway, EdgeRoutesVia, edgeData)
+			}
+		}
+	}
+}
+
+// nodeByPrivateIP finds the NIC or firewall owning a private IP address
+func (b *Builder) nodeByPrivateIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+
+	ids := b.sortedNodeIDs()
+	for _, id := range ids {
+		node := b.nodes[id]
+		if node.Type != NodeFirewall && node.Type != NodeNIC {
+			continue
+		}
+		if ips, ok := node.Data["privateIPs"].([]string); ok {
+			for _, candidate := range ips {
+				if candidate == ip {
+					return id
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// gatewaysForRouteTable returns gateways in VNets whose subnets use the route table
+func (b *Builder) gatewaysForRouteTable(rtID string) []string {
+	vnets := make(map[string]bool)
+	for _, edge := range b.edges {
+		if edge.Type == EdgeAssociatedWith && edge.To == rtID {
+			vnets[topLevelID(edge.From)] = true
+		}
+	}
+
+	// Spokes using remote gateways route via the gateway in the peered VNet
+	for _, edge := range b.edges {
+		if edge.Type == EdgePeeredWith && vnets[edge.From] && edge.Data["useRemoteGateways"] == true {
+			vnets[edge.To] = true
+		}
+	}
+
+	var gateways []string
+	for _, edge := range b.edges {
+		if edge.Type != EdgeAttachedTo || b.nodes[edge.From].Type != NodeGateway {
+			continue
+		}
+		if vnets[topLevelID(edge.To)] {
+			gateways = append(gateways, edge.From)
+		}
+	}
+	sort.Strings(gateways)
+	return gateways
+}
+
+// addEdge records an edge if both endpoints are known nodes
+func (b *Builder) addEdge(from, to, edgeType string, data map[string]interface{}) {
+	if from == "" || to == "" || from == to {
+		return
+	}
+	if _, ok := b.nodes[from]; !ok {
+		return
+	}
+	if _, ok := b.nodes[to]; !ok {
+		return
+	}
+
+	key := from + "|" + to + "|" + edgeType
+	if existing, ok := b.edges[key]; ok && existing.Data != nil {
+		return
+	}
+	b.edges[key] = Edge{From: from, To: to, Type: edgeType, Data: data}
+}
+
+// topology returns the nodes and edges in a deterministic order
+func (b *Builder) topology() *Topology {
+	topology := &Topology{
+		Nodes: make([]Node, 0, len(b.nodes)),
+		Edges: make([]Edge, 0, len(b.edges)),
+	}
+
+	for _, id := range b.sortedNodeIDs() {
+		topology.Nodes = append(topology.Nodes, *b.nodes[id])
+	}
+
+	for _, edge := range b.edges {
+		topology.Edges = append(topology.Edges, edge)
+	}
+	sort.Slice(topology.Edges, func(i, j int) bool {
+		a, c := topology.Edges[i], topology.Edges[j]
+		if a.From != c.From {
+			return a.From < c.From
+		}
+		if a.To != c.To {
+			return a.To < c.To
+		}
+		return a.Type < c.Type
+	})
+
+	return topology
+}
+
+func (b *Builder) sortedNodeIDs() []string {
+	ids := make([]string, 0, len(b.nodes))
+	for id := range b.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
 }
 
 // Topology represents the network topology graph
@@ -43,6 +463,52 @@ type Edge struct {
 	Data map[string]interface{} `json:"data,omitempty"`
 }
 
+// Node returns the node with the given ID, or nil if it doesn't exist
+func (t *Topology) Node(id string) *Node {
+	id = normalizeID(id)
+	for i := range t.Nodes {
+		if t.Nodes[i].ID == id {
+			return &t.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// NodesByType returns all nodes of the given type
+func (t *Topology) NodesByType(nodeType string) []Node {
+	var nodes []Node
+	for _, node := range t.Nodes {
+		if node.Type == nodeType {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// EdgesFrom returns edges leaving a node, optionally filtered by type
+func (t *Topology) EdgesFrom(id string, edgeType string) []Edge {
+	id = normalizeID(id)
+	var edges []Edge
+	for _, edge := range t.Edges {
+		if edge.From == id && (edgeType == "" || edge.Type == edgeType) {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// EdgesTo returns edges entering a node, optionally filtered by type
+func (t *Topology) EdgesTo(id string, edgeType string) []Edge {
+	id = normalizeID(id)
+	var edges []Edge
+	for _, edge := range t.Edges {
+		if edge.To == id && (edgeType == "" || edge.Type == edgeType) {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
 // SaveToFile saves the topology to a file
 func (t *Topology) SaveToFile(path string) error {
 	data, err := json.MarshalIndent(t, "", "  ")
@@ -52,19 +518,36 @@ func (t *Topology) SaveToFile(path string) error {
 	return os.WriteFile(path, data, 0644)
 }
 
-// LoadNormalizedData loads previously normalized data
-func LoadNormalizedData(dir string) (interface{}, error) {
-	// TODO: Implement loading logic
-	metaPath := fmt.Sprintf("%s/metadata.json", dir)
-	data, err := os.ReadFile(metaPath)
+// LoadNormalizedData loads previously scanned metadata and resources
+func LoadNormalizedData(dir string) (*Data, error) {
+	metaPath := filepath.Join(dir, "metadata.json")
+	metaBytes, err := os.ReadFile(metaPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read metadata: %w", err)
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
+	data := &Data{}
+	if err := json.Unmarshal(metaBytes, &data.Metadata); err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	resourcesPath := filepath.Join(dir, "raw", "all-resources.json")
+	resourceBytes, err := os.ReadFile(resourcesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resources: %w", err)
+	}
+	if err := json.Unmarshal(resourceBytes, &data.Resources); err != nil {
+		return nil, fmt.Errorf("failed to parse resources: %w", err)
+	}
+
+	groupsBytes, err := os.ReadFile(filepath.Join(dir, "raw", "resource-groups.json"))
+	if err == nil {
+		if err := json.Unmarshal(groupsBytes, &data.ResourceGroups); err != nil {
+			return nil, fmt.Errorf("failed to parse resource groups: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read resource groups: %w", err)
+	}
+
+	return data, nil
 }
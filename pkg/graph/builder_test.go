@@ -0,0 +1,175 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/topology.golden.json")
+
+const (
+	hubID     = "/subscriptions/sub1/resourcegroups/rg-net/providers/microsoft.network/virtualnetworks/vnet-hub"
+	spokeID   = "/subscriptions/sub1/resourcegroups/rg-app/providers/microsoft.network/virtualnetworks/vnet-spoke"
+	appSubnet = spokeID + "/subnets/snet-app"
+	nicID     = "/subscriptions/sub1/resourcegroups/rg-app/providers/microsoft.network/networkinterfaces/nic-vm1"
+	firewall  = "/subscriptions/sub1/resourcegroups/rg-net/providers/microsoft.network/azurefirewalls/fw-hub"
+	routes    = "/subscriptions/sub1/resourcegroups/rg-net/providers/microsoft.network/routetables/rt-app"
+)
+
+// loadResources reads the recorded Resource Graph rows in testdata
+func loadResources(t *testing.T) []map[string]interface{} {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/resources.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var resources []map[string]interface{}
+	if err := json.Unmarshal(data, &resources); err != nil {
+		t.Fatalf("failed to parse fixture: %v", err)
+	}
+	return resources
+}
+
+func build(t *testing.T, resources []map[string]interface{}) *Topology {
+	t.Helper()
+
+	topology, err := NewBuilder(&Data{Resources: resources}).Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return topology
+}
+
+func marshal(t *testing.T, topology *Topology) []byte {
+	t.Helper()
+
+	data, err := json.MarshalIndent(topology, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal topology: %v", err)
+	}
+	return append(data, '\n')
+}
+
+func TestBuildMatchesGolden(t *testing.T) {
+	got := marshal(t, build(t, loadResources(t)))
+
+	const golden = "testdata/topology.golden.json"
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("topology differs from %s; run go test ./pkg/graph -update and review the diff\n%s", golden, got)
+	}
+}
+
+func TestBuildIsDeterministic(t *testing.T) {
+	resources := loadResources(t)
+	want := marshal(t, build(t, resources))
+
+	reversed := make([]map[string]interface{}, len(resources))
+	for i, res := range resources {
+		reversed[len(resources)-1-i] = res
+	}
+	for i := 0; i < 5; i++ {
+		if got := marshal(t, build(t, reversed)); !bytes.Equal(got, want) {
+			t.Fatalf("topology depends on resource order or map iteration:\n%s", got)
+		}
+	}
+}
+
+func TestBuildEdges(t *testing.T) {
+	topology := build(t, loadResources(t))
+
+	tests := []struct {
+		from, to, edgeType string
+	}{
+		{spokeID, appSubnet, EdgeContains},
+		{nicID, appSubnet, EdgeAttachedTo},
+		{nicID, "/subscriptions/sub1/resourcegroups/rg-app/providers/microsoft.compute/virtualmachines/vm1", EdgeAttachedTo},
+		{appSubnet, "/subscriptions/sub1/resourcegroups/rg-net/providers/microsoft.network/networksecuritygroups/nsg-app", EdgeAssociatedWith},
+		{appSubnet, routes, EdgeAssociatedWith},
+		{appSubnet, "/subscriptions/sub1/resourcegroups/rg-net/providers/microsoft.network/natgateways/nat-app", EdgeEgressVia},
+		// Peering references differ in case from the VNet IDs
+		{hubID, spokeID, EdgePeeredWith},
+		{spokeID, hubID, EdgePeeredWith},
+		// Derived from child resource IDs: IP configurations and backend pools
+		{"/subscriptions/sub1/resourcegroups/rg-net/providers/microsoft.network/publicipaddresses/pip-vm1", nicID, EdgeAttachedTo},
+		{"/subscriptions/sub1/resourcegroups/rg-net/providers/microsoft.network/publicipaddresses/pip-fw", firewall, EdgeAttachedTo},
+		{nicID, "/subscriptions/sub1/resourcegroups/rg-app/providers/microsoft.network/loadbalancers/lb-app", EdgeAssociatedWith},
+		{nicID, "/subscriptions/sub1/resourcegroups/rg-net/providers/microsoft.network/applicationgateways/agw-web", EdgeAssociatedWith},
+		// The route to 10.0.1.5 uses the firewall's second IP configuration
+		{routes, firewall, EdgeRoutesVia},
+		{routes, nicID, EdgeRoutesVia},
+		// The spoke uses the hub's gateway through UseRemoteGateways
+		{routes, "/subscriptions/sub1/resourcegroups/rg-net/providers/microsoft.network/virtualnetworkgateways/vpngw-hub", EdgeRoutesVia},
+	}
+
+	for _, tt := range tests {
+		found := false
+		for _, edge := range topology.EdgesFrom(tt.from, tt.edgeType) {
+			if edge.To == tt.to {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing %s edge %s -> %s", tt.edgeType, lastSegment(tt.from), lastSegment(tt.to))
+		}
+	}
+
+	if got := len(topology.EdgesFrom(routes, EdgeRoutesVia)); got != 3 {
+		t.Errorf("got %d routes-via edges from rt-app, want 3 (unresolved and None next hops add none)", got)
+	}
+}
+
+func TestBuildNodes(t *testing.T) {
+	topology := build(t, loadResources(t))
+
+	fw := topology.Node(firewall)
+	if fw == nil || fw.Type != NodeFirewall {
+		t.Fatalf("firewall node = %v", fw)
+	}
+	if ips, _ := fw.Data["privateIPs"].([]string); len(ips) != 2 || ips[0] != "10.0.1.4" || ips[1] != "10.0.1.5" {
+		t.Errorf("firewall privateIPs = %v, want [10.0.1.4 10.0.1.5]", fw.Data["privateIPs"])
+	}
+
+	subnet := topology.Node(appSubnet)
+	if subnet == nil || subnet.Type != NodeSubnet {
+		t.Fatalf("subnet node = %v", subnet)
+	}
+	if prefixes, _ := subnet.Data["addressPrefixes"].([]string); len(prefixes) != 2 {
+		t.Errorf("subnet addressPrefixes = %v, want both prefixes", subnet.Data["addressPrefixes"])
+	}
+
+	partner := topology.Node("/subscriptions/sub2/resourceGroups/rg-partner/providers/Microsoft.Network/virtualNetworks/vnet-partner")
+	if partner == nil || partner.Data["external"] != true || partner.Data["subscriptionId"] != "sub2" {
+		t.Errorf("peered VNet outside the scan = %v, want an external node in sub2", partner)
+	}
+
+	if topology.Node("/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Storage/storageAccounts/stapp") != nil {
+		t.Error("storage account is not a network resource and should have no node")
+	}
+
+	counts := make(map[string]int)
+	for _, node := range topology.Nodes {
+		counts[node.Type]++
+	}
+	want := map[string]int{
+		NodeVNet: 3, NodeSubnet: 5, NodeNIC: 2, NodeVM: 1, NodeNSG: 1, NodeRouteTable: 1, NodeNATGateway: 1,
+		NodePublicIP: 4, NodePrivateEndpoint: 1, NodeLoadBalancer: 1, NodeAppGateway: 1, NodeFirewall: 1, NodeGateway: 1,
+	}
+	for nodeType, n := range want {
+		if counts[nodeType] != n {
+			t.Errorf("got %d %s nodes, want %d", counts[nodeType], nodeType, n)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package graph
+
+import "strings"
+
+// normalizeID lowercases an ARM resource ID and strips trailing slashes.
+// ARM IDs are case-insensitive and Resource Graph is not consistent about casing.
+func normalizeID(id string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(id)), "/")
+}
+
+// refID extracts the normalized "id" from a reference object such as {"id": "..."}
+func refID(ref interface{}) string {
+	return normalizeID(getString(asMap(ref), "id"))
+}
+
+// topLevelID returns the ID of the top-level resource for a child resource ID,
+// e.g. a subnet ID yields its VNet ID and an IP configuration ID yields its NIC
+func topLevelID(id string) string {
+	parts := strings.Split(normalizeID(id), "/")
+	// "", subscriptions, {sub}, resourcegroups, {rg}, providers, {ns}, {type}, {name}
+	if len(parts) < 9 || parts[1] != "subscriptions" || parts[5] != "providers" {
+		return ""
+	}
+	return strings.Join(parts[:9], "/")
+}
+
+// subscriptionOf returns the subscription ID segment of a resource ID
+func subscriptionOf(id string) string {
+	parts := strings.Split(normalizeID(id), "/")
+	if len(parts) > 2 && parts[1] == "subscriptions" {
+		return parts[2]
+	}
+	return ""
+}
+
+// lastSegment returns the final segment of a resource ID (usually the name)
+func lastSegment(id string) string {
+	parts := strings.Split(strings.TrimSuffix(id, "/"), "/")
+	return parts[len(parts)-1]
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func getMap(m map[string]interface{}, key string) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	return asMap(m[key])
+}
+
+func getSlice(m map[string]interface{}, key string) []interface{} {
+	if m == nil {
+		return nil
+	}
+	s, _ := m[key].([]interface{})
+	return s
+}
+
+func getString(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	s, _ := m[key].(string)
+	return s
+}
+
+func getStrings(m map[string]interface{}, key string) []string {
+	var values []string
+	for _, v := range getSlice(m, key) {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
@@ -0,0 +1,336 @@
+package ipam
+
+import (
+	"math"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// AzureReserved is the number of addresses Azure reserves in every subnet
+// prefix: the network address, three addresses for Azure services and the
+// last address
+const AzureReserved = 5
+
+// DefaultThreshold is the utilization percentage above which a subnet is
+// reported as running out of addresses
+const DefaultThreshold = 80.0
+
+// SubnetUsage is the address utilization of one subnet prefix. Dual-stack
+// subnets have one entry per prefix.
+type SubnetUsage struct {
+	VNet          string  `json:"vnet"`
+	VNetID        string  `json:"vnetId"`
+	Subnet        string  `json:"subnet"`
+	SubnetID      string  `json:"subnetId"`
+	Prefix        string  `json:"prefix"`
+	IPv6          bool    `json:"ipv6"`
+	Size          uint64  `json:"size"`   // addresses in the prefix, capped at math.MaxUint64
+	Usable        uint64  `json:"usable"` // size minus the Azure reserved addresses
+	Used          int     `json:"used"`   // NIC, private endpoint, load balancer and firewall IPs
+	Available     uint64  `json:"available"`
+	Utilization   float64 `json:"utilization"` // percentage of usable addresses in use
+	OverThreshold bool    `json:"overThreshold"`
+}
+
+// Overlap is a pair of VNet address spaces that share addresses
+type Overlap struct {
+	VNetA   string `json:"vnetA"`
+	VNetAID string `json:"vnetAId"`
+	PrefixA string `json:"prefixA"`
+	VNetB   string `json:"vnetB"`
+	VNetBID string `json:"vnetBId"`
+	PrefixB string `json:"prefixB"`
+
+	// Peered is true when the VNets are peered with each other
+	Peered bool `json:"peered"`
+	// CrossSubscription is true when the VNets are in different subscriptions
+	CrossSubscription bool `json:"crossSubscription"`
+	// External is true when VNet B was not scanned and is only known from
+	// a peering's remote address space
+	External bool `json:"external"`
+}
+
+// Relationship describes how the overlapping VNets are connected
+func (o Overlap) Relationship() string {
+	relationship := "unpeered"
+	if o.Peered {
+		relationship = "peered"
+	}
+	if o.CrossSubscription {
+		relationship += ", cross-subscription"
+	}
+	if o.External {
+		relationship += ", not scanned"
+	}
+	return relationship
+}
+
+// Analysis is the address utilization and overlap report of an inventory
+type Analysis struct {
+	Threshold float64       `json:"threshold"`
+	Subnets   []SubnetUsage `json:"subnets"`
+	Overlaps  []Overlap     `json:"overlaps"`
+}
+
+// OverThreshold returns the subnets whose utilization is above the threshold
+func (a *Analysis) OverThreshold() []SubnetUsage {
+	var subnets []SubnetUsage
+	for _, s := range a.Subnets {
+		if s.OverThreshold {
+			subnets = append(subnets, s)
+		}
+	}
+	return subnets
+}
+
+// Analyze counts the addresses used in every subnet and finds overlapping
+// VNet address spaces. A threshold of 0 or less uses DefaultThreshold.
+func Analyze(inv *models.Inventory, threshold float64) *Analysis {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	return &Analysis{
+		Threshold: threshold,
+		Subnets:   subnetUsage(inv, threshold),
+		Overlaps:  overlaps(inv),
+	}
+}
+
+// subnetUsage computes the utilization of every subnet prefix
+func subnetUsage(inv *models.Inventory, threshold float64) []SubnetUsage {
+	used := usedAddresses(inv)
+
+	var usage []SubnetUsage
+	for _, vnet := range inv.VNets {
+		for _, subnet := range vnet.Subnets {
+			prefixes := parsePrefixes(SubnetPrefixes(subnet))
+			counts := make([]int, len(prefixes))
+			for address := range used[strings.ToLower(subnet.ID)] {
+				ip, err := netip.ParseAddr(address)
+				for i, prefix := range prefixes {
+					// Consumers without a known address count against the
+					// first (IPv4) prefix
+					if err != nil && i == 0 || err == nil && prefix.Contains(ip) {
+						counts[i]++
+						break
+					}
+				}
+			}
+
+			for i, prefix := range prefixes {
+				u := SubnetUsage{
+					VNet:     vnet.Name,
+					VNetID:   vnet.ID,
+					Subnet:   subnet.Name,
+					SubnetID: subnet.ID,
+					Prefix:   prefix.String(),
+					IPv6:     prefix.Addr().Is6(),
+					Size:     Size(prefix),
+					Used:     counts[i],
+				}
+				u.Usable = Usable(prefix)
+				if u.Usable > uint64(u.Used) {
+					u.Available = u.Usable - uint64(u.Used)
+				}
+				if u.Usable > 0 {
+					u.Utilization = float64(u.Used) / float64(u.Usable) * 100
+				} else if u.Used > 0 {
+					u.Utilization = 100
+				}
+				u.OverThreshold = u.Utilization > threshold
+				usage = append(usage, u)
+			}
+		}
+	}
+	return usage
+}
+
+// usedAddresses returns the addresses in use per subnet ID (lower-cased).
+// Consumers whose address is not known yet (dynamic allocation before
+// start) are keyed by resource ID so they still count once.
+func usedAddresses(inv *models.Inventory) map[string]map[string]bool {
+	used := make(map[string]map[string]bool)
+	add := func(subnetID, address, resourceID string) {
+		if subnetID == "" {
+			return
+		}
+		key := strings.ToLower(subnetID)
+		if used[key] == nil {
+			used[key] = make(map[string]bool)
+		}
+		if ip, err := netip.ParseAddr(strings.TrimSpace(address)); err == nil {
+			used[key][ip.String()] = true
+		} else {
+			used[key][strings.ToLower(resourceID)] = true
+		}
+	}
+
+	for _, nic := range inv.NICs {
+		for _, c := range nic.IPConfigurations {
+			add(c.SubnetID, c.PrivateIP, nic.ID+"/"+c.Name)
+		}
+	}
+	// Private endpoints usually have a NIC as well; the address set removes
+	// the duplicate
+	for _, pe := range inv.PrivateEndpoints {
+		add(pe.SubnetID, pe.PrivateIP, pe.ID)
+	}
+	for _, lb := range inv.LoadBalancers {
+		for _, fe := range lb.FrontendIPs {
+			add(fe.SubnetID, fe.PrivateIP, lb.ID+"/"+fe.Name)
+		}
+	}
+	for _, fw := range inv.Firewalls {
+		add(fw.SubnetID, fw.PrivateIP, fw.ID)
+	}
+	return used
+}
+
+// addressSpace is a VNet address space, possibly of a VNet that is only
+// known from a peering
+type addressSpace struct {
+	vnetName string
+	vnetID   string
+	prefixes []netip.Prefix
+	external bool
+	peers    map[string]bool // lower-cased IDs of peered VNets
+}
+
+// overlaps finds VNet address spaces that share addresses, including the
+// remote address spaces of peered VNets that were not scanned
+func overlaps(inv *models.Inventory) []Overlap {
+	var spaces []addressSpace
+	scanned := make(map[string]bool)
+	for _, vnet := range inv.VNets {
+		scanned[strings.ToLower(vnet.ID)] = true
+	}
+
+	external := make(map[string]int)
+	for _, vnet := range inv.VNets {
+		space := addressSpace{
+			vnetName: vnet.Name,
+			vnetID:   vnet.ID,
+			prefixes: parsePrefixes(vnet.AddressSpaces),
+			peers:    make(map[string]bool),
+		}
+		for _, p := range vnet.Peerings {
+			remote := strings.ToLower(p.RemoteVNetID)
+			space.peers[remote] = true
+			if scanned[remote] || remote == "" {
+				continue
+			}
+			if i, seen := external[remote]; seen {
+				spaces[i].peers[strings.ToLower(vnet.ID)] = true
+				continue
+			}
+			name := p.RemoteVNetName
+			if name == "" {
+				name = lastSegment(p.RemoteVNetID)
+			}
+			external[remote] = len(spaces)
+			spaces = append(spaces, addressSpace{
+				vnetName: name,
+				vnetID:   p.RemoteVNetID,
+				prefixes: parsePrefixes(p.RemoteAddressSpaces),
+				external: true,
+				peers:    map[string]bool{strings.ToLower(vnet.ID): true},
+			})
+		}
+		spaces = append(spaces, space)
+	}
+
+	// Scanned VNets first so that an external VNet is always VNet B
+	sort.SliceStable(spaces, func(i, j int) bool {
+		return !spaces[i].external && spaces[j].external
+	})
+
+	var found []Overlap
+	for i, a := range spaces {
+		for _, b := range spaces[i+1:] {
+			if a.external && b.external {
+				continue
+			}
+			for _, pa := range a.prefixes {
+				for _, pb := range b.prefixes {
+					if !pa.Overlaps(pb) {
+						continue
+					}
+					found = append(found, Overlap{
+						VNetA:             a.vnetName,
+						VNetAID:           a.vnetID,
+						PrefixA:           pa.String(),
+						VNetB:             b.vnetName,
+						VNetBID:           b.vnetID,
+						PrefixB:           pb.String(),
+						Peered:            a.peers[strings.ToLower(b.vnetID)] || b.peers[strings.ToLower(a.vnetID)],
+						CrossSubscription: !strings.EqualFold(subscriptionOf(a.vnetID), subscriptionOf(b.vnetID)),
+						External:          b.external,
+					})
+				}
+			}
+		}
+	}
+	return found
+}
+
+// SubnetPrefixes returns all address prefixes of a subnet
+func SubnetPrefixes(subnet models.Subnet) []string {
+	if len(subnet.AddressPrefixes) > 0 {
+		return subnet.AddressPrefixes
+	}
+	if subnet.AddressPrefix != "" {
+		return []string{subnet.AddressPrefix}
+	}
+	return nil
+}
+
+// Size returns the number of addresses in a prefix, capped at math.MaxUint64
+// for IPv6 prefixes of /64 and shorter
+func Size(prefix netip.Prefix) uint64 {
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits >= 64 {
+		return math.MaxUint64
+	}
+	return 1 << hostBits
+}
+
+// Usable returns the number of addresses in a subnet prefix that Azure can
+// assign
+func Usable(prefix netip.Prefix) uint64 {
+	size := Size(prefix)
+	if size <= AzureReserved {
+		return 0
+	}
+	return size - AzureReserved
+}
+
+// parsePrefixes parses CIDR prefixes, skipping invalid ones
+func parsePrefixes(values []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, v := range values {
+		if prefix, err := netip.ParsePrefix(strings.TrimSpace(v)); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	return prefixes
+}
+
+// subscriptionOf returns the subscription ID segment of a resource ID
+func subscriptionOf(id string) string {
+	parts := strings.Split(strings.ToLower(id), "/")
+	if len(parts) > 2 && parts[1] == "subscriptions" {
+		return parts[2]
+	}
+	return ""
+}
+
+// lastSegment returns the final segment of a resource ID
+func lastSegment(id string) string {
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		return id[i+1:]
+	}
+	return id
+}
@@ -0,0 +1,285 @@
+package ipam
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// Block states
+const (
+	BlockUsed     = "used"
+	BlockReserved = "reserved"
+	BlockFree     = "free"
+)
+
+// Smallest subnets Azure accepts
+const (
+	minIPv4SubnetBits = 29
+	ipv6SubnetBits    = 64
+)
+
+// Block is an aligned CIDR block of a VNet address space
+type Block struct {
+	Prefix netip.Prefix `json:"prefix"`
+	State  string       `json:"state"`
+	Name   string       `json:"name,omitempty"` // subnet name or reserved range
+}
+
+// SpaceMap is one VNet address space split into used, reserved and free
+// blocks in address order
+type SpaceMap struct {
+	Prefix netip.Prefix `json:"prefix"`
+	Blocks []Block      `json:"blocks"`
+}
+
+// Allocated returns the percentage of the address space used by subnets
+func (m SpaceMap) Allocated() float64 {
+	used := new(big.Int)
+	for _, b := range m.Blocks {
+		if b.State == BlockUsed {
+			used.Add(used, BlockSize(b.Prefix))
+		}
+	}
+	ratio, _ := new(big.Rat).SetFrac(used, BlockSize(m.Prefix)).Float64()
+	return ratio * 100
+}
+
+// VNetMap is the address map of one VNet
+type VNetMap struct {
+	VNet   string     `json:"vnet"`
+	VNetID string     `json:"vnetId"`
+	Spaces []SpaceMap `json:"spaces"`
+}
+
+// Planner finds free address blocks in VNets, avoiding existing subnets
+// and reserved ranges
+type Planner struct {
+	inv      *models.Inventory
+	reserved []netip.Prefix
+}
+
+// NewPlanner creates a planner. reserved lists CIDR ranges that must not be
+// allocated, e.g. ranges set aside for future subnets or on-premises networks.
+func NewPlanner(inv *models.Inventory, reserved []string) (*Planner, error) {
+	p := &Planner{inv: inv}
+	for _, r := range reserved {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(r))
+		if err != nil {
+			return nil, fmt.Errorf("invalid reserved range %q: %w", r, err)
+		}
+		p.reserved = append(p.reserved, prefix.Masked())
+	}
+	sort.Slice(p.reserved, func(i, j int) bool {
+		return p.reserved[i].Addr().Less(p.reserved[j].Addr())
+	})
+	return p, nil
+}
+
+// FindVNet returns the VNet with the given name or resource ID. A value that
+// is not an exact match may be a unique part of a name, e.g. "hub" for
+// vnet-hub.
+func (p *Planner) FindVNet(value string) (*models.VNet, error) {
+	for i := range p.inv.VNets {
+		vnet := &p.inv.VNets[i]
+		if strings.EqualFold(vnet.Name, value) || strings.EqualFold(vnet.ID, value) {
+			return vnet, nil
+		}
+	}
+
+	var matches []*models.VNet
+	for i := range p.inv.VNets {
+		if strings.Contains(strings.ToLower(p.inv.VNets[i].Name), strings.ToLower(value)) {
+			matches = append(matches, &p.inv.VNets[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("VNet %q not found", value)
+	case 1:
+		return matches[0], nil
+	}
+	var names []string
+	for _, vnet := range matches {
+		names = append(names, vnet.Name)
+	}
+	return nil, fmt.Errorf("VNet %q is ambiguous: %s", value, strings.Join(names, ", "))
+}
+
+// Map splits every address space of a VNet into used, reserved and free
+// blocks
+func (p *Planner) Map(vnet *models.VNet) VNetMap {
+	m := VNetMap{VNet: vnet.Name, VNetID: vnet.ID}
+	for _, space := range parsePrefixes(vnet.AddressSpaces) {
+		m.Spaces = append(m.Spaces, p.mapSpace(vnet, space))
+	}
+	return m
+}
+
+// Next returns the first free aligned block with the given prefix length in
+// the VNet's address spaces. IPv6 subnets must be /64.
+func (p *Planner) Next(vnet *models.VNet, bits int, ipv6 bool) (netip.Prefix, error) {
+	if ipv6 && bits != ipv6SubnetBits {
+		return netip.Prefix{}, fmt.Errorf("IPv6 subnets must be /%d", ipv6SubnetBits)
+	}
+	if !ipv6 && (bits < 1 || bits > minIPv4SubnetBits) {
+		return netip.Prefix{}, fmt.Errorf("IPv4 subnets must be between /1 and /%d", minIPv4SubnetBits)
+	}
+
+	var searched []string
+	for _, space := range p.Map(vnet).Spaces {
+		if space.Prefix.Addr().Is6() != ipv6 {
+			continue
+		}
+		searched = append(searched, space.Prefix.String())
+		if space.Prefix.Bits() > bits {
+			continue
+		}
+		// Free blocks are maximal aligned CIDRs, so any free aligned block
+		// of the requested size starts a free block at least as large
+		for _, b := range space.Blocks {
+			if b.State == BlockFree && b.Prefix.Bits() <= bits {
+				return netip.PrefixFrom(b.Prefix.Addr(), bits), nil
+			}
+		}
+	}
+
+	family := "IPv4"
+	if ipv6 {
+		family = "IPv6"
+	}
+	if len(searched) == 0 {
+		return netip.Prefix{}, fmt.Errorf("%s has no %s address space", vnet.Name, family)
+	}
+	return netip.Prefix{}, fmt.Errorf("no free /%d in %s (%s)", bits, vnet.Name, strings.Join(searched, ", "))
+}
+
+// mapSpace splits one address space into blocks
+func (p *Planner) mapSpace(vnet *models.VNet, space netip.Prefix) SpaceMap {
+	type subnetPrefix struct {
+		name   string
+		prefix netip.Prefix
+	}
+	var subnets []subnetPrefix
+	for _, subnet := range vnet.Subnets {
+		for _, prefix := range parsePrefixes(SubnetPrefixes(subnet)) {
+			if space.Contains(prefix.Addr()) && space.Bits() <= prefix.Bits() {
+				subnets = append(subnets, subnetPrefix{subnet.Name, prefix})
+			}
+		}
+	}
+	sort.Slice(subnets, func(i, j int) bool {
+		return subnets[i].prefix.Addr().Less(subnets[j].prefix.Addr())
+	})
+
+	m := SpaceMap{Prefix: space}
+	cursor, end := space.Addr(), LastAddr(space)
+	done := false
+	for _, s := range subnets {
+		if done || s.prefix.Addr().Less(cursor) {
+			continue // overlapping subnet, already covered
+		}
+		if cursor.Less(s.prefix.Addr()) {
+			m.Blocks = append(m.Blocks, p.freeBlocks(cursor, s.prefix.Addr().Prev())...)
+		}
+		m.Blocks = append(m.Blocks, Block{Prefix: s.prefix, State: BlockUsed, Name: s.name})
+		cursor, done = next(LastAddr(s.prefix), end)
+	}
+	if !done {
+		m.Blocks = append(m.Blocks, p.freeBlocks(cursor, end)...)
+	}
+	return m
+}
+
+// freeBlocks splits an unallocated range into reserved and free blocks
+func (p *Planner) freeBlocks(start, end netip.Addr) []Block {
+	var blocks []Block
+	for _, r := range p.reserved {
+		rStart, rEnd := r.Addr(), LastAddr(r)
+		if rStart.BitLen() != start.BitLen() || rEnd.Less(start) || end.Less(rStart) {
+			continue
+		}
+		if rStart.Less(start) {
+			rStart = start
+		}
+		if end.Less(rEnd) {
+			rEnd = end
+		}
+		if start.Less(rStart) {
+			blocks = append(blocks, rangeBlocks(start, rStart.Prev(), BlockFree, "")...)
+		}
+		blocks = append(blocks, rangeBlocks(rStart, rEnd, BlockReserved, r.String())...)
+
+		var done bool
+		if start, done = next(rEnd, end); done {
+			return blocks
+		}
+	}
+	return append(blocks, rangeBlocks(start, end, BlockFree, "")...)
+}
+
+// rangeBlocks splits an address range into the fewest aligned CIDR blocks
+func rangeBlocks(start, end netip.Addr, state, name string) []Block {
+	var blocks []Block
+	for {
+		bits := 0
+		for ; bits < start.BitLen(); bits++ {
+			prefix := netip.PrefixFrom(start, bits)
+			if prefix.Masked().Addr() == start && !end.Less(LastAddr(prefix)) {
+				break
+			}
+		}
+		prefix := netip.PrefixFrom(start, bits)
+		blocks = append(blocks, Block{Prefix: prefix, State: state, Name: name})
+
+		var done bool
+		if start, done = next(LastAddr(prefix), end); done {
+			return blocks
+		}
+	}
+}
+
+// next returns the address after addr, and true when addr is the end of
+// the range
+func next(addr, end netip.Addr) (netip.Addr, bool) {
+	if addr == end || !addr.Less(end) {
+		return addr, true
+	}
+	return addr.Next(), false
+}
+
+// LastAddr returns the last address of a prefix
+func LastAddr(prefix netip.Prefix) netip.Addr {
+	prefix = prefix.Masked()
+	if prefix.Addr().Is4() {
+		b := prefix.Addr().As4()
+		for i := prefix.Bits(); i < 32; i++ {
+			b[i/8] |= 0x80 >> (i % 8)
+		}
+		return netip.AddrFrom4(b)
+	}
+	b := prefix.Addr().As16()
+	for i := prefix.Bits(); i < 128; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	return netip.AddrFrom16(b)
+}
+
+// BlockSize returns the number of addresses in a prefix
+func BlockSize(prefix netip.Prefix) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+}
+
+// Offset returns the position of an address within a prefix
+func Offset(prefix netip.Prefix, addr netip.Addr) *big.Int {
+	return new(big.Int).Sub(addrInt(addr), addrInt(prefix.Masked().Addr()))
+}
+
+func addrInt(addr netip.Addr) *big.Int {
+	b := addr.As16()
+	return new(big.Int).SetBytes(b[:])
+}
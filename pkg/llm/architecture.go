@@ -70,8 +70,8 @@ Return ONLY valid JSON (no markdown):
 				Content: prompt,
 			},
 		},
-		Temperature: 0.4, // Slightly creative for better descriptions
-		MaxTokens:   1500,
+		Temperature: c.temperatureOr(0.4), // Slightly creative for better descriptions
+		MaxTokens:   c.maxTokensOr(1500),
 	})
 
 	if err != nil {
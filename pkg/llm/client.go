@@ -11,16 +11,20 @@ import (
 
 // Client handles LLM API interactions
 type Client struct {
-	openai  *openai.Client
-	enabled bool
-	model   string
+	openai      *openai.Client
+	enabled     bool
+	model       string
+	maxTokens   int
+	temperature *float32
 }
 
 // Config holds LLM configuration
 type Config struct {
-	Enabled bool
-	APIKey  string
-	Model   string
+	Enabled     bool
+	APIKey      string
+	Model       string
+	MaxTokens   int      // Overrides per-request token limits when set
+	Temperature *float32 // Overrides per-request temperatures when set
 }
 
 // NewClient creates a new LLM client
@@ -45,12 +49,30 @@ func NewClient(config Config) *Client {
 	}
 
 	return &Client{
-		openai:  openai.NewClient(apiKey),
-		enabled: true,
-		model:   model,
+		openai:      openai.NewClient(apiKey),
+		enabled:     true,
+		model:       model,
+		maxTokens:   config.MaxTokens,
+		temperature: config.Temperature,
 	}
 }
 
+// temperatureOr returns the configured temperature or the request default
+func (c *Client) temperatureOr(def float32) float32 {
+	if c.temperature != nil {
+		return *c.temperature
+	}
+	return def
+}
+
+// maxTokensOr returns the configured token limit or the request default
+func (c *Client) maxTokensOr(def int) int {
+	if c.maxTokens > 0 {
+		return c.maxTokens
+	}
+	return def
+}
+
 // IsEnabled returns whether AI features are enabled
 func (c *Client) IsEnabled() bool {
 	return c.enabled
@@ -123,8 +145,8 @@ Return format (valid JSON only, no markdown):
 				Content: prompt,
 			},
 		},
-		Temperature: 0.3, // Lower temperature for more deterministic output
-		MaxTokens:   2000,
+		Temperature: c.temperatureOr(0.3), // Lower temperature for more deterministic output
+		MaxTokens:   c.maxTokensOr(2000),
 	})
 
 	if err != nil {
@@ -200,8 +222,8 @@ Return ONLY valid JSON array (no markdown):
 				Content: prompt,
 			},
 		},
-		Temperature: 0.2,
-		MaxTokens:   3000,
+		Temperature: c.temperatureOr(0.2),
+		MaxTokens:   c.maxTokensOr(3000),
 	})
 
 	if err != nil {
@@ -286,8 +308,8 @@ Focus on the top 5-8 most important insights only.`, string(findingsData))
 				Content: prompt,
 			},
 		},
-		Temperature: 0.3,
-		MaxTokens:   2500,
+		Temperature: c.temperatureOr(0.3),
+		MaxTokens:   c.maxTokensOr(2500),
 	})
 
 	if err != nil {
@@ -370,8 +392,8 @@ Focus on the top 5-8 most impactful insights only.`, string(findingsData))
 				Content: prompt,
 			},
 		},
-		Temperature: 0.3,
-		MaxTokens:   2500,
+		Temperature: c.temperatureOr(0.3),
+		MaxTokens:   c.maxTokensOr(2500),
 	})
 
 	if err != nil {
@@ -92,8 +92,8 @@ Return ONLY valid JSON array (no markdown):
 				Content: prompt,
 			},
 		},
-		Temperature: 0.3, // Lower temperature for more precise technical instructions
-		MaxTokens:   2500,
+		Temperature: c.temperatureOr(0.3), // Lower temperature for more precise technical instructions
+		MaxTokens:   c.maxTokensOr(2500),
 	})
 
 	if err != nil {
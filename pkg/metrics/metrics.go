@@ -0,0 +1,336 @@
+// Package metrics reads Azure Monitor metric exports and summarizes them
+// as percentiles per resource
+package metrics
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Azure Monitor platform metric names of virtual machines
+const (
+	CPU                    = "Percentage CPU"
+	NetworkIn              = "Network In Total"
+	NetworkOut             = "Network Out Total"
+	AvailableMemoryBytes   = "Available Memory Bytes"
+	AvailableMemoryPercent = "Available Memory Percentage"
+)
+
+// timeLayouts are the timestamp formats used by metric exports
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "1/2/2006 3:04:05 PM", "1/2/2006 15:04"}
+
+// Point is one metric value
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Store holds metric time series by resource and metric name
+type Store struct {
+	Source string
+	series map[string]map[string][]Point // by lower-cased resource ID, then lower-cased metric
+}
+
+// Load reads a metric export file, or every .json and .csv file in a
+// directory. JSON files are `az monitor metrics list` output; CSV files have
+// one row per data point with ResourceId, MetricName, TimeGenerated and
+// Average columns, as exported from the AzureMetrics table.
+func Load(path string) (*Store, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metrics directory: %w", err)
+		}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if !entry.IsDir() && (ext == ".json" || ext == ".csv") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	store := &Store{Source: path, series: make(map[string]map[string][]Point)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metrics: %w", err)
+		}
+		if strings.EqualFold(filepath.Ext(file), ".csv") {
+			err = store.parseCSV(bytes.NewReader(data))
+		} else {
+			err = store.parseJSON(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metrics %s: %w", file, err)
+		}
+	}
+	if len(store.series) == 0 {
+		return nil, fmt.Errorf("no metric data found in %s", path)
+	}
+
+	for _, metrics := range store.series {
+		for _, points := range metrics {
+			sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+		}
+	}
+	return store, nil
+}
+
+// Add records a metric value
+func (s *Store) Add(resourceID, metric string, p Point) {
+	id := strings.ToLower(resourceID)
+	if s.series[id] == nil {
+		s.series[id] = make(map[string][]Point)
+	}
+	name := strings.ToLower(metric)
+	s.series[id][name] = append(s.series[id][name], p)
+}
+
+// Points returns the values of a metric of a resource in time order
+func (s *Store) Points(resourceID, metric string) []Point {
+	return s.series[strings.ToLower(resourceID)][strings.ToLower(metric)]
+}
+
+// Days returns the number of days the metrics of a resource cover
+func (s *Store) Days(resourceID string) float64 {
+	var first, last time.Time
+	for _, points := range s.series[strings.ToLower(resourceID)] {
+		if len(points) == 0 {
+			continue
+		}
+		if first.IsZero() || points[0].Time.Before(first) {
+			first = points[0].Time
+		}
+		if points[len(points)-1].Time.After(last) {
+			last = points[len(points)-1].Time
+		}
+	}
+	return last.Sub(first).Hours() / 24
+}
+
+// Percentile returns the p-th percentile (0-100) of a metric of a resource
+func (s *Store) Percentile(resourceID, metric string, p float64) (float64, bool) {
+	points := s.Points(resourceID, metric)
+	if len(points) == 0 {
+		return 0, false
+	}
+	values := make([]float64, len(points))
+	for i, point := range points {
+		values[i] = point.Value
+	}
+	return Percentile(values, p), true
+}
+
+// NetworkMbps returns the p-th percentile of the combined inbound and
+// outbound throughput of a resource in megabits per second. The total
+// metrics are bytes per interval, so each value is divided by the interval
+// between samples.
+func (s *Store) NetworkMbps(resourceID string, p float64) (float64, bool) {
+	totals := make(map[time.Time]float64)
+	for _, metric := range []string{NetworkIn, NetworkOut} {
+		for _, point := range s.Points(resourceID, metric) {
+			totals[point.Time] += point.Value
+		}
+	}
+	if len(totals) < 2 {
+		return 0, false
+	}
+
+	times := make([]time.Time, 0, len(totals))
+	for t := range totals {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	gaps := make([]float64, 0, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		gaps = append(gaps, times[i].Sub(times[i-1]).Seconds())
+	}
+	interval := Percentile(gaps, 50)
+	if interval <= 0 {
+		return 0, false
+	}
+
+	rates := make([]float64, 0, len(times))
+	for _, t := range times {
+		rates = append(rates, totals[t]*8/interval/1e6)
+	}
+	return Percentile(rates, p), true
+}
+
+// Percentile returns the p-th percentile (0-100) of values by linear
+// interpolation between the closest ranks
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower < 0 {
+		lower = 0
+	}
+	if upper >= len(sorted) {
+		upper = len(sorted) - 1
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// metricResponse is the output of `az monitor metrics list`
+type metricResponse struct {
+	Value []struct {
+		ID   string `json:"id"`
+		Name struct {
+			Value string `json:"value"`
+		} `json:"name"`
+		Timeseries []struct {
+			Data []struct {
+				TimeStamp string   `json:"timeStamp"`
+				Average   *float64 `json:"average"`
+				Total     *float64 `json:"total"`
+				Maximum   *float64 `json:"maximum"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"value"`
+}
+
+func (s *Store) parseJSON(data []byte) error {
+	var responses []metricResponse
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if err := json.Unmarshal(data, &responses); err != nil {
+			return err
+		}
+	} else {
+		var response metricResponse
+		if err := json.Unmarshal(data, &response); err != nil {
+			return err
+		}
+		responses = append(responses, response)
+	}
+
+	for _, response := range responses {
+		for _, metric := range response.Value {
+			// Metric IDs are <resource ID>/providers/Microsoft.Insights/metrics/<name>
+			resourceID := metric.ID
+			if i := strings.Index(strings.ToLower(resourceID), "/providers/microsoft.insights/metrics"); i >= 0 {
+				resourceID = resourceID[:i]
+			}
+			for _, series := range metric.Timeseries {
+				for _, d := range series.Data {
+					// Byte counters such as Network In Total are summed
+					// per interval, gauges such as Percentage CPU averaged
+					value := d.Average
+					if d.Total != nil && (value == nil || strings.HasSuffix(metric.Name.Value, " Total")) {
+						value = d.Total
+					}
+					if value == nil {
+						value = d.Maximum
+					}
+					t, ok := parseTime(d.TimeStamp)
+					if value == nil || !ok {
+						continue
+					}
+					s.Add(resourceID, metric.Name.Value, Point{Time: t, Value: *value})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) parseCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	column := func(names ...string) (int, error) {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("missing column %q", names[0])
+	}
+
+	idCol, err := column("resourceid", "_resourceid")
+	if err != nil {
+		return err
+	}
+	metricCol, err := column("metricname", "metric")
+	if err != nil {
+		return err
+	}
+	timeCol, err := column("timegenerated", "timestamp", "time")
+	if err != nil {
+		return err
+	}
+	valueCol, err := column("average", "value", "total")
+	if err != nil {
+		return err
+	}
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		line++
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(record) <= idCol || len(record) <= metricCol || len(record) <= timeCol || len(record) <= valueCol {
+			continue
+		}
+
+		raw := strings.TrimSpace(record[valueCol])
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid value %q", line, raw)
+		}
+		t, ok := parseTime(strings.TrimSpace(record[timeCol]))
+		if !ok {
+			return fmt.Errorf("line %d: invalid time %q", line, record[timeCol])
+		}
+		s.Add(strings.TrimSpace(record[idCol]), strings.TrimSpace(record[metricCol]), Point{Time: t, Value: value})
+	}
+}
+
+func parseTime(value string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,17 @@
+package models
+
+// Inventory holds all normalized resources from a scan
+type Inventory struct {
+	VNets               []VNet               `json:"vnets"`
+	NICs                []NetworkInterface   `json:"nics"`
+	PublicIPs           []PublicIP           `json:"publicIps"`
+	PrivateEndpoints    []PrivateEndpoint    `json:"privateEndpoints"`
+	NSGs                []NSG                `json:"nsgs"`
+	ASGs                []ASG                `json:"asgs"`
+	RouteTables         []RouteTable         `json:"routeTables"`
+	NATGateways         []NATGateway         `json:"natGateways"`
+	Gateways            []Gateway            `json:"gateways"`
+	LoadBalancers       []LoadBalancer       `json:"loadBalancers"`
+	ApplicationGateways []ApplicationGateway `json:"applicationGateways"`
+	Firewalls           []AzureFirewall      `json:"firewalls"`
+}
@@ -7,6 +7,7 @@ type NSG struct {
 	Location      string            `json:"location"`
 	ResourceGroup string            `json:"resourceGroup"`
 	Rules         []NSGRule         `json:"rules"`
+	DefaultRules  []NSGRule         `json:"defaultRules,omitempty"` // Azure built-in rules (priority 65000+)
 	Subnets       []string          `json:"subnets,omitempty"`       // Subnet IDs this NSG is attached to
 	NICs          []string          `json:"nics,omitempty"`          // NIC IDs this NSG is attached to
 	Tags          map[string]string `json:"tags,omitempty"`
@@ -0,0 +1,159 @@
+package normalize
+
+import (
+	"fmt"
+	"strings"
+)
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func getMap(m map[string]interface{}, key string) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	return asMap(m[key])
+}
+
+func getSlice(m map[string]interface{}, key string) []interface{} {
+	if m == nil {
+		return nil
+	}
+	s, _ := m[key].([]interface{})
+	return s
+}
+
+func getString(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%v", v)
+	}
+	return ""
+}
+
+func getStrings(m map[string]interface{}, key string) []string {
+	var values []string
+	for _, v := range getSlice(m, key) {
+		if s, ok := v.(string); ok && s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+func getInt(m map[string]interface{}, key string) int {
+	if m == nil {
+		return 0
+	}
+	switch v := m[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		var n int
+		fmt.Sscanf(v, "%d", &n)
+		return n
+	}
+	return 0
+}
+
+func getBool(m map[string]interface{}, key string) bool {
+	if m == nil {
+		return false
+	}
+	b, _ := m[key].(bool)
+	return b
+}
+
+// props returns the "properties" bag of a resource or sub-resource
+func props(m map[string]interface{}) map[string]interface{} {
+	return getMap(m, "properties")
+}
+
+// refID extracts the "id" from a reference object such as {"id": "..."}
+func refID(ref interface{}) string {
+	return getString(asMap(ref), "id")
+}
+
+// refIDs extracts IDs from a list of reference objects
+func refIDs(m map[string]interface{}, key string) []string {
+	var ids []string
+	for _, ref := range getSlice(m, key) {
+		if id := refID(ref); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// skuName returns sku.name from a resource, falling back to properties.sku.name
+func skuName(res map[string]interface{}) string {
+	if name := getString(getMap(res, "sku"), "name"); name != "" {
+		return name
+	}
+	return getString(getMap(props(res), "sku"), "name")
+}
+
+// skuTier returns sku.tier from a resource, falling back to properties.sku.tier
+func skuTier(res map[string]interface{}) string {
+	if tier := getString(getMap(res, "sku"), "tier"); tier != "" {
+		return tier
+	}
+	return getString(getMap(props(res), "sku"), "tier")
+}
+
+// getTags converts the raw tag bag to a string map
+func getTags(res map[string]interface{}) map[string]string {
+	raw := getMap(res, "tags")
+	if len(raw) == 0 {
+		return nil
+	}
+	tags := make(map[string]string, len(raw))
+	for k, v := range raw {
+		tags[k] = fmt.Sprintf("%v", v)
+	}
+	return tags
+}
+
+// topLevelID returns the parent resource ID for a child resource ID
+func topLevelID(id string) string {
+	parts := strings.Split(strings.TrimSuffix(id, "/"), "/")
+	if len(parts) < 9 || !strings.EqualFold(parts[1], "subscriptions") || !strings.EqualFold(parts[5], "providers") {
+		return id
+	}
+	return strings.Join(parts[:9], "/")
+}
+
+// lastSegment returns the final segment of a resource ID (usually the name)
+func lastSegment(id string) string {
+	parts := strings.Split(strings.TrimSuffix(id, "/"), "/")
+	return parts[len(parts)-1]
+}
+
+// resourceTypeOf returns the lowercased provider type of a resource ID
+func resourceTypeOf(id string) string {
+	parts := strings.Split(strings.ToLower(topLevelID(id)), "/")
+	if len(parts) < 9 {
+		return ""
+	}
+	return parts[6] + "/" + parts[7]
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func lessID(a, b string) bool {
+	return strings.ToLower(a) < strings.ToLower(b)
+}
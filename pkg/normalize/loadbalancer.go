@@ -0,0 +1,239 @@
+package normalize
+
+import (
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// normalizeLoadBalancer converts a load balancer and its frontends, pools and rules
+func normalizeLoadBalancer(res map[string]interface{}) models.LoadBalancer {
+	p := props(res)
+
+	lb := models.LoadBalancer{
+		ID:                 getString(res, "id"),
+		Name:               getString(res, "name"),
+		Location:           getString(res, "location"),
+		ResourceGroup:      getString(res, "resourceGroup"),
+		SKU:                skuName(res),
+		Type:               "Internal",
+		FrontendIPs:        []models.LoadBalancerFrontend{},
+		BackendPools:       []models.LoadBalancerBackend{},
+		LoadBalancingRules: []models.LBRule{},
+		Probes:             []models.LBProbe{},
+		Tags:               getTags(res),
+	}
+
+	for _, feIface := range getSlice(p, "frontendIPConfigurations") {
+		fe := asMap(feIface)
+		fp := props(fe)
+		frontend := models.LoadBalancerFrontend{
+			Name:        getString(fe, "name"),
+			PrivateIP:   getString(fp, "privateIPAddress"),
+			PublicIPRef: refID(fp["publicIPAddress"]),
+			SubnetID:    refID(fp["subnet"]),
+			Zones:       getStrings(fe, "zones"),
+		}
+		if frontend.PublicIPRef != "" {
+			lb.Type = "Public"
+		}
+		lb.FrontendIPs = append(lb.FrontendIPs, frontend)
+	}
+
+	for _, poolIface := range getSlice(p, "backendAddressPools") {
+		pool := asMap(poolIface)
+		pp := props(pool)
+		backend := models.LoadBalancerBackend{
+			Name:    getString(pool, "name"),
+			NICRefs: refIDs(pp, "backendIPConfigurations"),
+		}
+		for _, addrIface := range getSlice(pp, "loadBalancerBackendAddresses") {
+			addr := asMap(addrIface)
+			ap := props(addr)
+			backend.Addresses = append(backend.Addresses, models.BackendAddress{
+				Name:      getString(addr, "name"),
+				IPAddress: getString(ap, "ipAddress"),
+				VNetID:    refID(ap["virtualNetwork"]),
+			})
+		}
+		lb.BackendPools = append(lb.BackendPools, backend)
+	}
+
+	for _, ruleIface := range getSlice(p, "loadBalancingRules") {
+		rule := asMap(ruleIface)
+		rp := props(rule)
+		lb.LoadBalancingRules = append(lb.LoadBalancingRules, models.LBRule{
+			Name:                getString(rule, "name"),
+			Protocol:            getString(rp, "protocol"),
+			FrontendPort:        getInt(rp, "frontendPort"),
+			BackendPort:         getInt(rp, "backendPort"),
+			FrontendIPRef:       refID(rp["frontendIPConfiguration"]),
+			BackendPoolRef:      refID(rp["backendAddressPool"]),
+			ProbeRef:            refID(rp["probe"]),
+			EnableFloatingIP:    getBool(rp, "enableFloatingIP"),
+			IdleTimeoutMins:     getInt(rp, "idleTimeoutInMinutes"),
+			LoadDistribution:    getString(rp, "loadDistribution"),
+			DisableOutboundSNAT: getBool(rp, "disableOutboundSnat"),
+		})
+	}
+
+	for _, probeIface := range getSlice(p, "probes") {
+		probe := asMap(probeIface)
+		pp := props(probe)
+		lb.Probes = append(lb.Probes, models.LBProbe{
+			Name:         getString(probe, "name"),
+			Protocol:     getString(pp, "protocol"),
+			Port:         getInt(pp, "port"),
+			Path:         getString(pp, "requestPath"),
+			IntervalSecs: getInt(pp, "intervalInSeconds"),
+			NumProbes:    getInt(pp, "numberOfProbes"),
+		})
+	}
+
+	for _, natIface := range getSlice(p, "inboundNatRules") {
+		nat := asMap(natIface)
+		np := props(nat)
+		lb.InboundNATRules = append(lb.InboundNATRules, models.LBNATRule{
+			Name:             getString(nat, "name"),
+			Protocol:         getString(np, "protocol"),
+			FrontendPort:     getInt(np, "frontendPort"),
+			BackendPort:      getInt(np, "backendPort"),
+			FrontendIPRef:    refID(np["frontendIPConfiguration"]),
+			NICRef:           refID(np["backendIPConfiguration"]),
+			EnableFloatingIP: getBool(np, "enableFloatingIP"),
+			IdleTimeoutMins:  getInt(np, "idleTimeoutInMinutes"),
+		})
+	}
+
+	for _, outIface := range getSlice(p, "outboundRules") {
+		out := asMap(outIface)
+		op := props(out)
+		lb.OutboundRules = append(lb.OutboundRules, models.LBOutboundRule{
+			Name:                   getString(out, "name"),
+			Protocol:               getString(op, "protocol"),
+			FrontendIPRefs:         refIDs(op, "frontendIPConfigurations"),
+			BackendPoolRef:         refID(op["backendAddressPool"]),
+			IdleTimeoutMins:        getInt(op, "idleTimeoutInMinutes"),
+			AllocatedOutboundPorts: getInt(op, "allocatedOutboundPorts"),
+			EnableTCPReset:         getBool(op, "enableTcpReset"),
+		})
+	}
+
+	return lb
+}
+
+// normalizeApplicationGateway converts an application gateway
+func normalizeApplicationGateway(res map[string]interface{}) models.ApplicationGateway {
+	p := props(res)
+	sku := getMap(p, "sku")
+
+	agw := models.ApplicationGateway{
+		ID:                  getString(res, "id"),
+		Name:                getString(res, "name"),
+		Location:            getString(res, "location"),
+		ResourceGroup:       getString(res, "resourceGroup"),
+		SKU:                 getString(sku, "name"),
+		Tier:                getString(sku, "tier"),
+		Capacity:            getInt(sku, "capacity"),
+		FrontendPorts:       []models.AppGWFrontendPort{},
+		BackendPools:        []models.AppGWBackendPool{},
+		HTTPListeners:       []models.AppGWListener{},
+		RequestRoutingRules: []models.AppGWRoutingRule{},
+		Tags:                getTags(res),
+	}
+	if agw.Capacity == 0 {
+		agw.Capacity = getInt(getMap(p, "autoscaleConfiguration"), "minCapacity")
+	}
+
+	for _, ipConfig := range getSlice(p, "gatewayIPConfigurations") {
+		if subnetID := refID(props(asMap(ipConfig))["subnet"]); subnetID != "" {
+			agw.SubnetID = subnetID
+			agw.VNetID = topLevelID(subnetID)
+		}
+	}
+
+	for _, feIface := range getSlice(p, "frontendIPConfigurations") {
+		fp := props(asMap(feIface))
+		if pip := refID(fp["publicIPAddress"]); pip != "" {
+			agw.PublicIPs = append(agw.PublicIPs, pip)
+		}
+		if ip := getString(fp, "privateIPAddress"); ip != "" {
+			agw.PrivateIPs = append(agw.PrivateIPs, ip)
+		}
+	}
+
+	for _, portIface := range getSlice(p, "frontendPorts") {
+		port := asMap(portIface)
+		agw.FrontendPorts = append(agw.FrontendPorts, models.AppGWFrontendPort{
+			Name: getString(port, "name"),
+			Port: getInt(props(port), "port"),
+		})
+	}
+
+	for _, poolIface := range getSlice(p, "backendAddressPools") {
+		pool := asMap(poolIface)
+		backend := models.AppGWBackendPool{Name: getString(pool, "name"), Addresses: []models.AppGWBackendAddress{}}
+		for _, addrIface := range getSlice(props(pool), "backendAddresses") {
+			addr := asMap(addrIface)
+			backend.Addresses = append(backend.Addresses, models.AppGWBackendAddress{
+				FQDN:      getString(addr, "fqdn"),
+				IPAddress: getString(addr, "ipAddress"),
+			})
+		}
+		agw.BackendPools = append(agw.BackendPools, backend)
+	}
+
+	for _, listenerIface := range getSlice(p, "httpListeners") {
+		listener := asMap(listenerIface)
+		lp := props(listener)
+		agw.HTTPListeners = append(agw.HTTPListeners, models.AppGWListener{
+			Name:                        getString(listener, "name"),
+			Protocol:                    getString(lp, "protocol"),
+			FrontendIPRef:               refID(lp["frontendIPConfiguration"]),
+			FrontendPortRef:             refID(lp["frontendPort"]),
+			HostName:                    getString(lp, "hostName"),
+			RequireServerNameIndication: getBool(lp, "requireServerNameIndication"),
+			SSLCertificateRef:           refID(lp["sslCertificate"]),
+		})
+	}
+
+	for _, ruleIface := range getSlice(p, "requestRoutingRules") {
+		rule := asMap(ruleIface)
+		rp := props(rule)
+		agw.RequestRoutingRules = append(agw.RequestRoutingRules, models.AppGWRoutingRule{
+			Name:                getString(rule, "name"),
+			RuleType:            getString(rp, "ruleType"),
+			Priority:            getInt(rp, "priority"),
+			ListenerRef:         refID(rp["httpListener"]),
+			BackendPoolRef:      refID(rp["backendAddressPool"]),
+			BackendHTTPSettings: refID(rp["backendHttpSettings"]),
+			RedirectConfigRef:   refID(rp["redirectConfiguration"]),
+		})
+	}
+
+	for _, probeIface := range getSlice(p, "probes") {
+		probe := asMap(probeIface)
+		pp := props(probe)
+		agw.Probes = append(agw.Probes, models.AppGWProbe{
+			Name:                    getString(probe, "name"),
+			Protocol:                getString(pp, "protocol"),
+			Host:                    getString(pp, "host"),
+			Path:                    getString(pp, "path"),
+			IntervalSecs:            getInt(pp, "interval"),
+			TimeoutSecs:             getInt(pp, "timeout"),
+			UnhealthyThreshold:      getInt(pp, "unhealthyThreshold"),
+			PickHostNameFromBackend: getBool(pp, "pickHostNameFromBackendHttpSettings"),
+		})
+	}
+
+	// WAF is enabled either inline or via an attached firewall policy
+	if waf := getMap(p, "webApplicationFirewallConfiguration"); waf != nil {
+		agw.WAFEnabled = getBool(waf, "enabled")
+		agw.WAFMode = getString(waf, "firewallMode")
+	}
+	if refID(p["firewallPolicy"]) != "" || strings.HasPrefix(strings.ToUpper(agw.Tier), "WAF") {
+		agw.WAFEnabled = true
+	}
+
+	return agw
+}
@@ -0,0 +1,219 @@
+package normalize
+
+import (
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// normalizeVNet converts a virtual network and its subnets and peerings
+func normalizeVNet(res map[string]interface{}) models.VNet {
+	p := props(res)
+
+	vnet := models.VNet{
+		ID:                   getString(res, "id"),
+		Name:                 getString(res, "name"),
+		Location:             getString(res, "location"),
+		ResourceGroup:        getString(res, "resourceGroup"),
+		AddressSpaces:        getStrings(getMap(p, "addressSpace"), "addressPrefixes"),
+		DNSServers:           getStrings(getMap(p, "dhcpOptions"), "dnsServers"),
+		Subnets:              []models.Subnet{},
+		Tags:                 getTags(res),
+		EnableDDoSProtection: getBool(p, "enableDdosProtection"),
+	}
+
+	for _, subnetIface := range getSlice(p, "subnets") {
+		vnet.Subnets = append(vnet.Subnets, normalizeSubnet(asMap(subnetIface)))
+	}
+
+	for _, peeringIface := range getSlice(p, "virtualNetworkPeerings") {
+		peering := asMap(peeringIface)
+		pp := props(peering)
+		remoteID := refID(pp["remoteVirtualNetwork"])
+
+		vnet.Peerings = append(vnet.Peerings, models.VNetPeering{
+			ID:                    getString(peering, "id"),
+			Name:                  getString(peering, "name"),
+			RemoteVNetID:          remoteID,
+			RemoteVNetName:        lastSegment(remoteID),
+			AllowVNetAccess:       getBool(pp, "allowVirtualNetworkAccess"),
+			AllowForwardedTraffic: getBool(pp, "allowForwardedTraffic"),
+			AllowGatewayTransit:   getBool(pp, "allowGatewayTransit"),
+			UseRemoteGateways:     getBool(pp, "useRemoteGateways"),
+			PeeringState:          getString(pp, "peeringState"),
+			RemoteAddressSpaces:   getStrings(getMap(pp, "remoteAddressSpace"), "addressPrefixes"),
+		})
+	}
+
+	return vnet
+}
+
+// normalizeSubnet converts an embedded subnet object
+func normalizeSubnet(subnet map[string]interface{}) models.Subnet {
+	p := props(subnet)
+
+	addressPrefix := getString(p, "addressPrefix")
+	prefixes := getStrings(p, "addressPrefixes")
+	if addressPrefix == "" && len(prefixes) > 0 {
+		addressPrefix = prefixes[0]
+	}
+	if addressPrefix != "" {
+		all := []string{addressPrefix}
+		for _, prefix := range prefixes {
+			all = appendUnique(all, prefix)
+		}
+		prefixes = all
+	}
+
+	s := models.Subnet{
+		ID:               getString(subnet, "id"),
+		Name:             getString(subnet, "name"),
+		AddressPrefix:    addressPrefix,
+		AddressPrefixes:  prefixes,
+		NSGRef:           refID(p["networkSecurityGroup"]),
+		RouteTableRef:    refID(p["routeTable"]),
+		NATGatewayRef:    refID(p["natGateway"]),
+		PrivateEndpoints: refIDs(p, "privateEndpoints"),
+
+		PrivateEndpointNetworkPolicies: getString(p, "privateEndpointNetworkPolicies"),
+	}
+
+	for _, se := range getSlice(p, "serviceEndpoints") {
+		if service := getString(props(asMap(se)), "service"); service != "" {
+			s.ServiceEndpoints = append(s.ServiceEndpoints, service)
+		}
+	}
+
+	for _, d := range getSlice(p, "delegations") {
+		if service := getString(props(asMap(d)), "serviceName"); service != "" {
+			s.Delegations = append(s.Delegations, service)
+		}
+	}
+
+	// Only IP configurations belonging to NICs are connected NICs
+	for _, ipConfig := range refIDs(p, "ipConfigurations") {
+		if resourceTypeOf(ipConfig) == "microsoft.network/networkinterfaces" {
+			s.ConnectedNICs = appendUnique(s.ConnectedNICs, topLevelID(ipConfig))
+		}
+	}
+
+	return s
+}
+
+// normalizeNIC converts a network interface
+func normalizeNIC(res map[string]interface{}) models.NetworkInterface {
+	p := props(res)
+
+	nic := models.NetworkInterface{
+		ID:                   getString(res, "id"),
+		Name:                 getString(res, "name"),
+		Location:             getString(res, "location"),
+		ResourceGroup:        getString(res, "resourceGroup"),
+		NSGRef:               refID(p["networkSecurityGroup"]),
+		EnableIPForwarding:   getBool(p, "enableIPForwarding"),
+		EnableAcceleratedNet: getBool(p, "enableAcceleratedNetworking"),
+		IPConfigurations:     []models.IPConfiguration{},
+	}
+
+	for _, ipConfigIface := range getSlice(p, "ipConfigurations") {
+		ipConfig := asMap(ipConfigIface)
+		ip := props(ipConfig)
+
+		config := models.IPConfiguration{
+			Name:                    getString(ipConfig, "name"),
+			PrivateIP:               getString(ip, "privateIPAddress"),
+			PrivateIPAllocation:     getString(ip, "privateIPAllocationMethod"),
+			SubnetID:                refID(ip["subnet"]),
+			PublicIPRef:             refID(ip["publicIPAddress"]),
+			LoadBalancerBackendRefs: refIDs(ip, "loadBalancerBackendAddressPools"),
+			AppGatewayBackendRefs:   refIDs(ip, "applicationGatewayBackendAddressPools"),
+			ASGRefs:                 refIDs(ip, "applicationSecurityGroups"),
+			Primary:                 getBool(ip, "primary"),
+		}
+		nic.IPConfigurations = append(nic.IPConfigurations, config)
+	}
+
+	// Top-level fields describe the primary (or first) IP configuration
+	if len(nic.IPConfigurations) > 0 {
+		primary := nic.IPConfigurations[0]
+		for _, config := range nic.IPConfigurations {
+			if config.Primary {
+				primary = config
+				break
+			}
+		}
+		nic.SubnetID = primary.SubnetID
+		nic.PrivateIP = primary.PrivateIP
+		nic.PrivateIPAllocation = primary.PrivateIPAllocation
+		nic.PublicIPRef = primary.PublicIPRef
+	}
+
+	if vmID := refID(p["virtualMachine"]); vmID != "" {
+		nic.AttachedTo = &models.AttachedResource{Type: "VM", ID: vmID, Name: lastSegment(vmID)}
+	} else if peID := refID(p["privateEndpoint"]); peID != "" {
+		nic.AttachedTo = &models.AttachedResource{Type: "PrivateEndpoint", ID: peID, Name: lastSegment(peID)}
+	}
+
+	return nic
+}
+
+// normalizePublicIP converts a public IP address
+func normalizePublicIP(res map[string]interface{}) models.PublicIP {
+	p := props(res)
+
+	version := getString(p, "publicIPAddressVersion")
+	if version == "" {
+		version = "IPv4"
+	}
+
+	return models.PublicIP{
+		ID:               getString(res, "id"),
+		Name:             getString(res, "name"),
+		Location:         getString(res, "location"),
+		ResourceGroup:    getString(res, "resourceGroup"),
+		IPAddress:        getString(p, "ipAddress"),
+		AllocationMethod: getString(p, "publicIPAllocationMethod"),
+		SKU:              skuName(res),
+		Version:          version,
+		DNSName:          getString(getMap(p, "dnsSettings"), "fqdn"),
+		Tags:             getTags(res),
+	}
+}
+
+// normalizePrivateEndpoint converts a private endpoint
+func normalizePrivateEndpoint(res map[string]interface{}) models.PrivateEndpoint {
+	p := props(res)
+
+	pe := models.PrivateEndpoint{
+		ID:            getString(res, "id"),
+		Name:          getString(res, "name"),
+		Location:      getString(res, "location"),
+		ResourceGroup: getString(res, "resourceGroup"),
+		SubnetID:      refID(p["subnet"]),
+	}
+
+	connections := append(getSlice(p, "privateLinkServiceConnections"), getSlice(p, "manualPrivateLinkServiceConnections")...)
+	for _, conn := range connections {
+		if target := getString(props(asMap(conn)), "privateLinkServiceId"); target != "" {
+			pe.PrivateLinkServiceID = target
+			break
+		}
+	}
+
+	for _, cfg := range getSlice(p, "customDnsConfigs") {
+		dns := asMap(cfg)
+		pe.CustomDNSConfigs = append(pe.CustomDNSConfigs, models.CustomDNSConfig{
+			FQDN:        getString(dns, "fqdn"),
+			IPAddresses: getStrings(dns, "ipAddresses"),
+		})
+	}
+	if len(pe.CustomDNSConfigs) > 0 && len(pe.CustomDNSConfigs[0].IPAddresses) > 0 {
+		pe.PrivateIP = pe.CustomDNSConfigs[0].IPAddresses[0]
+	}
+
+	for _, group := range getSlice(p, "privateDnsZoneGroups") {
+		if name := getString(asMap(group), "name"); name != "" {
+			pe.PrivateDNSZoneGroups = append(pe.PrivateDNSZoneGroups, name)
+		}
+	}
+
+	return pe
+}
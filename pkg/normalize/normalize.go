@@ -0,0 +1,273 @@
+package normalize
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// files maps each inventory collection to its file under normalized/
+var files = []string{
+	"vnets.json",
+	"nics.json",
+	"public-ips.json",
+	"private-endpoints.json",
+	"nsgs.json",
+	"asgs.json",
+	"route-tables.json",
+	"nat-gateways.json",
+	"gateways.json",
+	"load-balancers.json",
+	"application-gateways.json",
+	"firewalls.json",
+}
+
+// Normalize converts raw Resource Graph rows into typed models
+func Normalize(resources []map[string]interface{}) *models.Inventory {
+	inv := &models.Inventory{
+		VNets:               []models.VNet{},
+		NICs:                []models.NetworkInterface{},
+		PublicIPs:           []models.PublicIP{},
+		PrivateEndpoints:    []models.PrivateEndpoint{},
+		NSGs:                []models.NSG{},
+		ASGs:                []models.ASG{},
+		RouteTables:         []models.RouteTable{},
+		NATGateways:         []models.NATGateway{},
+		Gateways:            []models.Gateway{},
+		LoadBalancers:       []models.LoadBalancer{},
+		ApplicationGateways: []models.ApplicationGateway{},
+		Firewalls:           []models.AzureFirewall{},
+	}
+
+	var connections []map[string]interface{}
+
+	for _, res := range resources {
+		switch strings.ToLower(getString(res, "type")) {
+		case "microsoft.network/virtualnetworks":
+			inv.VNets = append(inv.VNets, normalizeVNet(res))
+		case "microsoft.network/networkinterfaces":
+			inv.NICs = append(inv.NICs, normalizeNIC(res))
+		case "microsoft.network/publicipaddresses":
+			inv.PublicIPs = append(inv.PublicIPs, normalizePublicIP(res))
+		case "microsoft.network/privateendpoints":
+			inv.PrivateEndpoints = append(inv.PrivateEndpoints, normalizePrivateEndpoint(res))
+		case "microsoft.network/networksecuritygroups":
+			inv.NSGs = append(inv.NSGs, normalizeNSG(res))
+		case "microsoft.network/applicationsecuritygroups":
+			inv.ASGs = append(inv.ASGs, normalizeASG(res))
+		case "microsoft.network/routetables":
+			inv.RouteTables = append(inv.RouteTables, normalizeRouteTable(res))
+		case "microsoft.network/natgateways":
+			inv.NATGateways = append(inv.NATGateways, normalizeNATGateway(res))
+		case "microsoft.network/virtualnetworkgateways":
+			inv.Gateways = append(inv.Gateways, normalizeGateway(res))
+		case "microsoft.network/connections":
+			connections = append(connections, res)
+		case "microsoft.network/loadbalancers":
+			inv.LoadBalancers = append(inv.LoadBalancers, normalizeLoadBalancer(res))
+		case "microsoft.network/applicationgateways":
+			inv.ApplicationGateways = append(inv.ApplicationGateways, normalizeApplicationGateway(res))
+		case "microsoft.network/azurefirewalls":
+			inv.Firewalls = append(inv.Firewalls, normalizeFirewall(res))
+		}
+	}
+
+	attachConnections(inv, connections)
+	linkReferences(inv)
+	sortInventory(inv)
+
+	return inv
+}
+
+// linkReferences fills in back-references that are only present on the other side
+func linkReferences(inv *models.Inventory) {
+	subnets := make(map[string]*models.Subnet)
+	for i := range inv.VNets {
+		for j := range inv.VNets[i].Subnets {
+			subnet := &inv.VNets[i].Subnets[j]
+			subnets[strings.ToLower(subnet.ID)] = subnet
+		}
+	}
+
+	for _, nic := range inv.NICs {
+		for _, ipConfig := range nic.IPConfigurations {
+			if subnet, ok := subnets[strings.ToLower(ipConfig.SubnetID)]; ok {
+				subnet.ConnectedNICs = appendUnique(subnet.ConnectedNICs, nic.ID)
+			}
+		}
+	}
+
+	for i := range inv.PrivateEndpoints {
+		pe := &inv.PrivateEndpoints[i]
+		if subnet, ok := subnets[strings.ToLower(pe.SubnetID)]; ok {
+			subnet.PrivateEndpoints = appendUnique(subnet.PrivateEndpoints, pe.ID)
+		}
+	}
+
+	for i := range inv.NICs {
+		nic := &inv.NICs[i]
+		if nic.AttachedTo == nil || nic.AttachedTo.Type != "PrivateEndpoint" {
+			continue
+		}
+		for j := range inv.PrivateEndpoints {
+			pe := &inv.PrivateEndpoints[j]
+			if strings.EqualFold(pe.ID, nic.AttachedTo.ID) && pe.PrivateIP == "" {
+				pe.PrivateIP = nic.PrivateIP
+			}
+		}
+	}
+
+	// NSG and route table associations are reported on both sides; merge them
+	for i := range inv.NSGs {
+		nsg := &inv.NSGs[i]
+		for _, subnet := range subnets {
+			if strings.EqualFold(subnet.NSGRef, nsg.ID) {
+				nsg.Subnets = appendUnique(nsg.Subnets, subnet.ID)
+			}
+		}
+		for _, nic := range inv.NICs {
+			if strings.EqualFold(nic.NSGRef, nsg.ID) {
+				nsg.NICs = appendUnique(nsg.NICs, nic.ID)
+			}
+		}
+	}
+
+	for i := range inv.RouteTables {
+		rt := &inv.RouteTables[i]
+		for _, subnet := range subnets {
+			if strings.EqualFold(subnet.RouteTableRef, rt.ID) {
+				rt.Subnets = appendUnique(rt.Subnets, subnet.ID)
+			}
+		}
+	}
+
+	for i := range inv.NATGateways {
+		nat := &inv.NATGateways[i]
+		for _, subnet := range subnets {
+			if strings.EqualFold(subnet.NATGatewayRef, nat.ID) {
+				nat.Subnets = appendUnique(nat.Subnets, subnet.ID)
+			}
+		}
+	}
+
+	// Resolve remote address spaces for peerings within the inventory
+	vnetSpaces := make(map[string][]string)
+	for _, vnet := range inv.VNets {
+		vnetSpaces[strings.ToLower(vnet.ID)] = vnet.AddressSpaces
+	}
+	for i := range inv.VNets {
+		for j := range inv.VNets[i].Peerings {
+			peering := &inv.VNets[i].Peerings[j]
+			if len(peering.RemoteAddressSpaces) == 0 {
+				peering.RemoteAddressSpaces = vnetSpaces[strings.ToLower(peering.RemoteVNetID)]
+			}
+		}
+	}
+}
+
+// sortInventory orders every collection by ID so output is deterministic
+func sortInventory(inv *models.Inventory) {
+	sort.Slice(inv.VNets, func(i, j int) bool { return lessID(inv.VNets[i].ID, inv.VNets[j].ID) })
+	sort.Slice(inv.NICs, func(i, j int) bool { return lessID(inv.NICs[i].ID, inv.NICs[j].ID) })
+	sort.Slice(inv.PublicIPs, func(i, j int) bool { return lessID(inv.PublicIPs[i].ID, inv.PublicIPs[j].ID) })
+	sort.Slice(inv.PrivateEndpoints, func(i, j int) bool {
+		return lessID(inv.PrivateEndpoints[i].ID, inv.PrivateEndpoints[j].ID)
+	})
+	sort.Slice(inv.NSGs, func(i, j int) bool { return lessID(inv.NSGs[i].ID, inv.NSGs[j].ID) })
+	sort.Slice(inv.ASGs, func(i, j int) bool { return lessID(inv.ASGs[i].ID, inv.ASGs[j].ID) })
+	sort.Slice(inv.RouteTables, func(i, j int) bool { return lessID(inv.RouteTables[i].ID, inv.RouteTables[j].ID) })
+	sort.Slice(inv.NATGateways, func(i, j int) bool { return lessID(inv.NATGateways[i].ID, inv.NATGateways[j].ID) })
+	sort.Slice(inv.Gateways, func(i, j int) bool { return lessID(inv.Gateways[i].ID, inv.Gateways[j].ID) })
+	sort.Slice(inv.LoadBalancers, func(i, j int) bool {
+		return lessID(inv.LoadBalancers[i].ID, inv.LoadBalancers[j].ID)
+	})
+	sort.Slice(inv.ApplicationGateways, func(i, j int) bool {
+		return lessID(inv.ApplicationGateways[i].ID, inv.ApplicationGateways[j].ID)
+	})
+	sort.Slice(inv.Firewalls, func(i, j int) bool { return lessID(inv.Firewalls[i].ID, inv.Firewalls[j].ID) })
+
+	for i := range inv.NSGs {
+		nsg := &inv.NSGs[i]
+		sort.SliceStable(nsg.Rules, func(a, b int) bool { return nsg.Rules[a].Priority < nsg.Rules[b].Priority })
+		sort.SliceStable(nsg.DefaultRules, func(a, b int) bool {
+			return nsg.DefaultRules[a].Priority < nsg.DefaultRules[b].Priority
+		})
+		sort.Strings(nsg.Subnets)
+		sort.Strings(nsg.NICs)
+	}
+	for i := range inv.VNets {
+		for j := range inv.VNets[i].Subnets {
+			sort.Strings(inv.VNets[i].Subnets[j].ConnectedNICs)
+			sort.Strings(inv.VNets[i].Subnets[j].PrivateEndpoints)
+		}
+	}
+	for i := range inv.RouteTables {
+		sort.Strings(inv.RouteTables[i].Subnets)
+	}
+	for i := range inv.NATGateways {
+		sort.Strings(inv.NATGateways[i].Subnets)
+	}
+}
+
+// collections returns pointers to the inventory collections in files order
+func collections(inv *models.Inventory) []interface{} {
+	return []interface{}{
+		&inv.VNets,
+		&inv.NICs,
+		&inv.PublicIPs,
+		&inv.PrivateEndpoints,
+		&inv.NSGs,
+		&inv.ASGs,
+		&inv.RouteTables,
+		&inv.NATGateways,
+		&inv.Gateways,
+		&inv.LoadBalancers,
+		&inv.ApplicationGateways,
+		&inv.Firewalls,
+	}
+}
+
+// SaveToDirectory writes the inventory to dir/normalized/*.json
+func SaveToDirectory(inv *models.Inventory, dir string) error {
+	normDir := filepath.Join(dir, "normalized")
+	if err := os.MkdirAll(normDir, 0755); err != nil {
+		return fmt.Errorf("failed to create normalized directory: %w", err)
+	}
+
+	collections := collections(inv)
+	for i, name := range files {
+		data, err := json.MarshalIndent(collections[i], "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(normDir, name), data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadFromDirectory reads a previously saved inventory from dir/normalized
+func LoadFromDirectory(dir string) (*models.Inventory, error) {
+	normDir := filepath.Join(dir, "normalized")
+	inv := &models.Inventory{}
+
+	collections := collections(inv)
+	for i, name := range files {
+		data, err := os.ReadFile(filepath.Join(normDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := json.Unmarshal(data, collections[i]); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+	}
+
+	return inv, nil
+}
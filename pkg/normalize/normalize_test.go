@@ -0,0 +1,637 @@
+package normalize
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+const (
+	hubID     = "/subscriptions/sub1/resourceGroups/rg-net/providers/Microsoft.Network/virtualNetworks/vnet-hub"
+	spokeID   = "/subscriptions/sub1/resourceGroups/rg-spoke/providers/Microsoft.Network/virtualNetworks/vnet-spoke"
+	appSubnet = hubID + "/subnets/snet-app"
+	nicVM1    = "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network/networkInterfaces/nic-vm1"
+	peSubnet  = spokeID + "/subnets/snet-pe"
+
+	appNetwork = "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network"
+	netNetwork = "/subscriptions/sub1/resourceGroups/rg-net/providers/Microsoft.Network"
+	dataGroup  = "/subscriptions/sub1/resourceGroups/rg-data/providers"
+)
+
+// loadFixture normalizes the recorded Resource Graph rows in testdata
+func loadFixture(t *testing.T) *models.Inventory {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/resources.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var resources []map[string]interface{}
+	if err := json.Unmarshal(data, &resources); err != nil {
+		t.Fatalf("failed to parse fixture: %v", err)
+	}
+	return Normalize(resources)
+}
+
+func findVNet(t *testing.T, inv *models.Inventory, name string) models.VNet {
+	t.Helper()
+	for _, vnet := range inv.VNets {
+		if vnet.Name == name {
+			return vnet
+		}
+	}
+	t.Fatalf("vnet %s not found", name)
+	return models.VNet{}
+}
+
+func findSubnet(t *testing.T, vnet models.VNet, name string) models.Subnet {
+	t.Helper()
+	for _, subnet := range vnet.Subnets {
+		if subnet.Name == name {
+			return subnet
+		}
+	}
+	t.Fatalf("subnet %s not found in %s", name, vnet.Name)
+	return models.Subnet{}
+}
+
+func findPeering(t *testing.T, vnet models.VNet, name string) models.VNetPeering {
+	t.Helper()
+	for _, peering := range vnet.Peerings {
+		if peering.Name == name {
+			return peering
+		}
+	}
+	t.Fatalf("peering %s not found in %s", name, vnet.Name)
+	return models.VNetPeering{}
+}
+
+func findNIC(t *testing.T, inv *models.Inventory, name string) models.NetworkInterface {
+	t.Helper()
+	for _, nic := range inv.NICs {
+		if nic.Name == name {
+			return nic
+		}
+	}
+	t.Fatalf("nic %s not found", name)
+	return models.NetworkInterface{}
+}
+
+func findRouteTable(t *testing.T, inv *models.Inventory, name string) models.RouteTable {
+	t.Helper()
+	for _, rt := range inv.RouteTables {
+		if rt.Name == name {
+			return rt
+		}
+	}
+	t.Fatalf("route table %s not found", name)
+	return models.RouteTable{}
+}
+
+func ruleNames(rules []models.NSGRule) []string {
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	return names
+}
+
+func assertEqual(t *testing.T, field string, got, want interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %#v, want %#v", field, got, want)
+	}
+}
+
+func TestNormalizeMatchesTypesCaseInsensitively(t *testing.T) {
+	inv := loadFixture(t)
+
+	assertEqual(t, "vnets", len(inv.VNets), 2)
+	assertEqual(t, "nics", len(inv.NICs), 3)
+	assertEqual(t, "public ips", len(inv.PublicIPs), 2)
+	assertEqual(t, "private endpoints", len(inv.PrivateEndpoints), 2)
+	assertEqual(t, "nsgs", len(inv.NSGs), 1)
+	assertEqual(t, "route tables", len(inv.RouteTables), 2)
+	assertEqual(t, "nat gateways", len(inv.NATGateways), 1)
+	assertEqual(t, "gateways", len(inv.Gateways), 1)
+	assertEqual(t, "load balancers", len(inv.LoadBalancers), 2)
+	assertEqual(t, "application gateways", len(inv.ApplicationGateways), 2)
+	assertEqual(t, "firewalls", len(inv.Firewalls), 2)
+
+	// Collections are sorted by ID regardless of input order
+	assertEqual(t, "first vnet", inv.VNets[0].ID, hubID)
+	assertEqual(t, "first nic", inv.NICs[0].Name, "nic-orphan")
+}
+
+func TestNormalizeVNet(t *testing.T) {
+	hub := findVNet(t, loadFixture(t), "vnet-hub")
+
+	assertEqual(t, "resource group", hub.ResourceGroup, "rg-net")
+	assertEqual(t, "address spaces", hub.AddressSpaces, []string{"10.0.0.0/16", "fd00:db8::/48"})
+	assertEqual(t, "dns servers", hub.DNSServers, []string{"10.0.0.4"})
+	assertEqual(t, "tags", hub.Tags, map[string]string{"env": "prod", "owner": "network-team"})
+	assertEqual(t, "subnets", len(hub.Subnets), 2)
+
+	spoke := findVNet(t, loadFixture(t), "vnet-spoke")
+	if spoke.DNSServers != nil || spoke.Tags != nil {
+		t.Errorf("missing dhcpOptions and tags gave dns %v and tags %v, want nil", spoke.DNSServers, spoke.Tags)
+	}
+}
+
+func TestNormalizeSubnet(t *testing.T) {
+	inv := loadFixture(t)
+	hub := findVNet(t, inv, "vnet-hub")
+
+	gateway := findSubnet(t, hub, "GatewaySubnet")
+	assertEqual(t, "gateway prefix", gateway.AddressPrefix, "10.0.0.0/27")
+	assertEqual(t, "gateway prefixes", gateway.AddressPrefixes, []string{"10.0.0.0/27"})
+
+	// Dual-stack subnets only report the plural form
+	app := findSubnet(t, hub, "snet-app")
+	assertEqual(t, "app prefix", app.AddressPrefix, "10.0.1.0/24")
+	assertEqual(t, "app prefixes", app.AddressPrefixes, []string{"10.0.1.0/24", "fd00:db8:0:1::/64"})
+	assertEqual(t, "route table", app.RouteTableRef, "/subscriptions/sub1/resourceGroups/rg-net/providers/Microsoft.Network/routeTables/rt-app")
+	assertEqual(t, "service endpoints", app.ServiceEndpoints, []string{"Microsoft.Storage"})
+	assertEqual(t, "delegations", app.Delegations, []string{"Microsoft.Web/serverFarms"})
+	assertEqual(t, "pe policies", app.PrivateEndpointNetworkPolicies, "Enabled")
+
+	// Load balancer frontends are not connected NICs, and the NIC reported on
+	// both sides appears once
+	assertEqual(t, "connected nics", app.ConnectedNICs, []string{nicVM1})
+
+	empty := findSubnet(t, findVNet(t, inv, "vnet-spoke"), "snet-empty")
+	assertEqual(t, "empty subnet", empty, models.Subnet{
+		ID:   spokeID + "/subnets/snet-empty",
+		Name: "snet-empty",
+	})
+}
+
+func TestNormalizeSubnetMergesPrefixForms(t *testing.T) {
+	tests := []struct {
+		name       string
+		props      map[string]interface{}
+		wantPrefix string
+		wantAll    []string
+	}{
+		{
+			name:       "singular only",
+			props:      map[string]interface{}{"addressPrefix": "10.0.0.0/24"},
+			wantPrefix: "10.0.0.0/24",
+			wantAll:    []string{"10.0.0.0/24"},
+		},
+		{
+			name:       "plural only",
+			props:      map[string]interface{}{"addressPrefixes": []interface{}{"10.0.0.0/24", "10.0.1.0/24"}},
+			wantPrefix: "10.0.0.0/24",
+			wantAll:    []string{"10.0.0.0/24", "10.0.1.0/24"},
+		},
+		{
+			name: "both forms overlap",
+			props: map[string]interface{}{
+				"addressPrefix":   "10.0.1.0/24",
+				"addressPrefixes": []interface{}{"10.0.0.0/24", "10.0.1.0/24"},
+			},
+			wantPrefix: "10.0.1.0/24",
+			wantAll:    []string{"10.0.1.0/24", "10.0.0.0/24"},
+		},
+		{
+			name:  "neither",
+			props: map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subnet := normalizeSubnet(map[string]interface{}{"name": "s", "properties": tt.props})
+			assertEqual(t, "address prefix", subnet.AddressPrefix, tt.wantPrefix)
+			assertEqual(t, "address prefixes", subnet.AddressPrefixes, tt.wantAll)
+		})
+	}
+}
+
+func TestNormalizePeerings(t *testing.T) {
+	inv := loadFixture(t)
+	hub := findVNet(t, inv, "vnet-hub")
+	spoke := findVNet(t, inv, "vnet-spoke")
+
+	hubToSpoke := findPeering(t, hub, "hub-to-spoke")
+	assertEqual(t, "remote vnet", hubToSpoke.RemoteVNetID, spokeID)
+	assertEqual(t, "remote name", hubToSpoke.RemoteVNetName, "vnet-spoke")
+	if !hubToSpoke.AllowVNetAccess || !hubToSpoke.AllowForwardedTraffic || !hubToSpoke.AllowGatewayTransit || hubToSpoke.UseRemoteGateways {
+		t.Errorf("hub-to-spoke flags = %+v", hubToSpoke)
+	}
+	// The remote address space is missing from the row and resolved from the inventory
+	assertEqual(t, "resolved remote space", hubToSpoke.RemoteAddressSpaces, []string{"10.1.0.0/16"})
+
+	spokeToHub := findPeering(t, spoke, "spoke-to-hub")
+	if !spokeToHub.UseRemoteGateways || spokeToHub.AllowGatewayTransit || spokeToHub.AllowForwardedTraffic {
+		t.Errorf("spoke-to-hub flags = %+v", spokeToHub)
+	}
+	assertEqual(t, "declared remote space", spokeToHub.RemoteAddressSpaces, []string{"10.0.0.0/16"})
+
+	partner := findPeering(t, spoke, "spoke-to-partner")
+	assertEqual(t, "partner state", partner.PeeringState, "Disconnected")
+	if partner.RemoteAddressSpaces != nil || partner.AllowVNetAccess {
+		t.Errorf("peering outside the inventory = %+v, want no address space or access", partner)
+	}
+}
+
+func TestNormalizeNIC(t *testing.T) {
+	inv := loadFixture(t)
+
+	nic := findNIC(t, inv, "nic-vm1")
+	assertEqual(t, "ip configurations", len(nic.IPConfigurations), 2)
+	// Top-level fields come from the primary configuration, not the first one
+	assertEqual(t, "private ip", nic.PrivateIP, "10.0.1.4")
+	assertEqual(t, "allocation", nic.PrivateIPAllocation, "Static")
+	assertEqual(t, "subnet", nic.SubnetID, appSubnet)
+	assertEqual(t, "public ip", nic.PublicIPRef, "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network/publicIPAddresses/pip-vm1")
+	assertEqual(t, "asgs", nic.IPConfigurations[1].ASGRefs, []string{"/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network/applicationSecurityGroups/asg-web"})
+	assertEqual(t, "ip forwarding", nic.EnableIPForwarding, true)
+	assertEqual(t, "attached to", nic.AttachedTo, &models.AttachedResource{
+		Type: "VM",
+		ID:   "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Compute/virtualMachines/vm1",
+		Name: "vm1",
+	})
+
+	orphan := findNIC(t, inv, "nic-orphan")
+	assertEqual(t, "orphan ip configurations", orphan.IPConfigurations, []models.IPConfiguration{})
+	if orphan.SubnetID != "" || orphan.PrivateIP != "" || orphan.AttachedTo != nil {
+		t.Errorf("nic without properties = %+v, want empty references", orphan)
+	}
+}
+
+func TestNormalizeNSG(t *testing.T) {
+	inv := loadFixture(t)
+	nsg := inv.NSGs[0]
+
+	// Rules are sorted by priority, including priorities recorded as strings
+	assertEqual(t, "rules", ruleNames(nsg.Rules), []string{"allow-ssh-bastion", "allow-web", "deny-all-inbound"})
+	assertEqual(t, "default rules", ruleNames(nsg.DefaultRules), []string{"AllowVnetInBound", "DenyAllInBound"})
+
+	web := nsg.Rules[1]
+	assertEqual(t, "priority", web.Priority, 200)
+	// Singular and plural forms merge without case-insensitive duplicates
+	assertEqual(t, "sources", web.SourceAddressPrefixes, []string{"Internet", "203.0.113.0/24"})
+	assertEqual(t, "destinations", web.DestAddressPrefixes, []string{"10.0.1.4"})
+	assertEqual(t, "dest ports", web.DestPortRanges, []string{"443", "80"})
+	assertEqual(t, "dest asgs", len(web.DestASGs), 1)
+	assertEqual(t, "description", web.Description, "Public web traffic")
+
+	ssh := nsg.Rules[0]
+	assertEqual(t, "ssh dest ports", ssh.DestPortRanges, []string{"22"})
+	assertEqual(t, "ssh source asgs", ssh.SourceASGs, []string(nil))
+
+	// Associations are only recorded on the subnet and NIC side, with
+	// different casing on the subnet reference
+	assertEqual(t, "subnets", nsg.Subnets, []string{appSubnet})
+	assertEqual(t, "nics", nsg.NICs, []string{nicVM1})
+}
+
+func TestNormalizeRouteTable(t *testing.T) {
+	inv := loadFixture(t)
+
+	rt := findRouteTable(t, inv, "rt-app")
+	assertEqual(t, "disable bgp", rt.DisableBGPRoutePropagation, true)
+	assertEqual(t, "routes", rt.Routes, []models.Route{
+		{Name: "default-to-firewall", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIPAddress: "10.0.0.68"},
+		{Name: "blackhole", AddressPrefix: "192.168.0.0/16", NextHopType: "None"},
+	})
+	assertEqual(t, "subnets", rt.Subnets, []string{appSubnet})
+
+	unused := findRouteTable(t, inv, "rt-unused")
+	assertEqual(t, "unused routes", unused.Routes, []models.Route{})
+	assertEqual(t, "unused subnets", unused.Subnets, []string(nil))
+}
+
+func TestNormalizePublicIP(t *testing.T) {
+	inv := loadFixture(t)
+
+	assertEqual(t, "standard", inv.PublicIPs[0], models.PublicIP{
+		ID:               appNetwork + "/publicIPAddresses/pip-vm1",
+		Name:             "pip-vm1",
+		Location:         "westeurope",
+		ResourceGroup:    "rg-app",
+		IPAddress:        "20.50.1.10",
+		AllocationMethod: "Static",
+		SKU:              "Standard",
+		Version:          "IPv4",
+		DNSName:          "vm1.westeurope.cloudapp.azure.com",
+		Tags:             map[string]string{"env": "prod"},
+	})
+
+	// An unassigned dynamic address has no IP and defaults to IPv4
+	basic := inv.PublicIPs[1]
+	assertEqual(t, "basic name", basic.Name, "pip-basic")
+	assertEqual(t, "basic sku", basic.SKU, "Basic")
+	assertEqual(t, "basic version", basic.Version, "IPv4")
+	if basic.IPAddress != "" || basic.DNSName != "" || basic.Tags != nil {
+		t.Errorf("dynamic public ip = %+v, want no address, dns name or tags", basic)
+	}
+}
+
+func TestNormalizePrivateEndpoint(t *testing.T) {
+	inv := loadFixture(t)
+
+	blob := inv.PrivateEndpoints[0]
+	assertEqual(t, "blob name", blob.Name, "pe-blob")
+	assertEqual(t, "blob subnet", blob.SubnetID, peSubnet)
+	assertEqual(t, "blob target", blob.PrivateLinkServiceID, dataGroup+"/Microsoft.Storage/storageAccounts/stdata")
+	// Without a NIC in the inventory the IP comes from the custom DNS config
+	assertEqual(t, "blob private ip", blob.PrivateIP, "10.1.2.11")
+	assertEqual(t, "blob dns", blob.CustomDNSConfigs, []models.CustomDNSConfig{
+		{FQDN: "stdata.blob.core.windows.net", IPAddresses: []string{"10.1.2.11"}},
+	})
+
+	// Manually approved connections and the NIC's private IP are picked up
+	sql := inv.PrivateEndpoints[1]
+	assertEqual(t, "sql name", sql.Name, "pe-sql")
+	assertEqual(t, "sql target", sql.PrivateLinkServiceID, dataGroup+"/Microsoft.Sql/servers/sql-app")
+	assertEqual(t, "sql private ip", sql.PrivateIP, "10.1.2.10")
+	assertEqual(t, "sql zone groups", sql.PrivateDNSZoneGroups, []string{"default"})
+
+	nic := findNIC(t, inv, "pe-sql.nic.0a1b")
+	assertEqual(t, "nic attached to", nic.AttachedTo, &models.AttachedResource{Type: "PrivateEndpoint", ID: sql.ID, Name: "pe-sql"})
+
+	subnet := findSubnet(t, findVNet(t, inv, "vnet-spoke"), "snet-pe")
+	assertEqual(t, "subnet private endpoints", subnet.PrivateEndpoints, []string{blob.ID, sql.ID})
+	assertEqual(t, "subnet connected nics", subnet.ConnectedNICs, []string{nic.ID})
+	assertEqual(t, "subnet pe policies", subnet.PrivateEndpointNetworkPolicies, "Disabled")
+}
+
+func TestNormalizeNATGateway(t *testing.T) {
+	inv := loadFixture(t)
+
+	// The hub subnet is only listed on the NAT gateway and the spoke subnet
+	// only references the NAT gateway; both end up associated once
+	assertEqual(t, "nat gateway", inv.NATGateways[0], models.NATGateway{
+		ID:               netNetwork + "/natGateways/nat-egress",
+		Name:             "nat-egress",
+		Location:         "westeurope",
+		ResourceGroup:    "rg-net",
+		SKU:              "Standard",
+		PublicIPs:        []string{netNetwork + "/publicIPAddresses/pip-nat"},
+		PublicIPPrefixes: []string{netNetwork + "/publicIPPrefixes/ippre-nat"},
+		IdleTimeoutMins:  10,
+		Subnets:          []string{hubID + "/subnets/SNET-APP", peSubnet},
+	})
+
+	subnet := findSubnet(t, findVNet(t, inv, "vnet-spoke"), "snet-pe")
+	assertEqual(t, "subnet nat gateway", subnet.NATGatewayRef, inv.NATGateways[0].ID)
+}
+
+func TestNormalizeGateway(t *testing.T) {
+	gw := loadFixture(t).Gateways[0]
+
+	assertEqual(t, "name", gw.Name, "vpngw-hub")
+	assertEqual(t, "type", gw.Type, "Vpn")
+	// The SKU is only recorded under properties for gateways
+	assertEqual(t, "sku", gw.SKU, "VpnGw2AZ")
+	assertEqual(t, "vpn type", gw.VPNType, "RouteBased")
+	if !gw.EnableBGP || !gw.ActiveActive {
+		t.Errorf("bgp %v and active-active %v, want both enabled", gw.EnableBGP, gw.ActiveActive)
+	}
+	assertEqual(t, "subnet", gw.SubnetID, hubID+"/subnets/GatewaySubnet")
+	assertEqual(t, "vnet", gw.VNetID, hubID)
+	assertEqual(t, "public ips", gw.PublicIPs, []string{netNetwork + "/publicIPAddresses/pip-gw1", netNetwork + "/publicIPAddresses/pip-gw2"})
+	// Active-active gateways report the first instance's private IP
+	assertEqual(t, "private ip", gw.PrivateIP, "10.0.0.4")
+	assertEqual(t, "bgp settings", gw.BGPSettings, &models.BGPSettings{ASN: 65515, BGPPeeringAddress: "10.0.0.4,10.0.0.5"})
+
+	// Connections reference the gateway with different casing
+	assertEqual(t, "connections", gw.Connections, []models.GatewayConnection{
+		{
+			ID:                    netNetwork + "/connections/cn-onprem",
+			Name:                  "cn-onprem",
+			Type:                  "IPsec",
+			ConnectionStatus:      "Connected",
+			LocalNetworkGatewayID: netNetwork + "/localNetworkGateways/lng-dc1",
+			SharedKey:             true,
+			RoutingWeight:         10,
+			EnableBGP:             true,
+		},
+		{
+			ID:               netNetwork + "/connections/cn-dr",
+			Name:             "cn-dr",
+			Type:             "Vnet2Vnet",
+			ConnectionStatus: "NotConnected",
+			Peer:             "/subscriptions/sub2/resourceGroups/rg-dr/providers/Microsoft.Network/virtualNetworkGateways/vpngw-dr",
+		},
+	})
+}
+
+func TestNormalizeLoadBalancer(t *testing.T) {
+	inv := loadFixture(t)
+	lbID := appNetwork + "/loadBalancers/lb-app"
+	ipConfig := nicVM1 + "/ipConfigurations/ipconfig2"
+
+	assertEqual(t, "internal", inv.LoadBalancers[0], models.LoadBalancer{
+		ID:            lbID,
+		Name:          "lb-app",
+		Location:      "westeurope",
+		ResourceGroup: "rg-app",
+		SKU:           "Standard",
+		Type:          "Internal",
+		FrontendIPs: []models.LoadBalancerFrontend{
+			{Name: "fe1", PrivateIP: "10.0.1.100", SubnetID: appSubnet, Zones: []string{"1", "2", "3"}},
+		},
+		BackendPools: []models.LoadBalancerBackend{
+			{Name: "pool-nics", NICRefs: []string{ipConfig}},
+			{Name: "pool-ips", Addresses: []models.BackendAddress{{Name: "addr1", IPAddress: "10.0.1.20", VNetID: hubID}}},
+		},
+		LoadBalancingRules: []models.LBRule{
+			{
+				Name:                "https",
+				Protocol:            "Tcp",
+				FrontendPort:        443,
+				BackendPort:         8443, // recorded as a string
+				FrontendIPRef:       lbID + "/frontendIPConfigurations/fe1",
+				BackendPoolRef:      lbID + "/backendAddressPools/pool-nics",
+				ProbeRef:            lbID + "/probes/hp-https",
+				EnableFloatingIP:    true,
+				IdleTimeoutMins:     4,
+				LoadDistribution:    "SourceIP",
+				DisableOutboundSNAT: true,
+			},
+		},
+		Probes: []models.LBProbe{
+			{Name: "hp-https", Protocol: "Https", Port: 8443, Path: "/healthz", IntervalSecs: 5, NumProbes: 2},
+		},
+		InboundNATRules: []models.LBNATRule{
+			{
+				Name:            "rdp-vm1",
+				Protocol:        "Tcp",
+				FrontendPort:    50001,
+				BackendPort:     3389,
+				FrontendIPRef:   lbID + "/frontendIPConfigurations/fe1",
+				NICRef:          ipConfig,
+				IdleTimeoutMins: 4,
+			},
+		},
+		OutboundRules: []models.LBOutboundRule{
+			{
+				Name:                   "egress",
+				Protocol:               "All",
+				FrontendIPRefs:         []string{lbID + "/frontendIPConfigurations/fe1"},
+				BackendPoolRef:         lbID + "/backendAddressPools/pool-nics",
+				IdleTimeoutMins:        15,
+				AllocatedOutboundPorts: 1024,
+				EnableTCPReset:         true,
+			},
+		},
+	})
+
+	// A public frontend makes the load balancer public; empty sections stay empty
+	public := inv.LoadBalancers[1]
+	assertEqual(t, "public type", public.Type, "Public")
+	assertEqual(t, "public sku", public.SKU, "Basic")
+	assertEqual(t, "public frontend", public.FrontendIPs[0].PublicIPRef, netNetwork+"/publicIPAddresses/pip-basic")
+	assertEqual(t, "public pools", public.BackendPools, []models.LoadBalancerBackend{})
+	assertEqual(t, "public rules", public.LoadBalancingRules, []models.LBRule{})
+	assertEqual(t, "public probes", public.Probes, []models.LBProbe{})
+	assertEqual(t, "public nat rules", public.InboundNATRules, []models.LBNATRule(nil))
+}
+
+func TestNormalizeApplicationGateway(t *testing.T) {
+	inv := loadFixture(t)
+	agwID := netNetwork + "/applicationGateways/agw-web"
+
+	legacy := inv.ApplicationGateways[0]
+	assertEqual(t, "legacy name", legacy.Name, "agw-legacy")
+	assertEqual(t, "legacy capacity", legacy.Capacity, 2)
+	assertEqual(t, "legacy waf", legacy.WAFEnabled, true)
+	assertEqual(t, "legacy waf mode", legacy.WAFMode, "Prevention")
+	assertEqual(t, "legacy pools", legacy.BackendPools, []models.AppGWBackendPool{})
+
+	web := inv.ApplicationGateways[1]
+	assertEqual(t, "sku", web.SKU, "WAF_v2")
+	assertEqual(t, "tier", web.Tier, "WAF_v2")
+	// Autoscaling gateways report their minimum capacity
+	assertEqual(t, "capacity", web.Capacity, 2)
+	assertEqual(t, "subnet", web.SubnetID, hubID+"/subnets/snet-appgw")
+	assertEqual(t, "vnet", web.VNetID, hubID)
+	assertEqual(t, "public ips", web.PublicIPs, []string{netNetwork + "/publicIPAddresses/pip-agw"})
+	assertEqual(t, "private ips", web.PrivateIPs, []string{"10.0.3.10"})
+	assertEqual(t, "frontend ports", web.FrontendPorts, []models.AppGWFrontendPort{{Name: "port-443", Port: 443}})
+	assertEqual(t, "backend pools", web.BackendPools, []models.AppGWBackendPool{
+		{Name: "pool-web", Addresses: []models.AppGWBackendAddress{{FQDN: "app.internal.contoso.com"}, {IPAddress: "10.0.1.4"}}},
+		{Name: "pool-empty", Addresses: []models.AppGWBackendAddress{}},
+	})
+	assertEqual(t, "listeners", web.HTTPListeners, []models.AppGWListener{
+		{
+			Name:                        "listener-https",
+			Protocol:                    "Https",
+			FrontendIPRef:               agwID + "/frontendIPConfigurations/fe-public",
+			FrontendPortRef:             agwID + "/frontendPorts/port-443",
+			HostName:                    "www.contoso.com",
+			RequireServerNameIndication: true,
+			SSLCertificateRef:           agwID + "/sslCertificates/cert-www",
+		},
+	})
+	assertEqual(t, "routing rules", web.RequestRoutingRules, []models.AppGWRoutingRule{
+		{
+			Name:                "rule-web",
+			RuleType:            "Basic",
+			Priority:            100,
+			ListenerRef:         agwID + "/httpListeners/listener-https",
+			BackendPoolRef:      agwID + "/backendAddressPools/pool-web",
+			BackendHTTPSettings: agwID + "/backendHttpSettingsCollection/settings-web",
+		},
+	})
+	assertEqual(t, "probes", web.Probes, []models.AppGWProbe{
+		{Name: "probe-web", Protocol: "Https", Path: "/healthz", IntervalSecs: 30, TimeoutSecs: 30, UnhealthyThreshold: 3, PickHostNameFromBackend: true},
+	})
+	// The WAF tier enables the WAF even though the inline configuration is off
+	assertEqual(t, "waf", web.WAFEnabled, true)
+	assertEqual(t, "waf mode", web.WAFMode, "Detection")
+}
+
+func TestNormalizeFirewall(t *testing.T) {
+	inv := loadFixture(t)
+
+	fw := inv.Firewalls[0]
+	assertEqual(t, "name", fw.Name, "fw-hub")
+	assertEqual(t, "sku", fw.SKU, "AZFW_VNet")
+	assertEqual(t, "tier", fw.Tier, "Standard")
+	assertEqual(t, "subnet", fw.SubnetID, hubID+"/subnets/AzureFirewallSubnet")
+	assertEqual(t, "vnet", fw.VNetID, hubID)
+	assertEqual(t, "management subnet", fw.ManagementSubnetID, hubID+"/subnets/AzureFirewallManagementSubnet")
+	// Additional IP configurations only carry public IPs
+	assertEqual(t, "private ip", fw.PrivateIP, "10.0.0.68")
+	assertEqual(t, "public ips", fw.PublicIPs, []string{netNetwork + "/publicIPAddresses/pip-fw1", netNetwork + "/publicIPAddresses/pip-fw2"})
+	assertEqual(t, "threat intel", fw.ThreatIntelMode, "Alert")
+	assertEqual(t, "rules", fw.Rules, []models.FirewallRuleCollection{
+		{
+			Name: "net-allow", Priority: 200, Action: "Allow", Type: "Network",
+			Rules: []models.FirewallRule{{
+				Name:            "dns",
+				RuleType:        "Network",
+				Protocols:       []string{"UDP", "TCP"},
+				SourceAddresses: []string{"10.1.0.0/16"},
+				DestAddresses:   []string{"168.63.129.16"},
+				DestPorts:       []string{"53"},
+			}},
+		},
+		{
+			Name: "app-allow", Priority: 300, Action: "Allow", Type: "Application",
+			Rules: []models.FirewallRule{{
+				Name:            "updates",
+				RuleType:        "Application",
+				Protocols:       []string{"Https"},
+				SourceAddresses: []string{"10.1.0.0/16"},
+				TargetFQDNs:     []string{"*.ubuntu.com"},
+			}},
+		},
+		{
+			Name: "dnat", Priority: 100, Action: "Dnat", Type: "NAT",
+			Rules: []models.FirewallRule{{
+				Name:              "rdp",
+				RuleType:          "NAT",
+				Protocols:         []string{"TCP"},
+				SourceAddresses:   []string{"*"},
+				DestAddresses:     []string{"20.50.1.20"},
+				DestPorts:         []string{"3389"},
+				TranslatedAddress: "10.0.1.4",
+				TranslatedPort:    "3389",
+			}},
+		},
+	})
+
+	// Policy-managed firewalls have no classic rules
+	premium := inv.Firewalls[1]
+	assertEqual(t, "premium tier", premium.Tier, "Premium")
+	assertEqual(t, "premium policy", premium.FirewallPolicyID, netNetwork+"/firewallPolicies/fwp-premium")
+	assertEqual(t, "premium public ips", premium.PublicIPs, []string{})
+	assertEqual(t, "premium rules", premium.Rules, []models.FirewallRuleCollection(nil))
+}
+
+func TestSaveAndLoadDirectory(t *testing.T) {
+	inv := loadFixture(t)
+	dir := t.TempDir()
+
+	if err := SaveToDirectory(inv, dir); err != nil {
+		t.Fatalf("SaveToDirectory: %v", err)
+	}
+	loaded, err := LoadFromDirectory(dir)
+	if err != nil {
+		t.Fatalf("LoadFromDirectory: %v", err)
+	}
+
+	want, _ := json.Marshal(inv)
+	got, _ := json.Marshal(loaded)
+	if string(got) != string(want) {
+		t.Errorf("round trip changed the inventory:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestLoadFromDirectoryMissingFile(t *testing.T) {
+	_, err := LoadFromDirectory(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("failed to read %s", files[0])) {
+		t.Errorf("got error %v, want a read error for %s", err, files[0])
+	}
+}
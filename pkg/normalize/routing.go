@@ -0,0 +1,127 @@
+package normalize
+
+import (
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// normalizeRouteTable converts a route table and its user-defined routes
+func normalizeRouteTable(res map[string]interface{}) models.RouteTable {
+	p := props(res)
+
+	rt := models.RouteTable{
+		ID:                         getString(res, "id"),
+		Name:                       getString(res, "name"),
+		Location:                   getString(res, "location"),
+		ResourceGroup:              getString(res, "resourceGroup"),
+		Routes:                     []models.Route{},
+		DisableBGPRoutePropagation: getBool(p, "disableBgpRoutePropagation"),
+		Subnets:                    refIDs(p, "subnets"),
+		Tags:                       getTags(res),
+	}
+
+	for _, routeIface := range getSlice(p, "routes") {
+		route := asMap(routeIface)
+		rp := props(route)
+		rt.Routes = append(rt.Routes, models.Route{
+			Name:             getString(route, "name"),
+			AddressPrefix:    getString(rp, "addressPrefix"),
+			NextHopType:      getString(rp, "nextHopType"),
+			NextHopIPAddress: getString(rp, "nextHopIpAddress"),
+			HasBGPOverride:   getBool(rp, "hasBgpOverride"),
+		})
+	}
+
+	return rt
+}
+
+// normalizeGateway converts a VPN or ExpressRoute virtual network gateway
+func normalizeGateway(res map[string]interface{}) models.Gateway {
+	p := props(res)
+
+	gw := models.Gateway{
+		ID:            getString(res, "id"),
+		Name:          getString(res, "name"),
+		Location:      getString(res, "location"),
+		ResourceGroup: getString(res, "resourceGroup"),
+		Type:          getString(p, "gatewayType"),
+		SKU:           skuName(res),
+		VPNType:       getString(p, "vpnType"),
+		EnableBGP:     getBool(p, "enableBgp"),
+		ActiveActive:  getBool(p, "activeActive"),
+		PublicIPs:     []string{},
+		Tags:          getTags(res),
+	}
+
+	for _, ipConfig := range getSlice(p, "ipConfigurations") {
+		ip := props(asMap(ipConfig))
+		if subnetID := refID(ip["subnet"]); subnetID != "" {
+			gw.SubnetID = subnetID
+			gw.VNetID = topLevelID(subnetID)
+		}
+		if pip := refID(ip["publicIPAddress"]); pip != "" {
+			gw.PublicIPs = append(gw.PublicIPs, pip)
+		}
+		if privateIP := getString(ip, "privateIPAddress"); privateIP != "" && gw.PrivateIP == "" {
+			gw.PrivateIP = privateIP
+		}
+	}
+
+	if bgp := getMap(p, "bgpSettings"); bgp != nil {
+		gw.BGPSettings = &models.BGPSettings{
+			ASN:               int64(getInt(bgp, "asn")),
+			BGPPeeringAddress: getString(bgp, "bgpPeeringAddress"),
+			PeerWeight:        getInt(bgp, "peerWeight"),
+		}
+	}
+
+	return gw
+}
+
+// attachConnections adds gateway connections to the gateways they belong to
+func attachConnections(inv *models.Inventory, connections []map[string]interface{}) {
+	for _, res := range connections {
+		p := props(res)
+		gatewayID := refID(p["virtualNetworkGateway1"])
+
+		conn := models.GatewayConnection{
+			ID:                    getString(res, "id"),
+			Name:                  getString(res, "name"),
+			Type:                  getString(p, "connectionType"),
+			ConnectionStatus:      getString(p, "connectionStatus"),
+			LocalNetworkGatewayID: refID(p["localNetworkGateway2"]),
+			Peer:                  refID(p["peer"]),
+			SharedKey:             p["sharedKey"] != nil,
+			RoutingWeight:         getInt(p, "routingWeight"),
+			EnableBGP:             getBool(p, "enableBgp"),
+		}
+		if conn.Peer == "" {
+			conn.Peer = refID(p["virtualNetworkGateway2"])
+		}
+
+		for i := range inv.Gateways {
+			if strings.EqualFold(inv.Gateways[i].ID, gatewayID) {
+				inv.Gateways[i].Connections = append(inv.Gateways[i].Connections, conn)
+			}
+		}
+	}
+}
+
+// normalizeNATGateway converts a NAT gateway
+func normalizeNATGateway(res map[string]interface{}) models.NATGateway {
+	p := props(res)
+
+	return models.NATGateway{
+		ID:               getString(res, "id"),
+		Name:             getString(res, "name"),
+		Location:         getString(res, "location"),
+		ResourceGroup:    getString(res, "resourceGroup"),
+		SKU:              skuName(res),
+		PublicIPs:        refIDs(p, "publicIpAddresses"),
+		PublicIPPrefixes: refIDs(p, "publicIpPrefixes"),
+		IdleTimeoutMins:  getInt(p, "idleTimeoutInMinutes"),
+		Subnets:          refIDs(p, "subnets"),
+		Tags:             getTags(res),
+	}
+}
@@ -0,0 +1,162 @@
+package normalize
+
+import (
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// normalizeNSG converts a network security group and its rules
+func normalizeNSG(res map[string]interface{}) models.NSG {
+	p := props(res)
+
+	nsg := models.NSG{
+		ID:            getString(res, "id"),
+		Name:          getString(res, "name"),
+		Location:      getString(res, "location"),
+		ResourceGroup: getString(res, "resourceGroup"),
+		Rules:         []models.NSGRule{},
+		Subnets:       refIDs(p, "subnets"),
+		NICs:          refIDs(p, "networkInterfaces"),
+		Tags:          getTags(res),
+	}
+
+	for _, rule := range getSlice(p, "securityRules") {
+		nsg.Rules = append(nsg.Rules, normalizeNSGRule(asMap(rule)))
+	}
+
+	for _, rule := range getSlice(p, "defaultSecurityRules") {
+		nsg.DefaultRules = append(nsg.DefaultRules, normalizeNSGRule(asMap(rule)))
+	}
+
+	return nsg
+}
+
+// normalizeNSGRule converts a security rule, merging the singular and plural
+// forms of address prefixes and port ranges into lists
+func normalizeNSGRule(rule map[string]interface{}) models.NSGRule {
+	p := props(rule)
+
+	return models.NSGRule{
+		Name:                  getString(rule, "name"),
+		Priority:              getInt(p, "priority"),
+		Direction:             getString(p, "direction"),
+		Access:                getString(p, "access"),
+		Protocol:              getString(p, "protocol"),
+		SourceAddressPrefixes: mergeSingular(p, "sourceAddressPrefix", "sourceAddressPrefixes"),
+		SourcePortRanges:      mergeSingular(p, "sourcePortRange", "sourcePortRanges"),
+		DestAddressPrefixes:   mergeSingular(p, "destinationAddressPrefix", "destinationAddressPrefixes"),
+		DestPortRanges:        mergeSingular(p, "destinationPortRange", "destinationPortRanges"),
+		SourceASGs:            refIDs(p, "sourceApplicationSecurityGroups"),
+		DestASGs:              refIDs(p, "destinationApplicationSecurityGroups"),
+		Description:           getString(p, "description"),
+	}
+}
+
+// mergeSingular combines a singular property with its plural list form
+func mergeSingular(p map[string]interface{}, singular, plural string) []string {
+	values := []string{}
+	if v := getString(p, singular); v != "" {
+		values = append(values, v)
+	}
+	for _, v := range getStrings(p, plural) {
+		values = appendUnique(values, v)
+	}
+	return values
+}
+
+// normalizeASG converts an application security group
+func normalizeASG(res map[string]interface{}) models.ASG {
+	return models.ASG{
+		ID:            getString(res, "id"),
+		Name:          getString(res, "name"),
+		Location:      getString(res, "location"),
+		ResourceGroup: getString(res, "resourceGroup"),
+		Tags:          getTags(res),
+	}
+}
+
+// normalizeFirewall converts an Azure Firewall including classic rule collections
+func normalizeFirewall(res map[string]interface{}) models.AzureFirewall {
+	p := props(res)
+
+	fw := models.AzureFirewall{
+		ID:               getString(res, "id"),
+		Name:             getString(res, "name"),
+		Location:         getString(res, "location"),
+		ResourceGroup:    getString(res, "resourceGroup"),
+		SKU:              skuName(res),
+		Tier:             skuTier(res),
+		PublicIPs:        []string{},
+		FirewallPolicyID: refID(p["firewallPolicy"]),
+		ThreatIntelMode:  getString(p, "threatIntelMode"),
+		Tags:             getTags(res),
+	}
+
+	for _, ipConfig := range getSlice(p, "ipConfigurations") {
+		ip := props(asMap(ipConfig))
+		if subnetID := refID(ip["subnet"]); subnetID != "" {
+			fw.SubnetID = subnetID
+			fw.VNetID = topLevelID(subnetID)
+		}
+		if privateIP := getString(ip, "privateIPAddress"); privateIP != "" {
+			fw.PrivateIP = privateIP
+		}
+		if pip := refID(ip["publicIPAddress"]); pip != "" {
+			fw.PublicIPs = append(fw.PublicIPs, pip)
+		}
+	}
+
+	if mgmt := getMap(p, "managementIpConfiguration"); mgmt != nil {
+		fw.ManagementSubnetID = refID(props(mgmt)["subnet"])
+	}
+
+	collections := []struct {
+		key      string
+		ruleType string
+	}{
+		{"networkRuleCollections", "Network"},
+		{"applicationRuleCollections", "Application"},
+		{"natRuleCollections", "NAT"},
+	}
+	for _, c := range collections {
+		for _, collIface := range getSlice(p, c.key) {
+			coll := asMap(collIface)
+			cp := props(coll)
+
+			collection := models.FirewallRuleCollection{
+				Name:     getString(coll, "name"),
+				Priority: getInt(cp, "priority"),
+				Action:   getString(getMap(cp, "action"), "type"),
+				Type:     c.ruleType,
+			}
+
+			for _, ruleIface := range getSlice(cp, "rules") {
+				rule := asMap(ruleIface)
+				fr := models.FirewallRule{
+					Name:              getString(rule, "name"),
+					RuleType:          c.ruleType,
+					Protocols:         getStrings(rule, "protocols"),
+					SourceAddresses:   getStrings(rule, "sourceAddresses"),
+					DestAddresses:     getStrings(rule, "destinationAddresses"),
+					DestPorts:         getStrings(rule, "destinationPorts"),
+					DestFQDNs:         getStrings(rule, "destinationFqdns"),
+					TargetFQDNs:       getStrings(rule, "targetFqdns"),
+					TranslatedAddress: getString(rule, "translatedAddress"),
+					TranslatedPort:    getString(rule, "translatedPort"),
+				}
+				// Application rules describe protocols as objects
+				if len(fr.Protocols) == 0 {
+					for _, proto := range getSlice(rule, "protocols") {
+						if pt := getString(asMap(proto), "protocolType"); pt != "" {
+							fr.Protocols = append(fr.Protocols, pt)
+						}
+					}
+				}
+				collection.Rules = append(collection.Rules, fr)
+			}
+
+			fw.Rules = append(fw.Rules, collection)
+		}
+	}
+
+	return fw
+}
@@ -0,0 +1,181 @@
+package nsg
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// AddressKind classifies an NSG source or destination
+type AddressKind int
+
+// Address kinds
+const (
+	KindAny AddressKind = iota
+	KindPrefix
+	KindServiceTag
+	KindASG
+)
+
+// Service tags with special meaning for exposure
+const (
+	TagInternet          = "Internet"
+	TagVirtualNetwork    = "VirtualNetwork"
+	TagAzureLoadBalancer = "AzureLoadBalancer"
+	TagAzureCloud        = "AzureCloud"
+)
+
+// Address is a source or destination of an NSG rule: "*", an IP address or
+// CIDR prefix, a service tag such as Internet or AzureCloud.WestEurope, or an
+// application security group ID
+type Address struct {
+	Kind   AddressKind
+	Value  string // as written in the rule
+	Prefix netip.Prefix
+}
+
+// ParseAddress parses an address prefix from an NSG rule. Values that are
+// neither "*" nor an IP address or prefix are service tags.
+func ParseAddress(value string) Address {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "" || value == "*" || strings.EqualFold(value, "any"):
+		return Address{Kind: KindAny, Value: "*"}
+	}
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return Address{Kind: KindPrefix, Value: value, Prefix: prefix.Masked()}
+	}
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return Address{Kind: KindPrefix, Value: value, Prefix: netip.PrefixFrom(addr, addr.BitLen())}
+	}
+	return Address{Kind: KindServiceTag, Value: value}
+}
+
+// ASGAddress returns the address of an application security group
+func ASGAddress(id string) Address {
+	return Address{Kind: KindASG, Value: id}
+}
+
+// parseAddresses parses prefixes and ASG IDs; no addresses at all means any.
+// Azure does not combine ASGs with address prefixes, so a "*" prefix next to
+// ASGs is a placeholder and the ASGs alone are the addresses.
+func parseAddresses(prefixes, asgs []string) []Address {
+	var addresses []Address
+	for _, prefix := range prefixes {
+		address := ParseAddress(prefix)
+		if address.Kind == KindAny && len(asgs) > 0 {
+			continue
+		}
+		addresses = append(addresses, address)
+	}
+	for _, id := range asgs {
+		addresses = append(addresses, ASGAddress(id))
+	}
+	if len(addresses) == 0 {
+		addresses = append(addresses, Address{Kind: KindAny, Value: "*"})
+	}
+	return addresses
+}
+
+// String returns the address as written, or the ASG name for an ASG
+func (a Address) String() string {
+	if a.Kind == KindASG {
+		if i := strings.LastIndex(a.Value, "/"); i >= 0 {
+			return a.Value[i+1:]
+		}
+	}
+	return a.Value
+}
+
+// IsTag reports whether the address is the given service tag, ignoring case
+// and any regional suffix such as AzureCloud.WestEurope
+func (a Address) IsTag(tag string) bool {
+	if a.Kind != KindServiceTag {
+		return false
+	}
+	base, _, _ := strings.Cut(a.Value, ".")
+	return strings.EqualFold(base, tag)
+}
+
+// IsPublic reports whether a prefix lies in public address space
+func (a Address) IsPublic() bool {
+	if a.Kind != KindPrefix {
+		return false
+	}
+	if a.Prefix.Bits() == 0 {
+		return true
+	}
+	addr := a.Prefix.Addr()
+	return !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() && !addr.IsUnspecified()
+}
+
+// IsInternetWide reports whether the address includes the whole Internet:
+// "*", the Internet tag, 0.0.0.0/0 or ::/0
+func (a Address) IsInternetWide() bool {
+	switch a.Kind {
+	case KindAny:
+		return true
+	case KindPrefix:
+		return a.Prefix.Bits() == 0
+	case KindServiceTag:
+		return strings.EqualFold(a.Value, TagInternet)
+	}
+	return false
+}
+
+// Contains reports whether every address matched by other is also matched
+// by a. It is conservative: unrelated service tags do not contain each other.
+func (a Address) Contains(other Address) bool {
+	switch a.Kind {
+	case KindAny:
+		return true
+	case KindPrefix:
+		// 0.0.0.0/0 is treated as covering the Internet tag
+		if a.Prefix.Bits() == 0 && other.Kind == KindServiceTag && other.IsInternetWide() {
+			return true
+		}
+		return other.Kind == KindPrefix && a.Prefix.Addr().Is4() == other.Prefix.Addr().Is4() &&
+			a.Prefix.Bits() <= other.Prefix.Bits() && a.Prefix.Contains(other.Prefix.Addr())
+	case KindServiceTag:
+		if strings.EqualFold(a.Value, other.Value) {
+			return other.Kind == KindServiceTag
+		}
+		if a.IsInternetWide() {
+			return other.Kind == KindPrefix && other.IsPublic() && other.Prefix.Bits() > 0
+		}
+		// A global tag contains its regional variants
+		return !strings.Contains(a.Value, ".") && other.IsTag(a.Value)
+	case KindASG:
+		return other.Kind == KindASG && strings.EqualFold(a.Value, other.Value)
+	}
+	return false
+}
+
+// containsAny reports whether any of the addresses contains other
+func containsAny(addresses []Address, other Address) bool {
+	for _, a := range addresses {
+		if a.Contains(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAll reports whether every address in others is contained by one
+// of the addresses
+func containsAll(addresses, others []Address) bool {
+	for _, other := range others {
+		if !containsAny(addresses, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// joinAddresses formats addresses for messages
+func joinAddresses(addresses []Address) string {
+	parts := make([]string, len(addresses))
+	for i, a := range addresses {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ", ")
+}
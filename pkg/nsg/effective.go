@@ -0,0 +1,299 @@
+package nsg
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// Endpoint is one side of a flow, described by every address an NSG rule
+// may match it with
+type Endpoint []Address
+
+// Internet is an endpoint anywhere on the Internet
+func Internet() Endpoint {
+	return Endpoint{ParseAddress(TagInternet)}
+}
+
+// Host is an endpoint inside a virtual network with a private IP and
+// optional application security group memberships
+func Host(ip string, asgs []string) Endpoint {
+	endpoint := Endpoint{ParseAddress(TagVirtualNetwork)}
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		endpoint = append(endpoint, Address{Kind: KindPrefix, Value: ip, Prefix: netip.PrefixFrom(addr, addr.BitLen())})
+	}
+	for _, id := range asgs {
+		endpoint = append(endpoint, ASGAddress(id))
+	}
+	return endpoint
+}
+
+// matchedBy reports whether any of the rule addresses matches the endpoint
+func (e Endpoint) matchedBy(addresses []Address) bool {
+	for _, a := range e {
+		if containsAny(addresses, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns the ports of a protocol that the NSG allows from source to
+// destination. Rules are evaluated in priority order and the first matching
+// rule decides each port. A nil NSG allows everything. Rules restricted to
+// some source ports are treated conservatively: their allows count, their
+// denies do not.
+func (n *NSG) Allowed(direction, protocol string, source, destination Endpoint) PortSet {
+	if n == nil {
+		return AllPorts()
+	}
+
+	remaining := AllPorts()
+	var allowed PortSet
+	for _, rule := range n.RulesFor(direction) {
+		if !rule.HasProtocol(protocol) || !source.matchedBy(rule.Sources) || !destination.matchedBy(rule.Destinations) {
+			continue
+		}
+
+		ports := rule.portsFor(protocol).Intersect(remaining)
+		if rule.Access == Allow {
+			allowed = allowed.Union(ports)
+		} else if !rule.SourcePorts.IsAll() {
+			continue
+		}
+		remaining = remaining.Subtract(ports)
+	}
+	return allowed
+}
+
+// Decide returns the rule that decides a flow to one destination port, with
+// the same treatment of source-port restricted rules as Allowed. The port is
+// ignored for protocols without ports. ok is false when no rule matches.
+func (n *NSG) Decide(direction, protocol string, port int, source, destination Endpoint) (rule Rule, ok bool) {
+	for _, rule := range n.RulesFor(direction) {
+		if !rule.HasProtocol(protocol) || !source.matchedBy(rule.Sources) || !destination.matchedBy(rule.Destinations) {
+			continue
+		}
+		if hasPorts(protocol) && !rule.DestPorts.Contains(port) {
+			continue
+		}
+		if rule.Access == Deny && !rule.SourcePorts.IsAll() {
+			continue
+		}
+		return rule, true
+	}
+	return Rule{}, false
+}
+
+// AllowedPorts returns Allowed for every protocol, omitting protocols with
+// no allowed ports
+func (n *NSG) AllowedPorts(direction string, source, destination Endpoint) map[string]PortSet {
+	ports := make(map[string]PortSet)
+	for _, protocol := range Protocols {
+		if allowed := n.Allowed(direction, protocol, source, destination); !allowed.IsEmpty() {
+			ports[protocol] = allowed
+		}
+	}
+	return ports
+}
+
+// Layers are the NSGs applied to a NIC: inbound traffic passes the subnet
+// NSG and then the NIC NSG, outbound traffic the reverse. Either may be nil.
+type Layers struct {
+	Subnet *NSG
+	NIC    *NSG
+}
+
+// Allowed returns the ports of a protocol allowed by both layers
+func (l Layers) Allowed(direction, protocol string, source, destination Endpoint) PortSet {
+	return l.Subnet.Allowed(direction, protocol, source, destination).
+		Intersect(l.NIC.Allowed(direction, protocol, source, destination))
+}
+
+// AllowedPorts returns Allowed for every protocol, omitting protocols with
+// no allowed ports
+func (l Layers) AllowedPorts(direction string, source, destination Endpoint) map[string]PortSet {
+	ports := make(map[string]PortSet)
+	for _, protocol := range Protocols {
+		if allowed := l.Allowed(direction, protocol, source, destination); !allowed.IsEmpty() {
+			ports[protocol] = allowed
+		}
+	}
+	return ports
+}
+
+// Access is the effective Internet access of one NIC IP configuration,
+// combining its subnet NSG and NIC NSG
+type Access struct {
+	NICID       string
+	NICName     string
+	VMID        string // empty when the NIC is not attached to a VM
+	VMName      string
+	IPConfig    string
+	PrivateIP   string
+	PublicIPID  string
+	PublicIP    string
+	PublicIPSKU string
+	SubnetID    string
+	SubnetNSG   string // NSG names, empty when none is associated
+	NICNSG      string
+
+	// Inbound and Outbound are the ports open from and to the Internet
+	// after both NSGs
+	Inbound  map[string]PortSet
+	Outbound map[string]PortSet
+	// BlockedBySubnet and BlockedByNIC are inbound ports the other NSG
+	// allows but this one blocks
+	BlockedBySubnet map[string]PortSet
+	BlockedByNIC    map[string]PortSet
+
+	// Reachable is true when the IP configuration has a public IP and
+	// inbound Internet traffic passes both NSGs
+	Reachable bool
+	Status    string
+}
+
+// EffectiveAccess evaluates the Internet access of every NIC IP
+// configuration in the inventory
+func EffectiveAccess(inv *models.Inventory) []Access {
+	nsgs := make(map[string]*NSG)
+	for _, m := range inv.NSGs {
+		nsgs[strings.ToLower(m.ID)] = New(m)
+	}
+	subnetNSGs := make(map[string]string)
+	for _, vnet := range inv.VNets {
+		for _, subnet := range vnet.Subnets {
+			if subnet.NSGRef != "" {
+				subnetNSGs[strings.ToLower(subnet.ID)] = strings.ToLower(subnet.NSGRef)
+			}
+		}
+	}
+	publicIPs := make(map[string]models.PublicIP)
+	for _, pip := range inv.PublicIPs {
+		publicIPs[strings.ToLower(pip.ID)] = pip
+	}
+
+	var result []Access
+	for _, nic := range inv.NICs {
+		for _, config := range nic.IPConfigurations {
+			layers := Layers{
+				Subnet: nsgs[subnetNSGs[strings.ToLower(config.SubnetID)]],
+				NIC:    nsgs[strings.ToLower(nic.NSGRef)],
+			}
+
+			access := Access{
+				NICID:      nic.ID,
+				NICName:    nic.Name,
+				IPConfig:   config.Name,
+				PrivateIP:  config.PrivateIP,
+				PublicIPID: config.PublicIPRef,
+				SubnetID:   config.SubnetID,
+			}
+			if nic.AttachedTo != nil && nic.AttachedTo.Type == "VM" {
+				access.VMID = nic.AttachedTo.ID
+				access.VMName = nic.AttachedTo.Name
+			}
+			if layers.Subnet != nil {
+				access.SubnetNSG = layers.Subnet.Name
+			}
+			if layers.NIC != nil {
+				access.NICNSG = layers.NIC.Name
+			}
+			if pip, ok := publicIPs[strings.ToLower(config.PublicIPRef)]; ok {
+				access.PublicIP = pip.IPAddress
+				access.PublicIPSKU = pip.SKU
+			}
+
+			host := Host(config.PrivateIP, config.ASGRefs)
+			access.Inbound = layers.AllowedPorts(Inbound, Internet(), host)
+			access.Outbound = layers.AllowedPorts(Outbound, host, Internet())
+
+			subnetInbound := layers.Subnet.AllowedPorts(Inbound, Internet(), host)
+			nicInbound := layers.NIC.AllowedPorts(Inbound, Internet(), host)
+			if layers.NIC != nil && layers.Subnet != nil {
+				access.BlockedByNIC = subtractPorts(subnetInbound, nicInbound)
+				access.BlockedBySubnet = subtractPorts(nicInbound, subnetInbound)
+			}
+
+			access.Reachable, access.Status = access.evaluate(layers)
+			result = append(result, access)
+		}
+	}
+
+	return result
+}
+
+// evaluate decides whether the IP configuration is reachable and explains why
+func (a *Access) evaluate(layers Layers) (bool, string) {
+	if a.PublicIPID == "" {
+		return false, "No public IP"
+	}
+
+	// Standard public IPs are closed to inbound traffic unless an NSG
+	// allows it
+	if layers.Subnet == nil && layers.NIC == nil {
+		if strings.EqualFold(a.PublicIPSKU, "Standard") {
+			a.Inbound = map[string]PortSet{}
+			return false, "Blocked: Standard public IP without an NSG denies inbound traffic"
+		}
+		return true, "Reachable on all ports: no NSG is associated"
+	}
+
+	if len(a.Inbound) == 0 {
+		switch {
+		case len(a.BlockedByNIC) > 0:
+			return false, fmt.Sprintf("Blocked by NIC NSG %s (subnet NSG %s allows %s)", a.NICNSG, a.SubnetNSG, FormatPorts(a.BlockedByNIC))
+		case len(a.BlockedBySubnet) > 0:
+			return false, fmt.Sprintf("Blocked by subnet NSG %s (NIC NSG %s allows %s)", a.SubnetNSG, a.NICNSG, FormatPorts(a.BlockedBySubnet))
+		default:
+			return false, "Blocked: no NSG allows inbound Internet traffic"
+		}
+	}
+
+	status := "Reachable on " + FormatPorts(a.Inbound)
+	if len(a.BlockedByNIC) > 0 {
+		status += fmt.Sprintf("; %s blocked by NIC NSG %s", FormatPorts(a.BlockedByNIC), a.NICNSG)
+	}
+	if len(a.BlockedBySubnet) > 0 {
+		status += fmt.Sprintf("; %s blocked by subnet NSG %s", FormatPorts(a.BlockedBySubnet), a.SubnetNSG)
+	}
+	return true, status
+}
+
+// subtractPorts returns the ports in a that are not in b, per protocol
+func subtractPorts(a, b map[string]PortSet) map[string]PortSet {
+	result := make(map[string]PortSet)
+	for protocol, ports := range a {
+		if remaining := ports.Subtract(b[protocol]); !remaining.IsEmpty() {
+			result[protocol] = remaining
+		}
+	}
+	return result
+}
+
+// Reaches reports whether a TCP or UDP port is in a per-protocol port map
+func Reaches(ports map[string]PortSet, port int) bool {
+	return ports["TCP"].Contains(port) || ports["UDP"].Contains(port)
+}
+
+// FormatPorts lists protocols and ports, e.g. "TCP 22, 8000-8080; ICMP"
+func FormatPorts(ports map[string]PortSet) string {
+	var parts []string
+	for _, protocol := range Protocols {
+		set, ok := ports[protocol]
+		if !ok {
+			continue
+		}
+		if hasPorts(protocol) {
+			parts = append(parts, fmt.Sprintf("%s %s", protocol, set))
+		} else {
+			parts = append(parts, protocol)
+		}
+	}
+	if len(parts) == len(Protocols) && ports["TCP"].IsAll() && ports["UDP"].IsAll() {
+		return "all traffic"
+	}
+	return strings.Join(parts, "; ")
+}
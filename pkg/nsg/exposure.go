@@ -0,0 +1,121 @@
+package nsg
+
+// Scope is how widely a source reaches into a network
+type Scope int
+
+// Scopes, from narrowest to widest
+const (
+	ScopeInternal   Scope = iota // private ranges, VirtualNetwork, ASGs and other service tags
+	ScopePublic                  // a specific public address range
+	ScopeAzureCloud              // any Azure customer, via the AzureCloud tag
+	ScopeInternet                // anyone on the Internet
+)
+
+// String names the scope for messages
+func (s Scope) String() string {
+	switch s {
+	case ScopeInternet:
+		return "Internet"
+	case ScopeAzureCloud:
+		return "AzureCloud"
+	case ScopePublic:
+		return "public range"
+	default:
+		return "internal"
+	}
+}
+
+// Scope classifies an address as a traffic source
+func (a Address) Scope() Scope {
+	switch {
+	case a.IsInternetWide():
+		return ScopeInternet
+	case a.IsTag(TagAzureCloud):
+		return ScopeAzureCloud
+	case a.IsPublic():
+		return ScopePublic
+	default:
+		return ScopeInternal
+	}
+}
+
+// Exposure is traffic from an external source that an inbound allow rule
+// lets through, after higher-priority rules have decided their share
+type Exposure struct {
+	Rule   Rule
+	Source Address
+	Scope  Scope
+	// Ports reachable per protocol; protocols without ports map to all ports
+	Ports map[string]PortSet
+}
+
+// InboundExposure returns, for every inbound allow rule and external source,
+// the protocols and ports that rule actually opens. Ports already decided by
+// a higher-priority rule covering the same source, destinations and source
+// ports are excluded, so fully shadowed rules expose nothing.
+func (n *NSG) InboundExposure() []Exposure {
+	var exposures []Exposure
+
+	rules := n.RulesFor(Inbound)
+	for i, rule := range rules {
+		if rule.Access != Allow {
+			continue
+		}
+
+		for _, source := range rule.Sources {
+			scope := source.Scope()
+			if scope == ScopeInternal {
+				continue
+			}
+
+			// External traffic from "*" is Internet traffic, so rules for the
+			// Internet tag decide it
+			probe := source
+			if source.Kind == KindAny {
+				probe = ParseAddress(TagInternet)
+			}
+
+			exposure := Exposure{Rule: rule, Source: source, Scope: scope, Ports: map[string]PortSet{}}
+			for _, protocol := range rule.Protocols {
+				ports := rule.portsFor(protocol)
+				for _, earlier := range rules[:i] {
+					if earlier.covers(rule, probe, protocol) {
+						ports = ports.Subtract(earlier.portsFor(protocol))
+					}
+				}
+				if !ports.IsEmpty() {
+					exposure.Ports[protocol] = ports
+				}
+			}
+
+			if len(exposure.Ports) > 0 {
+				exposures = append(exposures, exposure)
+			}
+		}
+	}
+
+	return exposures
+}
+
+// portsFor returns the destination ports a rule matches for a protocol
+func (r Rule) portsFor(protocol string) PortSet {
+	if !hasPorts(protocol) {
+		return AllPorts()
+	}
+	return r.DestPorts
+}
+
+// Reaches reports whether a TCP or UDP port is reachable
+func (e Exposure) Reaches(port int) bool {
+	return Reaches(e.Ports, port)
+}
+
+// Destinations formats the rule's destinations for messages
+func (e Exposure) Destinations() string {
+	return joinAddresses(e.Rule.Destinations)
+}
+
+// String lists reachable protocols and ports, e.g. "TCP 22, 8000-8080; ICMP"
+func (e Exposure) String() string {
+	return FormatPorts(e.Ports)
+}
@@ -0,0 +1,169 @@
+package nsg
+
+import (
+	"sort"
+	"strings"
+)
+
+// Shadow is a custom rule whose traffic is entirely decided by
+// higher-priority rules, so it never takes effect
+type Shadow struct {
+	Rule Rule
+	By   []string // names of the deciding rules, in priority order
+	// Redundant is true when every deciding rule has the same access, so
+	// removing the rule changes nothing. Otherwise the rule's intent is
+	// contradicted by an earlier rule.
+	Redundant bool
+}
+
+// Duplicate is a custom rule matching exactly the same traffic with the
+// same access as a higher-priority rule
+type Duplicate struct {
+	Rule Rule
+	Of   Rule
+}
+
+// Shadowed returns custom rules fully shadowed by higher-priority rules
+func (n *NSG) Shadowed() []Shadow {
+	var shadows []Shadow
+
+	for _, direction := range []string{Inbound, Outbound} {
+		rules := n.RulesFor(direction)
+		for i, rule := range rules {
+			if rule.Default {
+				continue
+			}
+			if by, accesses, ok := shadowedBy(rule, rules[:i]); ok {
+				shadows = append(shadows, Shadow{
+					Rule:      rule,
+					By:        by,
+					Redundant: len(accesses) == 1 && accesses[rule.Access],
+				})
+			}
+		}
+	}
+
+	return shadows
+}
+
+// shadowedBy reports whether earlier rules decide all traffic of rule, and
+// which rules and access values decided it
+func shadowedBy(rule Rule, earlier []Rule) ([]string, map[string]bool, bool) {
+	deciding := make(map[int]bool)
+	accesses := make(map[string]bool)
+
+	for _, source := range rule.Sources {
+		for _, protocol := range rule.Protocols {
+			ports := rule.portsFor(protocol)
+			for j, e := range earlier {
+				if ports.IsEmpty() {
+					break
+				}
+				if !e.covers(rule, source, protocol) {
+					continue
+				}
+				decided := ports.Intersect(e.portsFor(protocol))
+				if decided.IsEmpty() {
+					continue
+				}
+				deciding[j] = true
+				accesses[e.Access] = true
+				ports = ports.Subtract(decided)
+			}
+			if !ports.IsEmpty() {
+				return nil, nil, false
+			}
+		}
+	}
+
+	indexes := make([]int, 0, len(deciding))
+	for j := range deciding {
+		indexes = append(indexes, j)
+	}
+	sort.Ints(indexes)
+	by := make([]string, len(indexes))
+	for i, j := range indexes {
+		by[i] = earlier[j].Name
+	}
+	return by, accesses, true
+}
+
+// Duplicates returns custom rules identical in effect to a higher-priority
+// rule of the same direction and access
+func (n *NSG) Duplicates() []Duplicate {
+	var duplicates []Duplicate
+
+	for _, direction := range []string{Inbound, Outbound} {
+		rules := n.RulesFor(direction)
+		for i, rule := range rules {
+			if rule.Default {
+				continue
+			}
+			for _, earlier := range rules[:i] {
+				if !earlier.Default && rule.sameTraffic(earlier) && rule.Access == earlier.Access {
+					duplicates = append(duplicates, Duplicate{Rule: rule, Of: earlier})
+					break
+				}
+			}
+		}
+	}
+
+	return duplicates
+}
+
+// sameTraffic reports whether two rules match exactly the same flows
+func (r Rule) sameTraffic(other Rule) bool {
+	return r.Direction == other.Direction &&
+		sameStrings(r.Protocols, other.Protocols) &&
+		sameAddresses(r.Sources, other.Sources) &&
+		sameAddresses(r.Destinations, other.Destinations) &&
+		r.SourcePorts.String() == other.SourcePorts.String() &&
+		r.DestPorts.String() == other.DestPorts.String()
+}
+
+// ASGs returns the application security group IDs a rule references
+func (r Rule) ASGs() []string {
+	var ids []string
+	for _, a := range append(append([]Address(nil), r.Sources...), r.Destinations...) {
+		if a.Kind == KindASG {
+			ids = append(ids, a.Value)
+		}
+	}
+	return ids
+}
+
+func sameAddresses(a, b []Address) bool {
+	keys := func(addresses []Address) []string {
+		var k []string
+		for _, address := range addresses {
+			if address.Kind == KindPrefix {
+				k = append(k, address.Prefix.String())
+			} else {
+				k = append(k, strings.ToLower(address.Value))
+			}
+		}
+		return k
+	}
+	return sameStrings(keys(a), keys(b))
+}
+
+// sameStrings compares two lists as sets, ignoring case
+func sameStrings(a, b []string) bool {
+	set := func(values []string) map[string]bool {
+		m := make(map[string]bool)
+		for _, v := range values {
+			m[strings.ToLower(v)] = true
+		}
+		return m
+	}
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for v := range sa {
+		if !sb[v] {
+			return false
+		}
+	}
+	return true
+}
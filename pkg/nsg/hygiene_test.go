@@ -0,0 +1,229 @@
+package nsg
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// to restricts a rule to destination prefixes
+func to(r models.NSGRule, destinations ...string) models.NSGRule {
+	r.DestAddressPrefixes = destinations
+	return r
+}
+
+// outbound turns a rule into an outbound rule
+func outbound(r models.NSGRule) models.NSGRule {
+	r.Direction = Outbound
+	return r
+}
+
+func TestShadowed(t *testing.T) {
+	type shadow struct {
+		rule      string
+		by        []string
+		redundant bool
+	}
+	tests := []struct {
+		name  string
+		rules []models.NSGRule
+		want  []shadow
+	}{
+		{
+			name: "broader allow first",
+			rules: []models.NSGRule{
+				inbound("allow-internet-tcp", 100, Allow, "Tcp", []string{"Internet"}, []string{"*"}),
+				inbound("allow-partner-https", 200, Allow, "Tcp", []string{"203.0.113.0/24"}, []string{"443"}),
+			},
+			want: []shadow{{"allow-partner-https", []string{"allow-internet-tcp"}, true}},
+		},
+		{
+			name: "deny contradicts a later allow",
+			rules: []models.NSGRule{
+				inbound("deny-ssh", 100, Deny, "*", []string{"*"}, []string{"22"}),
+				inbound("allow-ssh", 200, Allow, "Tcp", []string{"Internet"}, []string{"22"}),
+			},
+			want: []shadow{{"allow-ssh", []string{"deny-ssh"}, false}},
+		},
+		{
+			name: "several rules together",
+			rules: []models.NSGRule{
+				inbound("allow-low", 100, Allow, "Tcp", []string{"*"}, []string{"1000-2000"}),
+				inbound("deny-high", 110, Deny, "Tcp", []string{"*"}, []string{"2001-3000"}),
+				inbound("allow-middle", 200, Allow, "Tcp", []string{"10.0.0.0/8"}, []string{"1500-2500"}),
+			},
+			want: []shadow{{"allow-middle", []string{"allow-low", "deny-high"}, false}},
+		},
+		{
+			name: "every source covered by a different rule",
+			rules: []models.NSGRule{
+				inbound("allow-a", 100, Allow, "Tcp", []string{"10.0.1.0/24"}, []string{"443"}),
+				inbound("allow-b", 110, Allow, "Tcp", []string{"10.0.2.0/24"}, []string{"443"}),
+				inbound("allow-both", 200, Allow, "Tcp", []string{"10.0.1.0/24", "10.0.2.0/24"}, []string{"443"}),
+			},
+			want: []shadow{{"allow-both", []string{"allow-a", "allow-b"}, true}},
+		},
+		{
+			name: "some ports left",
+			rules: []models.NSGRule{
+				inbound("allow-http", 100, Allow, "Tcp", []string{"*"}, []string{"80"}),
+				inbound("allow-web", 200, Allow, "Tcp", []string{"*"}, []string{"80", "443"}),
+			},
+		},
+		{
+			name: "some sources left",
+			rules: []models.NSGRule{
+				inbound("allow-a", 100, Allow, "Tcp", []string{"10.0.1.0/24"}, []string{"443"}),
+				inbound("allow-both", 200, Allow, "Tcp", []string{"10.0.1.0/24", "10.0.2.0/24"}, []string{"443"}),
+			},
+		},
+		{
+			name: "narrower source first",
+			rules: []models.NSGRule{
+				inbound("allow-vnet-range", 100, Allow, "Tcp", []string{"10.0.0.0/16"}, []string{"22"}),
+				inbound("allow-private", 200, Allow, "Tcp", []string{"10.0.0.0/8"}, []string{"22"}),
+			},
+		},
+		{
+			name: "narrower destination first",
+			rules: []models.NSGRule{
+				to(inbound("deny-host", 100, Deny, "Tcp", []string{"*"}, []string{"*"}), "10.0.1.4"),
+				inbound("allow-all-hosts", 200, Allow, "Tcp", []string{"*"}, []string{"443"}),
+			},
+		},
+		{
+			name: "udp left by a tcp rule",
+			rules: []models.NSGRule{
+				inbound("deny-dns-tcp", 100, Deny, "Tcp", []string{"*"}, []string{"53"}),
+				inbound("allow-dns", 200, Allow, "*", []string{"*"}, []string{"53"}),
+			},
+		},
+		{
+			name: "icmp is not decided by a port-restricted any rule",
+			rules: []models.NSGRule{
+				inbound("deny-ssh", 100, Deny, "*", []string{"*"}, []string{"22"}),
+				inbound("allow-ping", 200, Allow, "Icmp", []string{"*"}, nil),
+			},
+		},
+		{
+			name: "other direction",
+			rules: []models.NSGRule{
+				outbound(inbound("deny-all-out", 100, Deny, "*", []string{"*"}, []string{"*"})),
+				inbound("allow-https", 200, Allow, "Tcp", []string{"*"}, []string{"443"}),
+			},
+		},
+		{
+			name: "default rules are not reported",
+			rules: []models.NSGRule{
+				inbound("deny-all", 4096, Deny, "*", []string{"*"}, []string{"*"}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []shadow
+			for _, s := range New(models.NSG{Name: "nsg", Rules: tt.rules}).Shadowed() {
+				got = append(got, shadow{s.Rule.Name, s.By, s.Redundant})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("shadowed = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []models.NSGRule
+		want  map[string]string // duplicate -> original
+	}{
+		{
+			name: "same traffic written differently",
+			rules: []models.NSGRule{
+				inbound("allow-web", 100, Allow, "Tcp", []string{"Internet", "10.0.0.0/24"}, []string{"443,80"}),
+				inbound("allow-web-copy", 200, Allow, "TCP", []string{"10.0.0.5/24", "internet"}, []string{"80", "443"}),
+			},
+			want: map[string]string{"allow-web-copy": "allow-web"},
+		},
+		{
+			name: "first match is reported",
+			rules: []models.NSGRule{
+				inbound("a", 100, Allow, "Tcp", []string{"*"}, []string{"22"}),
+				inbound("b", 110, Allow, "Tcp", []string{"*"}, []string{"22"}),
+				inbound("c", 120, Allow, "Tcp", []string{"*"}, []string{"22"}),
+			},
+			want: map[string]string{"b": "a", "c": "a"},
+		},
+		{
+			name: "different access",
+			rules: []models.NSGRule{
+				inbound("allow-ssh", 100, Allow, "Tcp", []string{"*"}, []string{"22"}),
+				inbound("deny-ssh", 200, Deny, "Tcp", []string{"*"}, []string{"22"}),
+			},
+		},
+		{
+			name: "different ports",
+			rules: []models.NSGRule{
+				inbound("allow-ssh", 100, Allow, "Tcp", []string{"*"}, []string{"22"}),
+				inbound("allow-ssh-alt", 200, Allow, "Tcp", []string{"*"}, []string{"2222"}),
+			},
+		},
+		{
+			name: "different protocol",
+			rules: []models.NSGRule{
+				inbound("allow-dns-tcp", 100, Allow, "Tcp", []string{"*"}, []string{"53"}),
+				inbound("allow-dns-udp", 200, Allow, "Udp", []string{"*"}, []string{"53"}),
+			},
+		},
+		{
+			name: "different direction",
+			rules: []models.NSGRule{
+				inbound("allow-https-in", 100, Allow, "Tcp", []string{"*"}, []string{"443"}),
+				outbound(inbound("allow-https-out", 200, Allow, "Tcp", []string{"*"}, []string{"443"})),
+			},
+		},
+		{
+			name: "same as a default rule",
+			rules: []models.NSGRule{
+				to(inbound("allow-vnet", 4000, Allow, "*", []string{"VirtualNetwork"}, []string{"*"}), "VirtualNetwork"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, d := range New(models.NSG{Name: "nsg", Rules: tt.rules}).Duplicates() {
+				got[d.Rule.Name] = d.Of.Name
+			}
+			want := tt.want
+			if want == nil {
+				want = map[string]string{}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("duplicates = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRuleASGs(t *testing.T) {
+	r := inbound("web-to-db", 100, Allow, "Tcp", []string{"*"}, []string{"1433"})
+	r.SourceASGs = []string{asgWeb}
+	r.DestAddressPrefixes = nil
+	r.DestASGs = []string{asgDB}
+
+	rule, err := NewRule(r)
+	if err != nil {
+		t.Fatalf("NewRule: %v", err)
+	}
+	if got := rule.ASGs(); !reflect.DeepEqual(got, []string{asgWeb, asgDB}) {
+		t.Errorf("ASGs() = %v, want the source and destination ASGs", got)
+	}
+	if got := New(models.NSG{}).Rules[0].ASGs(); got != nil {
+		t.Errorf("default rule ASGs() = %v, want none", got)
+	}
+}
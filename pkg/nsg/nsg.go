@@ -0,0 +1,188 @@
+package nsg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// Directions and access values
+const (
+	Inbound  = "Inbound"
+	Outbound = "Outbound"
+	Allow    = "Allow"
+	Deny     = "Deny"
+)
+
+// Protocols evaluated by NSG rules; "*" in a rule expands to all of them
+var Protocols = []string{"TCP", "UDP", "ICMP", "ESP", "AH"}
+
+// Rule is a parsed NSG security rule
+type Rule struct {
+	Name         string
+	Priority     int
+	Direction    string // Inbound or Outbound
+	Access       string // Allow or Deny
+	Protocols    []string
+	Sources      []Address
+	SourcePorts  PortSet
+	Destinations []Address
+	DestPorts    PortSet
+	Default      bool // Azure built-in rule
+}
+
+// NSG is a network security group with its rules in evaluation order
+type NSG struct {
+	ID    string
+	Name  string
+	Rules []Rule // custom rules followed by default rules, by priority
+	// Invalid lists rules that could not be parsed and are ignored
+	Invalid []string
+}
+
+// New parses a normalized NSG. When the NSG carries no default rules, the
+// standard Azure defaults are used.
+func New(m models.NSG) *NSG {
+	n := &NSG{ID: m.ID, Name: m.Name}
+
+	for _, r := range m.Rules {
+		rule, err := NewRule(r)
+		if err != nil {
+			n.Invalid = append(n.Invalid, fmt.Sprintf("%s: %v", r.Name, err))
+			continue
+		}
+		n.Rules = append(n.Rules, rule)
+	}
+
+	defaults := m.DefaultRules
+	if len(defaults) == 0 {
+		defaults = DefaultRules()
+	}
+	for _, r := range defaults {
+		rule, err := NewRule(r)
+		if err != nil {
+			continue
+		}
+		rule.Default = true
+		n.Rules = append(n.Rules, rule)
+	}
+
+	sort.SliceStable(n.Rules, func(i, j int) bool {
+		return n.Rules[i].Priority < n.Rules[j].Priority
+	})
+	return n
+}
+
+// NewRule parses a normalized security rule
+func NewRule(r models.NSGRule) (Rule, error) {
+	rule := Rule{
+		Name:         r.Name,
+		Priority:     r.Priority,
+		Direction:    canonical(r.Direction, Inbound, Outbound),
+		Access:       canonical(r.Access, Allow, Deny),
+		Sources:      parseAddresses(r.SourceAddressPrefixes, r.SourceASGs),
+		Destinations: parseAddresses(r.DestAddressPrefixes, r.DestASGs),
+	}
+	if rule.Direction == "" {
+		return Rule{}, fmt.Errorf("unknown direction %q", r.Direction)
+	}
+	if rule.Access == "" {
+		return Rule{}, fmt.Errorf("unknown access %q", r.Access)
+	}
+
+	var err error
+	if rule.SourcePorts, err = ParsePorts(r.SourcePortRanges); err != nil {
+		return Rule{}, err
+	}
+	if rule.DestPorts, err = ParsePorts(r.DestPortRanges); err != nil {
+		return Rule{}, err
+	}
+	rule.Protocols = parseProtocol(r.Protocol, !rule.SourcePorts.IsAll() || !rule.DestPorts.IsAll())
+	return rule, nil
+}
+
+// DefaultRules returns the security rules Azure adds to every NSG
+func DefaultRules() []models.NSGRule {
+	rule := func(name string, priority int, direction, access, source, dest string) models.NSGRule {
+		return models.NSGRule{
+			Name:                  name,
+			Priority:              priority,
+			Direction:             direction,
+			Access:                access,
+			Protocol:              "*",
+			SourceAddressPrefixes: []string{source},
+			SourcePortRanges:      []string{"*"},
+			DestAddressPrefixes:   []string{dest},
+			DestPortRanges:        []string{"*"},
+		}
+	}
+	return []models.NSGRule{
+		rule("AllowVnetInBound", 65000, Inbound, Allow, TagVirtualNetwork, TagVirtualNetwork),
+		rule("AllowAzureLoadBalancerInBound", 65001, Inbound, Allow, TagAzureLoadBalancer, "*"),
+		rule("DenyAllInBound", 65500, Inbound, Deny, "*", "*"),
+		rule("AllowVnetOutBound", 65000, Outbound, Allow, TagVirtualNetwork, TagVirtualNetwork),
+		rule("AllowInternetOutBound", 65001, Outbound, Allow, "*", TagInternet),
+		rule("DenyAllOutBound", 65500, Outbound, Deny, "*", "*"),
+	}
+}
+
+// RulesFor returns the rules of one direction in evaluation order
+func (n *NSG) RulesFor(direction string) []Rule {
+	var rules []Rule
+	for _, rule := range n.Rules {
+		if rule.Direction == direction {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// HasProtocol reports whether the rule applies to a protocol
+func (r Rule) HasProtocol(protocol string) bool {
+	for _, p := range r.Protocols {
+		if strings.EqualFold(p, protocol) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether r matches every flow of other for a protocol, so
+// that r, evaluated first, decides those flows
+func (r Rule) covers(other Rule, source Address, protocol string) bool {
+	return r.Direction == other.Direction &&
+		r.HasProtocol(protocol) &&
+		containsAny(r.Sources, source) &&
+		containsAll(r.Destinations, other.Destinations) &&
+		r.SourcePorts.ContainsAll(other.SourcePorts)
+}
+
+// parseProtocol expands a rule protocol into the protocols it matches. A
+// "*" rule restricted to some ports only matches the protocols with ports.
+func parseProtocol(protocol string, portRestricted bool) []string {
+	protocol = strings.TrimSpace(protocol)
+	if protocol == "" || protocol == "*" || strings.EqualFold(protocol, "any") {
+		if portRestricted {
+			return []string{"TCP", "UDP"}
+		}
+		return append([]string(nil), Protocols...)
+	}
+	return []string{strings.ToUpper(protocol)}
+}
+
+// hasPorts reports whether a protocol uses ports
+func hasPorts(protocol string) bool {
+	return protocol == "TCP" || protocol == "UDP"
+}
+
+// canonical returns the option equal to s ignoring case, or ""
+func canonical(s string, options ...string) string {
+	for _, option := range options {
+		if strings.EqualFold(s, option) {
+			return option
+		}
+	}
+	return ""
+}
@@ -0,0 +1,323 @@
+package nsg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+const (
+	asgWeb = "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network/applicationSecurityGroups/asg-web"
+	asgDB  = "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Network/applicationSecurityGroups/asg-db"
+)
+
+// inbound builds a normalized inbound rule from any destination
+func inbound(name string, priority int, access, protocol string, sources, ports []string) models.NSGRule {
+	return models.NSGRule{
+		Name:                  name,
+		Priority:              priority,
+		Direction:             Inbound,
+		Access:                access,
+		Protocol:              protocol,
+		SourceAddressPrefixes: sources,
+		SourcePortRanges:      []string{"*"},
+		DestAddressPrefixes:   []string{"*"},
+		DestPortRanges:        ports,
+	}
+}
+
+func ports(t *testing.T, specs ...string) PortSet {
+	t.Helper()
+	set, err := ParsePorts(specs)
+	if err != nil {
+		t.Fatalf("ParsePorts(%v): %v", specs, err)
+	}
+	return set
+}
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []string
+		want  PortSet
+		str   string
+	}{
+		{"none means all", nil, AllPorts(), "*"},
+		{"wildcard", []string{"*"}, AllPorts(), "*"},
+		{"wildcard in a list", []string{"22", "*"}, AllPorts(), "*"},
+		{"single port", []string{"22"}, PortSet{{22, 22}}, "22"},
+		{"five digit port", []string{"13389"}, PortSet{{13389, 13389}}, "13389"},
+		{"range", []string{"2200-2300"}, PortSet{{2200, 2300}}, "2200-2300"},
+		{"single port range", []string{"443-443"}, PortSet{{443, 443}}, "443"},
+		{"comma separated", []string{"80, 443"}, PortSet{{80, 80}, {443, 443}}, "80, 443"},
+		{"list is sorted", []string{"443", "22", "3389"}, PortSet{{22, 22}, {443, 443}, {3389, 3389}}, "22, 443, 3389"},
+		{"adjacent ports merge", []string{"80", "81", "82-90"}, PortSet{{80, 90}}, "80-90"},
+		{"overlapping ranges merge", []string{"1000-2000", "1500-2500"}, PortSet{{1000, 2500}}, "1000-2500"},
+		{"contained range", []string{"2200-2300", "2250"}, PortSet{{2200, 2300}}, "2200-2300"},
+		{"whitespace", []string{" 22 ", ""}, PortSet{{22, 22}}, "22"},
+		{"full range", []string{"0-65535"}, AllPorts(), "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ports(t, tt.specs...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePorts(%q) = %v, want %v", tt.specs, got, tt.want)
+			}
+			if got.String() != tt.str {
+				t.Errorf("String() = %q, want %q", got.String(), tt.str)
+			}
+		})
+	}
+}
+
+func TestParsePortsErrors(t *testing.T) {
+	for _, spec := range []string{"ssh", "70000", "2300-2200", "-5", "22-", "1-2-3"} {
+		if set, err := ParsePorts([]string{spec}); err == nil {
+			t.Errorf("ParsePorts(%q) = %v, want an error", spec, set)
+		}
+	}
+}
+
+func TestPortSetOperations(t *testing.T) {
+	a := ports(t, "20-30", "100")
+	b := ports(t, "25-110")
+
+	if got := a.Union(b).String(); got != "20-110" {
+		t.Errorf("union = %s, want 20-110", got)
+	}
+	if got := a.Intersect(b).String(); got != "25-30, 100" {
+		t.Errorf("intersect = %s, want 25-30, 100", got)
+	}
+	if got := a.Subtract(b).String(); got != "20-24" {
+		t.Errorf("subtract = %s, want 20-24", got)
+	}
+	if got := AllPorts().Subtract(ports(t, "22")).String(); got != "0-21, 23-65535" {
+		t.Errorf("all but 22 = %s", got)
+	}
+	if !b.ContainsAll(ports(t, "30-40", "100")) || b.ContainsAll(a) {
+		t.Errorf("ContainsAll gave the wrong answer for %v", b)
+	}
+	if a.Count() != 12 || !a.Contains(100) || a.Contains(99) {
+		t.Errorf("count %d or membership of %v is wrong", a.Count(), a)
+	}
+}
+
+func TestAddressContains(t *testing.T) {
+	tests := []struct {
+		a, other string
+		want     bool
+	}{
+		{"*", "Internet", true},
+		{"*", "10.0.0.4", true},
+		{"Internet", "Internet", true},
+		{"internet", "Internet", true},
+		{"Internet", "203.0.113.0/24", true},
+		{"Internet", "10.0.0.0/8", false},
+		{"Internet", "0.0.0.0/0", false},
+		{"Internet", "AzureCloud", false},
+		{"0.0.0.0/0", "Internet", true},
+		{"0.0.0.0/0", "198.51.100.7", true},
+		{"0.0.0.0/0", "2001:db8::1", false},
+		{"::/0", "2001:db8::1", true},
+		{"10.0.0.0/16", "10.0.1.4", true},
+		{"10.0.0.0/16", "10.0.1.0/24", true},
+		{"10.0.1.0/24", "10.0.0.0/16", false},
+		{"10.0.0.0/16", "10.1.0.0/16", false},
+		{"10.0.0.0/16", "VirtualNetwork", false},
+		{"VirtualNetwork", "10.0.1.4", false},
+		{"VirtualNetwork", "virtualnetwork", true},
+		{"AzureCloud", "AzureCloud.WestEurope", true},
+		{"AzureCloud.WestEurope", "AzureCloud", false},
+		{"AzureCloud.WestEurope", "AzureCloud.EastUS", false},
+		{"Storage", "AzureCloud", false},
+		{"Storage", "Storage.WestEurope", true},
+	}
+
+	for _, tt := range tests {
+		if got := ParseAddress(tt.a).Contains(ParseAddress(tt.other)); got != tt.want {
+			t.Errorf("%s contains %s = %v, want %v", tt.a, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestASGContains(t *testing.T) {
+	web := ASGAddress(asgWeb)
+
+	if !web.Contains(ASGAddress(strings.ToUpper(asgWeb))) {
+		t.Error("an ASG should contain itself regardless of case")
+	}
+	if web.Contains(ASGAddress(asgDB)) {
+		t.Error("an ASG should not contain another ASG")
+	}
+	if web.Contains(ParseAddress("10.0.1.4")) || ParseAddress("10.0.0.0/8").Contains(web) {
+		t.Error("ASGs and prefixes should not contain each other")
+	}
+	if !ParseAddress("*").Contains(web) {
+		t.Error("* should contain an ASG")
+	}
+	if web.String() != "asg-web" {
+		t.Errorf("String() = %q, want the ASG name", web.String())
+	}
+}
+
+func TestAddressScope(t *testing.T) {
+	tests := []struct {
+		address string
+		want    Scope
+	}{
+		{"*", ScopeInternet},
+		{"Internet", ScopeInternet},
+		{"0.0.0.0/0", ScopeInternet},
+		{"AzureCloud", ScopeAzureCloud},
+		{"AzureCloud.WestEurope", ScopeAzureCloud},
+		{"203.0.113.0/24", ScopePublic},
+		{"10.0.0.0/8", ScopeInternal},
+		{"192.168.1.1", ScopeInternal},
+		{"VirtualNetwork", ScopeInternal},
+		{"AzureLoadBalancer", ScopeInternal},
+	}
+
+	for _, tt := range tests {
+		if got := ParseAddress(tt.address).Scope(); got != tt.want {
+			t.Errorf("%s scope = %s, want %s", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestNewRuleAddresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []string
+		asgs     []string
+		want     []string
+	}{
+		{"prefix array", []string{"10.0.0.0/24", "Internet", "203.0.113.7"}, nil, []string{"10.0.0.0/24", "Internet", "203.0.113.7"}},
+		{"nothing means any", nil, nil, []string{"*"}},
+		{"asgs replace the * placeholder", []string{"*"}, []string{asgWeb, asgDB}, []string{"asg-web", "asg-db"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := inbound("r", 100, Allow, "Tcp", tt.prefixes, []string{"443"})
+			r.SourceASGs = tt.asgs
+			rule, err := NewRule(r)
+			if err != nil {
+				t.Fatalf("NewRule: %v", err)
+			}
+			var got []string
+			for _, source := range rule.Sources {
+				got = append(got, source.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sources = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRuleProtocols(t *testing.T) {
+	tests := []struct {
+		name        string
+		protocol    string
+		sourcePorts []string
+		destPorts   []string
+		want        []string
+	}{
+		{"any protocol and port", "*", []string{"*"}, []string{"*"}, Protocols},
+		{"any spelled out", "Any", nil, nil, Protocols},
+		{"any with a destination port", "*", []string{"*"}, []string{"22"}, []string{"TCP", "UDP"}},
+		{"any with source ports", "*", []string{"1024-65535"}, []string{"*"}, []string{"TCP", "UDP"}},
+		{"tcp", "Tcp", nil, []string{"443"}, []string{"TCP"}},
+		{"icmp", "Icmp", nil, nil, []string{"ICMP"}},
+		{"esp", "Esp", nil, nil, []string{"ESP"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := inbound("r", 100, Allow, tt.protocol, []string{"*"}, tt.destPorts)
+			r.SourcePortRanges = tt.sourcePorts
+			rule, err := NewRule(r)
+			if err != nil {
+				t.Fatalf("NewRule: %v", err)
+			}
+			if !reflect.DeepEqual(rule.Protocols, tt.want) {
+				t.Errorf("protocols = %v, want %v", rule.Protocols, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRuleErrors(t *testing.T) {
+	badDirection := inbound("r", 100, Allow, "Tcp", nil, nil)
+	badDirection.Direction = "Sideways"
+	badAccess := inbound("r", 100, "Maybe", "Tcp", nil, nil)
+	badPort := inbound("r", 100, Allow, "Tcp", nil, []string{"http"})
+
+	for _, r := range []models.NSGRule{badDirection, badAccess, badPort} {
+		if _, err := NewRule(r); err == nil {
+			t.Errorf("NewRule(%+v) succeeded, want an error", r)
+		}
+	}
+
+	n := New(models.NSG{Name: "nsg", Rules: []models.NSGRule{badPort}})
+	if len(n.Invalid) != 1 || len(n.RulesFor(Inbound)) != 3 {
+		t.Errorf("invalid rules %v and %d inbound rules, want the bad rule skipped and the defaults kept", n.Invalid, len(n.RulesFor(Inbound)))
+	}
+}
+
+func TestInboundExposure(t *testing.T) {
+	n := New(models.NSG{
+		Name: "nsg-web",
+		// Listed out of order; New sorts by priority
+		Rules: []models.NSGRule{
+			inbound("allow-internet-all", 160, Allow, "*", []string{"Internet"}, []string{"*"}),
+			inbound("deny-ssh", 100, Deny, "*", []string{"Internet"}, []string{"22"}),
+			inbound("allow-admin", 110, Allow, "Tcp", []string{"*"}, []string{"22", "3389"}),
+			inbound("allow-azure-https", 120, Allow, "Tcp", []string{"AzureCloud.WestEurope"}, []string{"443"}),
+			inbound("allow-partner", 130, Allow, "*", []string{"203.0.113.0/24", "10.20.0.0/16"}, []string{"8080"}),
+			inbound("allow-internal", 140, Allow, "Tcp", []string{"10.0.0.0/8", "VirtualNetwork"}, []string{"22"}),
+			inbound("allow-rdp-again", 170, Allow, "Tcp", []string{"Internet"}, []string{"3389"}),
+		},
+	})
+
+	type exposure struct {
+		rule, source string
+		scope        Scope
+		ports        string
+	}
+	var got []exposure
+	for _, e := range n.InboundExposure() {
+		got = append(got, exposure{e.Rule.Name, e.Source.String(), e.Scope, e.String()})
+	}
+
+	want := []exposure{
+		// SSH from the Internet is denied first, leaving RDP
+		{"allow-admin", "*", ScopeInternet, "TCP 3389"},
+		{"allow-azure-https", "AzureCloud.WestEurope", ScopeAzureCloud, "TCP 443"},
+		// A "*" rule with a port opens TCP and UDP only, and the private
+		// source is not an exposure
+		{"allow-partner", "203.0.113.0/24", ScopePublic, "TCP 8080; UDP 8080"},
+		// The earlier "*" deny on port 22 leaves ICMP, ESP and AH open
+		{"allow-internet-all", "Internet", ScopeInternet, "TCP 0-21, 23-3388, 3390-65535; UDP 0-21, 23-65535; ICMP; ESP; AH"},
+		// allow-rdp-again is fully shadowed and exposes nothing
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("exposures:\n got %+v\nwant %+v", got, want)
+	}
+
+	exposures := n.InboundExposure()
+	if !exposures[0].Reaches(3389) || exposures[0].Reaches(22) {
+		t.Errorf("allow-admin reaches = %v, want 3389 but not 22", exposures[0].Ports)
+	}
+}
+
+func TestInboundExposureDefaultsOnly(t *testing.T) {
+	// The default rules allow VirtualNetwork and AzureLoadBalancer, neither
+	// of which is external
+	if exposures := New(models.NSG{Name: "empty"}).InboundExposure(); len(exposures) != 0 {
+		t.Errorf("got %d exposures for an NSG with only default rules, want 0", len(exposures))
+	}
+}
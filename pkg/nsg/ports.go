@@ -0,0 +1,191 @@
+package nsg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxPort is the highest TCP/UDP port
+const MaxPort = 65535
+
+// PortRange is an inclusive range of ports
+type PortRange struct {
+	From int
+	To   int
+}
+
+// PortSet is a sorted list of non-overlapping, non-adjacent port ranges
+type PortSet []PortRange
+
+// AllPorts returns the set of every port
+func AllPorts() PortSet {
+	return PortSet{{0, MaxPort}}
+}
+
+// ParsePorts parses NSG port specifications such as "*", "22", "2200-2300"
+// or a comma-separated list of them. An empty list means all ports.
+func ParsePorts(specs []string) (PortSet, error) {
+	if len(specs) == 0 {
+		return AllPorts(), nil
+	}
+
+	var ranges PortSet
+	for _, spec := range specs {
+		for _, part := range strings.Split(spec, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			if part == "*" {
+				return AllPorts(), nil
+			}
+
+			from, to := part, part
+			if i := strings.Index(part, "-"); i > 0 {
+				from, to = part[:i], part[i+1:]
+			}
+			lo, err := parsePort(from)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port range %q: %w", part, err)
+			}
+			hi, err := parsePort(to)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port range %q: %w", part, err)
+			}
+			if lo > hi {
+				return nil, fmt.Errorf("invalid port range %q: start is after end", part)
+			}
+			ranges = append(ranges, PortRange{lo, hi})
+		}
+	}
+	if len(ranges) == 0 {
+		return AllPorts(), nil
+	}
+	return ranges.normalize(), nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if port < 0 || port > MaxPort {
+		return 0, fmt.Errorf("%d is out of range", port)
+	}
+	return port, nil
+}
+
+// normalize sorts ranges and merges overlapping or adjacent ones
+func (s PortSet) normalize() PortSet {
+	if len(s) == 0 {
+		return nil
+	}
+	sorted := append(PortSet(nil), s...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].From < sorted[j].From })
+
+	merged := PortSet{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.From <= last.To+1 {
+			if r.To > last.To {
+				last.To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// IsEmpty reports whether the set holds no ports
+func (s PortSet) IsEmpty() bool {
+	return len(s) == 0
+}
+
+// IsAll reports whether the set holds every port
+func (s PortSet) IsAll() bool {
+	return len(s) == 1 && s[0].From == 0 && s[0].To == MaxPort
+}
+
+// Contains reports whether a port is in the set
+func (s PortSet) Contains(port int) bool {
+	for _, r := range s {
+		if port >= r.From && port <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsAll reports whether every port of other is in the set
+func (s PortSet) ContainsAll(other PortSet) bool {
+	return other.Subtract(s).IsEmpty()
+}
+
+// Count returns the number of ports in the set
+func (s PortSet) Count() int {
+	count := 0
+	for _, r := range s {
+		count += r.To - r.From + 1
+	}
+	return count
+}
+
+// Union returns the ports in either set
+func (s PortSet) Union(other PortSet) PortSet {
+	return append(append(PortSet(nil), s...), other...).normalize()
+}
+
+// Intersect returns the ports in both sets
+func (s PortSet) Intersect(other PortSet) PortSet {
+	var result PortSet
+	for _, a := range s {
+		for _, b := range other {
+			lo, hi := max(a.From, b.From), min(a.To, b.To)
+			if lo <= hi {
+				result = append(result, PortRange{lo, hi})
+			}
+		}
+	}
+	return result.normalize()
+}
+
+// Subtract returns the ports in s that are not in other
+func (s PortSet) Subtract(other PortSet) PortSet {
+	result := append(PortSet(nil), s...)
+	for _, b := range other {
+		var next PortSet
+		for _, a := range result {
+			if b.To < a.From || b.From > a.To {
+				next = append(next, a)
+				continue
+			}
+			if a.From < b.From {
+				next = append(next, PortRange{a.From, b.From - 1})
+			}
+			if a.To > b.To {
+				next = append(next, PortRange{b.To + 1, a.To})
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// String formats the set as NSG port specifications, e.g. "22, 8000-8080"
+func (s PortSet) String() string {
+	if s.IsAll() {
+		return "*"
+	}
+	parts := make([]string, len(s))
+	for i, r := range s {
+		if r.From == r.To {
+			parts[i] = strconv.Itoa(r.From)
+		} else {
+			parts[i] = fmt.Sprintf("%d-%d", r.From, r.To)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,258 @@
+package pricing
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HoursPerMonth converts hourly prices to monthly costs
+const HoursPerMonth = 730
+
+// DefaultRegion is used for resources in regions the price sheet does not
+// cover; such prices are marked approximate
+const DefaultRegion = "eastus"
+
+//go:embed prices.json
+var bundledPrices []byte
+
+// Price is one meter of a price sheet, with the field names of the Azure
+// Retail Prices API
+type Price struct {
+	ServiceName   string  `json:"serviceName"`
+	ProductName   string  `json:"productName"`
+	SkuName       string  `json:"skuName"`
+	ArmSkuName    string  `json:"armSkuName"`
+	MeterName     string  `json:"meterName"`
+	ArmRegionName string  `json:"armRegionName"`
+	UnitPrice     float64 `json:"unitPrice"`
+	UnitOfMeasure string  `json:"unitOfMeasure"`
+	Type          string  `json:"type"`
+	CurrencyCode  string  `json:"currencyCode"`
+
+	// ReservationTerm is "1 Year" or "3 Years" for reservation meters, whose
+	// unit price is the price of the whole term
+	ReservationTerm string `json:"reservationTerm,omitempty"`
+	// SavingsPlan lists the hourly savings plan prices of a meter by term
+	SavingsPlan []SavingsPlanPrice `json:"savingsPlan,omitempty"`
+}
+
+// SavingsPlanPrice is the hourly price of a meter under a savings plan
+type SavingsPlanPrice struct {
+	UnitPrice float64 `json:"unitPrice"`
+	Term      string  `json:"term"`
+}
+
+// Monthly returns the monthly cost of one unit of the meter, or false for
+// units that are not time-based (e.g. per GB transferred)
+func (p Price) Monthly() (float64, bool) {
+	switch strings.ToLower(strings.TrimSpace(p.UnitOfMeasure)) {
+	case "1 hour", "1 hours", "1/hour":
+		return p.UnitPrice * HoursPerMonth, true
+	case "1 day", "1/day":
+		return p.UnitPrice * HoursPerMonth / 24, true
+	case "1 month", "1/month":
+		return p.UnitPrice, true
+	}
+	return 0, false
+}
+
+// Catalog is a price sheet indexed by service and region
+type Catalog struct {
+	Source   string // file name, or a description of the bundled sheet
+	Currency string
+
+	prices       map[string][]Price // by lower-cased "service|region"
+	reservations map[string][]Price // reservation meters, keyed like prices
+}
+
+var (
+	defaultCatalog *Catalog
+	defaultOnce    sync.Once
+)
+
+// Default returns the bundled catalog of approximate list prices
+func Default() *Catalog {
+	defaultOnce.Do(func() {
+		catalog, err := parseJSON(bundledPrices)
+		if err != nil {
+			panic(fmt.Sprintf("bundled price sheet is invalid: %v", err))
+		}
+		defaultCatalog = catalog
+	})
+	return defaultCatalog
+}
+
+// Load reads a price sheet exported from the Azure Retail Prices API, as
+// JSON ({"Items": [...]} or a plain array) or CSV with the same column names
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price sheet: %w", err)
+	}
+
+	var catalog *Catalog
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		catalog, err = parseCSV(bytes.NewReader(data))
+	} else {
+		catalog, err = parseJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse price sheet %s: %w", path, err)
+	}
+	catalog.Source = path
+	return catalog, nil
+}
+
+// NewCatalog indexes a list of prices. Spot, low-priority and dev/test
+// meters are skipped; estimates use pay-as-you-go prices and reservation
+// meters are kept apart for commitment savings.
+func NewCatalog(prices []Price) *Catalog {
+	c := &Catalog{prices: make(map[string][]Price), reservations: make(map[string][]Price)}
+	for _, p := range prices {
+		meter := strings.ToLower(p.MeterName + " " + p.SkuName)
+		if strings.Contains(meter, "spot") || strings.Contains(meter, "low priority") {
+			continue
+		}
+		key := strings.ToLower(p.ServiceName + "|" + p.ArmRegionName)
+		switch {
+		case strings.EqualFold(p.Type, "Reservation"):
+			c.reservations[key] = append(c.reservations[key], p)
+			continue
+		case p.Type != "" && !strings.EqualFold(p.Type, "Consumption"):
+			continue
+		}
+		if c.Currency == "" {
+			c.Currency = p.CurrencyCode
+		}
+		c.prices[key] = append(c.prices[key], p)
+	}
+	if c.Currency == "" {
+		c.Currency = "USD"
+	}
+	return c
+}
+
+// Len returns the number of meters in the catalog
+func (c *Catalog) Len() int {
+	n := 0
+	for _, prices := range c.prices {
+		n += len(prices)
+	}
+	for _, prices := range c.reservations {
+		n += len(prices)
+	}
+	return n
+}
+
+// find returns the first meter of a service in a region that matches,
+// falling back to DefaultRegion. approximate is true for fallback prices.
+func (c *Catalog) find(service, region string, match func(Price) bool) (price Price, approximate, ok bool) {
+	return findIn(c.prices, service, region, match)
+}
+
+// findIn is find over a set of meters
+func findIn(prices map[string][]Price, service, region string, match func(Price) bool) (price Price, approximate, ok bool) {
+	for _, r := range []string{region, DefaultRegion} {
+		for _, p := range prices[strings.ToLower(service+"|"+r)] {
+			if match(p) {
+				return p, !strings.EqualFold(r, region), true
+			}
+		}
+	}
+	return Price{}, false, false
+}
+
+// priceSheet is the Retail Prices API response format
+type priceSheet struct {
+	BillingCurrency string  `json:"BillingCurrency"`
+	Source          string  `json:"Source"`
+	Items           []Price `json:"Items"`
+}
+
+func parseJSON(data []byte) (*Catalog, error) {
+	var sheet priceSheet
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if err := json.Unmarshal(data, &sheet.Items); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(data, &sheet); err != nil {
+		return nil, err
+	}
+	if len(sheet.Items) == 0 {
+		return nil, fmt.Errorf("no prices found")
+	}
+
+	catalog := NewCatalog(sheet.Items)
+	catalog.Source = sheet.Source
+	if sheet.BillingCurrency != "" {
+		catalog.Currency = sheet.BillingCurrency
+	}
+	return catalog, nil
+}
+
+func parseCSV(r io.Reader) (*Catalog, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"servicename", "armregionname", "unitprice", "unitofmeasure"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+
+	var prices []Price
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		unitPrice, err := strconv.ParseFloat(field("unitprice"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unitPrice %q", field("unitprice"))
+		}
+		prices = append(prices, Price{
+			ServiceName:     field("servicename"),
+			ProductName:     field("productname"),
+			SkuName:         field("skuname"),
+			ArmSkuName:      field("armskuname"),
+			MeterName:       field("metername"),
+			ArmRegionName:   field("armregionname"),
+			UnitPrice:       unitPrice,
+			UnitOfMeasure:   field("unitofmeasure"),
+			Type:            field("type"),
+			CurrencyCode:    field("currencycode"),
+			ReservationTerm: field("reservationterm"),
+		})
+	}
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("no prices found")
+	}
+	return NewCatalog(prices), nil
+}
@@ -0,0 +1,79 @@
+package pricing
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Commitment kinds
+const (
+	Reservation = "Reservation"
+	SavingsPlan = "Savings Plan"
+)
+
+// CommitmentTerms are the commitment lengths in years
+var CommitmentTerms = []int{1, 3}
+
+// Commitment is the monthly compute cost of a VM size under a reservation
+// or savings plan
+type Commitment struct {
+	Kind        string
+	Years       int
+	Monthly     float64
+	Approximate bool // priced at DefaultRegion rates
+}
+
+// VMCommitment returns the monthly cost of a VM size under a reservation or
+// savings plan of the given years, and false if the catalog has no price.
+// Commitments cover compute only, so they are priced from the Linux meter;
+// Windows licenses stay pay-as-you-go.
+func (c *Catalog) VMCommitment(kind, size, region string, years int) (Commitment, bool) {
+	term := termName(years)
+	region = strings.ToLower(region)
+	commitment := Commitment{Kind: kind, Years: years}
+
+	switch kind {
+	case Reservation:
+		p, approximate, ok := findIn(c.reservations, "Virtual Machines", region, func(p Price) bool {
+			return vmMatch(size, false)(p) && strings.EqualFold(p.ReservationTerm, term)
+		})
+		if !ok {
+			return commitment, false
+		}
+		// Reservation unit prices are for the whole term
+		commitment.Monthly = p.UnitPrice / float64(12*years)
+		commitment.Approximate = approximate
+
+	case SavingsPlan:
+		var hourly float64
+		_, approximate, ok := c.find("Virtual Machines", region, func(p Price) bool {
+			if !vmMatch(size, false)(p) {
+				return false
+			}
+			for _, plan := range p.SavingsPlan {
+				if strings.EqualFold(plan.Term, term) {
+					hourly = plan.UnitPrice
+					return true
+				}
+			}
+			return false
+		})
+		if !ok {
+			return commitment, false
+		}
+		commitment.Monthly = hourly * HoursPerMonth
+		commitment.Approximate = approximate
+
+	default:
+		return commitment, false
+	}
+	return commitment, true
+}
+
+// termName returns the Retail Prices API name of a term, e.g. "3 Years"
+func termName(years int) string {
+	if years == 1 {
+		return "1 Year"
+	}
+	return fmt.Sprintf("%d Years", years)
+}
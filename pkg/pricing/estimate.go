@@ -0,0 +1,264 @@
+package pricing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Estimate is the monthly pay-as-you-go cost of one resource
+type Estimate struct {
+	ResourceID string  `json:"resourceId"`
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	Region     string  `json:"region"`
+	SKU        string  `json:"sku,omitempty"`
+	Monthly    float64 `json:"monthly"`
+	Meter      string  `json:"meter,omitempty"` // meter the estimate is based on
+	Priced     bool    `json:"priced"`
+	// Approximate is true when the price was taken from DefaultRegion
+	// because the sheet has no price for the resource's region
+	Approximate bool   `json:"approximate,omitempty"`
+	Reason      string `json:"reason,omitempty"` // why the resource could not be priced
+}
+
+// freeTypes are resource types without a charge of their own
+var freeTypes = map[string]bool{
+	"microsoft.network/virtualnetworks":                     true,
+	"microsoft.network/networksecuritygroups":               true,
+	"microsoft.network/routetables":                         true,
+	"microsoft.network/networkinterfaces":                   true,
+	"microsoft.network/applicationsecuritygroups":           true,
+	"microsoft.network/privatednszones/virtualnetworklinks": true,
+	"microsoft.compute/availabilitysets":                    true,
+	"microsoft.network/networkwatchers":                     true,
+	"microsoft.insights/actiongroups":                       true,
+	"microsoft.managedidentity/userassignedidentities":      true,
+}
+
+// diskTiers maps managed disk sizes to the tier number billed for them,
+// e.g. a 100 GiB Premium SSD is billed as P10 (128 GiB)
+var diskTiers = []struct {
+	maxGB int
+	tier  int
+}{
+	{4, 1}, {8, 2}, {16, 3}, {32, 4}, {64, 6}, {128, 10}, {256, 15}, {512, 20},
+	{1024, 30}, {2048, 40}, {4096, 50}, {8192, 60}, {16384, 70}, {32767, 80},
+}
+
+// Estimate resolves a resource to its monthly cost. Resources without a
+// charge of their own are priced at zero; resources whose SKU has no
+// time-based meter in the catalog are returned with Priced false and a
+// Reason.
+func (c *Catalog) Estimate(res map[string]interface{}) Estimate {
+	resType := strings.ToLower(getString(res, "type"))
+	e := Estimate{
+		ResourceID: getString(res, "id"),
+		Name:       getString(res, "name"),
+		Type:       resType,
+		Region:     strings.ToLower(getString(res, "location")),
+	}
+	props := getMap(res, "properties")
+
+	if freeTypes[resType] {
+		e.Priced = true
+		return e
+	}
+
+	switch resType {
+	case "microsoft.compute/virtualmachines":
+		size := getString(getMap(props, "hardwareProfile"), "vmSize")
+		windows := strings.EqualFold(getString(getMap(getMap(props, "storageProfile"), "osDisk"), "osType"), "Windows")
+		e.SKU = size
+		c.price(&e, "Virtual Machines", vmMatch(size, windows))
+
+	case "microsoft.compute/disks":
+		sku := skuName(res)
+		size := getInt(props, "diskSizeGB")
+		e.SKU = sku
+		product, letter := diskProduct(sku)
+		if product == "" {
+			e.Reason = fmt.Sprintf("disk SKU %s is billed by provisioned capacity and performance", valueOr(sku, "unknown"))
+			return e
+		}
+		tier := diskTier(letter, size)
+		redundancy := "LRS"
+		if strings.HasSuffix(strings.ToUpper(sku), "_ZRS") {
+			redundancy = "ZRS"
+		}
+		meter := tier + " " + redundancy
+		e.SKU = fmt.Sprintf("%s (%s, %d GiB)", sku, tier, size)
+		c.price(&e, "Storage", func(p Price) bool {
+			return strings.EqualFold(p.ProductName, product) && strings.EqualFold(p.SkuName, meter)
+		})
+
+	case "microsoft.network/publicipaddresses":
+		sku := valueOr(skuName(res), "Basic")
+		allocation := valueOr(getString(props, "publicIPAllocationMethod"), "Dynamic")
+		e.SKU = sku + " " + allocation
+		c.price(&e, "Virtual Network", func(p Price) bool {
+			meter := strings.ToLower(p.MeterName)
+			return strings.EqualFold(p.SkuName, sku) && strings.Contains(meter, "public ip") &&
+				strings.Contains(meter, strings.ToLower(allocation)) && !strings.Contains(meter, "prefix")
+		})
+
+	case "microsoft.network/natgateways":
+		e.SKU = valueOr(skuName(res), "Standard")
+		c.price(&e, "NAT Gateway", func(p Price) bool {
+			return strings.EqualFold(p.MeterName, e.SKU+" Gateway")
+		})
+
+	case "microsoft.network/loadbalancers":
+		e.SKU = valueOr(skuName(res), "Basic")
+		if strings.EqualFold(e.SKU, "Basic") {
+			e.Priced = true // Basic load balancers are free
+			return e
+		}
+		c.price(&e, "Load Balancer", func(p Price) bool {
+			return strings.EqualFold(p.SkuName, e.SKU) && strings.Contains(strings.ToLower(p.MeterName), "included lb rules")
+		})
+
+	case "microsoft.network/applicationgateways":
+		sku := getString(getMap(props, "sku"), "name")
+		e.SKU = sku
+		c.price(&e, "Application Gateway", func(p Price) bool {
+			if strings.HasSuffix(strings.ToLower(sku), "_v2") {
+				return strings.EqualFold(p.MeterName, sku+" Fixed Cost")
+			}
+			// v1 SKUs are named tier_size, e.g. WAF_Medium
+			tier, size, _ := strings.Cut(sku, "_")
+			return strings.EqualFold(p.MeterName, size+" Gateway") &&
+				strings.EqualFold(p.ProductName, "Application Gateway "+tier)
+		})
+		if e.Priced && strings.HasSuffix(strings.ToLower(sku), "_v2") {
+			e.Meter += " (capacity units not included)"
+		}
+
+	case "microsoft.network/azurefirewalls":
+		e.SKU = valueOr(getString(getMap(props, "sku"), "tier"), "Standard")
+		c.price(&e, "Azure Firewall", func(p Price) bool {
+			return strings.EqualFold(p.MeterName, e.SKU+" Deployment")
+		})
+
+	case "microsoft.network/virtualnetworkgateways":
+		e.SKU = getString(getMap(props, "sku"), "name")
+		service := "VPN Gateway"
+		if strings.EqualFold(getString(props, "gatewayType"), "ExpressRoute") {
+			service = "ExpressRoute"
+		}
+		c.price(&e, service, func(p Price) bool {
+			return strings.EqualFold(p.SkuName, e.SKU) && strings.EqualFold(p.MeterName, e.SKU)
+		})
+
+	case "microsoft.storage/storageaccounts":
+		e.SKU = skuName(res)
+		e.Reason = "billed by stored data and transactions; use a Cost Management export for actual spend"
+
+	default:
+		e.Reason = "no pricing rule for this resource type"
+	}
+
+	return e
+}
+
+// price sets the estimate from the first matching time-based meter
+func (c *Catalog) price(e *Estimate, service string, match func(Price) bool) {
+	p, approximate, ok := c.find(service, e.Region, func(p Price) bool {
+		_, timed := p.Monthly()
+		return timed && match(p)
+	})
+	if !ok {
+		e.Reason = fmt.Sprintf("no %s price for %s in %s", service, valueOr(e.SKU, "unknown SKU"), e.Region)
+		return
+	}
+
+	monthly, _ := p.Monthly()
+	e.Monthly = monthly
+	e.Meter = p.MeterName
+	e.Priced = true
+	e.Approximate = approximate
+	if approximate {
+		e.Reason = fmt.Sprintf("priced at %s rates", DefaultRegion)
+	}
+}
+
+// EstimateAll prices every resource, sorted by descending monthly cost
+func (c *Catalog) EstimateAll(resources []map[string]interface{}) []Estimate {
+	estimates := make([]Estimate, 0, len(resources))
+	for _, res := range resources {
+		estimates = append(estimates, c.Estimate(res))
+	}
+	sort.SliceStable(estimates, func(i, j int) bool {
+		return estimates[i].Monthly > estimates[j].Monthly
+	})
+	return estimates
+}
+
+// diskProduct returns the price sheet product and tier letter of a managed
+// disk SKU, or "" for SKUs not billed by size tier
+func diskProduct(sku string) (string, string) {
+	switch strings.ToLower(sku) {
+	case "premium_lrs", "premium_zrs":
+		return "Premium SSD Managed Disks", "P"
+	case "standardssd_lrs", "standardssd_zrs":
+		return "Standard SSD Managed Disks", "E"
+	case "standard_lrs", "":
+		return "Standard HDD Managed Disks", "S"
+	}
+	return "", ""
+}
+
+// diskTier returns the billed tier of a disk size, e.g. P10
+func diskTier(letter string, sizeGB int) string {
+	tier := diskTiers[len(diskTiers)-1].tier
+	for _, t := range diskTiers {
+		if sizeGB <= t.maxGB {
+			tier = t.tier
+			break
+		}
+	}
+	// Standard HDD tiers start at S4
+	if letter == "S" && tier < 4 {
+		tier = 4
+	}
+	return fmt.Sprintf("%s%d", letter, tier)
+}
+
+func getMap(m map[string]interface{}, key string) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+func getString(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	v, _ := m[key].(string)
+	return v
+}
+
+func getInt(m map[string]interface{}, key string) int {
+	if m == nil {
+		return 0
+	}
+	v, _ := m[key].(float64)
+	return int(v)
+}
+
+// skuName returns the SKU name from the resource or its properties
+func skuName(res map[string]interface{}) string {
+	if name := getString(getMap(res, "sku"), "name"); name != "" {
+		return name
+	}
+	return getString(getMap(getMap(res, "properties"), "sku"), "name")
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
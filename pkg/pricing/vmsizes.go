@@ -0,0 +1,120 @@
+package pricing
+
+import (
+	"sort"
+	"strings"
+)
+
+// VMSize is the capacity of a virtual machine size
+type VMSize struct {
+	Name     string
+	Series   string // sizes of one series differ only in capacity, e.g. Dsv5
+	VCPUs    int
+	MemoryGB float64
+}
+
+// vmSizes lists the sizes of the series in the bundled price sheet
+var vmSizes = []VMSize{
+	{"Standard_B1s", "B", 1, 1},
+	{"Standard_B1ms", "B", 1, 2},
+	{"Standard_B2s", "B", 2, 4},
+	{"Standard_B2ms", "B", 2, 8},
+	{"Standard_B4ms", "B", 4, 16},
+	{"Standard_B8ms", "B", 8, 32},
+	{"Standard_B12ms", "B", 12, 48},
+	{"Standard_B16ms", "B", 16, 64},
+
+	{"Standard_D2s_v3", "Dsv3", 2, 8},
+	{"Standard_D4s_v3", "Dsv3", 4, 16},
+	{"Standard_D8s_v3", "Dsv3", 8, 32},
+	{"Standard_D16s_v3", "Dsv3", 16, 64},
+	{"Standard_D32s_v3", "Dsv3", 32, 128},
+	{"Standard_D64s_v3", "Dsv3", 64, 256},
+
+	{"Standard_D2s_v4", "Dsv4", 2, 8},
+	{"Standard_D4s_v4", "Dsv4", 4, 16},
+	{"Standard_D8s_v4", "Dsv4", 8, 32},
+	{"Standard_D16s_v4", "Dsv4", 16, 64},
+	{"Standard_D32s_v4", "Dsv4", 32, 128},
+
+	{"Standard_D2s_v5", "Dsv5", 2, 8},
+	{"Standard_D4s_v5", "Dsv5", 4, 16},
+	{"Standard_D8s_v5", "Dsv5", 8, 32},
+	{"Standard_D16s_v5", "Dsv5", 16, 64},
+	{"Standard_D32s_v5", "Dsv5", 32, 128},
+	{"Standard_D64s_v5", "Dsv5", 64, 256},
+
+	{"Standard_D2as_v5", "Dasv5", 2, 8},
+	{"Standard_D4as_v5", "Dasv5", 4, 16},
+	{"Standard_D8as_v5", "Dasv5", 8, 32},
+	{"Standard_D16as_v5", "Dasv5", 16, 64},
+	{"Standard_D32as_v5", "Dasv5", 32, 128},
+
+	{"Standard_E2s_v3", "Esv3", 2, 16},
+	{"Standard_E4s_v3", "Esv3", 4, 32},
+	{"Standard_E8s_v3", "Esv3", 8, 64},
+	{"Standard_E16s_v3", "Esv3", 16, 128},
+	{"Standard_E32s_v3", "Esv3", 32, 256},
+
+	{"Standard_E2s_v5", "Esv5", 2, 16},
+	{"Standard_E4s_v5", "Esv5", 4, 32},
+	{"Standard_E8s_v5", "Esv5", 8, 64},
+	{"Standard_E16s_v5", "Esv5", 16, 128},
+	{"Standard_E32s_v5", "Esv5", 32, 256},
+
+	{"Standard_F2s_v2", "Fsv2", 2, 4},
+	{"Standard_F4s_v2", "Fsv2", 4, 8},
+	{"Standard_F8s_v2", "Fsv2", 8, 16},
+	{"Standard_F16s_v2", "Fsv2", 16, 32},
+	{"Standard_F32s_v2", "Fsv2", 32, 64},
+}
+
+// LookupVMSize returns the capacity of a VM size
+func LookupVMSize(name string) (VMSize, bool) {
+	for _, size := range vmSizes {
+		if strings.EqualFold(size.Name, name) {
+			return size, true
+		}
+	}
+	return VMSize{}, false
+}
+
+// SmallerVMSizes returns the sizes of the same series with fewer vCPUs or
+// less memory than a size, smallest first
+func SmallerVMSizes(name string) []VMSize {
+	current, ok := LookupVMSize(name)
+	if !ok {
+		return nil
+	}
+
+	var smaller []VMSize
+	for _, size := range vmSizes {
+		if size.Series == current.Series && size.Name != current.Name &&
+			size.VCPUs <= current.VCPUs && size.MemoryGB <= current.MemoryGB {
+			smaller = append(smaller, size)
+		}
+	}
+	sort.SliceStable(smaller, func(i, j int) bool {
+		if smaller[i].VCPUs != smaller[j].VCPUs {
+			return smaller[i].VCPUs < smaller[j].VCPUs
+		}
+		return smaller[i].MemoryGB < smaller[j].MemoryGB
+	})
+	return smaller
+}
+
+// VMMonthly returns the monthly pay-as-you-go price of a VM size in a
+// region, and false if the catalog has no price for it
+func (c *Catalog) VMMonthly(size, region string, windows bool) (float64, bool) {
+	e := Estimate{Region: strings.ToLower(region), SKU: size}
+	c.price(&e, "Virtual Machines", vmMatch(size, windows))
+	return e.Monthly, e.Priced
+}
+
+// vmMatch matches the meter of a VM size and operating system
+func vmMatch(size string, windows bool) func(Price) bool {
+	return func(p Price) bool {
+		return strings.EqualFold(p.ArmSkuName, size) &&
+			strings.Contains(strings.ToLower(p.ProductName), "windows") == windows
+	}
+}
@@ -0,0 +1,69 @@
+package reach
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/nsg"
+)
+
+// firewallDecision evaluates the classic network rule collections of an
+// Azure Firewall. Collections are processed by priority and the first
+// matching rule decides; with no match the firewall denies. decided is
+// false when the rules live in a firewall policy that is not scanned.
+func firewallDecision(fw models.AzureFirewall, protocol string, port int, src, dst netip.Addr) (collection models.FirewallRuleCollection, rule models.FirewallRule, allowed, decided bool) {
+	var collections []models.FirewallRuleCollection
+	for _, c := range fw.Rules {
+		if c.Type == "Network" {
+			collections = append(collections, c)
+		}
+	}
+	if len(collections) == 0 && fw.FirewallPolicyID != "" {
+		return collection, rule, false, false
+	}
+
+	sort.SliceStable(collections, func(i, j int) bool {
+		return collections[i].Priority < collections[j].Priority
+	})
+	for _, c := range collections {
+		for _, r := range c.Rules {
+			if firewallRuleMatches(r, protocol, port, src, dst) {
+				return c, r, strings.EqualFold(c.Action, "Allow"), true
+			}
+		}
+	}
+	return collection, rule, false, true
+}
+
+// firewallRuleMatches reports whether a network rule matches a flow.
+// Addresses other than IPs and prefixes, such as IP groups or service
+// tags, never match.
+func firewallRuleMatches(r models.FirewallRule, protocol string, port int, src, dst netip.Addr) bool {
+	protocolMatch := false
+	for _, p := range r.Protocols {
+		if strings.EqualFold(p, "Any") || strings.EqualFold(p, protocol) {
+			protocolMatch = true
+		}
+	}
+	if !protocolMatch || !addressMatches(r.SourceAddresses, src) || !addressMatches(r.DestAddresses, dst) {
+		return false
+	}
+	if protocol != "TCP" && protocol != "UDP" {
+		return true
+	}
+	ports, err := nsg.ParsePorts(r.DestPorts)
+	return err == nil && ports.Contains(port)
+}
+
+// addressMatches reports whether ip is in any of the addresses
+func addressMatches(addresses []string, ip netip.Addr) bool {
+	host := nsg.ParseAddress(ip.String())
+	for _, s := range addresses {
+		if nsg.ParseAddress(s).Contains(host) {
+			return true
+		}
+	}
+	return false
+}
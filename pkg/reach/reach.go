@@ -0,0 +1,569 @@
+// Package reach answers "can A reach B on port P?" from scanned data by
+// walking the path a packet takes: source NSGs, the effective route of each
+// subnet on the way, VNet peerings, firewalls and NVAs, gateways and the
+// destination NSGs.
+package reach
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/nsg"
+)
+
+// Hop verdicts
+const (
+	Pass    = "Pass"
+	Block   = "Block"
+	Unknown = "Unknown" // the scanned data cannot decide this hop
+)
+
+// Query verdicts
+const (
+	Reachable    = "Reachable"
+	Unreachable  = "Unreachable"
+	Undetermined = "Undetermined"
+)
+
+// maxHops bounds the number of appliances a path may traverse
+const maxHops = 8
+
+// Query asks whether traffic from one endpoint reaches another. From and
+// To are resource names, resource IDs or IP addresses.
+type Query struct {
+	From     string
+	To       string
+	Protocol string // TCP, UDP or ICMP; empty means TCP
+	Port     int    // destination port, required for TCP and UDP
+}
+
+// Hop is one step of the evaluated path
+type Hop struct {
+	Step     string `json:"step"`     // e.g. Source NSG, Route, Peering, Firewall
+	Resource string `json:"resource"` // the NSG, subnet, peering or appliance evaluated
+	Verdict  string `json:"verdict"`
+	Detail   string `json:"detail"` // the rule or route that decided the hop
+}
+
+// Result is the answer to a query
+type Result struct {
+	Source      Endpoint `json:"source"`
+	Destination Endpoint `json:"destination"`
+	Protocol    string   `json:"protocol"`
+	Port        int      `json:"port,omitempty"`
+	Hops        []Hop    `json:"hops"`
+	Verdict     string   `json:"verdict"`
+	Reason      string   `json:"reason"`
+}
+
+// Flow describes the queried traffic, e.g. "TCP 1433" or "ICMP"
+func (r *Result) Flow() string {
+	if r.Protocol == "TCP" || r.Protocol == "UDP" {
+		return fmt.Sprintf("%s %d", r.Protocol, r.Port)
+	}
+	return r.Protocol
+}
+
+// Evaluate answers a reachability query against an inventory
+func Evaluate(inv *models.Inventory, q Query) (*Result, error) {
+	protocol, err := parseProtocol(q.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == "TCP" || protocol == "UDP" {
+		if q.Port < 1 || q.Port > 65535 {
+			return nil, fmt.Errorf("a port between 1 and 65535 is required for %s", protocol)
+		}
+	} else {
+		q.Port = 0
+	}
+
+	net := newNetwork(inv)
+	src, err := net.resolve(q.From)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve source: %w", err)
+	}
+	dst, err := net.resolve(q.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve destination: %w", err)
+	}
+	if !src.InVNet() && !dst.InVNet() {
+		return nil, fmt.Errorf("neither %s nor %s is in a scanned virtual network", src, dst)
+	}
+
+	w := newWalker(net, src, dst, protocol, q.Port)
+	w.run()
+	return w.result, nil
+}
+
+// walker follows a flow through the network and records each hop
+type walker struct {
+	net      *network
+	protocol string
+	port     int
+	src, dst Endpoint
+	target   netip.Addr // the address packets are routed to
+
+	// NSG endpoints as seen on the source side and the destination side;
+	// they differ when the destination is addressed by its public IP
+	outSrc, outDst nsg.Endpoint
+	inSrc, inDst   nsg.Endpoint
+
+	result  *Result
+	unknown bool
+}
+
+func newWalker(net *network, src, dst Endpoint, protocol string, port int) *walker {
+	w := &walker{
+		net:      net,
+		protocol: protocol,
+		port:     port,
+		src:      src,
+		dst:      dst,
+		target:   dst.IP,
+		result:   &Result{Source: src, Destination: dst, Protocol: protocol, Port: port},
+	}
+
+	w.outSrc = nsgEndpoint(src)
+	w.outDst = nsgEndpoint(dst)
+	w.inSrc = w.outSrc
+	w.inDst = w.outDst
+	if dst.PublicIP != "" {
+		w.target = parseAddr(dst.PublicIP)
+		w.outDst = internetEndpoint(w.target)
+		// Traffic arriving at a public IP comes from the Internet after
+		// the source side's SNAT
+		if src.InVNet() {
+			w.inSrc = nsg.Internet()
+		}
+	}
+	return w
+}
+
+// nsgEndpoint returns the addresses NSG rules may match an endpoint with
+func nsgEndpoint(e Endpoint) nsg.Endpoint {
+	if e.Kind == KindInternet {
+		return internetEndpoint(e.IP)
+	}
+	return nsg.Host(e.IP.String(), e.ASGs)
+}
+
+// internetEndpoint is a public address matched by the Internet tag and by
+// prefixes containing it
+func internetEndpoint(ip netip.Addr) nsg.Endpoint {
+	return append(nsg.Internet(), nsg.ParseAddress(ip.String()))
+}
+
+// hop records a step and reports whether the flow continues past it
+func (w *walker) hop(step, resource, verdict, detail string) bool {
+	w.result.Hops = append(w.result.Hops, Hop{Step: step, Resource: resource, Verdict: verdict, Detail: detail})
+	switch verdict {
+	case Block:
+		w.finish(Unreachable, detail)
+		return false
+	case Unknown:
+		w.unknown = true
+	}
+	return true
+}
+
+// finish sets the query verdict once
+func (w *walker) finish(verdict, reason string) {
+	if w.result.Verdict == "" {
+		w.result.Verdict = verdict
+		w.result.Reason = reason
+	}
+}
+
+// stop ends the walk as undetermined
+func (w *walker) stop(step, resource, detail string) {
+	w.hop(step, resource, Unknown, detail)
+	w.finish(Undetermined, detail)
+}
+
+func (w *walker) run() {
+	switch {
+	case w.src.InVNet():
+		if w.sourceNSGs() {
+			w.route(w.net.subnets[strings.ToLower(w.src.SubnetID)])
+		}
+	case w.src.Kind == KindOnPremises:
+		w.fromOnPremises()
+	default:
+		w.fromInternet()
+	}
+}
+
+// sourceNSGs checks outbound rules: the NIC NSG first, then the subnet NSG
+func (w *walker) sourceNSGs() bool {
+	return w.checkNSG("Source NSG", w.src.NICNSG, "NIC", nsg.Outbound, w.outSrc, w.outDst) &&
+		(!w.nsgApplies(w.src) || w.checkNSG("Source NSG", w.src.SubnetNSG, "subnet", nsg.Outbound, w.outSrc, w.outDst))
+}
+
+// destinationNSGs checks inbound rules: the subnet NSG first, then the NIC NSG
+func (w *walker) destinationNSGs() bool {
+	if !w.nsgApplies(w.dst) {
+		return w.hop("Destination NSG", w.dst.SubnetName, Pass,
+			fmt.Sprintf("NSGs do not apply to private endpoints: network policies are disabled on subnet %s", w.dst.SubnetName))
+	}
+	return w.checkNSG("Destination NSG", w.dst.SubnetNSG, "subnet", nsg.Inbound, w.inSrc, w.inDst) &&
+		w.checkNSG("Destination NSG", w.dst.NICNSG, "NIC", nsg.Inbound, w.inSrc, w.inDst)
+}
+
+// nsgApplies reports whether the subnet NSG is enforced for an endpoint.
+// Private endpoints ignore it unless network policies are enabled.
+func (w *walker) nsgApplies(e Endpoint) bool {
+	if e.Kind != KindPrivateEndpoint || e.SubnetNSG == "" {
+		return true
+	}
+	info, ok := w.net.subnets[strings.ToLower(e.SubnetID)]
+	if !ok {
+		return true
+	}
+	policies := info.subnet.PrivateEndpointNetworkPolicies
+	return strings.EqualFold(policies, "Enabled") || strings.EqualFold(policies, "NetworkSecurityGroupEnabled")
+}
+
+// checkNSG evaluates one NSG and records the deciding rule. A missing NSG
+// allows everything and adds no hop.
+func (w *walker) checkNSG(step, id, scope, direction string, source, destination nsg.Endpoint) bool {
+	group := w.net.nsg(id)
+	if group == nil {
+		if id != "" {
+			return w.hop(step, ResourceName(id), Unknown, "NSG is not in the scanned data")
+		}
+		return true
+	}
+
+	resource := fmt.Sprintf("%s (%s, %s)", group.Name, scope, strings.ToLower(direction))
+	rule, ok := group.Decide(direction, w.protocol, w.port, source, destination)
+	if !ok {
+		return w.hop(step, resource, Block, "no rule matches the traffic")
+	}
+
+	kind := "rule"
+	if rule.Default {
+		kind = "default rule"
+	}
+	if rule.Access == nsg.Allow {
+		return w.hop(step, resource, Pass, fmt.Sprintf("allowed by %s '%s' (priority %d)", kind, rule.Name, rule.Priority))
+	}
+	return w.hop(step, resource, Block, fmt.Sprintf("denied by %s '%s' (priority %d) in %s", kind, rule.Name, rule.Priority, group.Name))
+}
+
+// route follows effective routes from a subnet until the flow is delivered,
+// dropped or leaves the scanned network
+func (w *walker) route(info subnetInfo) {
+	visited := make(map[string]bool)
+
+	for i := 0; i < maxHops; i++ {
+		resource := info.vnet.Name + "/" + info.subnet.Name
+		gateway, _ := w.net.gateway(info.vnet)
+		r, ok := w.net.lookup(info, w.target, gateway != nil)
+		if !ok {
+			w.hop("Route", resource, Block, fmt.Sprintf("no route to %s", w.target))
+			return
+		}
+
+		switch canonicalNextHop(r.NextHopType) {
+		case NextHopNone:
+			w.hop("Route", resource, Block, "dropped by "+r.String())
+			return
+		case NextHopVnetLocal:
+			w.hop("Route", resource, Pass, r.String())
+			w.deliver(info.vnet)
+			return
+		case NextHopVNetPeering:
+			w.hop("Route", resource, Pass, r.String())
+			if w.peering(info.vnet, r.RemoteVNet) {
+				w.deliver(w.net.vnet(r.RemoteVNet))
+			}
+			return
+		case NextHopInternet:
+			w.hop("Route", resource, Pass, r.String())
+			w.toInternet()
+			return
+		case NextHopVirtualNetworkGateway:
+			w.hop("Route", resource, Pass, r.String())
+			w.toGateway(info.vnet)
+			return
+		case NextHopVirtualAppliance:
+			w.hop("Route", resource, Pass, r.String())
+			next, ok := w.appliance(info.vnet, r.NextHopIP, visited)
+			if !ok {
+				return
+			}
+			info = next
+		default:
+			w.stop("Route", resource, fmt.Sprintf("next hop type %q is not supported: %s", r.NextHopType, r))
+			return
+		}
+	}
+
+	w.hop("Route", "", Block, fmt.Sprintf("more than %d appliances on the path", maxHops))
+}
+
+// deliver completes a flow that arrived in the destination's VNet
+func (w *walker) deliver(vnet *models.VNet) {
+	if vnet == nil {
+		w.stop("Destination", w.dst.String(), "the peered VNet is not in the scanned data")
+		return
+	}
+	if !strings.EqualFold(vnet.ID, w.dst.VNetID) {
+		w.hop("Destination", vnet.Name, Block, fmt.Sprintf("%s is not in %s", w.target, vnet.Name))
+		return
+	}
+	if w.destinationNSGs() {
+		w.reached()
+	}
+}
+
+// reached marks the flow as delivered
+func (w *walker) reached() {
+	if w.unknown {
+		w.finish(Undetermined, "the path is open as far as the scanned data shows, but some hops could not be evaluated")
+		return
+	}
+	reason := fmt.Sprintf("%s reaches %s on %s", w.src.Name, w.dst.Name, w.result.Flow())
+	if w.dst.Kind == KindAddress {
+		reason += "; no scanned resource uses the destination address"
+	}
+	w.finish(Reachable, reason)
+}
+
+// peering checks the peering between two VNets in both directions
+func (w *walker) peering(from *models.VNet, toID string) bool {
+	resource := from.Name + " → " + ResourceName(toID)
+	local := Peering(from, toID)
+	if local == nil {
+		return w.hop("Peering", resource, Block, fmt.Sprintf("%s has no peering to %s", from.Name, ResourceName(toID)))
+	}
+	if !strings.EqualFold(local.PeeringState, "Connected") {
+		return w.hop("Peering", resource, Block, fmt.Sprintf("peering '%s' is %s, not Connected", local.Name, local.PeeringState))
+	}
+	if !local.AllowVNetAccess {
+		return w.hop("Peering", resource, Block, fmt.Sprintf("peering '%s' does not allow virtual network access", local.Name))
+	}
+
+	remote := w.net.vnet(toID)
+	if remote == nil {
+		return w.hop("Peering", resource, Unknown, fmt.Sprintf("peering '%s' is connected; %s is not in the scanned data, so its side is not checked", local.Name, ResourceName(toID)))
+	}
+	back := Peering(remote, from.ID)
+	if back == nil {
+		return w.hop("Peering", resource, Block, fmt.Sprintf("%s has no peering back to %s", remote.Name, from.Name))
+	}
+	if !back.AllowVNetAccess {
+		return w.hop("Peering", resource, Block, fmt.Sprintf("peering '%s' on %s does not allow virtual network access", back.Name, remote.Name))
+	}
+
+	// Traffic whose source is outside the sending VNet was forwarded by an
+	// appliance or gateway and needs AllowForwardedTraffic on the receiving
+	// side, except on-premises traffic using gateway transit
+	detail := fmt.Sprintf("peerings '%s' and '%s' are connected", local.Name, back.Name)
+	if !inAddressSpace(w.src.IP, from.AddressSpaces) {
+		transit := w.src.Kind == KindOnPremises && local.AllowGatewayTransit && back.UseRemoteGateways
+		switch {
+		case transit:
+			detail += "; on-premises traffic uses gateway transit"
+		case back.AllowForwardedTraffic:
+			detail += fmt.Sprintf("; '%s' allows forwarded traffic", back.Name)
+		case w.src.Kind == KindOnPremises:
+			return w.hop("Peering", resource, Block, fmt.Sprintf("on-premises traffic needs gateway transit ('%s' with UseRemoteGateways) or AllowForwardedTraffic on '%s'", back.Name, back.Name))
+		default:
+			return w.hop("Peering", resource, Block, fmt.Sprintf("peering '%s' on %s does not allow forwarded traffic (AllowForwardedTraffic is off)", back.Name, remote.Name))
+		}
+	}
+	return w.hop("Peering", resource, Pass, detail)
+}
+
+// appliance passes the flow through a firewall or NVA and returns the
+// subnet it continues from
+func (w *walker) appliance(vnet *models.VNet, ip string, visited map[string]bool) (subnetInfo, bool) {
+	if visited[ip] {
+		w.hop("Appliance", ip, Block, fmt.Sprintf("routing loop: traffic returns to %s", ip))
+		return subnetInfo{}, false
+	}
+	visited[ip] = true
+
+	endpoint, err := w.net.resolveIP(parseAddr(ip))
+	if err != nil || (endpoint.Kind != KindFirewall && endpoint.Kind != KindNIC) {
+		w.stop("Appliance", ip, fmt.Sprintf("next hop %s is not a firewall or NIC in the scanned data", ip))
+		return subnetInfo{}, false
+	}
+	info, ok := w.net.subnets[strings.ToLower(endpoint.SubnetID)]
+	if !ok {
+		w.stop("Appliance", endpoint.Name, fmt.Sprintf("the subnet of %s is not in the scanned data", endpoint.Name))
+		return subnetInfo{}, false
+	}
+	if !strings.EqualFold(info.vnet.ID, vnet.ID) && !w.peering(vnet, info.vnet.ID) {
+		return subnetInfo{}, false
+	}
+
+	if endpoint.Kind == KindFirewall {
+		return info, w.firewall(endpoint)
+	}
+
+	if !endpoint.IPForwarding {
+		w.hop("Appliance", endpoint.Name, Block, fmt.Sprintf("IP forwarding is disabled on the NIC of %s, so it drops traffic for other addresses", endpoint.Name))
+		return subnetInfo{}, false
+	}
+	nva := w.checkNSG("Appliance NSG", endpoint.SubnetNSG, "subnet", nsg.Inbound, w.outSrc, w.outDst) &&
+		w.checkNSG("Appliance NSG", endpoint.NICNSG, "NIC", nsg.Inbound, w.outSrc, w.outDst) &&
+		w.checkNSG("Appliance NSG", endpoint.NICNSG, "NIC", nsg.Outbound, w.outSrc, w.outDst) &&
+		w.checkNSG("Appliance NSG", endpoint.SubnetNSG, "subnet", nsg.Outbound, w.outSrc, w.outDst)
+	if !nva {
+		return subnetInfo{}, false
+	}
+	w.hop("Appliance", endpoint.Name, Unknown, fmt.Sprintf("NVA at %s forwards traffic; its own rules are not evaluated", endpoint.IP))
+	return info, true
+}
+
+// firewall evaluates an Azure Firewall on the path
+func (w *walker) firewall(endpoint Endpoint) bool {
+	var fw models.AzureFirewall
+	for _, candidate := range w.net.inv.Firewalls {
+		if strings.EqualFold(candidate.ID, endpoint.ID) {
+			fw = candidate
+		}
+	}
+
+	collection, rule, allowed, decided := firewallDecision(fw, w.protocol, w.port, w.src.IP, w.target)
+	switch {
+	case !decided:
+		return w.hop("Firewall", fw.Name, Unknown, fmt.Sprintf("rules are in firewall policy %s, which is not evaluated", ResourceName(fw.FirewallPolicyID)))
+	case allowed:
+		return w.hop("Firewall", fw.Name, Pass, fmt.Sprintf("allowed by network rule '%s' in collection '%s' (priority %d)", rule.Name, collection.Name, collection.Priority))
+	case rule.Name != "":
+		return w.hop("Firewall", fw.Name, Block, fmt.Sprintf("denied by network rule '%s' in collection '%s' (priority %d)", rule.Name, collection.Name, collection.Priority))
+	}
+	return w.hop("Firewall", fw.Name, Block, "no network rule allows the traffic and Azure Firewall denies by default")
+}
+
+// toInternet follows a flow leaving Azure for a public address
+func (w *walker) toInternet() {
+	switch {
+	case w.dst.Kind == KindInternet:
+		if w.hop("Internet", w.target.String(), Pass, "traffic leaves Azure for the Internet") {
+			w.reached()
+		}
+	case w.dst.PublicIP != "":
+		if w.hop("Internet", w.dst.PublicIP, Pass, fmt.Sprintf("traffic leaves Azure and returns to public IP %s of %s", w.dst.PublicIP, w.dst.Name)) &&
+			w.publicIPOpen() && w.destinationNSGs() {
+			w.reached()
+		}
+	default:
+		w.hop("Internet", w.target.String(), Block, fmt.Sprintf("private address %s is not reachable over the Internet", w.target))
+	}
+}
+
+// toGateway follows a flow into a virtual network gateway
+func (w *walker) toGateway(vnet *models.VNet) {
+	gateway, gatewayVNet := w.net.gateway(vnet)
+	if gateway == nil {
+		w.hop("Gateway", vnet.Name, Block, fmt.Sprintf("no virtual network gateway in %s or in a peered VNet used through UseRemoteGateways", vnet.Name))
+		return
+	}
+	if !w.gatewayTransit(vnet, gateway, gatewayVNet) {
+		return
+	}
+	if w.dst.Kind != KindOnPremises {
+		w.stop("Gateway", gateway.Name, fmt.Sprintf("traffic to %s leaves through gateway %s; the path beyond it is not evaluated", w.target, gateway.Name))
+		return
+	}
+	if w.hop("Gateway", gateway.Name, Pass, fmt.Sprintf("traffic leaves to on-premises through %s; routing and firewalls beyond the gateway are not evaluated", gateway.Name)) {
+		w.reached()
+	}
+}
+
+// gatewayTransit checks that vnet may use a gateway deployed in another VNet
+func (w *walker) gatewayTransit(vnet *models.VNet, gateway *models.Gateway, gatewayVNet *models.VNet) bool {
+	if gatewayVNet == nil || strings.EqualFold(gatewayVNet.ID, vnet.ID) {
+		return true
+	}
+	resource := vnet.Name + " → " + gatewayVNet.Name
+	local := Peering(vnet, gatewayVNet.ID)
+	back := Peering(gatewayVNet, vnet.ID)
+	switch {
+	case local == nil || !strings.EqualFold(local.PeeringState, "Connected"):
+		return w.hop("Peering", resource, Block, fmt.Sprintf("the peering from %s to %s is not connected", vnet.Name, gatewayVNet.Name))
+	case back == nil || !back.AllowGatewayTransit:
+		return w.hop("Peering", resource, Block, fmt.Sprintf("%s does not allow gateway transit to %s, so %s cannot use %s", gatewayVNet.Name, vnet.Name, vnet.Name, gateway.Name))
+	}
+	return w.hop("Peering", resource, Pass, fmt.Sprintf("'%s' uses remote gateways and '%s' allows gateway transit", local.Name, back.Name))
+}
+
+// fromOnPremises follows a flow entering Azure through a gateway
+func (w *walker) fromOnPremises() {
+	dstVNet := w.net.vnet(w.dst.VNetID)
+	gateway, gatewayVNet := w.net.gateway(dstVNet)
+	if gateway == nil {
+		w.hop("Gateway", dstVNet.Name, Block, fmt.Sprintf("no virtual network gateway connects %s to on-premises networks", dstVNet.Name))
+		return
+	}
+	if !w.hop("Gateway", gateway.Name, Pass, fmt.Sprintf("traffic from %s enters Azure through %s in %s", w.src.IP, gateway.Name, gatewayVNet.Name)) {
+		return
+	}
+
+	// Traffic from the gateway follows the GatewaySubnet's routes
+	info, ok := w.net.subnets[strings.ToLower(gateway.SubnetID)]
+	if !ok {
+		if w.gatewayTransit(dstVNet, gateway, gatewayVNet) {
+			w.deliver(dstVNet)
+		}
+		return
+	}
+	w.route(info)
+}
+
+// fromInternet follows a flow from the Internet to a public IP
+func (w *walker) fromInternet() {
+	if w.dst.PublicIP == "" {
+		w.hop("Internet", w.dst.Name, Block, fmt.Sprintf("%s has no public IP on this address; address it by its public IP or public IP resource", w.dst.Name))
+		return
+	}
+	w.inSrc = w.outSrc
+	if w.hop("Internet", w.dst.PublicIP, Pass, fmt.Sprintf("traffic enters Azure at public IP %s of %s", w.dst.PublicIP, w.dst.Name)) &&
+		w.publicIPOpen() && w.destinationNSGs() {
+		w.reached()
+	}
+}
+
+// publicIPOpen checks that a Standard public IP has an NSG allowing inbound
+// traffic; without one Azure denies it
+func (w *walker) publicIPOpen() bool {
+	if w.dst.SubnetNSG != "" || w.dst.NICNSG != "" {
+		return true
+	}
+	for _, pip := range w.net.inv.PublicIPs {
+		if pip.IPAddress == w.dst.PublicIP && strings.EqualFold(pip.SKU, "Standard") {
+			return w.hop("Public IP", pip.Name, Block, "Standard public IPs deny inbound traffic unless an NSG allows it, and no NSG is associated")
+		}
+	}
+	return true
+}
+
+// parseProtocol canonicalizes a protocol name
+func parseProtocol(protocol string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(protocol)) {
+	case "", "TCP":
+		return "TCP", nil
+	case "UDP":
+		return "UDP", nil
+	case "ICMP":
+		return "ICMP", nil
+	}
+	return "", fmt.Errorf("unsupported protocol %q (use tcp, udp or icmp)", protocol)
+}
+
+// canonicalNextHop returns the next hop type with Azure's casing
+func canonicalNextHop(hop string) string {
+	for _, known := range []string{NextHopVnetLocal, NextHopVNetPeering, NextHopVirtualNetworkGateway, NextHopVirtualAppliance, NextHopInternet, NextHopNone} {
+		if strings.EqualFold(hop, known) {
+			return known
+		}
+	}
+	return hop
+}
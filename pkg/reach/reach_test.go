@@ -0,0 +1,442 @@
+package reach
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+const providers = "/subscriptions/sub1/resourceGroups/rg-net/providers/Microsoft.Network"
+
+// resourceID returns the ID of a network resource in the test subscription
+func resourceID(kind, name string) string {
+	return providers + "/" + kind + "/" + name
+}
+
+func subnetID(vnet, subnet string) string {
+	return resourceID("virtualNetworks", vnet) + "/subnets/" + subnet
+}
+
+// peer returns a connected peering with virtual network access
+func peer(from, to string, remoteSpace string) models.VNetPeering {
+	return models.VNetPeering{
+		ID:                  resourceID("virtualNetworks", from) + "/virtualNetworkPeerings/" + from + "-to-" + to,
+		Name:                from + "-to-" + to,
+		RemoteVNetID:        resourceID("virtualNetworks", to),
+		RemoteVNetName:      to,
+		AllowVNetAccess:     true,
+		PeeringState:        "Connected",
+		RemoteAddressSpaces: []string{remoteSpace},
+	}
+}
+
+func nic(name, vnet, subnet, ip string) models.NetworkInterface {
+	return models.NetworkInterface{
+		ID:   resourceID("networkInterfaces", name+"-nic"),
+		Name: name + "-nic",
+		IPConfigurations: []models.IPConfiguration{
+			{Name: "ipconfig1", PrivateIP: ip, SubnetID: subnetID(vnet, subnet), Primary: true},
+		},
+		AttachedTo: &models.AttachedResource{
+			Type: "VM",
+			ID:   "/subscriptions/sub1/resourceGroups/rg-app/providers/Microsoft.Compute/virtualMachines/" + name,
+			Name: name,
+		},
+	}
+}
+
+// hubAndSpokes returns a hub with a firewall, an NVA and a VPN gateway,
+// peered with two spokes:
+//
+//	vnet-hub     10.0.0.0/16  GatewaySubnet, AzureFirewallSubnet (fw-hub 10.0.1.4), snet-nva (nva 10.0.2.4)
+//	vnet-spoke1  10.1.0.0/16  snet-app (vm-app 10.1.1.4, vm-app2 10.1.1.5; nsg-app), snet-web (vm-web 10.1.2.4, no NSG)
+//	vnet-spoke2  10.2.0.0/16  snet-db (vm-db 10.2.1.4; nsg-db)
+//
+// Spoke-to-spoke traffic is routed to the firewall by rt-spoke1 and
+// rt-spoke2; the spokes use the hub's gateway and forwarded traffic is
+// allowed on the spoke side of every peering.
+func hubAndSpokes() *models.Inventory {
+	hubToSpoke1 := peer("vnet-hub", "vnet-spoke1", "10.1.0.0/16")
+	hubToSpoke1.AllowGatewayTransit = true
+	hubToSpoke2 := peer("vnet-hub", "vnet-spoke2", "10.2.0.0/16")
+	hubToSpoke2.AllowGatewayTransit = true
+	spoke1ToHub := peer("vnet-spoke1", "vnet-hub", "10.0.0.0/16")
+	spoke1ToHub.AllowForwardedTraffic = true
+	spoke1ToHub.UseRemoteGateways = true
+	spoke2ToHub := peer("vnet-spoke2", "vnet-hub", "10.0.0.0/16")
+	spoke2ToHub.AllowForwardedTraffic = true
+	spoke2ToHub.UseRemoteGateways = true
+
+	nva := nic("nva", "vnet-hub", "snet-nva", "10.0.2.4")
+	nva.EnableIPForwarding = true
+	web := nic("vm-web", "vnet-spoke1", "snet-web", "10.1.2.4")
+	web.IPConfigurations[0].PublicIPRef = resourceID("publicIPAddresses", "pip-web")
+
+	return &models.Inventory{
+		VNets: []models.VNet{
+			{
+				ID:            resourceID("virtualNetworks", "vnet-hub"),
+				Name:          "vnet-hub",
+				AddressSpaces: []string{"10.0.0.0/16"},
+				Subnets: []models.Subnet{
+					{ID: subnetID("vnet-hub", "GatewaySubnet"), Name: "GatewaySubnet", AddressPrefix: "10.0.0.0/27"},
+					{ID: subnetID("vnet-hub", "AzureFirewallSubnet"), Name: "AzureFirewallSubnet", AddressPrefix: "10.0.1.0/26"},
+					{ID: subnetID("vnet-hub", "snet-nva"), Name: "snet-nva", AddressPrefix: "10.0.2.0/24"},
+				},
+				Peerings: []models.VNetPeering{hubToSpoke1, hubToSpoke2},
+			},
+			{
+				ID:            resourceID("virtualNetworks", "vnet-spoke1"),
+				Name:          "vnet-spoke1",
+				AddressSpaces: []string{"10.1.0.0/16"},
+				Subnets: []models.Subnet{
+					{
+						ID:            subnetID("vnet-spoke1", "snet-app"),
+						Name:          "snet-app",
+						AddressPrefix: "10.1.1.0/24",
+						NSGRef:        resourceID("networkSecurityGroups", "nsg-app"),
+						RouteTableRef: resourceID("routeTables", "rt-spoke1"),
+					},
+					{ID: subnetID("vnet-spoke1", "snet-web"), Name: "snet-web", AddressPrefix: "10.1.2.0/24"},
+				},
+				Peerings: []models.VNetPeering{spoke1ToHub},
+			},
+			{
+				ID:            resourceID("virtualNetworks", "vnet-spoke2"),
+				Name:          "vnet-spoke2",
+				AddressSpaces: []string{"10.2.0.0/16"},
+				Subnets: []models.Subnet{
+					{
+						ID:            subnetID("vnet-spoke2", "snet-db"),
+						Name:          "snet-db",
+						AddressPrefix: "10.2.1.0/24",
+						NSGRef:        resourceID("networkSecurityGroups", "nsg-db"),
+						RouteTableRef: resourceID("routeTables", "rt-spoke2"),
+					},
+				},
+				Peerings: []models.VNetPeering{spoke2ToHub},
+			},
+		},
+		NICs: []models.NetworkInterface{
+			nic("vm-app", "vnet-spoke1", "snet-app", "10.1.1.4"),
+			nic("vm-app2", "vnet-spoke1", "snet-app", "10.1.1.5"),
+			web,
+			nic("vm-db", "vnet-spoke2", "snet-db", "10.2.1.4"),
+			nva,
+		},
+		PublicIPs: []models.PublicIP{
+			{ID: resourceID("publicIPAddresses", "pip-web"), Name: "pip-web", IPAddress: "20.1.1.10", SKU: "Standard"},
+		},
+		NSGs: []models.NSG{
+			{
+				ID:   resourceID("networkSecurityGroups", "nsg-app"),
+				Name: "nsg-app",
+				Rules: []models.NSGRule{
+					{
+						Name: "deny-ssh", Priority: 100, Direction: "Inbound", Access: "Deny", Protocol: "Tcp",
+						SourceAddressPrefixes: []string{"*"}, SourcePortRanges: []string{"*"},
+						DestAddressPrefixes: []string{"*"}, DestPortRanges: []string{"22"},
+					},
+					{
+						Name: "allow-https", Priority: 200, Direction: "Inbound", Access: "Allow", Protocol: "Tcp",
+						SourceAddressPrefixes: []string{"VirtualNetwork"}, SourcePortRanges: []string{"*"},
+						DestAddressPrefixes: []string{"*"}, DestPortRanges: []string{"443"},
+					},
+				},
+			},
+			{ID: resourceID("networkSecurityGroups", "nsg-db"), Name: "nsg-db"},
+		},
+		RouteTables: []models.RouteTable{
+			{
+				ID:     resourceID("routeTables", "rt-spoke1"),
+				Name:   "rt-spoke1",
+				Routes: []models.Route{{Name: "to-spoke2", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIPAddress: "10.0.1.4"}},
+			},
+			{
+				ID:     resourceID("routeTables", "rt-spoke2"),
+				Name:   "rt-spoke2",
+				Routes: []models.Route{{Name: "to-spoke1", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIPAddress: "10.0.1.4"}},
+			},
+		},
+		Gateways: []models.Gateway{
+			{
+				ID:       resourceID("virtualNetworkGateways", "vpngw-hub"),
+				Name:     "vpngw-hub",
+				Type:     "Vpn",
+				VNetID:   resourceID("virtualNetworks", "vnet-hub"),
+				SubnetID: subnetID("vnet-hub", "GatewaySubnet"),
+			},
+		},
+		Firewalls: []models.AzureFirewall{
+			{
+				ID:        resourceID("azureFirewalls", "fw-hub"),
+				Name:      "fw-hub",
+				VNetID:    resourceID("virtualNetworks", "vnet-hub"),
+				SubnetID:  subnetID("vnet-hub", "AzureFirewallSubnet"),
+				PrivateIP: "10.0.1.4",
+				Rules: []models.FirewallRuleCollection{
+					{
+						Name: "spokes", Priority: 100, Action: "Allow", Type: "Network",
+						Rules: []models.FirewallRule{
+							{Name: "app-to-sql", Protocols: []string{"TCP"}, SourceAddresses: []string{"10.1.0.0/16"}, DestAddresses: []string{"10.2.0.0/16"}, DestPorts: []string{"1433"}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// findPeering returns the peering from one VNet to another for modification
+func findPeering(t *testing.T, inv *models.Inventory, from, to string) *models.VNetPeering {
+	t.Helper()
+	for i := range inv.VNets {
+		if inv.VNets[i].Name != from {
+			continue
+		}
+		if p := Peering(&inv.VNets[i], resourceID("virtualNetworks", to)); p != nil {
+			return p
+		}
+	}
+	t.Fatalf("no peering from %s to %s", from, to)
+	return nil
+}
+
+// passes reports whether the path has a hop through resource that does not
+// block
+func passes(result *Result, resource string) bool {
+	for _, hop := range result.Hops {
+		if hop.Resource == resource && hop.Verdict != Block {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(t *testing.T, inv *models.Inventory)
+		from, to string
+		protocol string
+		port     int
+
+		verdict string
+		step    string // step of the last hop
+		detail  string // substring of the last hop's detail
+		via     string // resource of a hop the path must pass
+	}{
+		{
+			name: "NSG rule allows",
+			from: "vm-app", to: "vm-app2", port: 443,
+			verdict: Reachable, step: "Destination NSG", detail: "allowed by rule 'allow-https'",
+		},
+		{
+			name: "NSG rule denies",
+			from: "vm-app", to: "vm-app2", port: 22,
+			verdict: Unreachable, step: "Destination NSG", detail: "denied by rule 'deny-ssh' (priority 100)",
+		},
+		{
+			name: "NSG default rule allows VNet traffic",
+			from: "vm-app2", to: "vm-app", protocol: "UDP", port: 53,
+			verdict: Reachable, step: "Destination NSG", detail: "allowed by default rule 'AllowVnetInBound'",
+		},
+		{
+			name: "NSG denies outbound at the source",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				inv.NSGs[0].Rules = append(inv.NSGs[0].Rules, models.NSGRule{
+					Name: "deny-out", Priority: 100, Direction: "Outbound", Access: "Deny", Protocol: "*",
+					SourceAddressPrefixes: []string{"*"}, SourcePortRanges: []string{"*"},
+					DestAddressPrefixes: []string{"10.1.1.5"}, DestPortRanges: []string{"*"},
+				})
+			},
+			from: "vm-app", to: "vm-app2", port: 443,
+			verdict: Unreachable, step: "Source NSG", detail: "denied by rule 'deny-out'",
+		},
+		{
+			name: "UDR to firewall that allows",
+			from: "vm-app", to: "vm-db", port: 1433,
+			verdict: Reachable, step: "Destination NSG", via: "fw-hub",
+		},
+		{
+			name: "UDR to firewall that denies by default",
+			from: "vm-app", to: "vm-db", port: 22,
+			verdict: Unreachable, step: "Firewall", detail: "Azure Firewall denies by default",
+		},
+		{
+			name: "UDR to NVA",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				inv.RouteTables[0].Routes[0].NextHopIPAddress = "10.0.2.4"
+			},
+			from: "vm-app", to: "vm-db", port: 1433,
+			verdict: Undetermined, step: "Destination NSG", via: "nva",
+		},
+		{
+			name: "UDR to NVA without IP forwarding",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				inv.RouteTables[0].Routes[0].NextHopIPAddress = "10.0.2.4"
+				inv.NICs[4].EnableIPForwarding = false
+			},
+			from: "vm-app", to: "vm-db", port: 1433,
+			verdict: Unreachable, step: "Appliance", detail: "IP forwarding is disabled",
+		},
+		{
+			name: "UDR to a next hop that is not scanned",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				inv.RouteTables[0].Routes[0].NextHopIPAddress = "10.0.2.99"
+			},
+			from: "vm-app", to: "vm-db", port: 1433,
+			verdict: Undetermined, step: "Appliance", detail: "not a firewall or NIC",
+		},
+		{
+			name: "UDR with next hop None",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				inv.RouteTables[0].Routes[0].NextHopType = "None"
+			},
+			from: "vm-app", to: "vm-db", port: 1433,
+			verdict: Unreachable, step: "Route", detail: "dropped by UDR 'to-spoke2'",
+		},
+		{
+			name: "forwarded traffic not allowed by the receiving spoke",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				findPeering(t, inv, "vnet-spoke2", "vnet-hub").AllowForwardedTraffic = false
+			},
+			from: "vm-app", to: "vm-db", port: 1433,
+			verdict: Unreachable, step: "Peering", detail: "does not allow forwarded traffic",
+		},
+		{
+			name: "forwarded traffic flag is not needed for traffic from the hub",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				findPeering(t, inv, "vnet-spoke2", "vnet-hub").AllowForwardedTraffic = false
+			},
+			from: "nva", to: "vm-db", port: 1433,
+			verdict: Reachable, step: "Destination NSG",
+		},
+		{
+			name: "peering not connected",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				findPeering(t, inv, "vnet-spoke1", "vnet-hub").PeeringState = "Initiated"
+			},
+			from: "vm-app", to: "vm-db", port: 1433,
+			verdict: Unreachable, step: "Peering", detail: "is Initiated, not Connected",
+		},
+		{
+			name: "to on-premises through gateway transit",
+			from: "vm-app", to: "192.168.10.4", port: 443,
+			verdict: Reachable, step: "Gateway", via: "vnet-spoke1 → vnet-hub",
+		},
+		{
+			name: "to on-premises without UseRemoteGateways",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				findPeering(t, inv, "vnet-spoke1", "vnet-hub").UseRemoteGateways = false
+			},
+			from: "vm-app", to: "192.168.10.4", port: 443,
+			verdict: Unreachable, step: "Route", detail: "dropped by system route 192.168.0.0/16",
+		},
+		{
+			name: "to on-premises without AllowGatewayTransit on the hub",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				findPeering(t, inv, "vnet-hub", "vnet-spoke1").AllowGatewayTransit = false
+			},
+			from: "vm-app", to: "192.168.10.4", port: 443,
+			verdict: Unreachable, step: "Peering", detail: "does not allow gateway transit",
+		},
+		{
+			name: "from on-premises through gateway transit",
+			from: "192.168.10.4", to: "vm-app", port: 443,
+			verdict: Reachable, step: "Destination NSG", detail: "allowed by rule 'allow-https'", via: "vnet-hub → vnet-spoke1",
+		},
+		{
+			name: "from on-premises without UseRemoteGateways",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				findPeering(t, inv, "vnet-spoke1", "vnet-hub").UseRemoteGateways = false
+			},
+			from: "192.168.10.4", to: "vm-app", port: 443,
+			verdict: Unreachable, step: "Gateway", detail: "no virtual network gateway connects vnet-spoke1",
+		},
+		{
+			name: "Standard public IP without an NSG",
+			from: "203.0.113.7", to: "pip-web", port: 443,
+			verdict: Unreachable, step: "Public IP", detail: "Standard public IPs deny inbound traffic",
+		},
+		{
+			name: "Basic public IP without an NSG",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				inv.PublicIPs[0].SKU = "Basic"
+			},
+			from: "203.0.113.7", to: "pip-web", port: 443,
+			verdict: Reachable, step: "Internet",
+		},
+		{
+			name: "Standard public IP with an NSG that allows",
+			modify: func(t *testing.T, inv *models.Inventory) {
+				inv.NICs[2].NSGRef = resourceID("networkSecurityGroups", "nsg-web")
+				inv.NSGs = append(inv.NSGs, models.NSG{
+					ID:   resourceID("networkSecurityGroups", "nsg-web"),
+					Name: "nsg-web",
+					Rules: []models.NSGRule{{
+						Name: "allow-https-internet", Priority: 100, Direction: "Inbound", Access: "Allow", Protocol: "Tcp",
+						SourceAddressPrefixes: []string{"Internet"}, SourcePortRanges: []string{"*"},
+						DestAddressPrefixes: []string{"*"}, DestPortRanges: []string{"443"},
+					}},
+				})
+			},
+			from: "203.0.113.7", to: "20.1.1.10", port: 443,
+			verdict: Reachable, step: "Destination NSG", detail: "allowed by rule 'allow-https-internet'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := hubAndSpokes()
+			if tt.modify != nil {
+				tt.modify(t, inv)
+			}
+
+			result, err := Evaluate(inv, Query{From: tt.from, To: tt.to, Protocol: tt.protocol, Port: tt.port})
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if result.Verdict != tt.verdict {
+				t.Errorf("verdict = %s (%s), want %s", result.Verdict, result.Reason, tt.verdict)
+			}
+			if len(result.Hops) == 0 {
+				t.Fatal("no hops recorded")
+			}
+			last := result.Hops[len(result.Hops)-1]
+			if last.Step != tt.step || !strings.Contains(last.Detail, tt.detail) {
+				t.Errorf("last hop = %s: %s, want %s containing %q", last.Step, last.Detail, tt.step, tt.detail)
+			}
+			if tt.via != "" && !passes(result, tt.via) {
+				t.Errorf("path does not pass %s", tt.via)
+			}
+			if t.Failed() {
+				for _, hop := range result.Hops {
+					t.Logf("%s %s %s: %s", hop.Step, hop.Resource, hop.Verdict, hop.Detail)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateRejectsInvalidQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+	}{
+		{"missing port", Query{From: "vm-app", To: "vm-db"}},
+		{"unsupported protocol", Query{From: "vm-app", To: "vm-db", Protocol: "GRE", Port: 1}},
+		{"unknown source", Query{From: "vm-missing", To: "vm-db", Port: 443}},
+		{"address space without subnet", Query{From: "vm-app", To: "10.2.200.1", Port: 443}},
+		{"neither side in a VNet", Query{From: "203.0.113.7", To: "192.168.10.4", Port: 443}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Evaluate(hubAndSpokes(), tt.query); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
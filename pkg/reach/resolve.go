@@ -0,0 +1,377 @@
+package reach
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/nsg"
+)
+
+// Endpoint kinds
+const (
+	KindNIC             = "NIC"
+	KindPrivateEndpoint = "PrivateEndpoint"
+	KindFirewall        = "Firewall"
+	KindAddress         = "Address"    // an IP in a scanned subnet with no known owner
+	KindOnPremises      = "OnPremises" // a private IP outside the scanned VNets
+	KindInternet        = "Internet"
+)
+
+// Endpoint is a resolved source or destination of a query
+type Endpoint struct {
+	Kind       string     `json:"kind"`
+	Name       string     `json:"name"`
+	ID         string     `json:"id,omitempty"`
+	IP         netip.Addr `json:"ip"`
+	VNetID     string     `json:"vnetId,omitempty"` // empty outside the scanned VNets
+	VNetName   string     `json:"vnetName,omitempty"`
+	SubnetID   string     `json:"subnetId,omitempty"`
+	SubnetName string     `json:"subnetName,omitempty"`
+	SubnetNSG  string     `json:"subnetNsg,omitempty"` // NSG IDs, empty when none is associated
+	NICNSG     string     `json:"nicNsg,omitempty"`
+	ASGs       []string   `json:"asgs,omitempty"`
+	// IPForwarding is true for NICs that may forward traffic as an NVA
+	IPForwarding bool `json:"ipForwarding,omitempty"`
+	// PublicIP is set when the endpoint was addressed by its public IP
+	PublicIP string `json:"publicIp,omitempty"`
+}
+
+// InVNet reports whether the endpoint is inside a scanned subnet
+func (e Endpoint) InVNet() bool {
+	return e.SubnetID != ""
+}
+
+// String describes the endpoint, e.g. "vm-web1 (NIC vm-web1-nic, 10.1.1.4)"
+func (e Endpoint) String() string {
+	switch e.Kind {
+	case KindOnPremises:
+		return fmt.Sprintf("%s (on-premises)", e.IP)
+	case KindInternet:
+		return fmt.Sprintf("%s (Internet)", e.IP)
+	case KindAddress:
+		return fmt.Sprintf("%s (%s/%s)", e.IP, e.VNetName, e.SubnetName)
+	}
+	ip := e.IP.String()
+	if e.PublicIP != "" {
+		ip = e.PublicIP + " → " + ip
+	}
+	return fmt.Sprintf("%s (%s, %s)", e.Name, e.Kind, ip)
+}
+
+// subnetInfo locates a subnet in its VNet
+type subnetInfo struct {
+	vnet   *models.VNet
+	subnet *models.Subnet
+	prefix netip.Prefix
+}
+
+// network indexes an inventory for lookups during a query
+type network struct {
+	inv         *models.Inventory
+	nsgs        map[string]*nsg.NSG
+	vnets       map[string]*models.VNet
+	subnets     map[string]subnetInfo
+	routeTables map[string]*models.RouteTable
+}
+
+func newNetwork(inv *models.Inventory) *network {
+	n := &network{
+		inv:         inv,
+		nsgs:        make(map[string]*nsg.NSG),
+		vnets:       make(map[string]*models.VNet),
+		subnets:     make(map[string]subnetInfo),
+		routeTables: make(map[string]*models.RouteTable),
+	}
+
+	for _, m := range inv.NSGs {
+		n.nsgs[strings.ToLower(m.ID)] = nsg.New(m)
+	}
+	for i := range inv.VNets {
+		vnet := &inv.VNets[i]
+		n.vnets[strings.ToLower(vnet.ID)] = vnet
+		for j := range vnet.Subnets {
+			subnet := &vnet.Subnets[j]
+			prefix, _ := netip.ParsePrefix(subnet.AddressPrefix)
+			n.subnets[strings.ToLower(subnet.ID)] = subnetInfo{vnet: vnet, subnet: subnet, prefix: prefix.Masked()}
+		}
+	}
+	for i := range inv.RouteTables {
+		n.routeTables[strings.ToLower(inv.RouteTables[i].ID)] = &inv.RouteTables[i]
+	}
+	return n
+}
+
+// nsg returns the parsed NSG with the given ID, or nil
+func (n *network) nsg(id string) *nsg.NSG {
+	if id == "" {
+		return nil
+	}
+	return n.nsgs[strings.ToLower(id)]
+}
+
+// vnet returns the scanned VNet with the given ID, or nil
+func (n *network) vnet(id string) *models.VNet {
+	return n.vnets[strings.ToLower(id)]
+}
+
+// resolve turns a resource name, resource ID or IP address into an endpoint
+func (n *network) resolve(value string) (Endpoint, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Endpoint{}, fmt.Errorf("endpoint is empty")
+	}
+	if ip, err := netip.ParseAddr(value); err == nil {
+		return n.resolveIP(ip)
+	}
+
+	// Candidates are grouped by the resource they belong to so that a VM
+	// with several NICs resolves to its first NIC, while a name shared by
+	// different resources is reported as ambiguous
+	var owners []string
+	candidates := make(map[string]Endpoint)
+	add := func(owner string, endpoint Endpoint) {
+		owner = strings.ToLower(owner)
+		if _, ok := candidates[owner]; !ok {
+			owners = append(owners, owner)
+			candidates[owner] = endpoint
+		}
+	}
+	matches := func(name, id string) bool {
+		return name != "" && strings.EqualFold(name, value) || id != "" && strings.EqualFold(id, value)
+	}
+
+	for _, nic := range n.inv.NICs {
+		config, ok := primaryConfig(nic)
+		if !ok {
+			continue
+		}
+		if matches(nic.Name, nic.ID) {
+			add(nic.ID, n.nicEndpoint(nic, config))
+		}
+		if nic.AttachedTo != nil && matches(nic.AttachedTo.Name, nic.AttachedTo.ID) {
+			add(nic.AttachedTo.ID, n.nicEndpoint(nic, config))
+		}
+		for _, c := range nic.IPConfigurations {
+			if c.PublicIPRef != "" && matches(ResourceName(c.PublicIPRef), c.PublicIPRef) {
+				endpoint := n.nicEndpoint(nic, c)
+				endpoint.PublicIP = n.publicIPAddress(c.PublicIPRef)
+				add(c.PublicIPRef, endpoint)
+			}
+		}
+	}
+	for _, pe := range n.inv.PrivateEndpoints {
+		if matches(pe.Name, pe.ID) || pe.PrivateLinkServiceID != "" && matches(ResourceName(pe.PrivateLinkServiceID), pe.PrivateLinkServiceID) {
+			if endpoint, err := n.resolveIP(parseAddr(pe.PrivateIP)); err == nil && endpoint.InVNet() {
+				add(pe.ID, endpoint)
+			}
+		}
+	}
+	for _, fw := range n.inv.Firewalls {
+		if matches(fw.Name, fw.ID) {
+			add(fw.ID, n.firewallEndpoint(fw))
+		}
+	}
+
+	switch len(owners) {
+	case 0:
+		return Endpoint{}, fmt.Errorf("no VM, NIC, private endpoint, private link resource or firewall named %q in the scanned data", value)
+	case 1:
+		endpoint := candidates[owners[0]]
+		if !endpoint.IP.IsValid() {
+			return Endpoint{}, fmt.Errorf("%q has no private IP address in the scanned data", value)
+		}
+		return endpoint, nil
+	}
+
+	// A VM and its only NIC are the same endpoint
+	first := candidates[owners[0]]
+	for _, owner := range owners[1:] {
+		if candidates[owner].IP != first.IP {
+			sort.Strings(owners)
+			return Endpoint{}, fmt.Errorf("%q is ambiguous, use a resource ID: %s", value, strings.Join(owners, ", "))
+		}
+	}
+	return first, nil
+}
+
+// resolveIP finds the resource owning an IP address, or the subnet or
+// external network it belongs to
+func (n *network) resolveIP(ip netip.Addr) (Endpoint, error) {
+	if !ip.IsValid() {
+		return Endpoint{}, fmt.Errorf("invalid IP address")
+	}
+	ip = ip.Unmap()
+
+	for _, nic := range n.inv.NICs {
+		for _, config := range nic.IPConfigurations {
+			if parseAddr(config.PrivateIP) == ip {
+				return n.nicEndpoint(nic, config), nil
+			}
+		}
+	}
+	for _, fw := range n.inv.Firewalls {
+		if parseAddr(fw.PrivateIP) == ip {
+			return n.firewallEndpoint(fw), nil
+		}
+	}
+
+	// A public IP resolves to the NIC it is attached to
+	for _, pip := range n.inv.PublicIPs {
+		if parseAddr(pip.IPAddress) != ip {
+			continue
+		}
+		for _, nic := range n.inv.NICs {
+			for _, config := range nic.IPConfigurations {
+				if strings.EqualFold(config.PublicIPRef, pip.ID) {
+					endpoint := n.nicEndpoint(nic, config)
+					endpoint.PublicIP = pip.IPAddress
+					return endpoint, nil
+				}
+			}
+		}
+	}
+
+	endpoint := Endpoint{Kind: KindAddress, Name: ip.String(), IP: ip}
+	for _, pe := range n.inv.PrivateEndpoints {
+		if parseAddr(pe.PrivateIP) == ip {
+			endpoint = Endpoint{Kind: KindPrivateEndpoint, Name: pe.Name, ID: pe.ID, IP: ip}
+		}
+	}
+	for _, info := range n.sortedSubnets() {
+		if info.prefix.IsValid() && info.prefix.Contains(ip) {
+			n.placeInSubnet(&endpoint, info)
+			return endpoint, nil
+		}
+	}
+	for _, vnet := range n.inv.VNets {
+		if inAddressSpace(ip, vnet.AddressSpaces) {
+			return Endpoint{}, fmt.Errorf("%s is in the address space of %s but not in any of its subnets", ip, vnet.Name)
+		}
+	}
+
+	if isPrivate(ip) {
+		return Endpoint{Kind: KindOnPremises, Name: ip.String(), IP: ip}, nil
+	}
+	return Endpoint{Kind: KindInternet, Name: ip.String(), IP: ip}, nil
+}
+
+// nicEndpoint describes one IP configuration of a NIC
+func (n *network) nicEndpoint(nic models.NetworkInterface, config models.IPConfiguration) Endpoint {
+	endpoint := Endpoint{
+		Kind:         KindNIC,
+		Name:         nic.Name,
+		ID:           nic.ID,
+		IP:           parseAddr(config.PrivateIP),
+		NICNSG:       nic.NSGRef,
+		ASGs:         config.ASGRefs,
+		IPForwarding: nic.EnableIPForwarding,
+	}
+	if nic.AttachedTo != nil {
+		endpoint.Name = nic.AttachedTo.Name
+		endpoint.ID = nic.AttachedTo.ID
+		if nic.AttachedTo.Type == "PrivateEndpoint" {
+			endpoint.Kind = KindPrivateEndpoint
+			endpoint.NICNSG = ""
+		}
+	}
+	if info, ok := n.subnets[strings.ToLower(config.SubnetID)]; ok {
+		n.placeInSubnet(&endpoint, info)
+	}
+	return endpoint
+}
+
+// firewallEndpoint describes an Azure Firewall by its private IP
+func (n *network) firewallEndpoint(fw models.AzureFirewall) Endpoint {
+	endpoint := Endpoint{Kind: KindFirewall, Name: fw.Name, ID: fw.ID, IP: parseAddr(fw.PrivateIP)}
+	if info, ok := n.subnets[strings.ToLower(fw.SubnetID)]; ok {
+		n.placeInSubnet(&endpoint, info)
+	}
+	return endpoint
+}
+
+// placeInSubnet fills in the VNet, subnet and subnet NSG of an endpoint
+func (n *network) placeInSubnet(endpoint *Endpoint, info subnetInfo) {
+	endpoint.VNetID = info.vnet.ID
+	endpoint.VNetName = info.vnet.Name
+	endpoint.SubnetID = info.subnet.ID
+	endpoint.SubnetName = info.subnet.Name
+	endpoint.SubnetNSG = info.subnet.NSGRef
+}
+
+// publicIPAddress returns the address of a public IP resource
+func (n *network) publicIPAddress(id string) string {
+	for _, pip := range n.inv.PublicIPs {
+		if strings.EqualFold(pip.ID, id) {
+			return pip.IPAddress
+		}
+	}
+	return ""
+}
+
+// sortedSubnets returns subnets most specific first so that the narrowest
+// match wins
+func (n *network) sortedSubnets() []subnetInfo {
+	infos := make([]subnetInfo, 0, len(n.subnets))
+	for _, info := range n.subnets {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].prefix.Bits() != infos[j].prefix.Bits() {
+			return infos[i].prefix.Bits() > infos[j].prefix.Bits()
+		}
+		return strings.ToLower(infos[i].subnet.ID) < strings.ToLower(infos[j].subnet.ID)
+	})
+	return infos
+}
+
+// primaryConfig returns the primary IP configuration of a NIC
+func primaryConfig(nic models.NetworkInterface) (models.IPConfiguration, bool) {
+	for _, config := range nic.IPConfigurations {
+		if config.Primary {
+			return config, true
+		}
+	}
+	if len(nic.IPConfigurations) > 0 {
+		return nic.IPConfigurations[0], true
+	}
+	return models.IPConfiguration{}, false
+}
+
+// parseAddr parses an IP address, returning the zero Addr when invalid
+func parseAddr(s string) netip.Addr {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// inAddressSpace reports whether ip is in any of the prefixes
+func inAddressSpace(ip netip.Addr, prefixes []string) bool {
+	for _, s := range prefixes {
+		if prefix, err := netip.ParsePrefix(s); err == nil && prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrivate reports whether ip is in RFC 1918, shared (RFC 6598) or unique
+// local address space, which Azure routes to on-premises networks
+func isPrivate(ip netip.Addr) bool {
+	return ip.IsPrivate() || sharedAddressSpace.Contains(ip)
+}
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// ResourceName returns the final segment of a resource ID, which is the
+// resource's name
+func ResourceName(id string) string {
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		return id[i+1:]
+	}
+	return id
+}
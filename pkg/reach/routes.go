@@ -0,0 +1,226 @@
+package reach
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/models"
+)
+
+// Next hop types, as named by Azure effective routes
+const (
+	NextHopVnetLocal             = "VnetLocal"
+	NextHopVNetPeering           = "VNetPeering"
+	NextHopVirtualNetworkGateway = "VirtualNetworkGateway"
+	NextHopVirtualAppliance      = "VirtualAppliance"
+	NextHopInternet              = "Internet"
+	NextHopNone                  = "None"
+)
+
+// Route sources in order of preference for routes with the same prefix
+const (
+	SourceUser    = "User"
+	SourceGateway = "Gateway"
+	SourceDefault = "Default"
+)
+
+// Route is one entry of a subnet's effective route table
+type Route struct {
+	Prefix      netip.Prefix
+	NextHopType string
+	NextHopIP   string
+	RemoteVNet  string // peered VNet ID for VNetPeering routes
+	Source      string
+	Name        string // UDR name
+	Table       string // route table name for UDRs
+}
+
+// String describes the route, e.g. "UDR 'default-to-fw' in rt-spoke: 0.0.0.0/0 → VirtualAppliance 10.0.1.4"
+func (r Route) String() string {
+	hop := r.NextHopType
+	if r.NextHopIP != "" {
+		hop += " " + r.NextHopIP
+	}
+	switch r.Source {
+	case SourceUser:
+		return fmt.Sprintf("UDR '%s' in %s: %s → %s", r.Name, r.Table, r.Prefix, hop)
+	case SourceGateway:
+		return fmt.Sprintf("gateway-learned route: %s → %s", r.Prefix, hop)
+	}
+	return fmt.Sprintf("system route %s → %s", r.Prefix, hop)
+}
+
+// Router selects the effective routes of subnets in an inventory
+type Router struct {
+	net *network
+}
+
+// NewRouter indexes an inventory for route lookups
+func NewRouter(inv *models.Inventory) *Router {
+	return &Router{net: newNetwork(inv)}
+}
+
+// Lookup returns the route a subnet uses for a destination address
+func (r *Router) Lookup(subnetID string, dst netip.Addr) (Route, bool) {
+	info, ok := r.net.subnets[strings.ToLower(subnetID)]
+	if !ok {
+		return Route{}, false
+	}
+	gateway, _ := r.net.gateway(info.vnet)
+	return r.net.lookup(info, dst, gateway != nil)
+}
+
+// privateRanges get system routes to None unless a more specific route
+// (such as the VNet address space) covers the destination
+var privateRanges = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	sharedAddressSpace,
+}
+
+// lookup selects the route a subnet uses for a destination: the longest
+// matching prefix, with user routes preferred over gateway-learned routes
+// and gateway-learned routes over system routes of the same length.
+// gateway is true when the subnet can reach a virtual network gateway;
+// on-premises prefixes are then assumed to be learned from it.
+func (n *network) lookup(info subnetInfo, dst netip.Addr, gateway bool) (Route, bool) {
+	routes := n.systemRoutes(info.vnet, dst)
+
+	var table *models.RouteTable
+	if info.subnet.RouteTableRef != "" {
+		table = n.routeTables[strings.ToLower(info.subnet.RouteTableRef)]
+	}
+	if table != nil {
+		for _, udr := range table.Routes {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(udr.AddressPrefix))
+			if err != nil {
+				continue
+			}
+			routes = append(routes, Route{
+				Prefix:      prefix.Masked(),
+				NextHopType: canonicalNextHop(udr.NextHopType),
+				NextHopIP:   udr.NextHopIPAddress,
+				Source:      SourceUser,
+				Name:        udr.Name,
+				Table:       table.Name,
+			})
+		}
+	}
+
+	// The on-premises prefixes a gateway advertises are not in the scanned
+	// data. Assume the destination is advertised at least as specifically
+	// as its private range, unless route propagation is disabled.
+	if gateway && isPrivate(dst) && !n.inVNets(dst) && (table == nil || !table.DisableBGPRoutePropagation) {
+		prefix := netip.PrefixFrom(dst, 1).Masked()
+		for _, private := range privateRanges {
+			if private.Contains(dst) {
+				prefix = private
+			}
+		}
+		routes = append(routes, Route{Prefix: prefix, NextHopType: NextHopVirtualNetworkGateway, Source: SourceGateway})
+	}
+
+	var best Route
+	found := false
+	for _, r := range routes {
+		if !r.Prefix.Contains(dst) {
+			continue
+		}
+		if !found || r.Prefix.Bits() > best.Prefix.Bits() ||
+			r.Prefix.Bits() == best.Prefix.Bits() && sourceRank(r.Source) < sourceRank(best.Source) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+// systemRoutes returns the default routes Azure creates for a subnet in vnet
+func (n *network) systemRoutes(vnet *models.VNet, dst netip.Addr) []Route {
+	var routes []Route
+	for _, space := range vnet.AddressSpaces {
+		if prefix, err := netip.ParsePrefix(space); err == nil {
+			routes = append(routes, Route{Prefix: prefix.Masked(), NextHopType: NextHopVnetLocal, Source: SourceDefault})
+		}
+	}
+
+	// Peering routes are added for every peering so that a peering that is
+	// not connected is reported as the cause rather than a missing route
+	for _, peering := range vnet.Peerings {
+		for _, space := range peering.RemoteAddressSpaces {
+			if prefix, err := netip.ParsePrefix(space); err == nil {
+				routes = append(routes, Route{
+					Prefix:      prefix.Masked(),
+					NextHopType: NextHopVNetPeering,
+					RemoteVNet:  peering.RemoteVNetID,
+					Source:      SourceDefault,
+				})
+			}
+		}
+	}
+
+	if dst.Is4() {
+		for _, private := range privateRanges {
+			routes = append(routes, Route{Prefix: private, NextHopType: NextHopNone, Source: SourceDefault})
+		}
+		routes = append(routes, Route{Prefix: netip.MustParsePrefix("0.0.0.0/0"), NextHopType: NextHopInternet, Source: SourceDefault})
+	} else {
+		routes = append(routes, Route{Prefix: netip.MustParsePrefix("::/0"), NextHopType: NextHopInternet, Source: SourceDefault})
+	}
+	return routes
+}
+
+// inVNets reports whether ip is in the address space of a scanned VNet
+func (n *network) inVNets(ip netip.Addr) bool {
+	for _, vnet := range n.inv.VNets {
+		if inAddressSpace(ip, vnet.AddressSpaces) {
+			return true
+		}
+	}
+	return false
+}
+
+func sourceRank(source string) int {
+	switch source {
+	case SourceUser:
+		return 0
+	case SourceGateway:
+		return 1
+	}
+	return 2
+}
+
+// Peering returns the peering from one VNet to another, or nil
+func Peering(from *models.VNet, toID string) *models.VNetPeering {
+	if from == nil {
+		return nil
+	}
+	for i := range from.Peerings {
+		if strings.EqualFold(from.Peerings[i].RemoteVNetID, toID) {
+			return &from.Peerings[i]
+		}
+	}
+	return nil
+}
+
+// gateway returns the virtual network gateway a VNet uses: its own, or the
+// gateway of a peered VNet through a peering that uses remote gateways
+func (n *network) gateway(vnet *models.VNet) (*models.Gateway, *models.VNet) {
+	for i := range n.inv.Gateways {
+		if strings.EqualFold(n.inv.Gateways[i].VNetID, vnet.ID) {
+			return &n.inv.Gateways[i], vnet
+		}
+	}
+	for _, p := range vnet.Peerings {
+		if !p.UseRemoteGateways {
+			continue
+		}
+		for i := range n.inv.Gateways {
+			if strings.EqualFold(n.inv.Gateways[i].VNetID, p.RemoteVNetID) {
+				return &n.inv.Gateways[i], n.vnet(p.RemoteVNetID)
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,126 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+)
+
+// chargebackUntaggedRows is the number of unallocated resources listed
+const chargebackUntaggedRows = 20
+
+// RenderChargebackMarkdown renders a chargeback report: monthly cost by tag
+// values, with the share that cannot be allocated highlighted
+func RenderChargebackMarkdown(cb *analysis.Chargeback) string {
+	var content strings.Builder
+
+	content.WriteString(fmt.Sprintf("# Chargeback by %s\n\n", strings.Join(cb.Keys, ", ")))
+	if cb.Actual {
+		months := "no usage dates"
+		if len(cb.Months) > 0 {
+			months = strings.Join(cb.Months, ", ")
+		}
+		content.WriteString(fmt.Sprintf("*Actual spend (%s) from Cost Management export %s, averaged over billing months: %s.*\n\n",
+			cb.Currency, cb.Source, months))
+	} else {
+		content.WriteString(fmt.Sprintf("*Estimated from pay-as-you-go prices (%s): %s. Usage-based charges are not included", cb.Currency, cb.Source))
+		if cb.Unpriced > 0 {
+			content.WriteString(fmt.Sprintf(", and %d resources could not be priced", cb.Unpriced))
+		}
+		content.WriteString(".*\n\n")
+	}
+
+	content.WriteString(fmt.Sprintf("**Total Monthly Cost:** $%.2f\n\n", cb.Total))
+	content.WriteString(fmt.Sprintf("**Allocated:** $%.2f (%.1f%%), of which $%.2f through resource group tags\n\n",
+		cb.Allocated, cb.Share(cb.Allocated), cb.Inherited))
+	if cb.Unallocated > 0 {
+		content.WriteString(fmt.Sprintf("> ⚠️ **Unallocated: $%.2f (%.1f%%)** of monthly cost has no %s tag on the resource or its resource group",
+			cb.Unallocated, cb.Share(cb.Unallocated), strings.Join(cb.Keys, " or ")))
+		if cb.Unassigned > 0 {
+			content.WriteString(fmt.Sprintf(", including $%.2f not tied to a resource", cb.Unassigned))
+		}
+		content.WriteString(".\n\n")
+	} else {
+		content.WriteString("✅ All cost is allocated.\n\n")
+	}
+
+	content.WriteString("| " + strings.Join(cb.Keys, " | ") + " | Resources | Monthly Cost | Share |\n")
+	content.WriteString(strings.Repeat("|------", len(cb.Keys)) + "|-----------|--------------|-------|\n")
+	for _, a := range cb.Allocations {
+		values := make([]string, len(a.Values))
+		for i, v := range a.Values {
+			values[i] = v
+			if v == analysis.Untagged {
+				values[i] = "**" + v + "**"
+			}
+		}
+		resources := fmt.Sprintf("%d", a.Resources)
+		if a.Inherited > 0 {
+			resources += fmt.Sprintf(" (%d inherited)", a.Inherited)
+		}
+		content.WriteString(fmt.Sprintf("| %s | %s | $%.2f | %.1f%% |\n",
+			strings.Join(values, " | "), resources, a.Monthly, cb.Share(a.Monthly)))
+	}
+	if cb.Unassigned > 0 {
+		content.WriteString(fmt.Sprintf("| *Not tied to a resource*%s | - | $%.2f | %.1f%% |\n",
+			strings.Repeat(" | -", len(cb.Keys)-1), cb.Unassigned, cb.Share(cb.Unassigned)))
+	}
+	content.WriteString("\n")
+
+	if len(cb.Untagged) > 0 {
+		content.WriteString("## Unallocated Resources\n\n")
+		content.WriteString("Tag these resources or their resource groups to allocate their cost.\n\n")
+		content.WriteString("| Resource | Resource Group | Missing Tags | Monthly Cost |\n")
+		content.WriteString("|----------|----------------|--------------|--------------|\n")
+		for i, r := range cb.Untagged {
+			if i >= chargebackUntaggedRows {
+				content.WriteString(fmt.Sprintf("| ... | *%d more resources* | - | - |\n", len(cb.Untagged)-chargebackUntaggedRows))
+				break
+			}
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | $%.2f |\n",
+				r.Name, valueOrDash(r.ResourceGroup), strings.Join(r.Missing, ", "), r.Monthly))
+		}
+		content.WriteString("\n")
+	}
+
+	return content.String()
+}
+
+// RenderChargebackCSV renders the allocations as CSV, one row per
+// combination of tag values
+func RenderChargebackCSV(cb *analysis.Chargeback) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	header := append(append([]string{}, cb.Keys...), "resources", "inherited_resources", "monthly_cost", "share_percent", "allocated")
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, a := range cb.Allocations {
+		row := append(append([]string{}, a.Values...),
+			fmt.Sprintf("%d", a.Resources),
+			fmt.Sprintf("%d", a.Inherited),
+			fmt.Sprintf("%.2f", a.Monthly),
+			fmt.Sprintf("%.2f", cb.Share(a.Monthly)),
+			fmt.Sprintf("%t", a.Allocated()))
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if cb.Unassigned > 0 {
+		row := make([]string, len(cb.Keys))
+		for i := range row {
+			row[i] = "(not tied to a resource)"
+		}
+		row = append(row, "0", "0", fmt.Sprintf("%.2f", cb.Unassigned), fmt.Sprintf("%.2f", cb.Share(cb.Unassigned)), "false")
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/automationpi/azdocs/pkg/graph"
@@ -19,6 +20,13 @@ type DiagramConfig struct {
 	Theme     string
 	EnableAI  bool
 	OpenAIKey string
+
+	DataDir     string   // Directory written by scan (default ./data)
+	Model       string   // LLM model, empty uses the client default
+	MaxTokens   int      // LLM token limit override
+	Temperature *float32 // LLM temperature override
+
+	Redact []*regexp.Regexp // Matches are replaced with [REDACTED]
 }
 
 // DiagramRenderer generates Draw.io diagrams
@@ -31,11 +39,17 @@ type DiagramRenderer struct {
 func NewDiagramRenderer(config DiagramConfig) *DiagramRenderer {
 	// Initialize LLM client if AI is enabled
 	llmClient := llm.NewClient(llm.Config{
-		Enabled: config.EnableAI,
-		APIKey:  config.OpenAIKey,
-		Model:   "", // Use default model
+		Enabled:     config.EnableAI,
+		APIKey:      config.OpenAIKey,
+		Model:       config.Model,
+		MaxTokens:   config.MaxTokens,
+		Temperature: config.Temperature,
 	})
 
+	if config.DataDir == "" {
+		config.DataDir = "./data"
+	}
+
 	return &DiagramRenderer{
 		config:    config,
 		llmClient: llmClient,
@@ -86,7 +100,7 @@ func (r *DiagramRenderer) RenderAll(topology *graph.Topology) error {
 
 // loadResources loads resources from JSON file
 func (r *DiagramRenderer) loadResources() ([]map[string]interface{}, error) {
-	data, err := os.ReadFile("./data/raw/all-resources.json")
+	data, err := os.ReadFile(filepath.Join(r.config.DataDir, "raw", "all-resources.json"))
 	if err != nil {
 		return nil, err
 	}
@@ -431,7 +445,7 @@ func (r *DiagramRenderer) generateVNetDiagram(vnet map[string]interface{}, allRe
 
 	// Save diagram (removed legend as requested)
 	filename := filepath.Join(r.config.OutputDir, fmt.Sprintf("%s.drawio", vnetName))
-	return diagram.Save(filename)
+	return diagram.Save(filename, r.config.Redact...)
 }
 
 // extractSubnets extracts subnet information from VNet properties
@@ -653,7 +667,7 @@ func (r *DiagramRenderer) generateOverviewDiagram(resources []map[string]interfa
 
 	// Save diagram (removed legend)
 	filename := filepath.Join(r.config.OutputDir, "Overview.drawio")
-	return diagram.Save(filename)
+	return diagram.Save(filename, r.config.Redact...)
 }
 
 // filterByResourceGroup filters resources by resource group
@@ -946,15 +960,15 @@ func (d *DrawIODiagram) AddLegend(x, y float64) {
 	}
 }
 
-// Save saves the diagram to a file
-func (d *DrawIODiagram) Save(filename string) error {
+// Save saves the diagram to a file, applying any redaction patterns
+func (d *DrawIODiagram) Save(filename string, redact ...*regexp.Regexp) error {
 	data, err := xml.MarshalIndent(d, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal XML: %w", err)
 	}
 
 	// Add XML declaration
-	xmlData := []byte(xml.Header + string(data))
+	xmlData := []byte(Redact(xml.Header+string(data), redact))
 
 	return os.WriteFile(filename, xmlData, 0644)
 }
@@ -0,0 +1,119 @@
+package renderer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/snapshot"
+)
+
+// maxDiffValueLen truncates long before/after values in Markdown tables
+const maxDiffValueLen = 120
+
+// RenderDiffMarkdown renders a snapshot diff as a Markdown change report
+func RenderDiffMarkdown(diff *snapshot.Diff) string {
+	var content strings.Builder
+
+	content.WriteString("# Azure Change Report\n\n")
+	content.WriteString(fmt.Sprintf("**From:** `%s` (%s)\n\n", diff.From, diff.FromTime.Format("2006-01-02 15:04 MST")))
+	content.WriteString(fmt.Sprintf("**To:** `%s` (%s)\n\n", diff.To, diff.ToTime.Format("2006-01-02 15:04 MST")))
+
+	content.WriteString("## Summary\n\n")
+	content.WriteString("| Change | Resources |\n")
+	content.WriteString("|--------|-----------|\n")
+	content.WriteString(fmt.Sprintf("| ➕ Added | %d |\n", len(diff.Added)))
+	content.WriteString(fmt.Sprintf("| ➖ Removed | %d |\n", len(diff.Removed)))
+	content.WriteString(fmt.Sprintf("| ✏️ Modified | %d |\n", len(diff.Modified)))
+	content.WriteString("\n")
+
+	generateScoreDeltaSection(&content, diff.Scores)
+
+	if !diff.HasChanges() {
+		content.WriteString("✅ No resource changes between snapshots.\n")
+		return content.String()
+	}
+
+	if len(diff.Added) > 0 {
+		content.WriteString("## Added Resources\n\n")
+		writeResourceRefs(&content, diff.Added)
+	}
+
+	if len(diff.Removed) > 0 {
+		content.WriteString("## Removed Resources\n\n")
+		writeResourceRefs(&content, diff.Removed)
+	}
+
+	if len(diff.Modified) > 0 {
+		content.WriteString("## Modified Resources\n\n")
+		for _, res := range diff.Modified {
+			content.WriteString(fmt.Sprintf("### %s\n\n", res.Name))
+			content.WriteString(fmt.Sprintf("*%s* in `%s`\n\n", res.Type, res.ResourceGroup))
+			content.WriteString("| Property | Change | Before | After |\n")
+			content.WriteString("|----------|--------|--------|-------|\n")
+			for _, change := range res.Changes {
+				content.WriteString(fmt.Sprintf("| `%s` | %s | %s | %s |\n",
+					change.Path,
+					change.Kind,
+					formatDiffValue(change.Before),
+					formatDiffValue(change.After)))
+			}
+			content.WriteString("\n")
+		}
+	}
+
+	return content.String()
+}
+
+// generateScoreDeltaSection generates the analysis score comparison table
+func generateScoreDeltaSection(content *strings.Builder, scores []snapshot.ScoreDelta) {
+	content.WriteString("## Score Changes\n\n")
+	content.WriteString("| Category | Before | After | Delta | Findings |\n")
+	content.WriteString("|----------|--------|-------|-------|----------|\n")
+	for _, score := range scores {
+		icon := "➖"
+		if score.Delta > 0 {
+			icon = "📈"
+		} else if score.Delta < 0 {
+			icon = "📉"
+		}
+		content.WriteString(fmt.Sprintf("| %s | %d | %d | %s %+d | %d → %d |\n",
+			score.Category, score.Before, score.After, icon, score.Delta, score.FindingsBefore, score.FindingsAfter))
+	}
+	content.WriteString("\n")
+}
+
+// writeResourceRefs writes a table of resources
+func writeResourceRefs(content *strings.Builder, refs []snapshot.ResourceRef) {
+	content.WriteString("| Name | Type | Resource Group |\n")
+	content.WriteString("|------|------|----------------|\n")
+	for _, ref := range refs {
+		content.WriteString(fmt.Sprintf("| %s | %s | %s |\n", ref.Name, ref.Type, ref.ResourceGroup))
+	}
+	content.WriteString("\n")
+}
+
+// formatDiffValue renders a changed value compactly for a table cell
+func formatDiffValue(value interface{}) string {
+	if value == nil {
+		return "-"
+	}
+
+	var text string
+	if s, ok := value.(string); ok {
+		text = s
+	} else {
+		data, err := json.Marshal(value)
+		if err != nil {
+			text = fmt.Sprintf("%v", value)
+		} else {
+			text = string(data)
+		}
+	}
+
+	if len(text) > maxDiffValueLen {
+		text = text[:maxDiffValueLen] + "…"
+	}
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return "`" + text + "`"
+}
@@ -0,0 +1,134 @@
+package renderer
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/ipam"
+)
+
+// ipamMapCells is the width of the free/used bar drawn for an address space
+const ipamMapCells = 64
+
+// RenderIPAMMarkdown renders an address plan report: a free/used map of
+// every VNet address space with its used, reserved and free blocks
+func RenderIPAMMarkdown(maps []ipam.VNetMap, usage *ipam.Analysis) string {
+	var content strings.Builder
+
+	content.WriteString("# IP Address Plan\n\n")
+
+	usageByPrefix := make(map[string]ipam.SubnetUsage)
+	if usage != nil {
+		for _, u := range usage.Subnets {
+			usageByPrefix[strings.ToLower(u.VNetID)+"|"+u.Prefix] = u
+		}
+	}
+
+	content.WriteString("| VNet | Address Space | Allocated | Largest Free Block |\n")
+	content.WriteString("|------|---------------|-----------|--------------------|\n")
+	for _, m := range maps {
+		for _, space := range m.Spaces {
+			content.WriteString(fmt.Sprintf("| %s | `%s` | %.1f%% | %s |\n",
+				m.VNet, space.Prefix, space.Allocated(), largestFreeBlock(space)))
+		}
+	}
+	content.WriteString("\n")
+
+	generateAddressOverlapSection(&content, usage)
+
+	for _, m := range maps {
+		content.WriteString(fmt.Sprintf("## %s\n\n", m.VNet))
+		if len(m.Spaces) == 0 {
+			content.WriteString("No address space.\n\n")
+			continue
+		}
+
+		// One bar per address space: █ subnet, ▒ reserved, ░ free
+		content.WriteString("```\n")
+		for _, space := range m.Spaces {
+			content.WriteString(fmt.Sprintf("%-20s %s\n", space.Prefix, addressBar(space)))
+		}
+		content.WriteString("```\n\n")
+		content.WriteString("█ subnet  ▒ reserved  ░ free\n\n")
+
+		content.WriteString("| Block | Status | Subnet | Used / Usable IPs | Utilization |\n")
+		content.WriteString("|-------|--------|--------|-------------------|-------------|\n")
+		for _, space := range m.Spaces {
+			for _, b := range space.Blocks {
+				switch b.State {
+				case ipam.BlockUsed:
+					used, utilization := "-", "-"
+					if u, ok := usageByPrefix[strings.ToLower(m.VNetID)+"|"+b.Prefix.String()]; ok {
+						used = fmt.Sprintf("%d / %s", u.Used, formatAddressCount(u.Prefix, u.Usable))
+						utilization = fmt.Sprintf("%.1f%%", u.Utilization)
+						if u.OverThreshold {
+							utilization = "⚠️ " + utilization
+						}
+					}
+					content.WriteString(fmt.Sprintf("| `%s` | 🟦 Used | %s | %s | %s |\n", b.Prefix, b.Name, used, utilization))
+				case ipam.BlockReserved:
+					content.WriteString(fmt.Sprintf("| `%s` | 🟨 Reserved | - | - | - |\n", b.Prefix))
+				default:
+					content.WriteString(fmt.Sprintf("| `%s` | ⬜ Free | - | - | - |\n", b.Prefix))
+				}
+			}
+		}
+		content.WriteString("\n")
+	}
+
+	return content.String()
+}
+
+// addressBar draws an address space as cells marked with the most
+// significant block they contain, so small subnets stay visible
+func addressBar(space ipam.SpaceMap) string {
+	cells := make([]int, ipamMapCells) // 0 free, 1 reserved, 2 used
+	size := ipam.BlockSize(space.Prefix)
+	cellCount := big.NewInt(ipamMapCells)
+
+	cellOf := func(offset *big.Int) int {
+		i := new(big.Int).Mul(offset, cellCount)
+		return int(i.Div(i, size).Int64())
+	}
+
+	for _, b := range space.Blocks {
+		rank := 0
+		switch b.State {
+		case ipam.BlockUsed:
+			rank = 2
+		case ipam.BlockReserved:
+			rank = 1
+		default:
+			continue
+		}
+		first := cellOf(ipam.Offset(space.Prefix, b.Prefix.Addr()))
+		last := cellOf(ipam.Offset(space.Prefix, ipam.LastAddr(b.Prefix)))
+		for i := first; i <= last && i < ipamMapCells; i++ {
+			if rank > cells[i] {
+				cells[i] = rank
+			}
+		}
+	}
+
+	var bar strings.Builder
+	for _, c := range cells {
+		bar.WriteString([]string{"░", "▒", "█"}[c])
+	}
+	return bar.String()
+}
+
+// largestFreeBlock returns the shortest free prefix in an address space
+func largestFreeBlock(space ipam.SpaceMap) string {
+	largest := ""
+	bits := space.Prefix.Addr().BitLen() + 1
+	for _, b := range space.Blocks {
+		if b.State == ipam.BlockFree && b.Prefix.Bits() < bits {
+			largest, bits = "`"+b.Prefix.String()+"`", b.Prefix.Bits()
+		}
+	}
+	if largest == "" {
+		return "none"
+	}
+	return largest
+}
@@ -4,14 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/automationpi/azdocs/pkg/analysis"
 	"github.com/automationpi/azdocs/pkg/graph"
+	"github.com/automationpi/azdocs/pkg/ipam"
 	"github.com/automationpi/azdocs/pkg/llm"
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/normalize"
+	"github.com/automationpi/azdocs/pkg/nsg"
+	"github.com/automationpi/azdocs/pkg/rules"
+	"github.com/automationpi/azdocs/pkg/waiver"
 )
 
 // Config holds renderer configuration
@@ -22,6 +30,18 @@ type Config struct {
 	Theme        string
 	EnableAI     bool
 	OpenAIKey    string
+
+	DataDir                string           // Directory written by scan (default ./data)
+	DiagramsDir            string           // Diagram output directory (default OutputDir/diagrams)
+	Model                  string           // LLM model, empty uses the client default
+	MaxTokens              int              // LLM token limit override
+	Temperature            *float32         // LLM temperature override
+	IncludeEffectiveRoutes bool             // Render raw/effective-routes.json when present
+	MaxRoutesPerNIC        int              // Routes shown per NIC, 0 shows all
+	Redact                 []*regexp.Regexp // Matches are replaced with [REDACTED]
+	Waivers                []waiver.Waiver  // Accepted findings, excluded from scores
+	Rules                  []rules.Rule     // Custom rules evaluated alongside built-in analyses
+	Analysis               analysis.Options // Settings of the built-in analyses
 }
 
 // MarkdownRenderer generates Markdown documentation
@@ -33,11 +53,20 @@ type MarkdownRenderer struct {
 // NewMarkdownRenderer creates a new Markdown renderer
 func NewMarkdownRenderer(config Config) *MarkdownRenderer {
 	llmClient := llm.NewClient(llm.Config{
-		Enabled: config.EnableAI,
-		APIKey:  config.OpenAIKey,
-		Model:   "",
+		Enabled:     config.EnableAI,
+		APIKey:      config.OpenAIKey,
+		Model:       config.Model,
+		MaxTokens:   config.MaxTokens,
+		Temperature: config.Temperature,
 	})
 
+	if config.DataDir == "" {
+		config.DataDir = "./data"
+	}
+	if config.DiagramsDir == "" {
+		config.DiagramsDir = filepath.Join(config.OutputDir, "diagrams")
+	}
+
 	return &MarkdownRenderer{
 		config:    config,
 		llmClient: llmClient,
@@ -51,7 +80,7 @@ func (r *MarkdownRenderer) Render(topology *graph.Topology) error {
 	}
 
 	// Load the raw resources data to generate actual documentation
-	resourcesPath := "./data/raw/all-resources.json"
+	resourcesPath := filepath.Join(r.config.DataDir, "raw", "all-resources.json")
 	resources, err := r.loadResources(resourcesPath)
 	if err != nil {
 		// If we can't load resources, generate basic template
@@ -62,7 +91,24 @@ func (r *MarkdownRenderer) Render(topology *graph.Topology) error {
 	content := r.generateDocumentation(resources)
 
 	outputPath := filepath.Join(r.config.OutputDir, r.config.FileName)
-	return os.WriteFile(outputPath, []byte(content), 0644)
+	return os.WriteFile(outputPath, []byte(Redact(content, r.config.Redact)), 0644)
+}
+
+// Redact replaces every match of the patterns with [REDACTED]
+func Redact(content string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		content = pattern.ReplaceAllString(content, "[REDACTED]")
+	}
+	return content
+}
+
+// diagramsLink returns the diagrams directory relative to the Markdown file
+func (r *MarkdownRenderer) diagramsLink() string {
+	rel, err := filepath.Rel(r.config.OutputDir, r.config.DiagramsDir)
+	if err != nil {
+		return "diagrams"
+	}
+	return filepath.ToSlash(rel)
 }
 
 // loadResources loads resources from JSON file
@@ -140,10 +186,16 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 	rgCount := len(resourcesByRG)
 
 	// Run all analyses
-	securityAnalysis := analysis.AnalyzeSecurity(resources)
-	costAnalysis := analysis.AnalyzeCost(resources)
-	taggingAnalysis := analysis.AnalyzeTagging(resources)
-	complianceAnalysis := analysis.AnalyzeCompliance(resources)
+	report := analysis.Analyze(resources, r.config.Analysis)
+	if groups, err := r.loadResources(filepath.Join(r.config.DataDir, "raw", "resource-groups.json")); err == nil {
+		report.AnalyzeResourceGroups(groups, resources)
+	}
+	rules.Apply(report, r.config.Rules, resources)
+	waivers := waiver.Apply(report, r.config.Waivers, time.Now())
+	securityAnalysis := report.Security
+	costAnalysis := report.Cost
+	taggingAnalysis := report.Tagging
+	complianceAnalysis := report.Compliance
 
 	// Table of Contents
 	content.WriteString("## Table of Contents\n\n")
@@ -158,6 +210,9 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 	content.WriteString("- [Security & Compliance](#security--compliance)\n")
 	content.WriteString("- [Cost Optimization](#cost-optimization)\n")
 	content.WriteString("- [Tagging Strategy](#tagging-strategy)\n")
+	if len(waivers.Waived) > 0 || len(waivers.Expired) > 0 {
+		content.WriteString("- [Waived Findings](#waived-findings)\n")
+	}
 	content.WriteString("- [Resource Summary](#resource-summary)\n")
 	content.WriteString("- [Resource Groups](#resource-groups)\n")
 	for rgName := range resourcesByRG {
@@ -189,12 +244,17 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 	content.WriteString("| Category | Status | Score | Key Metrics |\n")
 	content.WriteString("|----------|--------|-------|-------------|\n")
 
-	content.WriteString(fmt.Sprintf("| **Security Posture** | %s | %d/100 | %d critical, %d high, %d medium issues |\n",
+	hygiene := ""
+	if securityAnalysis.HygieneCount > 0 {
+		hygiene = fmt.Sprintf(" (plus %d network hygiene, not scored)", securityAnalysis.HygieneCount)
+	}
+	content.WriteString(fmt.Sprintf("| **Security Posture** | %s | %d/100 | %d critical, %d high, %d medium issues%s |\n",
 		securityAnalysis.GetSecurityPosture(),
 		securityAnalysis.GetSecurityScore(),
 		securityAnalysis.CriticalCount,
 		securityAnalysis.HighCount,
-		securityAnalysis.MediumCount))
+		securityAnalysis.MediumCount,
+		hygiene))
 
 	content.WriteString(fmt.Sprintf("| **Cost Optimization** | %s | %d/100 | $%.0f/month (save $%.0f) |\n",
 		costAnalysis.GetCostHealth(),
@@ -202,7 +262,7 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 		costAnalysis.TotalMonthlyCost,
 		costAnalysis.PotentialMonthlySavings))
 
-	content.WriteString(fmt.Sprintf("| **Tagging Compliance** | %s | %d/100 | %.0f%% tagged, %d untagged resources |\n",
+	content.WriteString(fmt.Sprintf("| **Tagging Compliance** | %s | %d/100 | %.0f%% compliant, %d untagged resources |\n",
 		taggingAnalysis.GetTaggingHealth(),
 		taggingAnalysis.GetTaggingScore(),
 		taggingAnalysis.ComplianceRate,
@@ -239,7 +299,8 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 	// Network Architecture Diagrams
 	content.WriteString("## Network Architecture Diagrams\n\n")
 	if r.config.WithDiagrams {
-		content.WriteString("Network topology diagrams are generated in the `diagrams/` directory.\n\n")
+		diagrams := r.diagramsLink()
+		content.WriteString(fmt.Sprintf("Network topology diagrams are generated in the `%s/` directory.\n\n", diagrams))
 
 		// List VNet diagrams
 		vnets := r.filterByType(resources, "microsoft.network/virtualnetworks")
@@ -247,7 +308,7 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 			content.WriteString("### Virtual Network Diagrams\n\n")
 			for _, vnet := range vnets {
 				vnetName := r.getString(vnet, "name")
-				content.WriteString(fmt.Sprintf("- **[%s](diagrams/%s.drawio)** - ", vnetName, vnetName))
+				content.WriteString(fmt.Sprintf("- **[%s](%s/%s.drawio)** - ", vnetName, diagrams, vnetName))
 
 				// Add VNet address space
 				if props, ok := vnet["properties"].(map[string]interface{}); ok {
@@ -262,7 +323,7 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 			content.WriteString("\n")
 		}
 
-		content.WriteString("**[Overview Diagram](diagrams/Overview.drawio)** - Complete architecture overview\n\n")
+		content.WriteString(fmt.Sprintf("**[Overview Diagram](%s/Overview.drawio)** - Complete architecture overview\n\n", diagrams))
 		content.WriteString("💡 *Open `.drawio` files with [diagrams.net](https://app.diagrams.net) or VS Code with Draw.io Integration extension*\n\n")
 	} else {
 		content.WriteString("Diagram generation is disabled. Run with `--with-diagrams` to generate visual architecture diagrams.\n\n")
@@ -270,15 +331,22 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 
 	// IP Address Allocation
 	content.WriteString("## IP Address Allocation\n\n")
-	r.generateIPAddressTables(&content, resources)
+	r.generateIPAddressTables(&content, resources, securityAnalysis.IPAM)
+	generateAddressOverlapSection(&content, securityAnalysis.IPAM)
 
 	// Routing Configuration
 	content.WriteString("## Routing Configuration\n\n")
 	r.generateRoutingTables(&content, resources)
+	r.generateRouteAnalysisSection(&content, securityAnalysis.RouteIssues)
+	r.generateTopologySection(&content, securityAnalysis.Topology, securityAnalysis.PeeringIssues)
+	if r.config.IncludeEffectiveRoutes {
+		r.generateEffectiveRoutesSection(&content, r.loadEffectiveRoutes())
+	}
 
 	// Security & Compliance Section
 	content.WriteString("## Security & Compliance\n\n")
 	r.generateSecuritySection(&content, securityAnalysis)
+	r.generateNSGCleanupSection(&content, securityAnalysis.NSGCleanup)
 
 	// AI-powered security insights (if AI enabled)
 	if r.llmClient.IsEnabled() {
@@ -343,6 +411,12 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 	content.WriteString("## Tagging Strategy\n\n")
 	r.generateTaggingSection(&content, taggingAnalysis)
 
+	// Waived Findings Section
+	if len(waivers.Waived) > 0 || len(waivers.Expired) > 0 {
+		content.WriteString("## Waived Findings\n\n")
+		r.generateWaivedSection(&content, waivers)
+	}
+
 	// Resource Summary
 	content.WriteString("## Resource Summary\n\n")
 	resourcesByType := r.groupResourcesByType(resources)
@@ -424,6 +498,8 @@ func (r *MarkdownRenderer) generateDocumentation(resources []map[string]interfac
 			content.WriteString("\n")
 		}
 
+		r.generateEffectiveAccessSection(&content, nsg.EffectiveAccess(normalize.Normalize(resources)))
+
 		content.WriteString("### Route Tables\n\n")
 		rts := r.filterByType(networkResources, "microsoft.network/routetables")
 		if len(rts) > 0 {
@@ -656,8 +732,23 @@ func (r *MarkdownRenderer) getMostCommonLocation(resources []map[string]interfac
 	return mostCommon
 }
 
+// loadEffectiveRoutes loads effective routes captured by scan, if any
+func (r *MarkdownRenderer) loadEffectiveRoutes() []models.EffectiveRoutes {
+	data, err := os.ReadFile(filepath.Join(r.config.DataDir, "raw", "effective-routes.json"))
+	if err != nil {
+		return nil
+	}
+
+	var routes []models.EffectiveRoutes
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil
+	}
+
+	return routes
+}
+
 func (r *MarkdownRenderer) loadRecommendations() []interface{} {
-	data, err := os.ReadFile("./data/raw/recommendations.json")
+	data, err := os.ReadFile(filepath.Join(r.config.DataDir, "raw", "recommendations.json"))
 	if err != nil {
 		return []interface{}{}
 	}
@@ -694,7 +785,15 @@ func (r *MarkdownRenderer) getStringFromMap(m map[string]interface{}, key string
 }
 
 // generateIPAddressTables generates IP address allocation tables
-func (r *MarkdownRenderer) generateIPAddressTables(content *strings.Builder, resources []map[string]interface{}) {
+func (r *MarkdownRenderer) generateIPAddressTables(content *strings.Builder, resources []map[string]interface{}, usage *ipam.Analysis) {
+	usageBySubnet := make(map[string][]ipam.SubnetUsage)
+	if usage != nil {
+		for _, u := range usage.Subnets {
+			key := strings.ToLower(u.SubnetID)
+			usageBySubnet[key] = append(usageBySubnet[key], u)
+		}
+	}
+
 	// VNet Address Spaces
 	vnets := r.filterByType(resources, "microsoft.network/virtualnetworks")
 	if len(vnets) > 0 {
@@ -738,8 +837,8 @@ func (r *MarkdownRenderer) generateIPAddressTables(content *strings.Builder, res
 			if props, ok := vnet["properties"].(map[string]interface{}); ok {
 				if subnets, ok := props["subnets"].([]interface{}); ok && len(subnets) > 0 {
 					content.WriteString(fmt.Sprintf("**%s:**\n\n", vnetName))
-					content.WriteString("| Subnet | Address Prefix | Available IPs | NSG | Route Table |\n")
-					content.WriteString("|--------|----------------|---------------|-----|-------------|\n")
+					content.WriteString("| Subnet | Address Prefix | Used | Available IPs | Utilization | NSG | Route Table |\n")
+					content.WriteString("|--------|----------------|------|---------------|-------------|-----|-------------|\n")
 
 					for _, subnetIface := range subnets {
 						if subnet, ok := subnetIface.(map[string]interface{}); ok {
@@ -772,11 +871,20 @@ func (r *MarkdownRenderer) generateIPAddressTables(content *strings.Builder, res
 								}
 							}
 
-							// Calculate available IPs
-							availableIPs := calculateAvailableIPs(addressPrefix)
-
-							content.WriteString(fmt.Sprintf("| %s | `%s` | ~%d | %s | %s |\n",
-								subnetName, addressPrefix, availableIPs, nsg, routeTable))
+							// One row per prefix, so dual-stack subnets list IPv4 and IPv6 usage
+							rows := usageBySubnet[strings.ToLower(r.getString(subnet, "id"))]
+							if len(rows) == 0 {
+								content.WriteString(fmt.Sprintf("| %s | `%s` | - | - | - | %s | %s |\n",
+									subnetName, addressPrefix, nsg, routeTable))
+							}
+							for _, u := range rows {
+								utilization := fmt.Sprintf("%.1f%%", u.Utilization)
+								if u.OverThreshold {
+									utilization = "⚠️ " + utilization
+								}
+								content.WriteString(fmt.Sprintf("| %s | `%s` | %d | %s | %s | %s | %s |\n",
+									subnetName, u.Prefix, u.Used, formatAvailableIPs(u), utilization, nsg, routeTable))
+							}
 						}
 					}
 					content.WriteString("\n")
@@ -983,25 +1091,18 @@ func extractResourceName(resourceID string) string {
 	return resourceID
 }
 
-// Helper function to calculate available IPs in a subnet
-func calculateAvailableIPs(cidr string) int {
-	if cidr == "" || cidr == "N/A" {
-		return 0
-	}
-
-	parts := strings.Split(cidr, "/")
-	if len(parts) != 2 {
-		return 0
-	}
-
-	var prefixLen int
-	fmt.Sscanf(parts[1], "%d", &prefixLen)
+// formatAvailableIPs formats the unassigned addresses of a subnet prefix
+func formatAvailableIPs(u ipam.SubnetUsage) string {
+	return formatAddressCount(u.Prefix, u.Available)
+}
 
-	if prefixLen < 0 || prefixLen > 32 {
-		return 0
+// formatAddressCount formats a number of addresses in a prefix, showing the
+// order of magnitude for IPv6 subnets, which are usually /64
+func formatAddressCount(cidr string, count uint64) string {
+	if prefix, err := netip.ParsePrefix(cidr); err == nil {
+		if hostBits := prefix.Addr().BitLen() - prefix.Bits(); hostBits > 32 {
+			return fmt.Sprintf("~2^%d", hostBits)
+		}
 	}
-
-	totalIPs := 1 << (32 - prefixLen)
-	// Azure reserves 5 IPs per subnet
-	return totalIPs - 5
+	return fmt.Sprintf("%d", count)
 }
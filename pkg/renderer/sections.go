@@ -2,9 +2,15 @@ package renderer
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/automationpi/azdocs/pkg/analysis"
+	"github.com/automationpi/azdocs/pkg/ipam"
+	"github.com/automationpi/azdocs/pkg/models"
+	"github.com/automationpi/azdocs/pkg/nsg"
+	"github.com/automationpi/azdocs/pkg/pricing"
+	"github.com/automationpi/azdocs/pkg/waiver"
 )
 
 // PriorityAction represents a high-priority action item
@@ -22,10 +28,14 @@ func (r *MarkdownRenderer) getPriorityActions(security *analysis.SecurityAnalysi
 	// Add security critical items
 	for _, finding := range security.Findings {
 		if finding.Severity == "Critical" || finding.Severity == "High" {
+			label := "Security"
+			if finding.Hygiene() {
+				label = "Network"
+			}
 			actions = append(actions, PriorityAction{
 				Icon:     "🔴",
 				Title:    finding.Issue,
-				Impact:   fmt.Sprintf("Security: %s", finding.Impact),
+				Impact:   fmt.Sprintf("%s: %s", label, finding.Impact),
 				Severity: finding.Severity,
 			})
 		}
@@ -44,11 +54,12 @@ func (r *MarkdownRenderer) getPriorityActions(security *analysis.SecurityAnalysi
 	}
 
 	// Add tagging issues
-	for _, finding := range tagging.Findings {
-		if finding.Severity == "High" && len(finding.Resources) > 5 {
+	for _, group := range groupTagFindings(tagging.Findings) {
+		finding := group[0]
+		if finding.Severity == "High" && len(group) > 5 {
 			actions = append(actions, PriorityAction{
 				Icon:     "🏷️",
-				Title:    finding.Issue,
+				Title:    fmt.Sprintf("%s (%d resources)", finding.Issue, len(group)),
 				Impact:   "Governance: " + finding.Impact,
 				Severity: finding.Severity,
 			})
@@ -56,14 +67,20 @@ func (r *MarkdownRenderer) getPriorityActions(security *analysis.SecurityAnalysi
 	}
 
 	// Add compliance issues
+	counts := make(map[string]int)
+	for _, finding := range compliance.Findings {
+		counts[finding.RuleID+"/"+finding.Detail]++
+	}
 	for _, finding := range compliance.Findings {
-		if finding.Severity == "High" {
+		key := finding.RuleID + "/" + finding.Detail
+		if finding.Severity == "High" && counts[key] > 0 {
 			actions = append(actions, PriorityAction{
 				Icon:     "⚠️",
-				Title:    finding.Issue,
+				Title:    fmt.Sprintf("%s (%d resources)", finding.Issue, counts[key]),
 				Impact:   finding.Impact,
 				Severity: finding.Severity,
 			})
+			counts[key] = 0
 		}
 	}
 
@@ -104,17 +121,154 @@ func (r *MarkdownRenderer) generateSecuritySection(content *strings.Builder, sec
 	}
 }
 
+// generateNSGCleanupSection generates the per-NSG clean-up report
+func (r *MarkdownRenderer) generateNSGCleanupSection(content *strings.Builder, cleanups []analysis.NSGCleanup) {
+	content.WriteString("### NSG Cleanup\n\n")
+
+	needed := 0
+	for _, cleanup := range cleanups {
+		if !cleanup.HasIssues() {
+			continue
+		}
+		needed++
+
+		content.WriteString(fmt.Sprintf("#### %s (%s, %d rules)\n\n", cleanup.NSG, cleanup.ResourceGroup, cleanup.RuleCount))
+		if cleanup.Unattached {
+			content.WriteString("⚠️ Not associated with any subnet or network interface.\n\n")
+		}
+		if len(cleanup.Issues) > 0 {
+			content.WriteString("| Rule | Direction | Priority | Issue |\n")
+			content.WriteString("|------|-----------|----------|-------|\n")
+			for _, issue := range cleanup.Issues {
+				content.WriteString(fmt.Sprintf("| %s | %s | %d | %s |\n", issue.Rule, issue.Direction, issue.Priority, issue.Issue))
+			}
+			content.WriteString("\n")
+		}
+	}
+
+	if needed == 0 {
+		content.WriteString("✅ No shadowed, duplicate or broken NSG rules and no unattached NSGs.\n\n")
+	}
+}
+
+// generateRouteAnalysisSection generates the route table findings
+func (r *MarkdownRenderer) generateRouteAnalysisSection(content *strings.Builder, issues []analysis.RouteIssue) {
+	content.WriteString("### Route Analysis\n\n")
+
+	if len(issues) == 0 {
+		content.WriteString("✅ No black holes, broken next hops, conflicting routes, unattached route tables or asymmetric paths.\n\n")
+		return
+	}
+
+	content.WriteString("| Route Table | Route | Rule | Issue |\n")
+	content.WriteString("|-------------|-------|------|-------|\n")
+	for _, issue := range issues {
+		content.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", issue.RouteTable, valueOrDash(issue.Route), issue.RuleID, issue.Issue))
+	}
+	content.WriteString("\n")
+}
+
+// generateTopologySection generates the hub-and-spoke summary and the
+// peering health checks
+func (r *MarkdownRenderer) generateTopologySection(content *strings.Builder, topology analysis.Topology, issues []analysis.PeeringIssue) {
+	content.WriteString("### Hub-and-Spoke Topology\n\n")
+
+	if len(topology.Hubs) == 0 {
+		content.WriteString("No hub-and-spoke topology detected.\n\n")
+	} else {
+		spokes := 0
+		for _, hub := range topology.Hubs {
+			spokes += len(hub.Spokes)
+		}
+		content.WriteString(fmt.Sprintf("**Hub-and-spoke detected:** %d hub(s), %d spoke(s)\n\n", len(topology.Hubs), spokes))
+		content.WriteString("| Hub | Gateway | Firewall | Spokes |\n")
+		content.WriteString("|-----|---------|----------|--------|\n")
+		for _, hub := range topology.Hubs {
+			content.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+				hub.Name, yesNo(hub.Gateway), yesNo(hub.Firewall), valueOrDash(strings.Join(hub.Spokes, ", "))))
+		}
+		content.WriteString("\n")
+	}
+
+	if len(topology.Orphans) > 0 {
+		content.WriteString(fmt.Sprintf("**Orphaned VNets (no connected peerings):** %s\n\n", strings.Join(topology.Orphans, ", ")))
+	}
+	if len(topology.Other) > 0 {
+		content.WriteString(fmt.Sprintf("**Other peered VNets (not hub or spoke):** %s\n\n", strings.Join(topology.Other, ", ")))
+	}
+
+	content.WriteString("### Peering Health\n\n")
+	if len(issues) == 0 {
+		content.WriteString("✅ All peerings are connected in both directions, remote gateways exist and spokes route to each other through an appliance.\n\n")
+		return
+	}
+
+	content.WriteString("| VNet | Peering | Rule | Issue |\n")
+	content.WriteString("|------|---------|------|-------|\n")
+	for _, issue := range issues {
+		content.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", issue.VNet, issue.Peering, issue.RuleID, issue.Issue))
+	}
+	content.WriteString("\n")
+}
+
+// generateAddressOverlapSection generates the address space overlaps and
+// subnets above the utilization threshold
+func generateAddressOverlapSection(content *strings.Builder, usage *ipam.Analysis) {
+	if usage == nil {
+		return
+	}
+
+	content.WriteString("### Address Space Overlaps\n\n")
+	if len(usage.Overlaps) == 0 {
+		content.WriteString("✅ No overlapping VNet address spaces, including peered VNets outside the scan.\n\n")
+	} else {
+		content.WriteString("| VNet | Address Space | Overlaps VNet | Address Space | Relationship |\n")
+		content.WriteString("|------|---------------|---------------|---------------|--------------|\n")
+		for _, o := range usage.Overlaps {
+			content.WriteString(fmt.Sprintf("| %s | `%s` | %s | `%s` | %s |\n", o.VNetA, o.PrefixA, o.VNetB, o.PrefixB, o.Relationship()))
+		}
+		content.WriteString("\n")
+	}
+
+	if full := usage.OverThreshold(); len(full) > 0 {
+		content.WriteString(fmt.Sprintf("⚠️ **%d subnet(s) above %.0f%% utilization:** ", len(full), usage.Threshold))
+		var names []string
+		for _, s := range full {
+			names = append(names, fmt.Sprintf("%s/%s (%.0f%%)", s.VNet, s.Subnet, s.Utilization))
+		}
+		content.WriteString(strings.Join(names, ", ") + "\n\n")
+	}
+}
+
 // generateCostSection generates the cost optimization section
 func (r *MarkdownRenderer) generateCostSection(content *strings.Builder, cost *analysis.CostAnalysis) {
 	content.WriteString(fmt.Sprintf("**Cost Health:** %s (Score: %d/100)\n\n", cost.GetCostHealth(), cost.GetCostScore()))
-	content.WriteString(fmt.Sprintf("**Estimated Monthly Cost:** $%.2f\n\n", cost.TotalMonthlyCost))
+	if cost.Actual != nil {
+		content.WriteString(fmt.Sprintf("**Actual Monthly Cost:** $%.2f\n\n", cost.TotalMonthlyCost))
+	} else {
+		content.WriteString(fmt.Sprintf("**Estimated Monthly Cost:** $%.2f\n\n", cost.TotalMonthlyCost))
+	}
 	content.WriteString(fmt.Sprintf("**Potential Monthly Savings:** $%.2f (%.0f%%)\n\n",
 		cost.PotentialMonthlySavings,
 		(cost.PotentialMonthlySavings/cost.TotalMonthlyCost)*100))
+	if cost.Actual != nil {
+		months := "no usage dates"
+		if len(cost.Actual.Months) > 0 {
+			months = strings.Join(cost.Actual.Months, ", ")
+		}
+		content.WriteString(fmt.Sprintf("*Actual spend (%s) from Cost Management export %s, averaged over billing months: %s.*\n\n",
+			cost.Actual.Currency, cost.Actual.Source, months))
+	} else if cost.PriceSource != "" {
+		content.WriteString(fmt.Sprintf("*Estimated from pay-as-you-go prices (%s): %s. Usage-based charges such as data transfer and storage capacity are not included.*\n\n",
+			cost.Currency, cost.PriceSource))
+	}
+
+	if !cost.MetricsProvided {
+		content.WriteString("*VM right-sizing was skipped: no Azure Monitor metrics were provided (`--metrics`).*\n\n")
+	}
 
 	if len(cost.Findings) == 0 {
 		content.WriteString("✅ No major cost optimization opportunities detected.\n\n")
-		return
 	}
 
 	// Group by category
@@ -148,55 +302,456 @@ func (r *MarkdownRenderer) generateCostSection(content *strings.Builder, cost *a
 		}
 		content.WriteString("\n")
 	}
+
+	generateOrphanSection(content, cost)
+	generateCommitmentSection(content, cost)
+
+	if cost.Actual != nil {
+		generateActualSpendSection(content, cost.Actual)
+	} else {
+		generateUnpricedSection(content, cost.Unpriced)
+	}
+}
+
+// generateOrphanSection summarizes unused resources by type
+func generateOrphanSection(content *strings.Builder, cost *analysis.CostAnalysis) {
+	summaries := cost.OrphansByType()
+	if len(summaries) == 0 {
+		return
+	}
+
+	content.WriteString("### Unused Resources by Type\n\n")
+	content.WriteString("| Resource Type | Count | Monthly Cost |\n")
+	content.WriteString("|---------------|-------|--------------|\n")
+	for _, s := range summaries {
+		content.WriteString(fmt.Sprintf("| %s | %d | $%.2f |\n", s.Type, s.Count, s.Monthly))
+	}
+	content.WriteString("\n*Unattached NSGs and route tables are reported under Security.*\n\n")
+}
+
+// generateCommitmentSection lists reservation and savings plan savings for
+// always-on VMs by size family and region
+func generateCommitmentSection(content *strings.Builder, cost *analysis.CostAnalysis) {
+	if len(cost.Commitments) == 0 && len(cost.CommitmentExclusions) == 0 {
+		return
+	}
+
+	content.WriteString("### Commitment Opportunities\n\n")
+	if len(cost.Commitments) == 0 {
+		content.WriteString("No always-on VMs qualify for reservations or savings plans.\n\n")
+	} else {
+		content.WriteString("*Always-on VMs by size family and region, the scope of a reservation with instance size flexibility. " +
+			"Monthly savings are against Linux pay-as-you-go compute rates; Windows licenses are not covered by commitments.*\n\n")
+		content.WriteString("| Family | Region | VMs | vCPUs | Pay-as-you-go |")
+		for _, kind := range []string{pricing.Reservation, pricing.SavingsPlan} {
+			for _, years := range pricing.CommitmentTerms {
+				content.WriteString(fmt.Sprintf(" %s |", commitmentName(kind, years)))
+			}
+		}
+		content.WriteString("\n|--------|--------|-----|-------|---------------|")
+		content.WriteString(strings.Repeat("------|", 2*len(pricing.CommitmentTerms)))
+		content.WriteString("\n")
+
+		for _, o := range cost.Commitments {
+			region := o.Region
+			if o.Approximate {
+				region += " *"
+			}
+			content.WriteString(fmt.Sprintf("| %s | %s | %d (%s) | %d | $%.2f |",
+				o.Family, region, len(o.VMs), commitmentSizes(o.Sizes), o.VCPUs, o.PayAsYouGo))
+			for _, kind := range []string{pricing.Reservation, pricing.SavingsPlan} {
+				for _, years := range pricing.CommitmentTerms {
+					saving, ok := o.Saving(kind, years)
+					if !ok {
+						content.WriteString(" - |")
+						continue
+					}
+					content.WriteString(fmt.Sprintf(" $%.2f (%.0f%%) |", saving.Savings, (1-saving.Breakeven())*100))
+				}
+			}
+			content.WriteString("\n")
+		}
+		content.WriteString("\n")
+
+		content.WriteString("**Breakeven:** commitments are billed whether or not the VMs run, so they save money only while the VMs run more than the share of hours below.\n\n")
+		for _, total := range cost.CommitmentTotals() {
+			breakeven := total.Breakeven()
+			content.WriteString(fmt.Sprintf("- **%s:** saves $%.2f/month; breaks even at %.0f%% uptime, about %.1f of the %d months of the term\n",
+				commitmentName(total.Kind, total.Years), total.Savings, breakeven*100, breakeven*float64(12*total.Years), 12*total.Years))
+		}
+		content.WriteString("\nReservations apply to one size family and region; savings plans apply to compute in any size and region at a smaller discount.\n\n")
+		for _, o := range cost.Commitments {
+			if o.Approximate {
+				content.WriteString(fmt.Sprintf("\\* Priced at %s rates.\n\n", pricing.DefaultRegion))
+				break
+			}
+		}
+	}
+
+	if len(cost.CommitmentExclusions) > 0 {
+		excluded := make([]string, len(cost.CommitmentExclusions))
+		for i, e := range cost.CommitmentExclusions {
+			excluded[i] = fmt.Sprintf("%s (%s)", e.VM, e.Reason)
+		}
+		content.WriteString(fmt.Sprintf("*Left out:* %s\n\n", strings.Join(excluded, ", ")))
+	}
+}
+
+// commitmentName names a commitment term, e.g. "3-Year Reservation"
+func commitmentName(kind string, years int) string {
+	return fmt.Sprintf("%d-Year %s", years, kind)
+}
+
+// commitmentSizes formats VM size counts, e.g. "2× Standard_D4s_v3"
+func commitmentSizes(sizes map[string]int) string {
+	names := make([]string, 0, len(sizes))
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%d× %s", sizes[name], name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// generateActualSpendSection breaks actual spend down by resource group, tag
+// and resource
+func generateActualSpendSection(content *strings.Builder, actual *analysis.ActualCost) {
+	content.WriteString("### Actual Spend by Resource Group\n\n")
+	content.WriteString("| Resource Group | Resources | Monthly Cost | Share |\n")
+	content.WriteString("|----------------|-----------|--------------|-------|\n")
+	for _, s := range actual.ResourceGroups {
+		content.WriteString(fmt.Sprintf("| %s | %d | $%.2f | %s |\n", s.Name, s.Resources, s.Monthly, spendShare(s.Monthly, actual.Total)))
+	}
+	if actual.Unassigned != 0 {
+		content.WriteString(fmt.Sprintf("| *Not tied to a resource* | - | $%.2f | %s |\n", actual.Unassigned, spendShare(actual.Unassigned, actual.Total)))
+	}
+	content.WriteString("\n")
+
+	for _, key := range analysis.SpendTags {
+		values := actual.Tags[key]
+		if len(values) == 0 {
+			continue
+		}
+		content.WriteString(fmt.Sprintf("### Actual Spend by `%s`\n\n", key))
+		content.WriteString("| Value | Resources | Monthly Cost | Share |\n")
+		content.WriteString("|-------|-----------|--------------|-------|\n")
+		for _, s := range values {
+			content.WriteString(fmt.Sprintf("| %s | %d | $%.2f | %s |\n", s.Name, s.Resources, s.Monthly, spendShare(s.Monthly, actual.Total)))
+		}
+		content.WriteString("\n")
+	}
+
+	content.WriteString("### Top Resources by Actual Spend\n\n")
+	content.WriteString("| Resource | Resource Group | Type | Actual Monthly | Estimated Monthly |\n")
+	content.WriteString("|----------|----------------|------|----------------|-------------------|\n")
+	for i, s := range actual.Resources {
+		if i >= 20 {
+			content.WriteString(fmt.Sprintf("| ... | *%d more resources* | - | - | - |\n", len(actual.Resources)-20))
+			break
+		}
+		estimated, resType := "-", "*not scanned*"
+		if s.Scanned {
+			resType = s.Type
+		}
+		if s.Priced {
+			estimated = fmt.Sprintf("$%.2f", s.Estimated)
+		}
+		content.WriteString(fmt.Sprintf("| %s | %s | %s | $%.2f | %s |\n", s.Name, s.ResourceGroup, resType, s.Monthly, estimated))
+	}
+	content.WriteString("\n")
+}
+
+// spendShare formats a cost as a percentage of the total
+func spendShare(monthly, total float64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", monthly/total*100)
+}
+
+// generateUnpricedSection lists resources that are missing from the
+// estimated cost, or priced at another region's rates
+func generateUnpricedSection(content *strings.Builder, unpriced []pricing.Estimate) {
+	if len(unpriced) == 0 {
+		return
+	}
+
+	content.WriteString(fmt.Sprintf("### Unpriced Resources (%d)\n\n", len(unpriced)))
+	content.WriteString("These resources are not included in the estimated monthly cost, or are priced at another region's rates.\n\n")
+	content.WriteString("| Resource | Type | Region | SKU | Estimate | Reason |\n")
+	content.WriteString("|----------|------|--------|-----|----------|--------|\n")
+	for _, e := range unpriced {
+		estimate := "-"
+		if e.Priced {
+			estimate = fmt.Sprintf("~$%.2f", e.Monthly)
+		}
+		sku := e.SKU
+		if sku == "" {
+			sku = "-"
+		}
+		content.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+			e.Name, e.Type, e.Region, sku, estimate, e.Reason))
+	}
+	content.WriteString("\n")
 }
 
 // generateTaggingSection generates the tagging compliance section
 func (r *MarkdownRenderer) generateTaggingSection(content *strings.Builder, tagging *analysis.TaggingAnalysis) {
 	content.WriteString(fmt.Sprintf("**Tagging Health:** %s (Score: %d/100)\n\n", tagging.GetTaggingHealth(), tagging.GetTaggingScore()))
-	content.WriteString(fmt.Sprintf("**Compliance Rate:** %.0f%% (%d/%d resources tagged)\n\n",
+	content.WriteString(fmt.Sprintf("**Compliance Rate:** %.0f%% (%d/%d resources compliant, %d untagged)\n\n",
 		tagging.ComplianceRate,
-		tagging.TaggedResources,
-		tagging.TotalResources))
+		tagging.CompliantResources,
+		tagging.TotalResources,
+		tagging.UntaggedResources))
 
-	content.WriteString("**Required Tags:** ")
-	for i, tag := range tagging.RequiredTags {
-		if i > 0 {
-			content.WriteString(", ")
-		}
-		content.WriteString(fmt.Sprintf("`%s`", tag))
-	}
-	content.WriteString("\n\n")
+	r.generateTagPolicySummary(content, tagging)
+	r.generateTagGroupTable(content, tagging.ResourceGroups)
 
 	if len(tagging.Findings) == 0 {
 		content.WriteString("✅ Excellent tagging compliance!\n\n")
 		return
 	}
 
-	// Group by category
-	for _, finding := range tagging.Findings {
+	// One heading per issue, listing the resources it affects
+	for _, group := range groupTagFindings(tagging.Findings) {
+		finding := group[0]
+		var resources []string
+		for _, f := range group {
+			resources = append(resources, f.Resources...)
+		}
+
 		severityIcon := getSeverityIcon(finding.Severity)
-		content.WriteString(fmt.Sprintf("### %s %s: %s\n\n", severityIcon, finding.Severity, finding.Issue))
+		issue := finding.Issue
+		if len(resources) > 1 {
+			issue = fmt.Sprintf("%s (%d resources)", issue, len(resources))
+		}
+		content.WriteString(fmt.Sprintf("### %s %s: %s\n\n", severityIcon, finding.Severity, issue))
 		content.WriteString(fmt.Sprintf("**Impact:** %s\n\n", finding.Impact))
 		content.WriteString(fmt.Sprintf("**Remediation:** %s\n\n", finding.Remediation))
 
-		if len(finding.Resources) > 0 && len(finding.Resources) <= 10 {
+		if len(resources) > 0 && len(resources) <= 10 {
 			content.WriteString("**Affected Resources:**\n")
-			for _, res := range finding.Resources {
+			for _, res := range resources {
 				content.WriteString(fmt.Sprintf("- %s\n", res))
 			}
 			content.WriteString("\n")
-		} else if len(finding.Resources) > 10 {
-			content.WriteString(fmt.Sprintf("**Affected Resources:** %d resources (first 10 shown)\n", len(finding.Resources)))
+		} else if len(resources) > 10 {
+			content.WriteString(fmt.Sprintf("**Affected Resources:** %d resources (first 10 shown)\n", len(resources)))
 			for i := 0; i < 10; i++ {
-				content.WriteString(fmt.Sprintf("- %s\n", finding.Resources[i]))
+				content.WriteString(fmt.Sprintf("- %s\n", resources[i]))
 			}
-			content.WriteString(fmt.Sprintf("- *...and %d more*\n\n", len(finding.Resources)-10))
+			content.WriteString(fmt.Sprintf("- *...and %d more*\n\n", len(resources)-10))
 		}
 
 		content.WriteString("---\n\n")
 	}
 }
 
+// groupTagFindings groups the per-resource tagging findings by rule and tag,
+// in the order each issue was first reported
+func groupTagFindings(findings []analysis.TagFinding) [][]analysis.TagFinding {
+	var groups [][]analysis.TagFinding
+	index := make(map[string]int)
+	for _, f := range findings {
+		key := f.RuleID + "/" + f.Detail
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], f)
+	}
+	return groups
+}
+
+// generateTagPolicySummary lists the tagging policy the resources were
+// checked against
+func (r *MarkdownRenderer) generateTagPolicySummary(content *strings.Builder, tagging *analysis.TaggingAnalysis) {
+	policy := tagging.Policy
+
+	content.WriteString("**Required Tags:** ")
+	for i, tag := range tagging.RequiredTags {
+		if i > 0 {
+			content.WriteString(", ")
+		}
+		content.WriteString(fmt.Sprintf("`%s`", tag))
+	}
+	content.WriteString("\n\n")
+
+	for _, scope := range policy.Scopes {
+		var selects []string
+		if len(scope.Types) > 0 {
+			selects = append(selects, "types "+strings.Join(scope.Types, ", "))
+		}
+		if len(scope.ResourceGroups) > 0 {
+			selects = append(selects, "resource groups "+strings.Join(scope.ResourceGroups, ", "))
+		}
+		content.WriteString(fmt.Sprintf("- Also required of %s: `%s`\n", strings.Join(selects, " in "), strings.Join(scope.Required, "`, `")))
+	}
+	for _, rule := range policy.Values {
+		var allowed []string
+		if len(rule.Values) > 0 {
+			allowed = append(allowed, "one of "+strings.Join(rule.Values, ", "))
+		}
+		if rule.Pattern != "" {
+			allowed = append(allowed, fmt.Sprintf("matching `%s`", rule.Pattern))
+		}
+		description := strings.Join(allowed, " and ")
+		if rule.Description != "" {
+			description = rule.Description
+		}
+		content.WriteString(fmt.Sprintf("- `%s` must be %s\n", rule.Tag, description))
+	}
+	if policy.KeyCase == analysis.KeyCaseExact {
+		content.WriteString("- Tag keys must be spelled exactly as in the policy\n")
+	}
+	if policy.ValueCase == analysis.ValueCaseLower || policy.ValueCase == analysis.ValueCaseUpper {
+		content.WriteString(fmt.Sprintf("- Tag values must be %s case\n", policy.ValueCase))
+	}
+	if policy.Inherit {
+		content.WriteString("- Tags of a resource group count for its resources\n")
+	}
+	for _, e := range policy.Exemptions {
+		var selects []string
+		for _, list := range [][]string{e.Names, e.Types, e.ResourceGroups} {
+			if len(list) > 0 {
+				selects = append(selects, strings.Join(list, ", "))
+			}
+		}
+		from := "the policy"
+		if len(e.Tags) > 0 {
+			from = "`" + strings.Join(e.Tags, "`, `") + "`"
+		}
+		content.WriteString(fmt.Sprintf("- Exempt from %s: %s", from, strings.Join(selects, " / ")))
+		if e.Reason != "" {
+			content.WriteString(fmt.Sprintf(" (%s)", e.Reason))
+		}
+		content.WriteString("\n")
+	}
+	if tagging.ExemptResources > 0 {
+		content.WriteString(fmt.Sprintf("\n*%d resources are exempt from the policy and not counted.*\n", tagging.ExemptResources))
+	}
+	content.WriteString("\n")
+}
+
+// generateTagGroupTable generates the per-resource-group tagging compliance
+// table, least compliant first
+func (r *MarkdownRenderer) generateTagGroupTable(content *strings.Builder, groups []analysis.TagGroupCompliance) {
+	if len(groups) == 0 {
+		return
+	}
+
+	content.WriteString("### Compliance by Resource Group\n\n")
+	content.WriteString("| Resource Group | Resources | Compliant | Rate | Missing Tags | Invalid |\n")
+	content.WriteString("|----------------|-----------|-----------|------|--------------|---------|\n")
+	for _, g := range groups {
+		tags := make([]string, 0, len(g.Missing))
+		for tag := range g.Missing {
+			tags = append(tags, tag)
+		}
+		sort.Slice(tags, func(i, j int) bool {
+			if g.Missing[tags[i]] != g.Missing[tags[j]] {
+				return g.Missing[tags[i]] > g.Missing[tags[j]]
+			}
+			return tags[i] < tags[j]
+		})
+		missing := make([]string, len(tags))
+		for i, tag := range tags {
+			missing[i] = fmt.Sprintf("%s (%d)", tag, g.Missing[tag])
+		}
+
+		content.WriteString(fmt.Sprintf("| %s | %d | %d | %.0f%% | %s | %d |\n",
+			valueOrDash(g.Name), g.Resources, g.Compliant, g.Rate(), valueOrDash(strings.Join(missing, ", ")), g.Invalid))
+	}
+	content.WriteString("\n")
+}
+
+// generateEffectiveRoutesSection generates the per-NIC effective routes tables
+func (r *MarkdownRenderer) generateEffectiveRoutesSection(content *strings.Builder, nicRoutes []models.EffectiveRoutes) {
+	content.WriteString("### Effective Routes\n\n")
+
+	if len(nicRoutes) == 0 {
+		content.WriteString("*No effective routes captured. Run `azdoc scan` with `rendering.include-effective-routes: true`.*\n\n")
+		return
+	}
+
+	for _, nic := range nicRoutes {
+		content.WriteString(fmt.Sprintf("#### %s\n\n", nic.NICName))
+		content.WriteString("| Source | State | Address Prefixes | Next Hop Type | Next Hop IP |\n")
+		content.WriteString("|--------|-------|------------------|---------------|-------------|\n")
+
+		for i, route := range nic.Routes {
+			if r.config.MaxRoutesPerNIC > 0 && i >= r.config.MaxRoutesPerNIC {
+				content.WriteString(fmt.Sprintf("| ... | *%d more routes* | - | - | - |\n", len(nic.Routes)-i))
+				break
+			}
+
+			nextHop := "-"
+			if len(route.NextHopIPAddresses) > 0 {
+				nextHop = strings.Join(route.NextHopIPAddresses, ", ")
+			}
+			content.WriteString(fmt.Sprintf("| %s | %s | `%s` | %s | %s |\n",
+				route.Source,
+				route.State,
+				strings.Join(route.AddressPrefixes, "`, `"),
+				route.NextHopType,
+				nextHop))
+		}
+		content.WriteString("\n")
+	}
+}
+
+// generateEffectiveAccessSection generates the per-NIC Internet access table,
+// combining subnet and NIC NSGs
+func (r *MarkdownRenderer) generateEffectiveAccessSection(content *strings.Builder, access []nsg.Access) {
+	content.WriteString("### Effective NSG Access\n\n")
+
+	if len(access) == 0 {
+		content.WriteString("*No network interfaces found.*\n\n")
+		return
+	}
+
+	content.WriteString("| NIC | VM | Private IP | Public IP | Subnet NSG | NIC NSG | Outbound to Internet | Inbound from Internet |\n")
+	content.WriteString("|-----|----|------------|-----------|------------|---------|----------------------|-----------------------|\n")
+	for _, a := range access {
+		icon := "✅"
+		if a.Reachable {
+			icon = "⚠️"
+		}
+		content.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s | %s | %s %s |\n",
+			a.NICName,
+			valueOrDash(a.VMName),
+			valueOrDash(a.PrivateIP),
+			valueOrDash(a.PublicIP),
+			valueOrDash(a.SubnetNSG),
+			valueOrDash(a.NICNSG),
+			valueOrDash(nsg.FormatPorts(a.Outbound)),
+			icon,
+			a.Status))
+	}
+	content.WriteString("\n")
+}
+
+// valueOrDash returns "-" for empty table cells
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// yesNo formats a flag for table cells
+func yesNo(value bool) string {
+	if value {
+		return "Yes"
+	}
+	return "No"
+}
+
 func getSeverityIcon(severity string) string {
 	switch severity {
 	case "Critical":
@@ -324,3 +879,51 @@ func (r *MarkdownRenderer) generateAICostInsights(content *strings.Builder, insi
 		}
 	}
 }
+
+// generateWaivedSection lists findings suppressed by waivers and waivers
+// that have expired
+func (r *MarkdownRenderer) generateWaivedSection(content *strings.Builder, result *waiver.Result) {
+	content.WriteString("Accepted risks from the waiver file. Waived findings are excluded from the scores above.\n\n")
+
+	if len(result.Waived) > 0 {
+		content.WriteString("| Severity | Rule | Finding | Justification | Owner | Expires |\n")
+		content.WriteString("|----------|------|---------|---------------|-------|---------|\n")
+		for _, waived := range result.Waived {
+			content.WriteString(fmt.Sprintf("| %s %s | %s | %s | %s | %s | %s |\n",
+				getSeverityIcon(waived.Severity),
+				waived.Severity,
+				waived.RuleID,
+				waived.Issue,
+				waived.Waiver.Justification,
+				waived.Waiver.Owner,
+				waived.Waiver.Expires))
+		}
+		content.WriteString("\n")
+	}
+
+	if len(result.Expired) > 0 {
+		content.WriteString("### ⏰ Expired Waivers\n\n")
+		content.WriteString("These waivers are no longer applied; their findings are reported above again.\n\n")
+		content.WriteString("| Waiver | Owner | Expired |\n")
+		content.WriteString("|--------|-------|---------|\n")
+		for _, expired := range result.Expired {
+			content.WriteString(fmt.Sprintf("| %s | %s | %s |\n", describeWaiver(expired), expired.Owner, expired.Expires))
+		}
+		content.WriteString("\n")
+	}
+}
+
+// describeWaiver names what a waiver targets
+func describeWaiver(w waiver.Waiver) string {
+	var parts []string
+	if w.Fingerprint != "" {
+		parts = append(parts, fmt.Sprintf("`%s`", w.Fingerprint))
+	}
+	if w.Rule != "" {
+		parts = append(parts, w.Rule)
+	}
+	if w.Resource != "" {
+		parts = append(parts, fmt.Sprintf("`%s`", w.Resource))
+	}
+	return strings.Join(parts, " ")
+}
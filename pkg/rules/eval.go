@@ -0,0 +1,423 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+)
+
+// resourcePrefix makes a path inside forEach refer to the enclosing resource
+const resourcePrefix = "$resource."
+
+// Apply evaluates custom rules against resources and adds their findings to
+// the report, so they count towards scores like built-in findings
+func Apply(report *analysis.Report, rules []Rule, resources []map[string]interface{}) {
+	for _, rule := range rules {
+		report.Add(rule.Catalog(), rule.Evaluate(resources))
+	}
+}
+
+// Evaluate returns a finding for every selected resource, or forEach
+// element, that meets the rule's conditions
+func (r Rule) Evaluate(resources []map[string]interface{}) []analysis.Finding {
+	var findings []analysis.Finding
+
+	for _, resource := range resources {
+		if !r.Resource.selects(resource) {
+			continue
+		}
+
+		if r.ForEach == "" {
+			if r.matches(resource, resource) {
+				findings = append(findings, r.finding(resource, nil))
+			}
+			continue
+		}
+
+		for _, value := range resolve(resource, r.ForEach) {
+			for _, element := range elements(value) {
+				if r.matches(element, resource) {
+					findings = append(findings, r.finding(resource, element))
+				}
+			}
+		}
+	}
+
+	return findings
+}
+
+// selects reports whether a resource is in scope of the selector
+func (s Selector) selects(resource map[string]interface{}) bool {
+	if !globMatch(s.Type, getString(resource, "type")) {
+		return false
+	}
+	if s.Location != "" && !globMatch(s.Location, getString(resource, "location")) {
+		return false
+	}
+	if len(s.Tags) > 0 {
+		tags, _ := resource["tags"].(map[string]interface{})
+		for key, want := range s.Tags {
+			value, ok := lookupFold(tags, key)
+			if !ok || !globMatch(want, fmt.Sprintf("%v", value)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matches reports whether all When and, if given, any Any condition hold
+func (r Rule) matches(context, resource map[string]interface{}) bool {
+	for _, c := range r.When {
+		if !c.holds(context, resource) {
+			return false
+		}
+	}
+	if len(r.Any) == 0 {
+		return true
+	}
+	for _, c := range r.Any {
+		if c.holds(context, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// holds evaluates a condition. Positive operators hold if any value found at
+// the path satisfies them; their negations hold if none does.
+func (c Condition) holds(context, resource map[string]interface{}) bool {
+	var values []interface{}
+	if strings.HasPrefix(c.Path, resourcePrefix) {
+		values = resolve(resource, strings.TrimPrefix(c.Path, resourcePrefix))
+	} else {
+		values = resolve(context, c.Path)
+	}
+
+	switch c.Op {
+	case OpExists:
+		return len(values) > 0
+	case OpNotExists:
+		return len(values) == 0
+	case OpNotEquals:
+		return !anyValue(values, func(v interface{}) bool { return equal(v, c.Value) })
+	case OpNotIn:
+		return !anyValue(values, func(v interface{}) bool { return in(v, c.Value) })
+	case OpEquals:
+		return anyValue(values, func(v interface{}) bool { return equal(v, c.Value) })
+	case OpIn:
+		return anyValue(values, func(v interface{}) bool { return in(v, c.Value) })
+	case OpContains:
+		return anyValue(values, func(v interface{}) bool { return contains(v, c.Value) })
+	case OpMatches:
+		re := c.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(fmt.Sprintf("%v", c.Value)); err != nil {
+				return false
+			}
+		}
+		return anyValue(values, func(v interface{}) bool {
+			s, ok := v.(string)
+			return ok && re.MatchString(s)
+		})
+	default:
+		return anyValue(values, func(v interface{}) bool { return compare(v, c.Op, c.Value) })
+	}
+}
+
+// finding builds the finding for a resource and optional forEach element
+func (r Rule) finding(resource, element map[string]interface{}) analysis.Finding {
+	item := ""
+	if element != nil {
+		item = getString(element, "name")
+	}
+	return analysis.Finding{
+		RuleID:      r.ID,
+		Analysis:    r.Analysis,
+		Severity:    r.Severity,
+		Category:    r.Category,
+		Resources:   []string{getString(resource, "name")},
+		ResourceIDs: []string{getString(resource, "id")},
+		Detail:      item,
+		Issue:       render(r.Issue, resource, element),
+		Impact:      render(r.Impact, resource, element),
+		Remediation: render(r.Remediation, resource, element),
+	}
+}
+
+// templateVar matches {{name}} placeholders in messages
+var templateVar = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// render substitutes placeholders in a message: {{name}}, {{id}}, {{type}},
+// {{location}} and {{resourceGroup}} describe the resource, {{item}} is the
+// forEach element's name, and any other placeholder is resolved as a path
+// against the element (or resource).
+func render(template string, resource, element map[string]interface{}) string {
+	return templateVar.ReplaceAllStringFunc(template, func(match string) string {
+		key := templateVar.FindStringSubmatch(match)[1]
+		switch key {
+		case "name", "id", "type", "location", "resourceGroup":
+			return getString(resource, key)
+		case "item":
+			return getString(element, "name")
+		}
+
+		context := resource
+		path := key
+		if strings.HasPrefix(path, resourcePrefix) {
+			path = strings.TrimPrefix(path, resourcePrefix)
+		} else if element != nil {
+			context = element
+		}
+		var parts []string
+		for _, value := range resolve(context, path) {
+			parts = append(parts, fmt.Sprintf("%v", value))
+		}
+		return strings.Join(parts, ", ")
+	})
+}
+
+// resolve returns the values found at a path. Lists indexed with [*] fan out
+// to all their elements; missing properties yield no values.
+func resolve(root map[string]interface{}, path string) []interface{} {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	values := []interface{}{root}
+	if path == "" {
+		return values
+	}
+
+	for _, segment := range strings.Split(path, ".") {
+		name, indexes := splitIndexes(segment)
+
+		var next []interface{}
+		for _, value := range values {
+			if name != "" {
+				m, ok := value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if value, ok = lookupFold(m, name); !ok {
+					continue
+				}
+			}
+			next = append(next, index(value, indexes)...)
+		}
+		values = next
+	}
+
+	var present []interface{}
+	for _, value := range values {
+		if value != nil {
+			present = append(present, value)
+		}
+	}
+	return present
+}
+
+// splitIndexes splits "rules[0][*]" into "rules" and ["0", "*"]
+func splitIndexes(segment string) (string, []string) {
+	open := strings.Index(segment, "[")
+	if open < 0 {
+		return segment, nil
+	}
+	name := segment[:open]
+	var indexes []string
+	for _, part := range strings.Split(segment[open:], "[") {
+		if part = strings.TrimSuffix(part, "]"); part != "" {
+			indexes = append(indexes, part)
+		}
+	}
+	return name, indexes
+}
+
+// index applies list indexes to a value
+func index(value interface{}, indexes []string) []interface{} {
+	values := []interface{}{value}
+	for _, idx := range indexes {
+		var next []interface{}
+		for _, v := range values {
+			list, ok := v.([]interface{})
+			if !ok {
+				continue
+			}
+			if idx == "*" {
+				next = append(next, list...)
+				continue
+			}
+			i, err := strconv.Atoi(idx)
+			if err != nil {
+				continue
+			}
+			if i < 0 {
+				i += len(list)
+			}
+			if i >= 0 && i < len(list) {
+				next = append(next, list[i])
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// elements returns the objects in a forEach value: the items of a list or
+// the value itself if it is a single object
+func elements(value interface{}) []map[string]interface{} {
+	var result []map[string]interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				result = append(result, m)
+			}
+		}
+	case map[string]interface{}:
+		result = append(result, v)
+	}
+	return result
+}
+
+// lookupFold looks a key up in a map, falling back to a case-insensitive
+// match since ARM property names are case-insensitive
+func lookupFold(m map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := m[key]; ok {
+		return value, true
+	}
+	for k, value := range m {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func anyValue(values []interface{}, pred func(interface{}) bool) bool {
+	for _, value := range values {
+		if pred(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares a resource value with a rule value. Strings compare
+// case-insensitively and numbers by value; a string such as "true" or "443"
+// equals the matching boolean or number.
+func equal(actual, expected interface{}) bool {
+	if a, ok := toFloat(actual); ok {
+		if e, ok := toFloat(expected); ok {
+			return a == e
+		}
+	}
+	if a, ok := actual.(bool); ok {
+		if e, ok := expected.(bool); ok {
+			return a == e
+		}
+	}
+	if isScalar(actual) && isScalar(expected) {
+		return strings.EqualFold(fmt.Sprintf("%v", actual), fmt.Sprintf("%v", expected))
+	}
+	return reflect.DeepEqual(actual, expected)
+}
+
+// in reports whether actual equals any item of a list value
+func in(actual, list interface{}) bool {
+	items, _ := list.([]interface{})
+	for _, item := range items {
+		if equal(actual, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether a list holds the value, or a string contains it
+// as a case-insensitive substring
+func contains(actual, expected interface{}) bool {
+	switch v := actual.(type) {
+	case []interface{}:
+		return in(expected, v)
+	case string:
+		return strings.Contains(strings.ToLower(v), strings.ToLower(fmt.Sprintf("%v", expected)))
+	}
+	return false
+}
+
+// compare applies a numeric comparison operator
+func compare(actual interface{}, op string, expected interface{}) bool {
+	a, ok := toFloat(actual)
+	if !ok {
+		return false
+	}
+	e, ok := toFloat(expected)
+	if !ok {
+		return false
+	}
+	switch op {
+	case OpGT:
+		return a > e
+	case OpGTE:
+		return a >= e
+	case OpLT:
+		return a < e
+	case OpLTE:
+		return a <= e
+	}
+	return false
+}
+
+// toFloat converts numbers, and strings holding numbers, to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+// globMatch matches s against a pattern where "*" matches any characters,
+// ignoring case
+func globMatch(pattern, s string) bool {
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(s)
+}
+
+func getString(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	value, ok := lookupFold(m, key)
+	if !ok || value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,274 @@
+package rules
+
+import (
+	"testing"
+)
+
+// nsg is a raw NSG row with a mix of value types and case variations
+func nsg() map[string]interface{} {
+	return map[string]interface{}{
+		"id":       "/subscriptions/sub1/resourceGroups/rg-net/providers/Microsoft.Network/networkSecurityGroups/nsg-app",
+		"name":     "nsg-app",
+		"type":     "Microsoft.Network/networkSecurityGroups",
+		"location": "westeurope",
+		"tags":     map[string]interface{}{"Environment": "Prod", "owner": "network-team"},
+		"properties": map[string]interface{}{
+			"provisioningState": "Succeeded",
+			"flowLogs":          nil,
+			"enabled":           true,
+			"retentionDays":     float64(30),
+			"portString":        "443",
+			"securityRules": []interface{}{
+				map[string]interface{}{
+					"name": "allow-ssh",
+					"properties": map[string]interface{}{
+						"priority":             float64(100),
+						"access":               "Allow",
+						"destinationPortRange": "22",
+						"sourceAddressPrefix":  "*",
+					},
+				},
+				map[string]interface{}{
+					"name": "allow-web",
+					"properties": map[string]interface{}{
+						"priority":               float64(200),
+						"access":                 "Allow",
+						"destinationPortRanges":  []interface{}{"80", "443"},
+						"sourceAddressPrefixes":  []interface{}{"Internet"},
+						"destinationAddressType": map[string]interface{}{"kind": "vnet"},
+					},
+				},
+				map[string]interface{}{
+					"name": "deny-all",
+					"properties": map[string]interface{}{
+						"priority": "4096",
+						"access":   "Deny",
+					},
+				},
+			},
+		},
+	}
+}
+
+// holds compiles a condition and evaluates it against the NSG
+func holds(t *testing.T, c Condition) bool {
+	t.Helper()
+	if err := c.compile(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	resource := nsg()
+	return c.holds(resource, resource)
+}
+
+func TestConditionOperators(t *testing.T) {
+	tests := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"equals ignores case", Condition{Path: "properties.provisioningState", Value: "succeeded"}, true},
+		{"equals mismatch", Condition{Path: "properties.provisioningState", Op: OpEquals, Value: "Failed"}, false},
+		{"equals bool", Condition{Path: "properties.enabled", Value: true}, true},
+		{"equals bool as string", Condition{Path: "properties.enabled", Value: "true"}, true},
+		{"equals number", Condition{Path: "properties.retentionDays", Value: 30}, true},
+		{"equals number as string", Condition{Path: "properties.portString", Value: 443}, true},
+		{"notEquals", Condition{Path: "properties.provisioningState", Op: OpNotEquals, Value: "Failed"}, true},
+		{"notEquals same value", Condition{Path: "properties.provisioningState", Op: OpNotEquals, Value: "SUCCEEDED"}, false},
+		{"exists", Condition{Path: "properties.securityRules", Op: OpExists}, true},
+		{"exists null", Condition{Path: "properties.flowLogs", Op: OpExists}, false},
+		{"notExists null", Condition{Path: "properties.flowLogs", Op: OpNotExists}, true},
+		{"contains string", Condition{Path: "properties.provisioningState", Op: OpContains, Value: "CEED"}, true},
+		{"contains list", Condition{Path: "properties.securityRules[1].properties.destinationPortRanges", Op: OpContains, Value: "443"}, true},
+		{"contains list miss", Condition{Path: "properties.securityRules[1].properties.destinationPortRanges", Op: OpContains, Value: "8080"}, false},
+		{"in", Condition{Path: "location", Op: OpIn, Value: []interface{}{"eastus", "WestEurope"}}, true},
+		{"in miss", Condition{Path: "location", Op: OpIn, Value: []interface{}{"eastus"}}, false},
+		{"notIn", Condition{Path: "location", Op: OpNotIn, Value: []interface{}{"eastus"}}, true},
+		{"notIn hit", Condition{Path: "location", Op: OpNotIn, Value: []interface{}{"westeurope"}}, false},
+		{"matches", Condition{Path: "name", Op: OpMatches, Value: "^nsg-[a-z]+$"}, true},
+		{"matches is case sensitive", Condition{Path: "name", Op: OpMatches, Value: "^NSG-"}, false},
+		{"gt", Condition{Path: "properties.retentionDays", Op: OpGT, Value: 29}, true},
+		{"gt equal", Condition{Path: "properties.retentionDays", Op: OpGT, Value: 30}, false},
+		{"gte", Condition{Path: "properties.retentionDays", Op: OpGTE, Value: 30}, true},
+		{"lt", Condition{Path: "properties.retentionDays", Op: OpLT, Value: "31"}, true},
+		{"lte", Condition{Path: "properties.retentionDays", Op: OpLTE, Value: 29.5}, false},
+		{"gt on numeric string", Condition{Path: "properties.securityRules[2].properties.priority", Op: OpGT, Value: 4000}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := holds(t, tt.cond); got != tt.want {
+				t.Errorf("%s %s %v = %v, want %v", tt.cond.Path, tt.cond.Op, tt.cond.Value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionMissingPaths(t *testing.T) {
+	// Positive operators fail and negated ones hold when nothing is found
+	tests := []struct {
+		op    string
+		value interface{}
+		want  bool
+	}{
+		{OpEquals, "x", false},
+		{OpNotEquals, "x", true},
+		{OpExists, nil, false},
+		{OpNotExists, nil, true},
+		{OpContains, "x", false},
+		{OpIn, []interface{}{"x"}, false},
+		{OpNotIn, []interface{}{"x"}, true},
+		{OpMatches, ".*", false},
+		{OpGT, 0, false},
+		{OpLTE, 0, false},
+	}
+
+	for _, path := range []string{"properties.missing", "properties.securityRules[9].name", "nothing.at.all"} {
+		for _, tt := range tests {
+			if got := holds(t, Condition{Path: path, Op: tt.op, Value: tt.value}); got != tt.want {
+				t.Errorf("%s %s on missing path %s = %v, want %v", tt.op, tt.value, path, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestConditionArrays(t *testing.T) {
+	tests := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"any element matches", Condition{Path: "properties.securityRules[*].name", Value: "allow-web"}, true},
+		{"no element matches", Condition{Path: "properties.securityRules[*].name", Value: "allow-rdp"}, false},
+		{"notEquals needs every element to differ", Condition{Path: "properties.securityRules[*].properties.access", Op: OpNotEquals, Value: "Deny"}, false},
+		{"notIn over all elements", Condition{Path: "properties.securityRules[*].properties.access", Op: OpNotIn, Value: []interface{}{"Audit"}}, true},
+		{"index", Condition{Path: "properties.securityRules[0].name", Value: "allow-ssh"}, true},
+		{"negative index", Condition{Path: "properties.securityRules[-1].name", Value: "deny-all"}, true},
+		{"out of range", Condition{Path: "properties.securityRules[3].name", Op: OpExists}, false},
+		{"nested fan out", Condition{Path: "properties.securityRules[*].properties.destinationPortRanges[*]", Value: "80"}, true},
+		{"index into a non-list", Condition{Path: "name[0]", Op: OpExists}, false},
+		{"wildcard over a non-list", Condition{Path: "properties.provisioningState[*]", Op: OpExists}, false},
+		{"non-numeric index", Condition{Path: "properties.securityRules[first].name", Op: OpExists}, false},
+		{"gt over elements", Condition{Path: "properties.securityRules[*].properties.priority", Op: OpGT, Value: 150}, true},
+		{"property names ignore case", Condition{Path: "Properties.SecurityRules[*].Name", Value: "ALLOW-SSH"}, true},
+		{"dollar prefix", Condition{Path: "$.properties.securityRules[0].name", Value: "allow-ssh"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := holds(t, tt.cond); got != tt.want {
+				t.Errorf("%s %s %v = %v, want %v", tt.cond.Path, tt.cond.Op, tt.cond.Value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionTypeMismatches(t *testing.T) {
+	tests := []struct {
+		name string
+		cond Condition
+	}{
+		{"gt on text", Condition{Path: "properties.provisioningState", Op: OpGT, Value: 1}},
+		{"gt on bool", Condition{Path: "properties.enabled", Op: OpGT, Value: 0}},
+		{"gt on object", Condition{Path: "properties.securityRules[1].properties.destinationAddressType", Op: OpGT, Value: 0}},
+		{"equals object to string", Condition{Path: "properties.securityRules[1].properties.destinationAddressType", Value: "vnet"}},
+		{"equals list to string", Condition{Path: "properties.securityRules[1].properties.destinationPortRanges", Value: "80"}},
+		{"equals bool to number", Condition{Path: "properties.enabled", Value: 1}},
+		{"equals number to text", Condition{Path: "properties.retentionDays", Value: "thirty"}},
+		{"contains on number", Condition{Path: "properties.retentionDays", Op: OpContains, Value: "3"}},
+		{"contains on object", Condition{Path: "tags", Op: OpContains, Value: "owner"}},
+		{"matches on number", Condition{Path: "properties.retentionDays", Op: OpMatches, Value: "30"}},
+		{"matches on bool", Condition{Path: "properties.enabled", Op: OpMatches, Value: "true"}},
+		{"property of a string", Condition{Path: "name.length", Op: OpExists}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if holds(t, tt.cond) {
+				t.Errorf("%s %s %v holds, want a type mismatch to fail", tt.cond.Path, tt.cond.Op, tt.cond.Value)
+			}
+		})
+	}
+}
+
+func TestConditionCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cond Condition
+	}{
+		{"missing path", Condition{Op: OpExists}},
+		{"unknown op", Condition{Path: "name", Op: "startsWith", Value: "nsg"}},
+		{"matches needs a string", Condition{Path: "name", Op: OpMatches, Value: 1}},
+		{"invalid pattern", Condition{Path: "name", Op: OpMatches, Value: "("}},
+		{"in needs a list", Condition{Path: "location", Op: OpIn, Value: "eastus"}},
+		{"notIn needs a list", Condition{Path: "location", Op: OpNotIn, Value: map[string]interface{}{}}},
+		{"gt needs a number", Condition{Path: "properties.retentionDays", Op: OpGT, Value: "many"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cond.compile(); err == nil {
+				t.Errorf("compile(%+v) succeeded, want an error", tt.cond)
+			}
+		})
+	}
+}
+
+func TestEvaluateForEach(t *testing.T) {
+	rule := Rule{
+		ID:       "ORG-TEST-001",
+		Severity: "high",
+		Resource: Selector{Type: "microsoft.network/*", Tags: map[string]string{"environment": "prod"}},
+		ForEach:  "properties.securityRules",
+		When: []Condition{
+			{Path: "properties.access", Value: "Allow"},
+			{Path: "$resource.location", Value: "westeurope"},
+		},
+		Any: []Condition{
+			{Path: "properties.sourceAddressPrefix", Value: "*"},
+			{Path: "properties.sourceAddressPrefixes", Op: OpContains, Value: "internet"},
+		},
+		Issue: "{{name}} rule {{item}} allows {{properties.destinationPortRange}}{{properties.destinationPortRanges[*]}} in {{$resource.location}}",
+	}
+	if err := rule.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	findings := rule.Evaluate([]map[string]interface{}{nsg()})
+	if len(findings) != 2 {
+		t.Fatalf("got %d findings, want one per open allow rule", len(findings))
+	}
+	assertFinding := func(i int, item, issue string) {
+		t.Helper()
+		f := findings[i]
+		if f.Detail != item || f.Issue != issue || f.Severity != "High" || f.Resources[0] != "nsg-app" {
+			t.Errorf("finding %d = %+v, want item %s with issue %q", i, f, item, issue)
+		}
+	}
+	assertFinding(0, "allow-ssh", "nsg-app rule allow-ssh allows 22 in westeurope")
+	assertFinding(1, "allow-web", "nsg-app rule allow-web allows 80, 443 in westeurope")
+
+	// The selector filters on type and tag values before any condition runs
+	other := nsg()
+	other["tags"] = map[string]interface{}{"environment": "dev"}
+	storage := nsg()
+	storage["type"] = "Microsoft.Storage/storageAccounts"
+	if findings := rule.Evaluate([]map[string]interface{}{other, storage}); len(findings) != 0 {
+		t.Errorf("got %d findings for resources outside the selector, want 0", len(findings))
+	}
+}
+
+func TestExampleRules(t *testing.T) {
+	loaded, err := Load("../../examples/rules")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	results := Test(loaded)
+	if len(results) == 0 {
+		t.Fatal("example rules declare no tests")
+	}
+	for _, result := range results {
+		if !result.Passed {
+			t.Errorf("%s %q: got %d findings, want %d %s", result.Rule, result.Name, result.Actual, result.Expected, result.Error)
+		}
+	}
+}
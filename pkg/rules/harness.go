@@ -0,0 +1,101 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// TestResult is the outcome of one rule test case
+type TestResult struct {
+	Rule     string `json:"rule"`
+	File     string `json:"file"`
+	Name     string `json:"name"`
+	Expected int    `json:"expected"`
+	Actual   int    `json:"actual"`
+	Passed   bool   `json:"passed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Test runs every rule's test cases and returns one result per case. Rules
+// without test cases produce no results.
+func Test(rules []Rule) []TestResult {
+	var results []TestResult
+
+	for _, rule := range rules {
+		for i, test := range rule.Tests {
+			result := TestResult{
+				Rule:     rule.ID,
+				File:     rule.File,
+				Name:     test.Name,
+				Expected: test.Expect,
+			}
+			if result.Name == "" {
+				result.Name = fmt.Sprintf("test %d", i+1)
+			}
+
+			resources := test.Resources
+			if test.Fixture != "" {
+				loaded, err := loadFixture(filepath.Join(filepath.Dir(rule.File), test.Fixture))
+				if err != nil {
+					result.Error = err.Error()
+					results = append(results, result)
+					continue
+				}
+				resources = loaded
+			}
+
+			result.Actual = len(rule.Evaluate(resources))
+			result.Passed = result.Actual == result.Expected
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
+
+// loadFixture reads fixture resources from a JSON or YAML file holding a
+// list of resources, or an object with a "resources" list such as
+// data/raw/all-resources.json
+func loadFixture(path string) ([]map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var doc interface{}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".json" {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+
+	if m, ok := doc.(map[string]interface{}); ok {
+		for _, key := range []string{"resources", "data"} {
+			if list, ok := m[key]; ok {
+				doc = list
+				break
+			}
+		}
+	}
+
+	list, ok := doc.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("fixture %s must contain a list of resources", path)
+	}
+	var resources []map[string]interface{}
+	for _, item := range list {
+		if resource, ok := item.(map[string]interface{}); ok {
+			resources = append(resources, resource)
+		}
+	}
+	return resources, nil
+}
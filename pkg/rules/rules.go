@@ -0,0 +1,315 @@
+package rules
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultDir is the rules directory looked up when none is configured
+const DefaultDir = "rules"
+
+// Condition operators
+const (
+	OpEquals    = "equals"
+	OpNotEquals = "notEquals"
+	OpExists    = "exists"
+	OpNotExists = "notExists"
+	OpContains  = "contains"
+	OpIn        = "in"
+	OpNotIn     = "notIn"
+	OpMatches   = "matches"
+	OpGT        = "gt"
+	OpGTE       = "gte"
+	OpLT        = "lt"
+	OpLTE       = "lte"
+)
+
+var validOps = map[string]bool{
+	OpEquals: true, OpNotEquals: true, OpExists: true, OpNotExists: true,
+	OpContains: true, OpIn: true, OpNotIn: true, OpMatches: true,
+	OpGT: true, OpGTE: true, OpLT: true, OpLTE: true,
+}
+
+// Rule is a custom check declared in YAML. A rule selects resources by type,
+// optionally iterates over a list inside each resource with forEach, and
+// reports a finding for every resource (or element) that meets its
+// conditions.
+type Rule struct {
+	ID          string      `yaml:"id"`
+	Name        string      `yaml:"name"`
+	Description string      `yaml:"description"`
+	Analysis    string      `yaml:"analysis"` // Security (default), Cost, Tagging or Compliance
+	Severity    string      `yaml:"severity"` // Critical, High, Medium, Low
+	Category    string      `yaml:"category"`
+	Resource    Selector    `yaml:"resource"`
+	ForEach     string      `yaml:"forEach"` // path to a list evaluated element by element
+	When        []Condition `yaml:"when"`    // all must hold
+	Any         []Condition `yaml:"any"`     // at least one must hold, if given
+	Issue       string      `yaml:"issue"`   // templates, see render
+	Impact      string      `yaml:"impact"`
+	Remediation string      `yaml:"remediation"`
+	Tests       []TestCase  `yaml:"tests"`
+
+	// File is the file the rule was loaded from
+	File string `yaml:"-"`
+}
+
+// Selector chooses the resources a rule applies to
+type Selector struct {
+	Type     string            `yaml:"type"`     // resource type, "*" matches any characters
+	Location string            `yaml:"location"` // optional, "*" matches any characters
+	Tags     map[string]string `yaml:"tags"`     // required tag values, "*" for any value
+}
+
+// Condition tests the values found at a path. Paths are dotted property
+// names with optional [n] or [*] indexes, e.g. properties.securityRules[*].name,
+// and may start with "$.". Inside forEach, paths are relative to the element
+// and "$resource." refers to the enclosing resource.
+type Condition struct {
+	Path  string      `yaml:"path"`
+	Op    string      `yaml:"op"` // defaults to equals
+	Value interface{} `yaml:"value"`
+
+	re *regexp.Regexp
+}
+
+// TestCase runs a rule against fixture resources and checks the number of
+// findings. Resources are given inline or in a JSON or YAML fixture file
+// relative to the rule file.
+type TestCase struct {
+	Name      string                   `yaml:"name"`
+	Resources []map[string]interface{} `yaml:"resources"`
+	Fixture   string                   `yaml:"fixture"`
+	Expect    int                      `yaml:"expect"`
+}
+
+// file is the layout of a rules file: either a single rule or a list
+type file struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Load reads and validates all *.yaml and *.yml rule files below dir. A
+// missing directory yields no rules.
+func Load(dir string) ([]Rule, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules directory: %w", err)
+	}
+
+	var rules []Rule
+	for _, path := range paths {
+		loaded, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, loaded...)
+	}
+
+	if err := validateAll(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// LoadFile reads the rules in a single file without cross-file validation
+func LoadFile(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	var rules []Rule
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+		}
+
+		var f file
+		if err := node.Decode(&f); err == nil && len(f.Rules) > 0 {
+			rules = append(rules, f.Rules...)
+			continue
+		}
+		var rule Rule
+		if err := node.Decode(&rule); err != nil {
+			return nil, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	for i := range rules {
+		rules[i].File = path
+	}
+	return rules, nil
+}
+
+// validateAll validates every rule and checks that IDs are unique
+func validateAll(rules []Rule) error {
+	var problems []string
+	seen := make(map[string]string)
+	for i := range rules {
+		rule := &rules[i]
+		if err := rule.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: rule %q: %v", rule.File, rule.ID, err))
+			continue
+		}
+		key := strings.ToUpper(rule.ID)
+		if other, ok := seen[key]; ok {
+			problems = append(problems, fmt.Sprintf("%s: rule %q is already defined in %s", rule.File, rule.ID, other))
+		}
+		seen[key] = rule.File
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid rules:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// Validate checks a rule, fills in defaults and compiles its patterns
+func (r *Rule) Validate() error {
+	var missing []string
+	if r.ID == "" {
+		missing = append(missing, "id")
+	}
+	if r.Severity == "" {
+		missing = append(missing, "severity")
+	}
+	if r.Resource.Type == "" {
+		missing = append(missing, "resource.type")
+	}
+	if r.Issue == "" {
+		missing = append(missing, "issue")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+
+	if _, ok := analysis.LookupRule(strings.ToUpper(r.ID)); ok {
+		return fmt.Errorf("id %s is reserved for a built-in rule", r.ID)
+	}
+	if analysis.SeverityRank(r.Severity) == 0 {
+		return fmt.Errorf("severity %q must be one of Critical, High, Medium, Low", r.Severity)
+	}
+	r.Severity = canonical(r.Severity, "Critical", "High", "Medium", "Low")
+
+	if r.Analysis == "" {
+		r.Analysis = analysis.AnalysisSecurity
+	}
+	name := canonical(r.Analysis, analysis.Analyses...)
+	if name == "" {
+		return fmt.Errorf("analysis %q must be one of %s", r.Analysis, strings.Join(analysis.Analyses, ", "))
+	}
+	r.Analysis = name
+
+	if r.Name == "" {
+		r.Name = r.ID
+	}
+	if r.Category == "" {
+		r.Category = "Custom"
+	}
+
+	for _, conditions := range [][]Condition{r.When, r.Any} {
+		for i := range conditions {
+			if err := conditions[i].compile(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, test := range r.Tests {
+		if len(test.Resources) > 0 && test.Fixture != "" {
+			return fmt.Errorf("test %d: set either resources or fixture, not both", i+1)
+		}
+	}
+	return nil
+}
+
+// compile validates a condition and prepares its pattern
+func (c *Condition) compile() error {
+	if c.Path == "" {
+		return fmt.Errorf("condition is missing path")
+	}
+	if c.Op == "" {
+		c.Op = OpEquals
+	}
+	if !validOps[c.Op] {
+		return fmt.Errorf("condition on %s: unknown op %q", c.Path, c.Op)
+	}
+
+	switch c.Op {
+	case OpMatches:
+		pattern, ok := c.Value.(string)
+		if !ok {
+			return fmt.Errorf("condition on %s: matches needs a string pattern", c.Path)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("condition on %s: invalid pattern: %w", c.Path, err)
+		}
+		c.re = re
+	case OpIn, OpNotIn:
+		if _, ok := c.Value.([]interface{}); !ok {
+			return fmt.Errorf("condition on %s: %s needs a list value", c.Path, c.Op)
+		}
+	case OpGT, OpGTE, OpLT, OpLTE:
+		if _, ok := toFloat(c.Value); !ok {
+			return fmt.Errorf("condition on %s: %s needs a numeric value", c.Path, c.Op)
+		}
+	}
+	return nil
+}
+
+// Catalog returns the analysis catalog entry for a rule
+func (r Rule) Catalog() analysis.Rule {
+	description := r.Description
+	if description == "" {
+		description = r.Name
+	}
+	return analysis.Rule{
+		ID:          r.ID,
+		Name:        r.Name,
+		Analysis:    r.Analysis,
+		Description: description,
+	}
+}
+
+// canonical returns the option equal to s ignoring case, or ""
+func canonical(s string, options ...string) string {
+	for _, option := range options {
+		if strings.EqualFold(s, option) {
+			return option
+		}
+	}
+	return ""
+}
@@ -0,0 +1,278 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+)
+
+// Change kinds for property-level changes
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// comparedFields are the top-level resource fields compared between snapshots
+var comparedFields = []string{"location", "sku", "kind", "tags", "properties"}
+
+// ignoredKeys change on every deployment without a meaningful difference
+var ignoredKeys = map[string]bool{
+	"etag":              true,
+	"provisioningState": true,
+	"resourceGuid":      true,
+}
+
+// Diff describes the changes between two snapshots
+type Diff struct {
+	From     string           `json:"from"`
+	To       string           `json:"to"`
+	FromTime time.Time        `json:"fromTime"`
+	ToTime   time.Time        `json:"toTime"`
+	Added    []ResourceRef    `json:"added"`
+	Removed  []ResourceRef    `json:"removed"`
+	Modified []ResourceChange `json:"modified"`
+	Scores   []ScoreDelta     `json:"scores"`
+}
+
+// ResourceRef identifies a resource in a diff
+type ResourceRef struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	ResourceGroup string `json:"resourceGroup"`
+}
+
+// ResourceChange lists the property changes of a modified resource
+type ResourceChange struct {
+	ResourceRef
+	Changes []PropertyChange `json:"changes"`
+}
+
+// PropertyChange is a single changed value, addressed by a dotted path.
+// Lists of named objects (NSG rules, routes, subnets, peerings) are keyed by
+// name, e.g. properties.securityRules[AllowSSH].properties.access
+type PropertyChange struct {
+	Path   string      `json:"path"`
+	Kind   string      `json:"kind"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// ScoreDelta compares an analysis score between snapshots
+type ScoreDelta struct {
+	Category       string `json:"category"`
+	Before         int    `json:"before"`
+	After          int    `json:"after"`
+	Delta          int    `json:"delta"`
+	FindingsBefore int    `json:"findingsBefore"`
+	FindingsAfter  int    `json:"findingsAfter"`
+}
+
+// Compare computes the differences from one snapshot to another, scoring
+// both with the analysis options
+func Compare(from, to *Snapshot, opts analysis.Options) *Diff {
+	diff := &Diff{
+		From:     from.ID,
+		To:       to.ID,
+		FromTime: from.Timestamp,
+		ToTime:   to.Timestamp,
+		Added:    []ResourceRef{},
+		Removed:  []ResourceRef{},
+		Modified: []ResourceChange{},
+	}
+
+	before := indexByID(from.Resources)
+	after := indexByID(to.Resources)
+
+	for id, res := range after {
+		old, ok := before[id]
+		if !ok {
+			diff.Added = append(diff.Added, refOf(res))
+			continue
+		}
+
+		var changes []PropertyChange
+		for _, field := range comparedFields {
+			compareValues(field, old[field], res[field], &changes)
+		}
+		if len(changes) > 0 {
+			sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+			diff.Modified = append(diff.Modified, ResourceChange{ResourceRef: refOf(res), Changes: changes})
+		}
+	}
+
+	for id, res := range before {
+		if _, ok := after[id]; !ok {
+			diff.Removed = append(diff.Removed, refOf(res))
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return lessRef(diff.Added[i], diff.Added[j]) })
+	sort.Slice(diff.Removed, func(i, j int) bool { return lessRef(diff.Removed[i], diff.Removed[j]) })
+	sort.Slice(diff.Modified, func(i, j int) bool {
+		return lessRef(diff.Modified[i].ResourceRef, diff.Modified[j].ResourceRef)
+	})
+
+	diff.Scores = compareScores(from.Resources, to.Resources, opts)
+
+	return diff
+}
+
+// HasChanges reports whether any resource was added, removed or modified
+func (d *Diff) HasChanges() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Modified) > 0
+}
+
+// SaveJSON writes the diff to a JSON file
+func (d *Diff) SaveJSON(path string) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal diff: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// compareValues appends the changes between a and b at path
+func compareValues(path string, a, b interface{}, changes *[]PropertyChange) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		*changes = append(*changes, PropertyChange{Path: path, Kind: ChangeAdded, After: b})
+		return
+	case b == nil:
+		*changes = append(*changes, PropertyChange{Path: path, Kind: ChangeRemoved, Before: a})
+		return
+	}
+
+	mapA, okA := a.(map[string]interface{})
+	mapB, okB := b.(map[string]interface{})
+	if okA && okB {
+		for _, key := range unionKeys(mapA, mapB) {
+			if ignoredKeys[key] {
+				continue
+			}
+			compareValues(path+"."+key, mapA[key], mapB[key], changes)
+		}
+		return
+	}
+
+	sliceA, okA := a.([]interface{})
+	sliceB, okB := b.([]interface{})
+	if okA && okB {
+		namedA, okA := byName(sliceA)
+		namedB, okB := byName(sliceB)
+		if okA && okB {
+			for _, name := range unionKeys(namedA, namedB) {
+				compareValues(fmt.Sprintf("%s[%s]", path, name), namedA[name], namedB[name], changes)
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, PropertyChange{Path: path, Kind: ChangeChanged, Before: a, After: b})
+	}
+}
+
+// byName indexes a list whose elements are all objects with a name
+func byName(items []interface{}) (map[string]interface{}, bool) {
+	named := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok || name == "" {
+			return nil, false
+		}
+		named[name] = m
+	}
+	return named, true
+}
+
+// unionKeys returns the sorted keys present in either map
+func unionKeys(a, b map[string]interface{}) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var keys []string
+	for _, m := range []map[string]interface{}{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// compareScores runs each analysis on both snapshots
+func compareScores(before, after []map[string]interface{}, opts analysis.Options) []ScoreDelta {
+	reportA, reportB := analysis.Analyze(before, opts), analysis.Analyze(after, opts)
+	scoresA, scoresB := reportA.Scores(), reportB.Scores()
+	countA, countB := countFindings(reportA), countFindings(reportB)
+
+	var deltas []ScoreDelta
+	for _, name := range analysis.Analyses {
+		deltas = append(deltas, ScoreDelta{
+			Category:       name,
+			Before:         scoresA[name],
+			After:          scoresB[name],
+			Delta:          scoresB[name] - scoresA[name],
+			FindingsBefore: countA[name],
+			FindingsAfter:  countB[name],
+		})
+	}
+
+	return deltas
+}
+
+// countFindings counts findings per analysis
+func countFindings(report *analysis.Report) map[string]int {
+	counts := make(map[string]int)
+	for _, finding := range report.Findings() {
+		counts[finding.Analysis]++
+	}
+	return counts
+}
+
+// indexByID maps lowercased resource IDs to resources
+func indexByID(resources []map[string]interface{}) map[string]map[string]interface{} {
+	index := make(map[string]map[string]interface{}, len(resources))
+	for _, res := range resources {
+		if id, ok := res["id"].(string); ok && id != "" {
+			index[strings.ToLower(id)] = res
+		}
+	}
+	return index
+}
+
+// refOf builds a ResourceRef from a raw resource
+func refOf(res map[string]interface{}) ResourceRef {
+	ref := ResourceRef{}
+	ref.ID, _ = res["id"].(string)
+	ref.Name, _ = res["name"].(string)
+	ref.Type, _ = res["type"].(string)
+	ref.ResourceGroup, _ = res["resourceGroup"].(string)
+	return ref
+}
+
+// lessRef orders resources by type, then name, then ID
+func lessRef(a, b ResourceRef) bool {
+	if !strings.EqualFold(a.Type, b.Type) {
+		return strings.ToLower(a.Type) < strings.ToLower(b.Type)
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return strings.ToLower(a.ID) < strings.ToLower(b.ID)
+}
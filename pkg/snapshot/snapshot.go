@@ -0,0 +1,228 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// idFormat is the timestamp layout used for snapshot IDs. Snapshots saved
+// within the same second get a sequence suffix, e.g. 20261015T100000Z-2.
+const idFormat = "20060102T150405Z"
+
+// snapshotFiles are copied from the scan output into each snapshot
+var snapshotFiles = []string{
+	"metadata.json",
+	"raw/all-resources.json",
+	"raw/resource-groups.json",
+	"raw/recommendations.json",
+	"raw/effective-routes.json",
+}
+
+// Snapshot is one saved scan
+type Snapshot struct {
+	ID        string                   `json:"id"`
+	Path      string                   `json:"path"`
+	Timestamp time.Time                `json:"timestamp"`
+	Resources []map[string]interface{} `json:"-"`
+
+	seq int // orders snapshots saved within the same second
+}
+
+// Dir returns the directory holding snapshots under a cache directory
+func Dir(cacheDir string) string {
+	return filepath.Join(cacheDir, "snapshots")
+}
+
+// Save copies the scan output in dataDir into a new timestamped snapshot
+// under cacheDir/snapshots and returns its ID
+func Save(cacheDir, dataDir string, at time.Time) (string, error) {
+	if err := os.MkdirAll(Dir(cacheDir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	// Creating the directory claims the ID, so scans finishing within the
+	// same second never share a snapshot
+	base := at.UTC().Format(idFormat)
+	id := base
+	for seq := 2; ; seq++ {
+		err := os.Mkdir(filepath.Join(Dir(cacheDir), id), 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+		}
+		id = fmt.Sprintf("%s-%d", base, seq)
+	}
+	snapDir := filepath.Join(Dir(cacheDir), id)
+
+	for _, name := range snapshotFiles {
+		src := filepath.Join(dataDir, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyFile(src, filepath.Join(snapDir, name)); err != nil {
+			return "", fmt.Errorf("failed to snapshot %s: %w", name, err)
+		}
+	}
+
+	return id, nil
+}
+
+// List returns saved snapshots, oldest first
+func List(cacheDir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(Dir(cacheDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		ts, seq, ok := parseID(entry.Name())
+		if !ok {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{
+			ID:        entry.Name(),
+			Path:      filepath.Join(Dir(cacheDir), entry.Name()),
+			Timestamp: ts,
+			seq:       seq,
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].Timestamp.Equal(snapshots[j].Timestamp) {
+			return snapshots[i].Timestamp.Before(snapshots[j].Timestamp)
+		}
+		return snapshots[i].seq < snapshots[j].seq
+	})
+	return snapshots, nil
+}
+
+// parseID returns the timestamp and sequence number of a snapshot ID
+func parseID(id string) (time.Time, int, bool) {
+	stamp, suffix, found := strings.Cut(id, "-")
+	ts, err := time.Parse(idFormat, stamp)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	if !found {
+		return ts, 1, true
+	}
+	seq, err := strconv.Atoi(suffix)
+	if err != nil || seq < 2 {
+		return time.Time{}, 0, false
+	}
+	return ts, seq, true
+}
+
+// Load resolves a snapshot reference and reads its resources. A reference
+// is a snapshot ID (or unique ID prefix), "latest", "previous", or a path to
+// a scan output directory or all-resources.json file.
+func Load(cacheDir, ref string) (*Snapshot, error) {
+	snap, err := resolve(cacheDir, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	path := snap.Path
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "raw", "all-resources.json")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", ref, err)
+	}
+	if err := json.Unmarshal(data, &snap.Resources); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", ref, err)
+	}
+
+	return snap, nil
+}
+
+// resolve maps a reference to a snapshot location
+func resolve(cacheDir, ref string) (*Snapshot, error) {
+	if info, err := os.Stat(ref); err == nil {
+		snap := &Snapshot{ID: ref, Path: ref, Timestamp: info.ModTime()}
+		if ts, _, ok := parseID(filepath.Base(ref)); ok {
+			snap.ID, snap.Timestamp = filepath.Base(ref), ts
+		}
+		return snap, nil
+	}
+
+	snapshots, err := List(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ref {
+	case "latest":
+		if len(snapshots) == 0 {
+			return nil, fmt.Errorf("no snapshots found in %s", Dir(cacheDir))
+		}
+		return &snapshots[len(snapshots)-1], nil
+	case "previous":
+		if len(snapshots) < 2 {
+			return nil, fmt.Errorf("fewer than two snapshots found in %s", Dir(cacheDir))
+		}
+		return &snapshots[len(snapshots)-2], nil
+	}
+
+	// An exact ID wins over longer IDs it is a prefix of, e.g. the
+	// -2 snapshot of the same second
+	var matches []Snapshot
+	for _, snap := range snapshots {
+		if snap.ID == ref {
+			return &snap, nil
+		}
+		if strings.HasPrefix(snap.ID, ref) {
+			matches = append(matches, snap)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("snapshot %q not found", ref)
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("snapshot %q is ambiguous (%d matches)", ref, len(matches))
+	}
+}
+
+// copyFile copies src to dst, creating parent directories
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,181 @@
+package waiver
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/automationpi/azdocs/pkg/analysis"
+	"github.com/spf13/viper"
+)
+
+// DefaultFile is the waiver file looked up when none is configured
+const DefaultFile = "azdoc-waivers.yaml"
+
+// dateFormat is the layout of waiver expiry dates
+const dateFormat = "2006-01-02"
+
+// Waiver acknowledges an accepted finding. It matches either a finding
+// fingerprint, or a rule ID optionally narrowed to resources whose IDs match
+// a glob ("*" matches any characters, case-insensitive).
+type Waiver struct {
+	Fingerprint   string `mapstructure:"fingerprint" json:"fingerprint,omitempty"`
+	Rule          string `mapstructure:"rule" json:"rule,omitempty"`
+	Resource      string `mapstructure:"resource" json:"resource,omitempty"`
+	Justification string `mapstructure:"justification" json:"justification"`
+	Owner         string `mapstructure:"owner" json:"owner"`
+	Expires       string `mapstructure:"expires" json:"expires"` // YYYY-MM-DD, last day the waiver applies
+}
+
+// Waived is a finding suppressed by a waiver
+type Waived struct {
+	analysis.Finding
+	Waiver Waiver `json:"waiver"`
+}
+
+// Result is the outcome of applying waivers to a report
+type Result struct {
+	Waived  []Waived `json:"waived"`
+	Expired []Waiver `json:"expired"` // no longer applied; their findings re-surface
+	Unused  []Waiver `json:"unused"`  // active but matched no finding
+}
+
+// file is the layout of azdoc-waivers.yaml
+type file struct {
+	Waivers []Waiver `mapstructure:"waivers"`
+}
+
+// Load reads and validates a waiver file. A missing file yields no waivers.
+func Load(path string) ([]Waiver, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read waiver file: %w", err)
+	}
+
+	var f file
+	if err := v.Unmarshal(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse waiver file: %w", err)
+	}
+
+	var problems []string
+	for i, w := range f.Waivers {
+		if err := w.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("waiver %d: %v", i+1, err))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid waiver file %s:\n  - %s", path, strings.Join(problems, "\n  - "))
+	}
+
+	return f.Waivers, nil
+}
+
+// Validate checks that a waiver identifies findings and is accountable
+func (w Waiver) Validate() error {
+	var missing []string
+	if w.Fingerprint == "" && w.Rule == "" {
+		missing = append(missing, "fingerprint or rule")
+	}
+	if w.Justification == "" {
+		missing = append(missing, "justification")
+	}
+	if w.Owner == "" {
+		missing = append(missing, "owner")
+	}
+	if w.Expires == "" {
+		missing = append(missing, "expires")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	if _, err := time.Parse(dateFormat, w.Expires); err != nil {
+		return fmt.Errorf("expires %q must be a YYYY-MM-DD date", w.Expires)
+	}
+	return nil
+}
+
+// Expired reports whether the waiver's last day is before now
+func (w Waiver) Expired(now time.Time) bool {
+	expires, err := time.Parse(dateFormat, w.Expires)
+	if err != nil {
+		return true
+	}
+	return !now.UTC().Before(expires.AddDate(0, 0, 1))
+}
+
+// Matches reports whether the waiver covers a finding
+func (w Waiver) Matches(finding analysis.Finding) bool {
+	if w.Fingerprint != "" && !strings.EqualFold(w.Fingerprint, finding.Fingerprint) {
+		return false
+	}
+	if w.Rule != "" && !strings.EqualFold(w.Rule, finding.RuleID) {
+		return false
+	}
+	if w.Resource != "" {
+		if len(finding.ResourceIDs) == 0 {
+			return false
+		}
+		for _, id := range finding.ResourceIDs {
+			if !globMatch(w.Resource, id) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Apply removes findings covered by active waivers from the report, so they
+// are excluded from scores, and returns them with the waiver that applied
+func Apply(report *analysis.Report, waivers []Waiver, now time.Time) *Result {
+	result := &Result{Waived: []Waived{}, Expired: []Waiver{}, Unused: []Waiver{}}
+
+	var active []Waiver
+	for _, w := range waivers {
+		if w.Expired(now) {
+			result.Expired = append(result.Expired, w)
+		} else {
+			active = append(active, w)
+		}
+	}
+
+	used := make([]bool, len(active))
+	report.Filter(func(finding analysis.Finding) bool {
+		for i, w := range active {
+			if w.Matches(finding) {
+				used[i] = true
+				result.Waived = append(result.Waived, Waived{Finding: finding, Waiver: w})
+				return true
+			}
+		}
+		return false
+	})
+
+	for i, w := range active {
+		if !used[i] {
+			result.Unused = append(result.Unused, w)
+		}
+	}
+
+	return result
+}
+
+// globMatch matches s against a pattern where "*" matches any characters
+func globMatch(pattern, s string) bool {
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(s)
+}